@@ -0,0 +1,349 @@
+// Package crypt embeds payloads into JPEG images and reads them back.
+//
+// Embed and Extract are stateless: every setting is an explicit Option,
+// nothing is read from or written to the vars the CLI keeps in its
+// environments, and images are handled in memory. Nothing is written to
+// stdout or stderr: what the CLI prints comes from the results. What an
+// image holds is recorded in its header, so Extract needs no options beyond
+// the key.
+//
+//	res, err := crypt.Embed(ctx, cover, secret,
+//		crypt.WithKey(password), crypt.WithStrategy(crypt.StrategyQIM))
+//	...
+//	out, err := crypt.Extract(ctx, bytes.NewReader(res.Image), crypt.WithKey(password))
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/BuddhiLW/crypt/pkg/core"
+	"github.com/BuddhiLW/crypt/pkg/fec"
+	"github.com/BuddhiLW/crypt/pkg/seal"
+)
+
+type (
+	Method   = core.EmbedMethod
+	Strategy = core.DCTStrategy
+	ECCLevel = core.ECCLevel
+)
+
+const (
+	MethodQR      = core.EmbedMethodQR
+	MethodDirect  = core.EmbedMethodDirect
+	MethodMultiQR = core.EmbedMethodMultiQR // one QR of a multi-QR set
+)
+
+const (
+	StrategySingle    = core.DCTStrategySingle
+	StrategyMulti     = core.DCTStrategyMulti
+	StrategyDirect    = core.DCTStrategyDirect
+	StrategyPermuted  = core.DCTStrategyPermuted
+	StrategyThreshold = core.DCTStrategyThreshold
+	StrategyF5        = core.DCTStrategyF5
+	StrategyQIM       = core.DCTStrategyQIM
+)
+
+const (
+	ECCLow     = core.ECCLevelLow
+	ECCMedium  = core.ECCLevelMedium
+	ECCHigh    = core.ECCLevelHigh
+	ECCHighest = core.ECCLevelHighest
+)
+
+// CopiesAuto makes WithCopies fill the spare capacity of the cover
+const CopiesAuto = core.QRCopiesAuto
+
+// EmbedResult is the outcome of Embed
+type EmbedResult struct {
+	Image     []byte           // the stego JPEG
+	Header    core.ImageHeader // method, strategy and layout, as Extract reads them
+	Capacity  int              // bits the strategy offers in the cover
+	Embedded  int              // bytes written into the coefficients, copies and FEC included
+	Copies    int              // QR copies, 1 for direct payloads
+	Encrypted bool             // the payload was sealed with WithKey
+	F5        *core.F5Stats    // matrix embedding statistics, StrategyF5 only
+}
+
+// ExtractResult is the outcome of Extract
+type ExtractResult struct {
+	Payload   []byte
+	Header    core.ImageHeader
+	Corrected int  // byte errors FEC corrected in a direct payload
+	Encrypted bool // the payload was opened with WithKey
+}
+
+// Embed embeds payload into the JPEG read from cover and returns the stego
+// image. The cover's metadata segments and entropy coding are kept.
+func Embed(ctx context.Context, cover io.Reader, payload []byte, opts ...Option) (*EmbedResult, error) {
+	c, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("crypt: payload cannot be empty")
+	}
+	jpeg, err := io.ReadAll(cover)
+	if err != nil {
+		return nil, fmt.Errorf("crypt: failed to read cover: %w", err)
+	}
+
+	data := payload
+	if c.encrypt {
+		sealed, err := seal.Seal(payload, c.key, c.kdf)
+		if err != nil {
+			return nil, fmt.Errorf("crypt: %w", err)
+		}
+		// QR codes carry text, direct payloads the raw ciphertext
+		data = sealed
+		if c.method != MethodDirect {
+			data = []byte(base64.StdEncoding.EncodeToString(sealed))
+		}
+	}
+
+	processor, err := c.processor(c.strategy, c.params)
+	if err != nil {
+		return nil, err
+	}
+	capacity, err := processor.CalculateStreamCapacity(bytes.NewReader(jpeg), c.strategy)
+	if err != nil {
+		return nil, fmt.Errorf("crypt: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	header := core.ImageHeader{
+		Method:     c.method,
+		Strategy:   c.strategy,
+		Threshold:  c.params.Threshold,
+		QIMStep:    c.params.QIMStep,
+		Components: c.params.Components,
+	}
+	var body []byte
+	copies := 1
+	if c.method == MethodDirect {
+		if body, err = c.directPayload(data); err != nil {
+			return nil, err
+		}
+	} else {
+		modules, size, err := c.qrModules(string(data))
+		if err != nil {
+			return nil, err
+		}
+		copies = c.copies
+		if copies == CopiesAuto {
+			copies = core.QRCopies(capacity, len(modules))
+		}
+		body = bytes.Repeat(modules, copies)
+		header.QRModules = size
+	}
+	header.PayloadLength = len(body)
+	if len(body)*8 > capacity {
+		return nil, fmt.Errorf("crypt: %d bytes to embed exceed the %d bit capacity of the cover (%s strategy)",
+			len(body), capacity, c.strategy)
+	}
+
+	var stego bytes.Buffer
+	var f5 *core.F5Stats
+	if embedder, ok := processor.(core.F5StatsEmbedder); ok && c.strategy == StrategyF5 {
+		f5, err = embedder.EmbedF5Stream(bytes.NewReader(jpeg), &stego, body)
+	} else {
+		err = processor.EmbedDataStream(bytes.NewReader(jpeg), &stego, body, c.strategy)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("crypt: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := core.WriteImageHeaderStreamWithKey(&stego, &out, header, c.key); err != nil {
+		return nil, fmt.Errorf("crypt: failed to write image header: %w", err)
+	}
+	// Report the header with its version and default parameters filled in,
+	// as Extract reads it back
+	if raw, err := header.MarshalBinary(); err == nil {
+		if written, err := core.ParseImageHeader(raw); err == nil {
+			header = *written
+		}
+	}
+
+	return &EmbedResult{
+		Image:     out.Bytes(),
+		Header:    header,
+		Capacity:  capacity,
+		Embedded:  len(body),
+		Copies:    copies,
+		Encrypted: c.encrypt,
+		F5:        f5,
+	}, nil
+}
+
+// Extract reads back the payload of the stego JPEG read from stego. The
+// method, strategy and layout come from the image header.
+func Extract(ctx context.Context, stego io.Reader, opts ...Option) (*ExtractResult, error) {
+	c, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	jpeg, err := io.ReadAll(stego)
+	if err != nil {
+		return nil, fmt.Errorf("crypt: failed to read image: %w", err)
+	}
+
+	header, err := core.ReadImageHeaderStreamWithKey(bytes.NewReader(jpeg), c.key)
+	if errors.Is(err, core.ErrNoImageHeader) && c.layout != nil {
+		header, err = c.layout, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("crypt: %w", err)
+	}
+	if c.methodSet && header.Method != c.method {
+		return nil, fmt.Errorf("crypt: image holds a %s payload, not a %s payload", header.Method, c.method)
+	}
+	processor, err := c.processor(header.Strategy, header.Params())
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &ExtractResult{Header: *header, Encrypted: c.encrypt}
+	switch header.Method {
+	case MethodDirect:
+		raw, err := processor.ExtractDataStream(bytes.NewReader(jpeg), header.PayloadLength, header.Strategy)
+		if err != nil {
+			return nil, fmt.Errorf("crypt: %w", err)
+		}
+		result.Payload, result.Corrected, err = parseDirectPayload(raw)
+		if err != nil {
+			return nil, err
+		}
+	case MethodQR, MethodMultiQR:
+		text, err := readQR(processor, jpeg, header)
+		if err != nil {
+			return nil, err
+		}
+		result.Payload = []byte(text)
+	default:
+		return nil, fmt.Errorf("crypt: %s payloads span several tiles, use the grid API of pkg/core", header.Method)
+	}
+
+	if c.encrypt {
+		sealed := result.Payload
+		if !seal.IsVersioned(sealed) {
+			// Base64 text, from a QR code or an older direct payload
+			if sealed, err = base64.StdEncoding.DecodeString(string(sealed)); err != nil {
+				return nil, fmt.Errorf("crypt: payload is not sealed: %w", err)
+			}
+		}
+		if result.Payload, err = seal.Open(sealed, c.key); err != nil {
+			return nil, fmt.Errorf("crypt: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// processor returns the platform DCT processor for strategy
+func (c *config) processor(strategy Strategy, params core.DCTParams) (core.StreamDCTProcessor, error) {
+	dct, err := core.NewServiceFactory().CreateDCTProcessorFor(strategy, c.key, params)
+	if err != nil {
+		return nil, fmt.Errorf("crypt: %w", err)
+	}
+	processor, ok := dct.(core.StreamDCTProcessor)
+	if !ok {
+		return nil, fmt.Errorf("crypt: %T cannot process JPEGs in memory", dct)
+	}
+	return processor, nil
+}
+
+// qrModules encodes data as a QR module matrix at the ECC level of c
+func (c *config) qrModules(data string) ([]byte, int, error) {
+	qr := core.NewGoQRProcessor()
+	if c.ecc != nil {
+		return qr.GenerateModules(data, *c.ecc)
+	}
+	modules, size, err := qr.GenerateModules(data, ECCHighest)
+	if err != nil {
+		modules, size, err = qr.GenerateModules(data, ECCHigh)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("crypt: payload too large for a High ECC QR code: %w", err)
+	}
+	return modules, size, nil
+}
+
+// readQR decodes the QR the header describes, voting over its copies
+func readQR(processor core.StreamDCTProcessor, jpeg []byte, header *core.ImageHeader) (string, error) {
+	size := header.QRModules
+	if size == 0 {
+		size = header.QRPixelSize
+	}
+	bitstream, err := core.ExtractQRCopiesStream(processor, bytes.NewReader(jpeg), (size*size+7)/8, header.QRCopies(), header.Strategy)
+	if err != nil {
+		return "", fmt.Errorf("crypt: %w", err)
+	}
+
+	qr := core.NewGoQRProcessor()
+	if header.QRModules > 0 {
+		return qr.ReadModules(bitstream, size)
+	}
+	img, err := qr.ConvertFromBitstream(bitstream, size)
+	if err != nil {
+		return "", fmt.Errorf("crypt: %w", err)
+	}
+	return qr.ReadQRImage(img)
+}
+
+// Direct payload framing: [length:4][checksum:4][data], little endian, the
+// whole then FEC encoded when enabled
+
+// directPayload frames data as a direct payload
+func (c *config) directPayload(data []byte) ([]byte, error) {
+	payload := make([]byte, 8+len(data))
+	binary.LittleEndian.PutUint32(payload[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(payload[4:8], core.PayloadChecksum(data))
+	copy(payload[8:], data)
+	if !c.fec.Enabled() {
+		return payload, nil
+	}
+	encoded, err := fec.Encode(payload, c.fec)
+	if err != nil {
+		return nil, fmt.Errorf("crypt: FEC encoding failed: %w", err)
+	}
+	return encoded, nil
+}
+
+// parseDirectPayload undoes the FEC of a direct payload, when it has any,
+// and checks its framing. It returns the data and the corrected bytes.
+func parseDirectPayload(raw []byte) ([]byte, int, error) {
+	corrected := 0
+	decoded, n, err := fec.Decode(raw)
+	switch {
+	case err == nil:
+		raw, corrected = decoded, n
+	case !errors.Is(err, fec.ErrNotEncoded):
+		return nil, 0, fmt.Errorf("crypt: error correction failed: %w", err)
+	}
+
+	if len(raw) < 8 {
+		return nil, 0, fmt.Errorf("crypt: extracted data too small for header")
+	}
+	length := binary.LittleEndian.Uint32(raw[0:4])
+	checksum := binary.LittleEndian.Uint32(raw[4:8])
+	if length > uint32(len(raw)-8) {
+		return nil, 0, fmt.Errorf("crypt: extracted data length %d exceeds buffer size", length)
+	}
+	data := raw[8 : 8+length]
+	if actual := core.PayloadChecksum(data); actual != checksum {
+		return nil, 0, fmt.Errorf("crypt: checksum mismatch: expected %08x, got %08x", checksum, actual)
+	}
+	return data, corrected, nil
+}
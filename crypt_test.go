@@ -0,0 +1,263 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"testing"
+
+	"github.com/BuddhiLW/crypt/pkg/core"
+	"github.com/BuddhiLW/crypt/pkg/fec"
+	"github.com/BuddhiLW/crypt/pkg/seal"
+)
+
+// testCover returns a textured colour JPEG cover image
+func testCover(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 3), G: uint8(y * 5), B: uint8((x + y) * 2), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEmbedExtractRoundTrip(t *testing.T) {
+	cover := testCover(t, 512, 512)
+	payload := []byte("library facade round trip")
+	key := "facade-password"
+
+	for name, opts := range map[string][]Option{
+		"qr":              nil,
+		"qr sealed":       {WithKey(key), WithKDF(seal.ScryptParams())},
+		"qr permuted":     {WithStrategy(StrategyPermuted), WithWalkKey(key), WithCopies(3)},
+		"qr qim":          {WithStrategy(StrategyQIM), WithECC(ECCHigh), WithCopies(CopiesAuto)},
+		"direct":          {WithMethod(MethodDirect)},
+		"direct sealed":   {WithMethod(MethodDirect), WithKey(key), WithKDF(seal.ScryptParams())},
+		"direct fec":      {WithMethod(MethodDirect), WithFEC(fec.LevelLow)},
+		"direct f5":       {WithMethod(MethodDirect), WithStrategy(StrategyF5)},
+		"direct permuted": {WithMethod(MethodDirect), WithStrategy(StrategyPermuted), WithWalkKey(key)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			embedded, err := Embed(context.Background(), bytes.NewReader(cover), payload, opts...)
+			if err != nil {
+				t.Fatalf("Embed failed: %v", err)
+			}
+			if embedded.Embedded*8 > embedded.Capacity || embedded.Header.PayloadLength != embedded.Embedded {
+				t.Errorf("inconsistent result: %d bytes embedded in %d bits, header %+v",
+					embedded.Embedded, embedded.Capacity, embedded.Header)
+			}
+			if (embedded.F5 != nil) != (embedded.Header.Strategy == StrategyF5) {
+				t.Errorf("F5 statistics %+v for the %s strategy", embedded.F5, embedded.Header.Strategy)
+			}
+
+			// Extract only needs the key, the rest is in the header
+			var extractOpts []Option
+			for _, opt := range opts {
+				c := &config{}
+				opt(c)
+				if c.key != "" {
+					extractOpts = append(extractOpts, opt)
+				}
+			}
+			extracted, err := Extract(context.Background(), bytes.NewReader(embedded.Image), extractOpts...)
+			if err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			if !bytes.Equal(extracted.Payload, payload) {
+				t.Errorf("expected %q, got %q", payload, extracted.Payload)
+			}
+			if extracted.Header != embedded.Header {
+				t.Errorf("header %+v read back as %+v", embedded.Header, extracted.Header)
+			}
+		})
+	}
+}
+
+func TestEmbedSmallCover(t *testing.T) {
+	// 64 blocks: room for a single header copy
+	cover := testCover(t, 64, 64)
+	payload := []byte("tiny")
+	embedded, err := Embed(context.Background(), bytes.NewReader(cover), payload,
+		WithMethod(MethodDirect), WithWalkKey("small-cover"))
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	extracted, err := Extract(context.Background(), bytes.NewReader(embedded.Image), WithWalkKey("small-cover"))
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if !bytes.Equal(extracted.Payload, payload) {
+		t.Errorf("expected %q, got %q", payload, extracted.Payload)
+	}
+}
+
+func TestEmbedSealsPayload(t *testing.T) {
+	cover := testCover(t, 512, 512)
+	payload := []byte("only readable with the key")
+
+	embedded, err := Embed(context.Background(), bytes.NewReader(cover), payload,
+		WithMethod(MethodDirect), WithKey("right"), WithKDF(seal.ScryptParams()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !embedded.Encrypted {
+		t.Error("expected an encrypted result")
+	}
+
+	// The key also whitens the header, so the raw payload needs it as walk key
+	if _, err := Extract(context.Background(), bytes.NewReader(embedded.Image)); !errors.Is(err, core.ErrNoImageHeader) {
+		t.Errorf("expected ErrNoImageHeader without the key, got %v", err)
+	}
+	raw, err := Extract(context.Background(), bytes.NewReader(embedded.Image), WithWalkKey("right"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw.Payload, payload) {
+		t.Error("payload embedded in the clear")
+	}
+	if !seal.IsVersioned(raw.Payload) {
+		t.Error("expected the raw ciphertext in a direct payload, not its base64")
+	}
+	if _, err := Extract(context.Background(), bytes.NewReader(embedded.Image), WithKey("wrong")); err == nil {
+		t.Error("expected the wrong key to fail")
+	}
+}
+
+func TestExtractAfterRecompression(t *testing.T) {
+	cover := testCover(t, 512, 512)
+	payload := []byte("header and payload survive an upload")
+	embedded, err := Embed(context.Background(), bytes.NewReader(cover), payload,
+		WithMethod(MethodDirect), WithStrategy(StrategyQIM), WithFEC(fec.LevelMedium), WithWalkKey("upload-password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Save the pixels again at quality 70, like an upload pipeline
+	img, err := jpeg.Decode(bytes.NewReader(embedded.Image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resaved bytes.Buffer
+	if err := jpeg.Encode(&resaved, img, &jpeg.Options{Quality: 70}); err != nil {
+		t.Fatal(err)
+	}
+
+	// No layout: the header itself has to come through
+	extracted, err := Extract(context.Background(), &resaved, WithWalkKey("upload-password"))
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if !bytes.Equal(extracted.Payload, payload) {
+		t.Errorf("expected %q, got %q", payload, extracted.Payload)
+	}
+}
+
+func TestExtractLegacyLayout(t *testing.T) {
+	cover := testCover(t, 256, 256)
+	payload := []byte("no header")
+
+	// Embed the framed payload without writing a header, as before headers
+	c, err := newConfig([]Option{WithMethod(MethodDirect)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := c.directPayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor, err := c.processor(StrategyDirect, core.DCTParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stripped bytes.Buffer
+	if err := processor.EmbedDataStream(bytes.NewReader(cover), &stripped, body, StrategyDirect); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Extract(context.Background(), bytes.NewReader(stripped.Bytes())); !errors.Is(err, core.ErrNoImageHeader) {
+		t.Fatalf("expected ErrNoImageHeader, got %v", err)
+	}
+	extracted, err := Extract(context.Background(), bytes.NewReader(stripped.Bytes()),
+		WithLayout(core.ImageHeader{Method: MethodDirect, Strategy: StrategyDirect, PayloadLength: 64}))
+	if err != nil {
+		t.Fatalf("Extract with layout failed: %v", err)
+	}
+	if !bytes.Equal(extracted.Payload, payload) {
+		t.Errorf("expected %q, got %q", payload, extracted.Payload)
+	}
+}
+
+func TestEmbedExtractPrintNothing(t *testing.T) {
+	cover := testCover(t, 512, 512)
+	out, err := os.CreateTemp(t.TempDir(), "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = out, out
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	for _, opts := range [][]Option{
+		{WithKey("quiet"), WithKDF(seal.ScryptParams())},
+		{WithMethod(MethodDirect), WithStrategy(StrategyF5), WithWalkKey("quiet")},
+		{WithMethod(MethodDirect), WithStrategy(StrategySingle), WithWalkKey("quiet")},
+	} {
+		embedded, err := Embed(context.Background(), bytes.NewReader(cover), []byte("silent"), opts...)
+		if err != nil {
+			t.Fatalf("Embed failed: %v", err)
+		}
+		if _, err := Extract(context.Background(), bytes.NewReader(embedded.Image), opts...); err != nil {
+			t.Fatalf("Extract failed: %v", err)
+		}
+	}
+
+	os.Stdout, os.Stderr = stdout, stderr
+	if printed, err := os.ReadFile(out.Name()); err != nil || len(printed) > 0 {
+		t.Errorf("Embed and Extract printed %q (%v)", printed, err)
+	}
+}
+
+func TestEmbedHonoursContext(t *testing.T) {
+	cover := testCover(t, 256, 256)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := Embed(ctx, bytes.NewReader(cover), []byte("too late")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, err := Extract(ctx, bytes.NewReader(cover), WithLayout(core.ImageHeader{Method: MethodDirect, PayloadLength: 8})); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	cover := testCover(t, 128, 128)
+	for name, opts := range map[string][]Option{
+		"grid method":          {WithMethod(core.EmbedMethodQRGrid)},
+		"permuted without key": {WithStrategy(StrategyPermuted)},
+		"copies of direct":     {WithMethod(MethodDirect), WithCopies(2)},
+		"fec on qr":            {WithFEC(fec.LevelLow)},
+		"negative copies":      {WithCopies(-1)},
+		"invalid kdf":          {WithKey("k"), WithKDF(seal.Params{})},
+	} {
+		if _, err := Embed(context.Background(), bytes.NewReader(cover), []byte("x"), opts...); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if _, err := Embed(context.Background(), bytes.NewReader(cover), bytes.Repeat([]byte("x"), 4096),
+		WithMethod(MethodDirect)); err == nil {
+		t.Error("expected a payload over capacity to fail")
+	}
+}
@@ -10,6 +10,7 @@ require (
 	github.com/rwxrob/bonzai/futil v0.4.0
 	github.com/rwxrob/bonzai/vars v0.12.0
 	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/crypto v0.31.0
 )
 
 require (
@@ -42,7 +43,6 @@ require (
 	github.com/rwxrob/bonzai/uniq v0.1.0 // indirect
 	github.com/yuin/goldmark v1.7.8 // indirect
 	github.com/yuin/goldmark-emoji v1.0.4 // indirect
-	golang.org/x/crypto v0.31.0 // indirect
 	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/term v0.27.0 // indirect
@@ -0,0 +1,134 @@
+package crypt
+
+import (
+	"fmt"
+
+	"github.com/BuddhiLW/crypt/pkg/core"
+	"github.com/BuddhiLW/crypt/pkg/fec"
+	"github.com/BuddhiLW/crypt/pkg/seal"
+)
+
+// Option configures one Embed or Extract call
+type Option func(*config)
+
+// config holds the options of one call; nothing outlives it
+type config struct {
+	method      Method
+	methodSet   bool
+	strategy    Strategy
+	strategySet bool
+	params      core.DCTParams
+	key         string
+	encrypt     bool
+	kdf         seal.Params
+	ecc         *ECCLevel
+	fec         fec.Params
+	copies      int
+	layout      *core.ImageHeader
+}
+
+// newConfig applies opts over the defaults: a single QR with the single
+// coefficient strategy, no encryption and no FEC
+func newConfig(opts []Option) (*config, error) {
+	c := &config{method: MethodQR, copies: 1, kdf: seal.DefaultParams()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if !c.strategySet {
+		c.strategy = StrategySingle
+		if c.method == MethodDirect {
+			c.strategy = StrategyDirect
+		}
+	}
+	return c, c.validate()
+}
+
+// validate rejects options that do not fit together
+func (c *config) validate() error {
+	switch c.method {
+	case MethodQR, MethodMultiQR, MethodDirect:
+	default:
+		return fmt.Errorf("crypt: method %s spans several images or tiles, use the multi-QR API of pkg/core", c.method)
+	}
+	if c.strategy == StrategyPermuted && c.key == "" {
+		return fmt.Errorf("crypt: %s strategy requires WithKey or WithWalkKey", c.strategy)
+	}
+	if c.copies < 0 {
+		return fmt.Errorf("crypt: invalid QR copies %d", c.copies)
+	}
+	if c.method == MethodDirect && c.copies != 1 {
+		return fmt.Errorf("crypt: QR copies apply to QR methods, use WithFEC for direct payloads")
+	}
+	if c.method != MethodDirect && c.fec.Enabled() {
+		return fmt.Errorf("crypt: FEC applies to direct payloads, use WithCopies for QR methods")
+	}
+	if err := c.fec.Validate(); err != nil {
+		return fmt.Errorf("crypt: %w", err)
+	}
+	if c.encrypt {
+		if err := c.kdf.Validate(); err != nil {
+			return fmt.Errorf("crypt: %w", err)
+		}
+	}
+	return nil
+}
+
+// WithMethod selects how the payload is embedded: MethodQR (the default)
+// or MethodDirect. On Extract it makes other payloads an error.
+func WithMethod(m Method) Option {
+	return func(c *config) { c.method, c.methodSet = m, true }
+}
+
+// WithStrategy selects the DCT strategy. It defaults to StrategySingle for
+// QR codes and StrategyDirect for direct payloads.
+func WithStrategy(s Strategy) Option {
+	return func(c *config) { c.strategy, c.strategySet = s, true }
+}
+
+// WithParams sets the threshold, QIM step and components of the strategy
+func WithParams(p core.DCTParams) Option {
+	return func(c *config) { c.params = p }
+}
+
+// WithKey seals the payload with key before embedding, and opens it after
+// extraction. The permuted strategy walks the coefficients with it too,
+// and the image header is whitened with it.
+func WithKey(key string) Option {
+	return func(c *config) { c.key, c.encrypt = key, true }
+}
+
+// WithWalkKey only keys the walk of the permuted strategy and the image
+// header; the payload is embedded and returned as given, for data the
+// caller sealed itself
+func WithWalkKey(key string) Option {
+	return func(c *config) { c.key, c.encrypt = key, false }
+}
+
+// WithKDF sets the key derivation of WithKey, Argon2id by default
+func WithKDF(p seal.Params) Option {
+	return func(c *config) { c.kdf = p }
+}
+
+// WithECC fixes the error correction level of the QR code. By default the
+// Highest level is used when the data fits, High otherwise.
+func WithECC(level ECCLevel) Option {
+	return func(c *config) { c.ecc = &level }
+}
+
+// WithFEC protects a direct payload with Reed-Solomon parity and
+// repetition
+func WithFEC(p fec.Params) Option {
+	return func(c *config) { c.fec = p }
+}
+
+// WithCopies embeds copies copies of the QR, read back by a vote.
+// CopiesAuto fills the spare capacity of the cover.
+func WithCopies(copies int) Option {
+	return func(c *config) { c.copies = copies }
+}
+
+// WithLayout describes the payload of images without a header, embedded
+// before it existed. Images with a header ignore it.
+func WithLayout(h core.ImageHeader) Option {
+	return func(c *config) { c.layout = &h }
+}
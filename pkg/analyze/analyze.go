@@ -0,0 +1,169 @@
+// Package analyze looks for traces of embedding in the quantized DCT
+// coefficients of a JPEG: the statistics steganalysis uses against JSteg,
+// F5 and plain LSB replacement, and the crypt image header itself.
+package analyze
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/BuddhiLW/crypt/pkg/core"
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+// Verdict thresholds on the highest test score
+const (
+	SuspiciousScore = 0.3
+	StegoScore      = 0.7
+)
+
+// Score is the outcome of one test, from 0 (looks like a cover) to 1
+// (looks like it carries a payload)
+type Score struct {
+	Test   string  `json:"test"`
+	Score  float64 `json:"score"`
+	Detail string  `json:"detail"`
+}
+
+// Report is the outcome of all tests and the verdict drawn from them
+type Report struct {
+	Image   string  `json:"image"`
+	Tests   []Score `json:"tests"`
+	Score   float64 `json:"score"`
+	Verdict string  `json:"verdict"`
+}
+
+// Detector is one steganalysis test (SRP)
+type Detector interface {
+	Name() string
+	Detect(s *Sample) Score
+}
+
+// DefaultDetectors are the tests Analyze runs
+var DefaultDetectors = []Detector{
+	ChiSquareDetector{},
+	CalibrationDetector{},
+	JStegF5Detector{},
+	HeaderDetector{},
+}
+
+// Sample is a JPEG prepared for the detectors: its luminance blocks in
+// raster order and, computed on first use, their calibrated estimate
+type Sample struct {
+	Image  *jpegcoef.Image
+	Blocks []jpegcoef.Block
+
+	calibrated [2][]jpegcoef.Block
+}
+
+// NewSample prepares img for analysis
+func NewSample(img *jpegcoef.Image) (*Sample, error) {
+	if len(img.Components) == 0 || img.QuantTable(0) == nil {
+		return nil, fmt.Errorf("JPEG has no luminance quantization table")
+	}
+	y := &img.Components[0]
+	blocks := make([]jpegcoef.Block, 0, y.WidthInBlocks*y.HeightInBlocks)
+	for by := 0; by < y.HeightInBlocks; by++ {
+		for bx := 0; bx < y.WidthInBlocks; bx++ {
+			blocks = append(blocks, *y.Block(bx, by))
+		}
+	}
+	if len(blocks) < 4 {
+		return nil, fmt.Errorf("image too small to analyze: %d blocks", len(blocks))
+	}
+	return &Sample{Image: img, Blocks: blocks}, nil
+}
+
+// Calibrated returns the calibrated estimate of the cover, see Calibrate
+func (s *Sample) Calibrated() []jpegcoef.Block {
+	if s.calibrated[0] == nil {
+		s.calibrated[0] = Calibrate(&s.Image.Components[0], s.Image.QuantTable(0))
+	}
+	return s.calibrated[0]
+}
+
+// recalibrated is a second cover estimate, shifted differently, whose
+// distance to Calibrated measures the error of calibration itself
+func (s *Sample) recalibrated() []jpegcoef.Block {
+	if s.calibrated[1] == nil {
+		s.calibrated[1] = calibrate(&s.Image.Components[0], s.Image.QuantTable(0), 2, 6)
+	}
+	return s.calibrated[1]
+}
+
+// Analyze runs the default detectors on the JPEG at path
+func Analyze(path string) (*Report, error) {
+	img, err := jpegcoef.DecodeFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DCT coefficients from %s: %w", path, err)
+	}
+	sample, err := NewSample(img)
+	if err != nil {
+		return nil, err
+	}
+	report := Run(sample, DefaultDetectors)
+	report.Image = path
+	return report, nil
+}
+
+// Run runs detectors on sample; the verdict follows the highest score
+func Run(sample *Sample, detectors []Detector) *Report {
+	report := &Report{}
+	for _, detector := range detectors {
+		score := detector.Detect(sample)
+		score.Test = detector.Name()
+		report.Tests = append(report.Tests, score)
+		report.Score = max(report.Score, score.Score)
+	}
+	report.Verdict = verdict(report.Score)
+	return report
+}
+
+func verdict(score float64) string {
+	switch {
+	case score >= StegoScore:
+		return "stego"
+	case score >= SuspiciousScore:
+		return "suspicious"
+	default:
+		return "clean"
+	}
+}
+
+// ramp maps v linearly from [low, high] onto [0, 1]
+func ramp(v, low, high float64) float64 {
+	return max(0, min(1, (v-low)/(high-low)))
+}
+
+// imageHeader reads the crypt header from the sample, nil if there is none
+func (s *Sample) imageHeader() *core.ImageHeader {
+	header, err := core.ImageHeaderFrom(s.Image)
+	if err != nil {
+		return nil
+	}
+	return header
+}
+
+// WriteTable prints the report as a table, one row per test, followed by
+// the verdict
+func WriteTable(w io.Writer, report *Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TEST\tSCORE\tDETAIL")
+	for _, s := range report.Tests {
+		fmt.Fprintf(tw, "%s\t%.2f\t%s\n", s.Test, s.Score, s.Detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%s: %s (score %.2f)\n", report.Image, report.Verdict, report.Score)
+	return err
+}
+
+// WriteJSON prints the report as indented JSON
+func WriteJSON(w io.Writer, report *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
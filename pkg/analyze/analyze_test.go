@@ -0,0 +1,101 @@
+package analyze
+
+import (
+	"image"
+	"image/jpeg"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BuddhiLW/crypt/pkg/core"
+)
+
+// writeCover saves a photo-like cover: smooth value noise at a few scales
+// plus sensor noise, nothing aligned to the block grid
+func writeCover(t *testing.T, w, h int) string {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(3, 7))
+	plane := make([]float64, w*h)
+	amp := 20.0
+	for cell := 128; cell >= 4; cell /= 2 {
+		gw := w/cell + 2
+		grid := make([]float64, gw*(h/cell+2))
+		for i := range grid {
+			grid[i] = rng.Float64()*2 - 1
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				fx, fy := float64(x)/float64(cell), float64(y)/float64(cell)
+				x0, y0 := int(fx), int(fy)
+				tx, ty := fx-float64(x0), fy-float64(y0)
+				top := grid[y0*gw+x0]*(1-tx) + grid[y0*gw+x0+1]*tx
+				bottom := grid[(y0+1)*gw+x0]*(1-tx) + grid[(y0+1)*gw+x0+1]*tx
+				plane[y*w+x] += amp * (top*(1-ty) + bottom*ty)
+			}
+		}
+		amp *= 0.6
+	}
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i, v := range plane {
+		img.Pix[i] = uint8(math.Max(0, math.Min(255, 128+v+rng.NormFloat64()*2)))
+	}
+	path := filepath.Join(t.TempDir(), "cover.jpg")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := jpeg.Encode(f, img, &jpeg.Options{Quality: 75}); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func scores(report *Report) map[string]float64 {
+	out := map[string]float64{}
+	for _, s := range report.Tests {
+		out[s.Test] = s.Score
+	}
+	return out
+}
+
+func TestAnalyzeCleanCover(t *testing.T) {
+	report, err := Analyze(writeCover(t, 512, 512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Verdict != "clean" {
+		t.Errorf("cover judged %s: %+v", report.Verdict, report.Tests)
+	}
+}
+
+func TestAnalyzeFlagsFullSingleEmbedding(t *testing.T) {
+	cover := writeCover(t, 512, 512)
+	processor := core.NewGoDCTProcessor()
+	capacity, err := processor.CalculateImageCapacity(cover, core.DCTStrategySingle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, capacity/8)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range payload {
+		payload[i] = byte(rng.UintN(256))
+	}
+	stego := filepath.Join(t.TempDir(), "stego.jpg")
+	if err := processor.EmbedData(cover, stego, payload, core.DCTStrategySingle); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Analyze(stego)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Verdict != "stego" || scores(report)["jsteg-f5"] < StegoScore {
+		t.Errorf("full single embedding judged %s: %+v", report.Verdict, report.Tests)
+	}
+	if scores(report)["crypt-header"] != 0 {
+		t.Errorf("raw embedding reported a crypt header: %+v", report.Tests)
+	}
+}
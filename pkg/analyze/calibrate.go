@@ -0,0 +1,110 @@
+package analyze
+
+import (
+	"math"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+// calibrationShift is how far the luminance plane moves before it is cut
+// into blocks again: half a block breaks the grid any embedding follows
+const calibrationShift = 4
+
+// dctBasis[u][x] is the orthonormal 8 point DCT-II basis
+var dctBasis = func() (basis [8][8]float64) {
+	for u := 0; u < 8; u++ {
+		scale := math.Sqrt(2.0 / 8)
+		if u == 0 {
+			scale = math.Sqrt(1.0 / 8)
+		}
+		for x := 0; x < 8; x++ {
+			basis[u][x] = scale * math.Cos(float64((2*x+1)*u)*math.Pi/16)
+		}
+	}
+	return basis
+}()
+
+// Calibrate estimates the cover of the luminance component y: it
+// decompresses the plane, drops the first calibrationShift rows and columns
+// and compresses the rest again with the same quantization table. The
+// shifted blocks have the statistics of the cover but none of the changes
+// made to the original grid.
+func Calibrate(y *jpegcoef.Component, quant *[64]uint16) []jpegcoef.Block {
+	return calibrate(y, quant, calibrationShift, calibrationShift)
+}
+
+// calibrate is Calibrate shifting dx columns and dy rows
+func calibrate(y *jpegcoef.Component, quant *[64]uint16, dx, dy int) []jpegcoef.Block {
+	width, height := y.WidthInBlocks*8, y.HeightInBlocks*8
+	plane := make([]float64, width*height)
+	for by := 0; by < y.HeightInBlocks; by++ {
+		for bx := 0; bx < y.WidthInBlocks; bx++ {
+			var pixels [64]float64
+			inverseDCT(y.Block(bx, by), quant, &pixels)
+			for i, v := range pixels {
+				plane[(by*8+i/8)*width+bx*8+i%8] = math.Max(0, math.Min(255, math.Round(v+128)))
+			}
+		}
+	}
+
+	blocksX, blocksY := (width-dx)/8, (height-dy)/8
+	blocks := make([]jpegcoef.Block, 0, blocksX*blocksY)
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			var pixels [64]float64
+			for i := range pixels {
+				pixels[i] = plane[(dy+by*8+i/8)*width+dx+bx*8+i%8] - 128
+			}
+			blocks = append(blocks, forwardDCT(&pixels, quant))
+		}
+	}
+	return blocks
+}
+
+// inverseDCT dequantizes block and transforms it to level shifted pixels
+func inverseDCT(block *jpegcoef.Block, quant *[64]uint16, pixels *[64]float64) {
+	var tmp [64]float64
+	for v := 0; v < 8; v++ {
+		for x := 0; x < 8; x++ {
+			sum := 0.0
+			for u := 0; u < 8; u++ {
+				sum += dctBasis[u][x] * float64(block[v*8+u]) * float64(quant[v*8+u])
+			}
+			tmp[v*8+x] = sum
+		}
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			sum := 0.0
+			for v := 0; v < 8; v++ {
+				sum += dctBasis[v][y] * tmp[v*8+x]
+			}
+			pixels[y*8+x] = sum
+		}
+	}
+}
+
+// forwardDCT transforms level shifted pixels and quantizes the result
+func forwardDCT(pixels *[64]float64, quant *[64]uint16) jpegcoef.Block {
+	var tmp [64]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			sum := 0.0
+			for x := 0; x < 8; x++ {
+				sum += dctBasis[u][x] * pixels[y*8+x]
+			}
+			tmp[y*8+u] = sum
+		}
+	}
+	var block jpegcoef.Block
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			sum := 0.0
+			for y := 0; y < 8; y++ {
+				sum += dctBasis[v][y] * tmp[y*8+u]
+			}
+			block[v*8+u] = int32(math.Round(sum / float64(quant[v*8+u])))
+		}
+	}
+	return block
+}
@@ -0,0 +1,139 @@
+package analyze
+
+import "fmt"
+
+// Score ramps of the detectors, chosen so clean covers at qualities 70-95
+// stay below SuspiciousScore
+const (
+	// lsbRateFloor is the largest lower bound on the LSB replacement rate
+	// natural asymmetry produces; the score reaches 1 at lsbRateFloor+0.2
+	lsbRateFloor = 0.02
+	// lsbMinZ is how many standard deviations the asymmetry must exceed
+	// the calibrated cover's by
+	lsbMinZ = 3
+	// f5RateFloor is the largest shrinkage rate calibration error produces
+	f5RateFloor = 0.02
+	// calibrationRatioFloor is the largest ratio of stego-to-calibrated
+	// over calibrated-to-recalibrated distance covers show
+	calibrationRatioFloor = 1.6
+)
+
+// ChiSquareDetector is the Westfeld-Pfitzmann attack on JSteg: it pools the
+// AC coefficients of a growing prefix of blocks (64, 128, 256, ...) and
+// reports the highest probability that the pairs (2k, 2k+1) were equalized
+// by sequential LSB replacement. It catches JSteg-like embedding that fills
+// a large part of the image.
+type ChiSquareDetector struct{}
+
+func (ChiSquareDetector) Name() string { return "chi-square" }
+
+func (ChiSquareDetector) Detect(s *Sample) Score {
+	pooled := new(histogram)
+	best, blocks := 0.0, 0
+	next := 64
+	for i, block := range s.Blocks {
+		for pos := 1; pos < 64; pos++ {
+			pooled.add(block[pos])
+		}
+		if i+1 == next || i+1 == len(s.Blocks) {
+			if p, dof := chiSquarePairs(pooled, true); dof > 0 && p > best {
+				best, blocks = p, i+1
+			}
+			next *= 2
+		}
+	}
+	if blocks == 0 {
+		return Score{Detail: "pairs of values look like a cover"}
+	}
+	return Score{
+		Score:  best,
+		Detail: fmt.Sprintf("p=%.3f over the first %d blocks", best, blocks),
+	}
+}
+
+// CalibrationDetector compares the coefficient histograms of the 15 lowest
+// frequencies with those of the calibrated cover estimate. Calibrating twice
+// with different shifts measures how far calibration alone strays; an image
+// much further from its estimate than that was modified in the DCT domain.
+// It flags QIM and heavy F5 embedding best.
+type CalibrationDetector struct{}
+
+func (CalibrationDetector) Name() string { return "calibration" }
+
+func (CalibrationDetector) Detect(s *Sample) Score {
+	cal, recal := s.Calibrated(), s.recalibrated()
+	toCal := float64(len(s.Blocks)) / float64(len(cal))
+	toRecal := float64(len(cal)) / float64(len(recal))
+
+	stego, baseline := 0.0, 0.0
+	for pos := 1; pos < 16; pos++ {
+		calibrated := positionHistogram(cal, pos)
+		stego += histogramDistance(positionHistogram(s.Blocks, pos), scaled(calibrated, toCal)) / 15
+		baseline += histogramDistance(calibrated, scaled(positionHistogram(recal, pos), toRecal)) / 15
+	}
+	if baseline == 0 {
+		return Score{Detail: "calibration changed nothing"}
+	}
+	ratio := stego / baseline
+	return Score{
+		Score:  ramp(ratio, calibrationRatioFloor, calibrationRatioFloor+1.4),
+		Detail: fmt.Sprintf("distance %.4f vs %.4f between calibrations (ratio %.2f)", stego, baseline, ratio),
+	}
+}
+
+// JStegF5Detector estimates how much was embedded by the two ways of
+// changing a coefficient's LSB: replacement (JSteg and the crypt single,
+// multi, direct, permuted and threshold strategies) breaks the symmetry of
+// the histogram around zero; F5 decrements magnitudes, which moves ones to
+// zero compared with the calibrated cover.
+type JStegF5Detector struct{}
+
+func (JStegF5Detector) Name() string { return "jsteg-f5" }
+
+func (JStegF5Detector) Detect(s *Sample) Score {
+	cal := s.Calibrated()
+	toCal := float64(len(s.Blocks)) / float64(len(cal))
+
+	rate, z, position, bound := 0.0, 0.0, 0, 0.0
+	for pos := 1; pos < 64; pos++ {
+		r, zr := lsbSymmetry(positionHistogram(s.Blocks, pos), scaled(positionHistogram(cal, pos), toCal))
+		// Rank by the rate lsbMinZ standard deviations below the estimate,
+		// so a position with few small values cannot win on noise
+		if zr > lsbMinZ && r*(1-lsbMinZ/zr) > bound {
+			rate, z, position, bound = r, zr, pos, r*(1-lsbMinZ/zr)
+		}
+	}
+
+	beta := 0.0
+	for _, pos := range []int{1, 8, 9} {
+		beta += f5Rate(positionHistogram(s.Blocks, pos), scaled(positionHistogram(cal, pos), toCal)) / 3
+	}
+
+	lsb := ramp(bound, lsbRateFloor, lsbRateFloor+0.2)
+	f5 := ramp(beta, f5RateFloor, f5RateFloor+0.1)
+	detail := fmt.Sprintf("F5 shrinkage %.1f%%", beta*100)
+	if position > 0 {
+		detail = fmt.Sprintf("LSB replaced %.1f%% at coefficient %d (z=%.1f), %s", rate*100, position, z, detail)
+	} else {
+		detail = "LSB histogram symmetric, " + detail
+	}
+	return Score{Score: max(lsb, f5), Detail: detail}
+}
+
+// HeaderDetector looks for the crypt image header. Its CRC makes a false
+// match unlikely, so finding it settles the question. Headers embedded with
+// a key are noise without it, so only keyless and legacy ones are found.
+type HeaderDetector struct{}
+
+func (HeaderDetector) Name() string { return "crypt-header" }
+
+func (HeaderDetector) Detect(s *Sample) Score {
+	header := s.imageHeader()
+	if header == nil {
+		return Score{Detail: "no crypt header"}
+	}
+	return Score{
+		Score:  1,
+		Detail: fmt.Sprintf("crypt header v%d, strategy %s, %d payload bytes", header.Version, header.Strategy, header.PayloadLength),
+	}
+}
@@ -0,0 +1,350 @@
+package analyze
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+// PSNRIdentical is the PSNR reported for pixel identical images, whose
+// true PSNR is infinite
+const PSNRIdentical = 100.0
+
+// ssimWindow and ssimStride set the sliding windows SSIM averages over
+const (
+	ssimWindow = 8
+	ssimStride = 4
+)
+
+// ChannelChanges counts the DCT coefficients of one channel that differ
+// between cover and stego
+type ChannelChanges struct {
+	Channel       string  `json:"channel"`
+	Changed       int     `json:"changed"`
+	Total         int     `json:"total"`
+	Fraction      float64 `json:"fraction"`
+	ChangedBlocks int     `json:"changed_blocks"`
+	Blocks        int     `json:"blocks"`
+	// Positions counts changes per coefficient, in natural order
+	Positions [64]int `json:"positions"`
+}
+
+// Diff compares a stego image with its cover in pixel space (PSNR, SSIM)
+// and in the coefficient domain
+type Diff struct {
+	Cover    string           `json:"cover"`
+	Stego    string           `json:"stego"`
+	PSNR     float64          `json:"psnr_db"`
+	SSIM     float64          `json:"ssim"`
+	Channels []ChannelChanges `json:"channels"`
+
+	cover   image.Image
+	changes []blockChanges
+}
+
+// blockChanges is where one component changed, for the heatmap
+type blockChanges struct {
+	component *jpegcoef.Component
+	scaleX    int // pixels per block column, 8 times the subsampling
+	scaleY    int
+	perBlock  []int
+}
+
+// Compare decodes cover and stego and measures how far apart they are.
+// Both must have the same dimensions and component layout.
+func Compare(coverPath, stegoPath string) (*Diff, error) {
+	coverPixels, err := decodePixels(coverPath)
+	if err != nil {
+		return nil, err
+	}
+	stegoPixels, err := decodePixels(stegoPath)
+	if err != nil {
+		return nil, err
+	}
+	if coverPixels.Bounds().Size() != stegoPixels.Bounds().Size() {
+		return nil, fmt.Errorf("cover is %v but stego is %v", coverPixels.Bounds().Size(), stegoPixels.Bounds().Size())
+	}
+
+	coverCoef, err := jpegcoef.DecodeFile(coverPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DCT coefficients from %s: %w", coverPath, err)
+	}
+	stegoCoef, err := jpegcoef.DecodeFile(stegoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DCT coefficients from %s: %w", stegoPath, err)
+	}
+
+	diff := &Diff{
+		Cover: coverPath,
+		Stego: stegoPath,
+		PSNR:  psnr(coverPixels, stegoPixels),
+		SSIM:  ssim(luma(coverPixels), luma(stegoPixels)),
+		cover: coverPixels,
+	}
+	if err := diff.compareCoefficients(coverCoef, stegoCoef); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+func decodePixels(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	img, err := jpeg.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// compareCoefficients counts changed coefficients component by component
+func (d *Diff) compareCoefficients(cover, stego *jpegcoef.Image) error {
+	if len(cover.Components) != len(stego.Components) {
+		return fmt.Errorf("cover has %d components but stego has %d", len(cover.Components), len(stego.Components))
+	}
+	hmax, vmax := 1, 1
+	for _, c := range cover.Components {
+		hmax, vmax = max(hmax, c.H), max(vmax, c.V)
+	}
+	for i := range cover.Components {
+		c, s := &cover.Components[i], &stego.Components[i]
+		if c.WidthInBlocks != s.WidthInBlocks || c.HeightInBlocks != s.HeightInBlocks {
+			return fmt.Errorf("component %d is %dx%d blocks in the cover but %dx%d in stego",
+				i, c.WidthInBlocks, c.HeightInBlocks, s.WidthInBlocks, s.HeightInBlocks)
+		}
+
+		channel := ChannelChanges{Channel: channelName(i, len(cover.Components)), Blocks: c.WidthInBlocks * c.HeightInBlocks}
+		channel.Total = channel.Blocks * 64
+		perBlock := make([]int, channel.Blocks)
+		for by := 0; by < c.HeightInBlocks; by++ {
+			for bx := 0; bx < c.WidthInBlocks; bx++ {
+				cb, sb := c.Block(bx, by), s.Block(bx, by)
+				n := 0
+				for pos := range cb {
+					if cb[pos] != sb[pos] {
+						channel.Positions[pos]++
+						n++
+					}
+				}
+				if n > 0 {
+					channel.ChangedBlocks++
+					channel.Changed += n
+				}
+				perBlock[by*c.WidthInBlocks+bx] = n
+			}
+		}
+		channel.Fraction = float64(channel.Changed) / float64(channel.Total)
+		d.Channels = append(d.Channels, channel)
+		d.changes = append(d.changes, blockChanges{
+			component: c,
+			scaleX:    8 * hmax / c.H,
+			scaleY:    8 * vmax / c.V,
+			perBlock:  perBlock,
+		})
+	}
+	return nil
+}
+
+// channelName names component i the JFIF way
+func channelName(i, components int) string {
+	if components == 1 || components == 3 {
+		return [...]string{"Y", "Cb", "Cr"}[i]
+	}
+	return fmt.Sprintf("C%d", i)
+}
+
+// TopPositions returns the changed coefficient positions, most changed
+// first
+func (c ChannelChanges) TopPositions() []int {
+	var positions []int
+	for pos, n := range c.Positions {
+		if n > 0 {
+			positions = append(positions, pos)
+		}
+	}
+	sort.SliceStable(positions, func(i, j int) bool {
+		return c.Positions[positions[i]] > c.Positions[positions[j]]
+	})
+	return positions
+}
+
+// psnr is the peak signal to noise ratio over the RGB channels, in dB
+func psnr(a, b image.Image) float64 {
+	bounds, offset := a.Bounds(), b.Bounds().Min.Sub(a.Bounds().Min)
+	sum := 0.0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ar, ag, ab, _ := a.At(x, y).RGBA()
+			br, bg, bb, _ := b.At(x+offset.X, y+offset.Y).RGBA()
+			for _, d := range [3]float64{
+				float64(ar>>8) - float64(br>>8),
+				float64(ag>>8) - float64(bg>>8),
+				float64(ab>>8) - float64(bb>>8),
+			} {
+				sum += d * d
+			}
+		}
+	}
+	mse := sum / float64(3*bounds.Dx()*bounds.Dy())
+	if mse == 0 {
+		return PSNRIdentical
+	}
+	return math.Min(PSNRIdentical, 10*math.Log10(255*255/mse))
+}
+
+// luma returns the Y plane of img, straight from the decoder for YCbCr
+// and grayscale JPEGs
+func luma(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	if ycc, ok := img.(*image.YCbCr); ok {
+		for y := 0; y < bounds.Dy(); y++ {
+			copy(gray.Pix[y*gray.Stride:(y+1)*gray.Stride], ycc.Y[ycc.YOffset(bounds.Min.X, bounds.Min.Y+y):])
+		}
+		return gray
+	}
+	if g, ok := img.(*image.Gray); ok {
+		for y := 0; y < bounds.Dy(); y++ {
+			copy(gray.Pix[y*gray.Stride:(y+1)*gray.Stride], g.Pix[g.PixOffset(bounds.Min.X, bounds.Min.Y+y):])
+		}
+		return gray
+	}
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			gray.Pix[y*gray.Stride+x] = color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y
+		}
+	}
+	return gray
+}
+
+// ssim is the mean structural similarity (Wang et al. 2004) of two luma
+// planes over ssimWindow square windows every ssimStride pixels
+func ssim(a, b *image.Gray) float64 {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+	w, h := a.Rect.Dx(), a.Rect.Dy()
+	if w < ssimWindow || h < ssimWindow {
+		return 1
+	}
+	total, windows := 0.0, 0
+	n := float64(ssimWindow * ssimWindow)
+	for y := 0; y+ssimWindow <= h; y += ssimStride {
+		for x := 0; x+ssimWindow <= w; x += ssimStride {
+			var sa, sb, saa, sbb, sab float64
+			for dy := 0; dy < ssimWindow; dy++ {
+				for dx := 0; dx < ssimWindow; dx++ {
+					va := float64(a.Pix[(y+dy)*a.Stride+x+dx])
+					vb := float64(b.Pix[(y+dy)*b.Stride+x+dx])
+					sa, sb = sa+va, sb+vb
+					saa, sbb, sab = saa+va*va, sbb+vb*vb, sab+va*vb
+				}
+			}
+			ma, mb := sa/n, sb/n
+			va, vb := saa/n-ma*ma, sbb/n-mb*mb
+			cov := sab/n - ma*mb
+			total += (2*ma*mb + c1) * (2*cov + c2) / ((ma*ma + mb*mb + c1) * (va + vb + c2))
+			windows++
+		}
+	}
+	return total / float64(windows)
+}
+
+// Heatmap draws the cover darkened to half brightness with every changed
+// block tinted red, brighter the more of its coefficients changed. Chroma
+// blocks cover their subsampled area.
+func (d *Diff) Heatmap() *image.RGBA {
+	bounds := d.cover.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	heat := make([]int, w*h)
+	peak := 0
+	for _, bc := range d.changes {
+		c := bc.component
+		for by := 0; by < c.HeightInBlocks; by++ {
+			for bx := 0; bx < c.WidthInBlocks; bx++ {
+				n := bc.perBlock[by*c.WidthInBlocks+bx]
+				if n == 0 {
+					continue
+				}
+				for y := by * bc.scaleY; y < min(h, (by+1)*bc.scaleY); y++ {
+					for x := bx * bc.scaleX; x < min(w, (bx+1)*bc.scaleX); x++ {
+						heat[y*w+x] += n
+						peak = max(peak, heat[y*w+x])
+					}
+				}
+			}
+		}
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := color.GrayModel.Convert(d.cover.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y / 2
+			px := color.RGBA{R: v, G: v, B: v, A: 255}
+			if heat[y*w+x] > 0 {
+				// Even a single change stands out against the darkened cover
+				t := 0.35 + 0.65*float64(heat[y*w+x])/float64(peak)
+				px.R = uint8(float64(v)*(1-t) + 255*t)
+				px.G = uint8(float64(v) * (1 - t))
+				px.B = px.G
+			}
+			out.Set(x, y, px)
+		}
+	}
+	return out
+}
+
+// WriteHeatmap saves Heatmap as a PNG at path
+func (d *Diff) WriteHeatmap(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create heatmap %s: %w", path, err)
+	}
+	if err := png.Encode(f, d.Heatmap()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write heatmap %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// WriteDiffTable prints d as a summary line and one row per channel
+func WriteDiffTable(w io.Writer, d *Diff) error {
+	fmt.Fprintf(w, "%s -> %s\nPSNR %.2f dB, SSIM %.5f\n\n", d.Cover, d.Stego, d.PSNR, d.SSIM)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHANNEL\tCHANGED\tFRACTION\tBLOCKS\tPOSITIONS")
+	for _, c := range d.Channels {
+		var positions []string
+		for i, pos := range c.TopPositions() {
+			if i == 8 {
+				positions = append(positions, "...")
+				break
+			}
+			positions = append(positions, fmt.Sprintf("%d:%d", pos, c.Positions[pos]))
+		}
+		fmt.Fprintf(tw, "%s\t%d/%d\t%.4f%%\t%d/%d\t%s\n", c.Channel, c.Changed, c.Total,
+			c.Fraction*100, c.ChangedBlocks, c.Blocks, strings.Join(positions, " "))
+	}
+	return tw.Flush()
+}
+
+// WriteDiffJSON prints d as indented JSON
+func WriteDiffJSON(w io.Writer, d *Diff) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(d)
+}
@@ -0,0 +1,73 @@
+package analyze
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BuddhiLW/crypt/pkg/core"
+)
+
+func TestCompareIdentical(t *testing.T) {
+	cover := writeCover(t, 128, 96)
+	diff, err := Compare(cover, cover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.PSNR != PSNRIdentical || diff.SSIM < 0.99999 {
+		t.Errorf("identical images: PSNR %.2f, SSIM %.5f", diff.PSNR, diff.SSIM)
+	}
+	for _, c := range diff.Channels {
+		if c.Changed != 0 || c.ChangedBlocks != 0 {
+			t.Errorf("%s: %d coefficients changed", c.Channel, c.Changed)
+		}
+	}
+}
+
+func TestCompareCountsEmbeddedCoefficients(t *testing.T) {
+	cover := writeCover(t, 256, 256)
+	stego := filepath.Join(t.TempDir(), "stego.jpg")
+	payload := []byte("sixteen byte msg")
+	if err := core.NewGoDCTProcessor().EmbedData(cover, stego, payload, core.DCTStrategySingle); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := Compare(cover, stego)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.PSNR < 40 || diff.PSNR == PSNRIdentical || diff.SSIM < 0.99 {
+		t.Errorf("one coefficient per block: PSNR %.2f, SSIM %.5f", diff.PSNR, diff.SSIM)
+	}
+	y := diff.Channels[0]
+	// About half of the LSBs already hold the right bit
+	if y.Changed == 0 || y.Changed > len(payload)*8 || y.Positions[1] != y.Changed {
+		t.Errorf("expected up to %d changes at position 1, got %d (%v)", len(payload)*8, y.Changed, y.TopPositions())
+	}
+	if y.ChangedBlocks != y.Changed {
+		t.Errorf("single strategy changed %d coefficients in %d blocks", y.Changed, y.ChangedBlocks)
+	}
+
+	heatmap := filepath.Join(t.TempDir(), "heatmap.png")
+	if err := diff.WriteHeatmap(heatmap); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(heatmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 256 || img.Bounds().Dy() != 256 {
+		t.Errorf("heatmap is %v, want the cover size", img.Bounds())
+	}
+	// The first block carries the first bits and is tinted when it changed
+	r, g, _, _ := img.At(3, 3).RGBA()
+	if diff.changes[0].perBlock[0] > 0 && r <= g {
+		t.Errorf("changed block not tinted: r=%d g=%d", r>>8, g>>8)
+	}
+}
@@ -0,0 +1,72 @@
+package analyze
+
+import "math"
+
+// scaled returns h multiplied by factor, so a calibrated histogram of
+// fewer blocks compares with the original one
+func scaled(h *histogram, factor float64) []float64 {
+	out := make([]float64, histogramRange)
+	for i, c := range h {
+		out[i] = float64(c) * factor
+	}
+	return out
+}
+
+// lsbSymmetry estimates the fraction of coefficients at one position that
+// carry LSB replaced bits. Replacement swaps 0 with 1 and -1 with -2, so a
+// fraction p moves p/2 ((h(0)+h(1)) - (h(-1)+h(-2))) coefficients net from
+// the negative side of the histogram to the positive one. Gradients make
+// covers lopsided too, but calibration keeps their asymmetry, so only the
+// excess over the calibrated cover counts. z is that excess in standard
+// deviations.
+func lsbSymmetry(stego *histogram, cover []float64) (rate, z float64) {
+	s := scaled(stego, 1)
+	at := func(h []float64, v int) float64 { return h[histogramRange/2+v] }
+	den := at(s, 0) + at(s, 1) - at(s, -1) - at(s, -2)
+	mass := at(s, 0) + at(s, 1) + at(s, -1) + at(s, -2)
+	variance := at(s, 1) + at(s, -1) + at(cover, 1) + at(cover, -1)
+	// Near flat histograms hide replacement: nothing moves net
+	if variance < 20 || den < mass/40 {
+		return 0, 0
+	}
+	excess := (at(s, 1) - at(s, -1)) - (at(cover, 1) - at(cover, -1))
+	return math.Min(1, 2*excess/den), excess / math.Sqrt(variance)
+}
+
+// magnitude returns the count of coefficients with absolute value d
+func magnitude(h []float64, d int) float64 {
+	if d == 0 {
+		return h[histogramRange/2]
+	}
+	return h[histogramRange/2+d] + h[histogramRange/2-d]
+}
+
+// f5Rate estimates the fraction of nonzero coefficients F5 decremented
+// (Fridrich, Goljan and Hogea): shrinkage moves β of the ones to zero and
+// β of the twos to one, which the calibrated cover counts recover by least
+// squares
+func f5Rate(stego *histogram, cover []float64) float64 {
+	s := scaled(stego, 1)
+	h0, h1, h2 := magnitude(cover, 0), magnitude(cover, 1), magnitude(cover, 2)
+	H0, H1 := magnitude(s, 0), magnitude(s, 1)
+	den := h1*h1 + (h2-h1)*(h2-h1)
+	if den == 0 {
+		return 0
+	}
+	beta := (h1*(H0-h0) + (H1-h1)*(h2-h1)) / den
+	return math.Max(0, math.Min(1, beta))
+}
+
+// histogramDistance is the share of coefficients whose value differs
+// between the stego and calibrated histograms (half their L1 distance)
+func histogramDistance(stego *histogram, cover []float64) float64 {
+	diff, total := 0.0, 0.0
+	for i, c := range stego {
+		diff += math.Abs(float64(c) - cover[i])
+		total += float64(c)
+	}
+	if total == 0 {
+		return 0
+	}
+	return diff / (2 * total)
+}
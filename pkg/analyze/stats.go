@@ -0,0 +1,118 @@
+package analyze
+
+import (
+	"math"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+// histogramRange bounds the coefficient values counted: baseline 8 bit
+// JPEGs quantize to at most 11 bits
+const histogramRange = 2048
+
+// histogram counts coefficient values, offset by histogramRange/2
+type histogram [histogramRange]int
+
+func (h *histogram) add(v int32) {
+	h[min(max(int(v)+histogramRange/2, 0), histogramRange-1)]++
+}
+
+// at returns the count of value v
+func (h *histogram) at(v int) int {
+	i := v + histogramRange/2
+	if i < 0 || i >= histogramRange {
+		return 0
+	}
+	return h[i]
+}
+
+// total returns the number of counted coefficients
+func (h *histogram) total() int {
+	n := 0
+	for _, c := range h {
+		n += c
+	}
+	return n
+}
+
+// positionHistogram counts coefficient pos over blocks
+func positionHistogram(blocks []jpegcoef.Block, pos int) *histogram {
+	h := new(histogram)
+	for i := range blocks {
+		h.add(blocks[i][pos])
+	}
+	return h
+}
+
+// chiSquarePairs is the Westfeld-Pfitzmann statistic: LSB replacement
+// equalizes the counts of each value pair (2k, 2k+1), so the further a
+// pair sits from its mean the less likely the coefficients were replaced.
+// It returns the probability of embedding (the upper tail of the chi-square
+// distribution) and the degrees of freedom, 0 when too few pairs are
+// populated. skipZeroOne leaves out the pair JSteg never touches.
+func chiSquarePairs(h *histogram, skipZeroOne bool) (float64, int) {
+	chi, pairs := 0.0, 0
+	for v := -histogramRange / 2; v < histogramRange/2; v += 2 {
+		if skipZeroOne && v == 0 {
+			continue
+		}
+		even, odd := float64(h.at(v)), float64(h.at(v+1))
+		expected := (even + odd) / 2
+		if expected < 5 {
+			continue
+		}
+		chi += (even - expected) * (even - expected) / expected
+		pairs++
+	}
+	if pairs < 2 {
+		return 0, 0
+	}
+	return chiSquareSurvival(chi, pairs-1), pairs - 1
+}
+
+// chiSquareSurvival returns P(X > x) for X chi-square distributed with dof
+// degrees of freedom, the regularized upper incomplete gamma Q(dof/2, x/2)
+func chiSquareSurvival(x float64, dof int) float64 {
+	if x <= 0 {
+		return 1
+	}
+	a, z := float64(dof)/2, x/2
+	lg, _ := math.Lgamma(a)
+	prefix := math.Exp(-z + a*math.Log(z) - lg)
+	if z < a+1 {
+		// Series for the lower gamma P(a, z)
+		sum, term := 1/a, 1/a
+		for n := 1; n < 500; n++ {
+			term *= z / (a + float64(n))
+			sum += term
+			if term < sum*1e-14 {
+				break
+			}
+		}
+		return math.Max(0, 1-prefix*sum)
+	}
+	// Continued fraction for Q(a, z) (modified Lentz)
+	const tiny = 1e-300
+	b := z + 1 - a
+	c, d := 1/tiny, 1/b
+	f := d
+	for n := 1; n < 500; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		f *= delta
+		if math.Abs(delta-1) < 1e-14 {
+			break
+		}
+	}
+	return math.Min(1, prefix*f)
+}
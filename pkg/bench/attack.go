@@ -0,0 +1,324 @@
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// PixelQuality is the JPEG quality pixel domain attacks save their result
+// with, high enough that the attack itself dominates the damage
+const PixelQuality = 100
+
+// Attack transforms a JPEG the way the channel between sender and receiver
+// might: a re-save, a resize, an edit (SRP)
+type Attack interface {
+	Name() string
+	Apply(data []byte) ([]byte, error)
+}
+
+// Chain applies attacks in order. An empty chain leaves the image alone.
+type Chain []Attack
+
+// Name returns the attacks joined by '+', or none for the empty chain
+func (c Chain) Name() string {
+	if len(c) == 0 {
+		return "none"
+	}
+	names := make([]string, len(c))
+	for i, attack := range c {
+		names[i] = attack.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+// Apply runs every attack of the chain on data
+func (c Chain) Apply(data []byte) ([]byte, error) {
+	for _, attack := range c {
+		var err error
+		if data, err = attack.Apply(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", attack.Name(), err)
+		}
+	}
+	return data, nil
+}
+
+// DefaultChains are the attacks run when none are given
+var DefaultChains = []string{
+	"none",
+	"jpeg:95", "jpeg:90", "jpeg:85", "jpeg:75", "jpeg:65", "jpeg:50",
+	"chroma:444", "chroma:422",
+	"resize:0.75", "resize:0.5",
+	"crop:4", "crop:8",
+	"noise:2", "noise:5",
+	"brightness:10", "brightness:-10",
+}
+
+// ParseChain parses attacks joined by '+', e.g. resize:0.5+jpeg:90
+func ParseChain(spec string) (Chain, error) {
+	if spec == "" || spec == "none" {
+		return Chain{}, nil
+	}
+	var chain Chain
+	for _, part := range strings.Split(spec, "+") {
+		attack, err := ParseAttack(part)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, attack)
+	}
+	return chain, nil
+}
+
+// ParseAttack parses one attack of the form name:value:
+//
+//   - jpeg:<quality>: re-save at quality 1-100
+//   - chroma:<444|422|440|420|411|410>: resample the chroma planes
+//   - resize:<factor>: scale by factor and back to the original size
+//   - crop:<pixels>: cut pixels off the top and left edges
+//   - noise:<sigma>: add Gaussian noise
+//   - brightness:<delta>: shift every channel by delta
+func ParseAttack(spec string) (Attack, error) {
+	name, value, ok := strings.Cut(strings.TrimSpace(spec), ":")
+	if !ok {
+		return nil, fmt.Errorf("attack %q needs a value, e.g. jpeg:75", spec)
+	}
+	switch name {
+	case "jpeg":
+		quality, err := strconv.Atoi(value)
+		if err != nil || quality < 1 || quality > 100 {
+			return nil, fmt.Errorf("invalid JPEG quality %q: use 1-100", value)
+		}
+		return Recompress{Quality: quality}, nil
+	case "chroma":
+		ratio, ok := chromaRatios[value]
+		if !ok {
+			return nil, fmt.Errorf("invalid chroma subsampling %q: use 444, 422, 440, 420, 411 or 410", value)
+		}
+		return Chroma{Ratio: ratio}, nil
+	case "resize":
+		scale, err := strconv.ParseFloat(value, 64)
+		if err != nil || scale <= 0 || scale > 4 {
+			return nil, fmt.Errorf("invalid resize factor %q: use a factor above 0 and up to 4", value)
+		}
+		return Resize{Scale: scale}, nil
+	case "crop":
+		pixels, err := strconv.Atoi(value)
+		if err != nil || pixels < 0 {
+			return nil, fmt.Errorf("invalid crop %q: use a pixel count", value)
+		}
+		return Crop{Pixels: pixels}, nil
+	case "noise":
+		sigma, err := strconv.ParseFloat(value, 64)
+		if err != nil || sigma < 0 {
+			return nil, fmt.Errorf("invalid noise sigma %q", value)
+		}
+		return Noise{Sigma: sigma}, nil
+	case "brightness":
+		delta, err := strconv.Atoi(value)
+		if err != nil || delta < -255 || delta > 255 {
+			return nil, fmt.Errorf("invalid brightness shift %q: use -255 to 255", value)
+		}
+		return Brightness{Delta: delta}, nil
+	default:
+		return nil, fmt.Errorf("unknown attack %q", name)
+	}
+}
+
+// Recompress re-saves the image at Quality
+type Recompress struct {
+	Quality int
+}
+
+func (r Recompress) Name() string { return fmt.Sprintf("jpeg:%d", r.Quality) }
+
+func (r Recompress) Apply(data []byte) ([]byte, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return encodeJPEG(img, r.Quality)
+}
+
+var chromaRatios = map[string]image.YCbCrSubsampleRatio{
+	"444": image.YCbCrSubsampleRatio444,
+	"422": image.YCbCrSubsampleRatio422,
+	"440": image.YCbCrSubsampleRatio440,
+	"420": image.YCbCrSubsampleRatio420,
+	"411": image.YCbCrSubsampleRatio411,
+	"410": image.YCbCrSubsampleRatio410,
+}
+
+// Chroma resamples the chroma planes to Ratio, averaging each cell, as a
+// converter changing the subsampling would
+type Chroma struct {
+	Ratio image.YCbCrSubsampleRatio
+}
+
+func (c Chroma) Name() string {
+	for name, ratio := range chromaRatios {
+		if ratio == c.Ratio {
+			return "chroma:" + name
+		}
+	}
+	return "chroma:unknown"
+}
+
+func (c Chroma) Apply(data []byte) ([]byte, error) {
+	return applyPixels(data, func(src *image.RGBA) image.Image {
+		b := src.Bounds()
+		dst := image.NewYCbCr(b, c.Ratio)
+		cb := make([]int, len(dst.Cb))
+		cr := make([]int, len(dst.Cr))
+		count := make([]int, len(dst.Cb))
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				p := src.RGBAAt(x, y)
+				yy, u, v := color.RGBToYCbCr(p.R, p.G, p.B)
+				dst.Y[dst.YOffset(x, y)] = yy
+				i := dst.COffset(x, y)
+				cb[i] += int(u)
+				cr[i] += int(v)
+				count[i]++
+			}
+		}
+		for i, n := range count {
+			if n > 0 {
+				dst.Cb[i] = uint8((cb[i] + n/2) / n)
+				dst.Cr[i] = uint8((cr[i] + n/2) / n)
+			}
+		}
+		return dst
+	})
+}
+
+// Resize scales the image by Scale and back, bilinearly, so the block grid
+// stays where the extractor expects it
+type Resize struct {
+	Scale float64
+}
+
+func (r Resize) Name() string { return "resize:" + strconv.FormatFloat(r.Scale, 'f', -1, 64) }
+
+func (r Resize) Apply(data []byte) ([]byte, error) {
+	return applyPixels(data, func(src *image.RGBA) image.Image {
+		b := src.Bounds()
+		w := max(1, int(math.Round(float64(b.Dx())*r.Scale)))
+		h := max(1, int(math.Round(float64(b.Dy())*r.Scale)))
+		return resizeBilinear(resizeBilinear(src, w, h), b.Dx(), b.Dy())
+	})
+}
+
+// Crop cuts Pixels off the top and left edges, shifting the block grid
+type Crop struct {
+	Pixels int
+}
+
+func (c Crop) Name() string { return fmt.Sprintf("crop:%d", c.Pixels) }
+
+func (c Crop) Apply(data []byte) ([]byte, error) {
+	return applyPixels(data, func(src *image.RGBA) image.Image {
+		b := src.Bounds()
+		n := min(c.Pixels, b.Dx()-1, b.Dy()-1)
+		return src.SubImage(image.Rect(b.Min.X+n, b.Min.Y+n, b.Max.X, b.Max.Y))
+	})
+}
+
+// Noise adds Gaussian noise of standard deviation Sigma to every channel.
+// The noise is seeded, so runs are reproducible.
+type Noise struct {
+	Sigma float64
+}
+
+func (n Noise) Name() string { return "noise:" + strconv.FormatFloat(n.Sigma, 'f', -1, 64) }
+
+func (n Noise) Apply(data []byte) ([]byte, error) {
+	return applyPixels(data, func(src *image.RGBA) image.Image {
+		rng := rand.New(rand.NewPCG(1, 2))
+		for i := range src.Pix {
+			if i%4 != 3 {
+				src.Pix[i] = clamp8(float64(src.Pix[i]) + rng.NormFloat64()*n.Sigma)
+			}
+		}
+		return src
+	})
+}
+
+// Brightness shifts every channel by Delta
+type Brightness struct {
+	Delta int
+}
+
+func (s Brightness) Name() string { return fmt.Sprintf("brightness:%d", s.Delta) }
+
+func (s Brightness) Apply(data []byte) ([]byte, error) {
+	return applyPixels(data, func(src *image.RGBA) image.Image {
+		for i := range src.Pix {
+			if i%4 != 3 {
+				src.Pix[i] = clamp8(float64(int(src.Pix[i]) + s.Delta))
+			}
+		}
+		return src
+	})
+}
+
+// applyPixels decodes data, transforms its pixels and saves the result at
+// PixelQuality
+func applyPixels(data []byte, transform func(*image.RGBA) image.Image) ([]byte, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return encodeJPEG(transform(rgba), PixelQuality)
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resizeBilinear samples src at w x h pixels
+func resizeBilinear(src *image.RGBA, w, h int) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sx := float64(b.Dx()) / float64(w)
+	sy := float64(b.Dy()) / float64(h)
+	for y := 0; y < h; y++ {
+		fy := math.Max((float64(y)+0.5)*sy-0.5, 0)
+		y0 := min(int(fy), b.Dy()-1)
+		y1 := min(y0+1, b.Dy()-1)
+		wy := fy - float64(y0)
+		for x := 0; x < w; x++ {
+			fx := math.Max((float64(x)+0.5)*sx-0.5, 0)
+			x0 := min(int(fx), b.Dx()-1)
+			x1 := min(x0+1, b.Dx()-1)
+			wx := fx - float64(x0)
+			for c := 0; c < 4; c++ {
+				p00 := float64(src.Pix[src.PixOffset(b.Min.X+x0, b.Min.Y+y0)+c])
+				p01 := float64(src.Pix[src.PixOffset(b.Min.X+x1, b.Min.Y+y0)+c])
+				p10 := float64(src.Pix[src.PixOffset(b.Min.X+x0, b.Min.Y+y1)+c])
+				p11 := float64(src.Pix[src.PixOffset(b.Min.X+x1, b.Min.Y+y1)+c])
+				top := p00 + (p01-p00)*wx
+				bottom := p10 + (p11-p10)*wx
+				dst.Pix[dst.PixOffset(x, y)+c] = clamp8(top + (bottom-top)*wy)
+			}
+		}
+	}
+	return dst
+}
+
+func clamp8(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
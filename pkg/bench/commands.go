@@ -0,0 +1,113 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rwxrob/bonzai"
+	"github.com/rwxrob/bonzai/cmds/help"
+	"github.com/rwxrob/bonzai/comp"
+)
+
+var BenchCmd = &bonzai.Cmd{
+	Name:  "bench",
+	Short: "measure how embeddings survive image processing",
+	Comp:  comp.Cmds,
+	Cmds: []*bonzai.Cmd{
+		RobustnessCmd,
+		help.Cmd,
+	},
+}
+
+var RobustnessCmd = &bonzai.Cmd{
+	Name:  "robustness",
+	Alias: "r",
+	Short: "attack stego images and report bit error rates",
+	Usage: `robustness [json] <cover.jpg> <payload> [<strategies> [<attack>...]]`,
+	Comp:  comp.Cmds,
+	Cmds: []*bonzai.Cmd{
+		RobustnessJSONCmd,
+		help.Cmd,
+	},
+	Long: `
+Embeds the payload as a QR module matrix into the cover with each
+strategy, runs every attack on the stego image and extracts again. Each
+row reports the bit error rate of the modules and whether the QR still
+decodes. Everything runs in-process, no external tools are needed.
+
+Strategies are a comma separated list (single, multi, direct, permuted,
+threshold, f5, qim) or all (default).
+
+Attacks are name:value, chained with '+' (resize:0.5+jpeg:90):
+
+- jpeg:<quality>: re-save at quality 1-100
+- chroma:<444|422|440|420|411|410>: resample the chroma planes
+- resize:<factor>: scale by factor and back to the original size
+- crop:<pixels>: cut pixels off the top and left edges
+- noise:<sigma>: add Gaussian noise (seeded, reproducible)
+- brightness:<delta>: shift every channel by delta
+- none: no attack
+
+Pixel attacks save their result at quality 100. Without attacks a
+default set runs: re-saves from q95 down to q50, chroma resampling,
+resizes, crops, noise and brightness shifts.
+
+Usage:
+- bench robustness cover.jpg "secret"
+- bench robustness cover.jpg "secret" single,qim jpeg:75 resize:0.5+jpeg:90
+- bench robustness json cover.jpg "secret" all > results.json
+`,
+	Do: func(x *bonzai.Cmd, args ...string) error {
+		return runRobustness(os.Stdout, WriteTable, args)
+	},
+}
+
+var RobustnessJSONCmd = &bonzai.Cmd{
+	Name:  "json",
+	Short: "report robustness results as JSON",
+	Usage: `json <cover.jpg> <payload> [<strategies> [<attack>...]]`,
+	Do: func(x *bonzai.Cmd, args ...string) error {
+		// Progress goes to stderr so stdout holds nothing but the JSON
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = stdout }()
+		return runRobustness(stdout, WriteJSON, args)
+	},
+}
+
+// runRobustness parses the robustness arguments, runs the bench and writes
+// the results to w
+func runRobustness(w io.Writer, write func(io.Writer, []Result) error, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: robustness [json] <cover.jpg> <payload> [<strategies> [<attack>...]]")
+	}
+	cover, payload := args[0], args[1]
+
+	strategies := AllStrategies
+	if len(args) > 2 {
+		var err error
+		if strategies, err = ParseStrategies(args[2]); err != nil {
+			return err
+		}
+	}
+
+	specs := DefaultChains
+	if len(args) > 3 {
+		specs = args[3:]
+	}
+	chains := make([]Chain, len(specs))
+	for i, spec := range specs {
+		chain, err := ParseChain(spec)
+		if err != nil {
+			return err
+		}
+		chains[i] = chain
+	}
+
+	results, err := NewRobustnessBench().Run(cover, payload, strategies, chains)
+	if err != nil {
+		return err
+	}
+	return write(w, results)
+}
@@ -0,0 +1,204 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/BuddhiLW/crypt/pkg/core"
+)
+
+// benchPassword keys the walk of the permuted strategy. The bench measures
+// survival, not secrecy, so any fixed password will do.
+const benchPassword = "crypt-bench-robustness"
+
+// AllStrategies are the strategies benchmarked when none are given
+var AllStrategies = []core.DCTStrategy{
+	core.DCTStrategySingle,
+	core.DCTStrategyMulti,
+	core.DCTStrategyDirect,
+	core.DCTStrategyPermuted,
+	core.DCTStrategyThreshold,
+	core.DCTStrategyF5,
+	core.DCTStrategyQIM,
+}
+
+// ParseStrategies parses a comma separated strategy list, or all
+func ParseStrategies(spec string) ([]core.DCTStrategy, error) {
+	if spec == "" || spec == "all" {
+		return AllStrategies, nil
+	}
+	var strategies []core.DCTStrategy
+	for _, name := range strings.Split(spec, ",") {
+		strategy, err := core.ParseDCTStrategy(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		strategies = append(strategies, strategy)
+	}
+	return strategies, nil
+}
+
+// Result is the outcome of one strategy under one attack chain
+type Result struct {
+	Strategy  string  `json:"strategy"`
+	Attack    string  `json:"attack"`
+	Bits      int     `json:"bits"`
+	BitErrors int     `json:"bit_errors"`
+	BER       float64 `json:"ber"`
+	Decoded   bool    `json:"decoded"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// RobustnessBench embeds a payload as a QR module matrix with each
+// strategy, attacks the stego image and measures what comes back (SRP)
+type RobustnessBench struct {
+	qrProcessor  core.QRCodeProcessor
+	processorFor func(core.DCTStrategy) (core.DCTProcessor, error)
+}
+
+// NewRobustnessBench creates a bench using the platform DCT processor
+func NewRobustnessBench() *RobustnessBench {
+	factory := core.NewServiceFactory()
+	return NewRobustnessBenchWithProcessors(core.NewGoQRProcessor(), func(strategy core.DCTStrategy) (core.DCTProcessor, error) {
+		return factory.CreateDCTProcessorFor(strategy, benchPassword, core.DCTParams{})
+	})
+}
+
+// NewRobustnessBenchWithProcessors creates a bench with explicit processors
+func NewRobustnessBenchWithProcessors(qrProcessor core.QRCodeProcessor, processorFor func(core.DCTStrategy) (core.DCTProcessor, error)) *RobustnessBench {
+	return &RobustnessBench{qrProcessor: qrProcessor, processorFor: processorFor}
+}
+
+// Run embeds payload into cover with every strategy and tries to extract it
+// after every chain. Failures of single runs are reported in their Result;
+// Run itself only fails when the payload cannot be encoded or the scratch
+// directory cannot be created.
+func (b *RobustnessBench) Run(cover, payload string, strategies []core.DCTStrategy, chains []Chain) ([]Result, error) {
+	modules, size, err := b.qrProcessor.GenerateModules(payload, core.ECCLevelHigh)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload as QR: %w", err)
+	}
+	fmt.Printf("Payload: %d bytes as %dx%d QR modules (%d bits)\n", len(payload), size, size, size*size)
+	qr := benchQR{payload: payload, modules: modules, size: size}
+
+	dir, err := os.MkdirTemp("", "crypt-bench-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var results []Result
+	for _, strategy := range strategies {
+		stego := filepath.Join(dir, "stego.jpg")
+		processor, err := b.embed(cover, stego, modules, strategy)
+		for _, chain := range chains {
+			result := Result{Strategy: strategy.String(), Attack: chain.Name(), Bits: size * size}
+			if err == nil {
+				b.attack(&result, processor, stego, filepath.Join(dir, "attacked.jpg"), chain, qr, strategy)
+			} else {
+				result.Error = err.Error()
+				result.BitErrors, result.BER = result.Bits, 1
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// embed writes modules into cover with strategy, checking the capacity
+// first so the processor never sees a payload it cannot hold
+func (b *RobustnessBench) embed(cover, stego string, modules []byte, strategy core.DCTStrategy) (core.DCTProcessor, error) {
+	processor, err := b.processorFor(strategy)
+	if err != nil {
+		return nil, err
+	}
+	capacity, err := processor.CalculateImageCapacity(cover, strategy)
+	if err != nil {
+		return nil, err
+	}
+	if len(modules)*8 > capacity {
+		return nil, fmt.Errorf("%d bits exceed the %d bit capacity", len(modules)*8, capacity)
+	}
+	if err := processor.EmbedData(cover, stego, modules, strategy); err != nil {
+		return nil, err
+	}
+	return processor, nil
+}
+
+// benchQR is the payload and the QR module matrix carrying it
+type benchQR struct {
+	payload string
+	modules []byte
+	size    int
+}
+
+// attack applies chain to stego and fills in what survived
+func (b *RobustnessBench) attack(result *Result, processor core.DCTProcessor, stego, attacked string, chain Chain, qr benchQR, strategy core.DCTStrategy) {
+	fail := func(err error) {
+		result.Error = err.Error()
+		result.BitErrors, result.BER = result.Bits, 1
+	}
+
+	data, err := os.ReadFile(stego)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if data, err = chain.Apply(data); err != nil {
+		fail(err)
+		return
+	}
+	if err := os.WriteFile(attacked, data, 0644); err != nil {
+		fail(err)
+		return
+	}
+	extracted, err := processor.ExtractData(attacked, len(qr.modules), strategy)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	result.BitErrors = bitErrors(qr.modules, extracted, result.Bits)
+	result.BER = float64(result.BitErrors) / float64(result.Bits)
+	got, err := b.qrProcessor.ReadModules(extracted, qr.size)
+	result.Decoded = err == nil && got == qr.payload
+}
+
+// bitErrors counts the differing bits among the first n of want and got
+func bitErrors(want, got []byte, n int) int {
+	errors := 0
+	for i := 0; i < n/8; i++ {
+		errors += bits.OnesCount8(want[i] ^ got[i])
+	}
+	if rest := n % 8; rest > 0 {
+		errors += bits.OnesCount8((want[n/8] ^ got[n/8]) >> (8 - rest))
+	}
+	return errors
+}
+
+// WriteTable prints results as a table, one row per strategy and attack
+func WriteTable(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STRATEGY\tATTACK\tBER\tDECODED\tNOTE")
+	for _, r := range results {
+		decoded := "no"
+		if r.Decoded {
+			decoded = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.4f\t%s\t%s\n", r.Strategy, r.Attack, r.BER, decoded, r.Error)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON prints results as an indented JSON array
+func WriteJSON(w io.Writer, results []Result) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
@@ -0,0 +1,122 @@
+package bench
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BuddhiLW/crypt/pkg/core"
+)
+
+func writeCover(t *testing.T, w, h int) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8((x*7 + y*13 + (x*y)%31) % 256)
+			img.Set(x, y, color.RGBA{R: v, G: uint8(x * 3), B: uint8(y * 5), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cover.jpg")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseChain(t *testing.T) {
+	for spec, name := range map[string]string{
+		"":                         "none",
+		"none":                     "none",
+		"jpeg:75":                  "jpeg:75",
+		"resize:0.5+jpeg:90":       "resize:0.5+jpeg:90",
+		"chroma:422+crop:8":        "chroma:422+crop:8",
+		"noise:2.5+brightness:-10": "noise:2.5+brightness:-10",
+	} {
+		chain, err := ParseChain(spec)
+		if err != nil || chain.Name() != name {
+			t.Errorf("ParseChain(%q) = %q, %v; want %q", spec, chain.Name(), err, name)
+		}
+	}
+	for _, spec := range []string{"jpeg", "jpeg:0", "jpeg:101", "chroma:423", "resize:0", "crop:-1", "blur:3"} {
+		if _, err := ParseChain(spec); err == nil {
+			t.Errorf("ParseChain(%q) should fail", spec)
+		}
+	}
+}
+
+func TestAttacksKeepOrShiftGeometry(t *testing.T) {
+	data, err := os.ReadFile(writeCover(t, 64, 48))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for spec, want := range map[string]image.Point{
+		"jpeg:60":       {64, 48},
+		"chroma:410":    {64, 48},
+		"resize:0.5":    {64, 48},
+		"crop:5":        {59, 43},
+		"noise:3":       {64, 48},
+		"brightness:20": {64, 48},
+	} {
+		chain, _ := ParseChain(spec)
+		out, err := chain.Apply(data)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+		if err != nil || cfg.Width != want.X || cfg.Height != want.Y {
+			t.Errorf("%s: got %dx%d (%v), want %dx%d", spec, cfg.Width, cfg.Height, err, want.X, want.Y)
+		}
+	}
+}
+
+func TestRobustnessBench(t *testing.T) {
+	cover := writeCover(t, 256, 256)
+	bench := NewRobustnessBenchWithProcessors(core.NewGoQRProcessor(), func(strategy core.DCTStrategy) (core.DCTProcessor, error) {
+		return core.NewGoDCTProcessor(), nil
+	})
+
+	var chains []Chain
+	for _, spec := range []string{"none", "jpeg:75", "crop:8"} {
+		chain, err := ParseChain(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chains = append(chains, chain)
+	}
+	results, err := bench.Run(cover, "survives or not", []core.DCTStrategy{core.DCTStrategySingle, core.DCTStrategyQIM}, chains)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("expected 6 results, got %d", len(results))
+	}
+
+	outcome := map[string]Result{}
+	for _, r := range results {
+		outcome[r.Strategy+" "+r.Attack] = r
+	}
+	for key, decoded := range map[string]bool{
+		"single-coefficient none":    true,
+		"qim-lattice none":           true,
+		"qim-lattice jpeg:75":        true,
+		"single-coefficient jpeg:75": false,
+		"qim-lattice crop:8":         false,
+	} {
+		r := outcome[key]
+		if r.Decoded != decoded {
+			t.Errorf("%s: decoded=%v, want %v (BER %.4f, %s)", key, r.Decoded, decoded, r.BER, r.Error)
+		}
+		if decoded && r.BER > 0.05 {
+			t.Errorf("%s: decoded with BER %.4f", key, r.BER)
+		}
+	}
+}
@@ -6,76 +6,847 @@ package core
 /*
 #cgo CFLAGS: -I/usr/include
 #cgo LDFLAGS: -ljpeg
+#include <setjmp.h>
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
 #include <jpeglib.h>
+#include <jerror.h>
 
-// Forward declarations of the C functions we'll call
-int embed_qr_in_dct_single(const char *input_path, const char *output_path, unsigned char *qr_data, int qr_size);
-int embed_qr_in_dct_multi(const char *input_path, const char *output_path, unsigned char *qr_data, int qr_size);
-void extract_qr_from_dct_single(const char *input_path, unsigned char *qr_data, int qr_size);
-void extract_qr_from_dct_multi(const char *input_path, unsigned char *qr_data, int qr_size);
+// crypt_error_mgr replaces jpeg_std_error's error_exit, which calls exit()
+// and takes the whole process down, with a longjmp back to the function
+// that called into libjpeg. The library's message is kept for the Go error.
+struct crypt_error_mgr {
+    struct jpeg_error_mgr pub;
+    jmp_buf setjmp_buffer;
+    char *message;   // JMSG_LENGTH_MAX bytes owned by the caller
+    int strict;      // treat corrupt-data warnings as errors
+};
+
+static void crypt_error_exit(j_common_ptr cinfo) {
+    struct crypt_error_mgr *err = (struct crypt_error_mgr *)cinfo->err;
+    (*cinfo->err->format_message)(cinfo, err->message);
+    longjmp(err->setjmp_buffer, 1);
+}
+
+// crypt_emit_message fails on warnings in strict mode, like TurboJPEG's
+// TJFLAG_STOPONWARNING: libjpeg otherwise fills corrupt or truncated data
+// with zeros and carries on. Warnings are counted, never printed.
+static void crypt_emit_message(j_common_ptr cinfo, int msg_level) {
+    struct crypt_error_mgr *err = (struct crypt_error_mgr *)cinfo->err;
+    if (msg_level < 0 && err->strict) {
+        crypt_error_exit(cinfo);
+    }
+    if (msg_level < 0) {
+        err->pub.num_warnings++;
+    }
+}
+
+static struct jpeg_error_mgr *crypt_std_error(struct crypt_error_mgr *err, char *message, int strict) {
+    jpeg_std_error(&err->pub);
+    err->pub.error_exit = crypt_error_exit;
+    err->pub.emit_message = crypt_emit_message;
+    err->message = message;
+    err->strict = strict;
+    message[0] = '\0';
+    return &err->pub;
+}
+
+// release destroys the libjpeg objects of one call. Destroying is valid in
+// any state, also after a longjmp, so nothing is finished half-way.
+static void release(j_decompress_ptr in, j_compress_ptr out) {
+    if (in != NULL) {
+        jpeg_destroy_decompress(in);
+    }
+    if (out != NULL) {
+        jpeg_destroy_compress(out);
+    }
+}
+
+// crypt_destination_mgr collects the output in a malloc'd buffer that grows
+// as needed. Unlike jpeg_mem_dest's, the buffer belongs to the caller on
+// every path, so a longjmp out of the compressor cannot leak it.
+struct crypt_destination_mgr {
+    struct jpeg_destination_mgr pub;
+    unsigned char **buffer;  // freed by the caller, also after an error
+    unsigned long *size;     // bytes written, set once compression finishes
+    size_t allocated;
+};
+
+static void crypt_init_destination(j_compress_ptr cinfo) {
+    struct crypt_destination_mgr *dest = (struct crypt_destination_mgr *)cinfo->dest;
+    dest->pub.next_output_byte = *dest->buffer;
+    dest->pub.free_in_buffer = dest->allocated;
+}
+
+static boolean crypt_empty_output_buffer(j_compress_ptr cinfo) {
+    struct crypt_destination_mgr *dest = (struct crypt_destination_mgr *)cinfo->dest;
+    unsigned char *grown = realloc(*dest->buffer, dest->allocated * 2);
+    if (grown == NULL) {
+        ERREXIT1(cinfo, JERR_OUT_OF_MEMORY, 10);
+    }
+    *dest->buffer = grown;
+    dest->pub.next_output_byte = grown + dest->allocated;
+    dest->pub.free_in_buffer = dest->allocated;
+    dest->allocated *= 2;
+    return TRUE;
+}
+
+static void crypt_term_destination(j_compress_ptr cinfo) {
+    struct crypt_destination_mgr *dest = (struct crypt_destination_mgr *)cinfo->dest;
+    *dest->size = dest->allocated - dest->pub.free_in_buffer;
+}
+
+// crypt_mem_dest sends the output of cinfo to *buffer, which must be NULL
+static void crypt_mem_dest(j_compress_ptr cinfo, struct crypt_destination_mgr *dest,
+                           unsigned char **buffer, unsigned long *size) {
+    dest->allocated = 65536;
+    *buffer = malloc(dest->allocated);
+    if (*buffer == NULL) {
+        ERREXIT1(cinfo, JERR_OUT_OF_MEMORY, 10);
+    }
+    dest->buffer = buffer;
+    dest->size = size;
+    *size = 0;
+    dest->pub.init_destination = crypt_init_destination;
+    dest->pub.empty_output_buffer = crypt_empty_output_buffer;
+    dest->pub.term_destination = crypt_term_destination;
+    cinfo->dest = &dest->pub;
+}
+
+// save_markers asks libjpeg to keep every APPn and COM segment of the cover
+static void save_markers(j_decompress_ptr cinfo) {
+    jpeg_save_markers(cinfo, JPEG_COM, 0xFFFF);
+    for (int m = 0; m < 16; m++) {
+        jpeg_save_markers(cinfo, JPEG_APP0 + m, 0xFFFF);
+    }
+}
+
+// copy_markers writes the saved segments into the output, like jpegtran's
+// jcopy_markers_execute. It must run right after jpeg_write_coefficients.
+// The JFIF and Adobe markers libjpeg writes itself are not doubled.
+static void copy_markers(j_decompress_ptr in, j_compress_ptr out) {
+    for (jpeg_saved_marker_ptr m = in->marker_list; m != NULL; m = m->next) {
+        if (out->write_JFIF_header && m->marker == JPEG_APP0 &&
+            m->data_length >= 5 && memcmp(m->data, "JFIF", 5) == 0) {
+            continue;
+        }
+        if (out->write_Adobe_marker && m->marker == JPEG_APP0 + 14 &&
+            m->data_length >= 5 && memcmp(m->data, "Adobe", 5) == 0) {
+            continue;
+        }
+        jpeg_write_marker(out, m->marker, m->data, m->data_length);
+    }
+}
+
+// keep_coding gives the output the scan mode, entropy coder and restart
+// interval of the cover, which jpeg_copy_critical_parameters leaves at the
+// baseline defaults. A progressive cover gets libjpeg's standard script.
+static void keep_coding(j_decompress_ptr in, j_compress_ptr out) {
+    out->arith_code = in->arith_code;
+    out->restart_interval = in->restart_interval;
+    if (in->progressive_mode) {
+        jpeg_simple_progression(out);
+    }
+}
+
+// extract_data_directly_from_dct extracts data directly from DCT coefficients (high capacity)
+int extract_data_directly_from_dct(const unsigned char* jpeg, unsigned long jpeg_size, unsigned char* data, int max_data_size, char* message) {
+    struct jpeg_decompress_struct cinfo;
+    struct crypt_error_mgr jerr;
+
+    // Initialize JPEG decompression
+    memset(&cinfo, 0, sizeof(cinfo));
+    cinfo.err = crypt_std_error(&jerr, message, 0);
+    if (setjmp(jerr.setjmp_buffer)) {
+        release(&cinfo, NULL);
+        return 5;
+    }
+    jpeg_create_decompress(&cinfo);
+    jpeg_mem_src(&cinfo, jpeg, jpeg_size);
+    jpeg_read_header(&cinfo, TRUE);
+
+    // Read DCT coefficients
+    jvirt_barray_ptr *coef_ptrs = jpeg_read_coefficients(&cinfo);
+    if (!coef_ptrs) {
+        snprintf(message, JMSG_LENGTH_MAX, "failed to read DCT coefficients");
+        release(&cinfo, NULL);
+        return 2;
+    }
+
+    // Extract data bits from DCT coefficients
+    int bit_index = 0;
+    int coeff_positions[] = {1, 2, 3, 4, 5, 6};  // Same AC coefficients used during embedding
+    int coefficients_per_block = 6;
+    int max_bits = max_data_size * 8;
+
+    // Clear output buffer
+    memset(data, 0, max_data_size);
+
+    for (JDIMENSION by = 0; by < cinfo.comp_info[0].height_in_blocks && bit_index < max_bits; by++) {
+        JBLOCKARRAY block_row = (JBLOCKARRAY)(*cinfo.mem->access_virt_barray)(
+            (j_common_ptr)&cinfo, coef_ptrs[0], by, 1, FALSE);
+
+        for (JDIMENSION bx = 0; bx < cinfo.comp_info[0].width_in_blocks && bit_index < max_bits; bx++) {
+            // Extract up to 6 bits per block from different AC coefficients
+            for (int coeff_idx = 0; coeff_idx < coefficients_per_block && bit_index < max_bits; coeff_idx++) {
+                int coeff_pos = coeff_positions[coeff_idx];
+
+                // Extract the LSB of this coefficient
+                unsigned char bit = block_row[0][bx][coeff_pos] & 1;
+
+                // Store bit into output buffer
+                if (bit == 1) {
+                    data[bit_index / 8] |= 1 << (7 - (bit_index % 8)); // Set bit
+                } else {
+                    data[bit_index / 8] &= ~(1 << (7 - (bit_index % 8))); // Clear bit
+                }
+
+                bit_index++;
+            }
+        }
+    }
+
+    // Cleanup
+    jpeg_finish_decompress(&cinfo);
+    release(&cinfo, NULL);
+    return 0;
+}
+
+// embed_data_directly_in_dct embeds data directly into DCT coefficients (high capacity)
+int embed_data_directly_in_dct(const unsigned char* jpeg, unsigned long jpeg_size,
+                               unsigned char** out, unsigned long* out_size,
+                               const unsigned char* data, int data_size, char* message) {
+    struct jpeg_decompress_struct cinfo;
+    struct jpeg_compress_struct cinfo_out;
+    struct crypt_error_mgr jerr;
+    struct crypt_destination_mgr dest;
+
+    // Initialize JPEG decompression and compression. Both share the error
+    // manager; a corrupt cover fails instead of producing a corrupt output.
+    memset(&cinfo, 0, sizeof(cinfo));
+    memset(&cinfo_out, 0, sizeof(cinfo_out));
+    cinfo.err = crypt_std_error(&jerr, message, 1);
+    cinfo_out.err = &jerr.pub;
+    if (setjmp(jerr.setjmp_buffer)) {
+        release(&cinfo, &cinfo_out);
+        return 5;
+    }
+    jpeg_create_decompress(&cinfo);
+    jpeg_create_compress(&cinfo_out);
+    jpeg_mem_src(&cinfo, jpeg, jpeg_size);
+    save_markers(&cinfo);
+    jpeg_read_header(&cinfo, TRUE);
+
+    // Read DCT coefficients
+    jvirt_barray_ptr *coef_ptrs = jpeg_read_coefficients(&cinfo);
+    if (!coef_ptrs) {
+        snprintf(message, JMSG_LENGTH_MAX, "failed to read DCT coefficients");
+        release(&cinfo, &cinfo_out);
+        return 2;
+    }
+
+    // Initialize compression for output
+    jpeg_copy_critical_parameters(&cinfo, &cinfo_out);
+    keep_coding(&cinfo, &cinfo_out);
+
+    // Calculate capacity and embed data
+    int total_blocks = cinfo.comp_info[0].height_in_blocks * cinfo.comp_info[0].width_in_blocks;
+    int coefficients_per_block = 6;  // Use coefficients 1,2,3,4,5,6 (skip DC coefficient 0)
+    int available_bits = total_blocks * coefficients_per_block;
+    int required_bits = data_size * 8;
+
+    if (required_bits > available_bits) {
+        snprintf(message, JMSG_LENGTH_MAX, "data too large for direct DCT capacity: need %d bits, have %d", required_bits, available_bits);
+        release(&cinfo, &cinfo_out);
+        return 4;
+    }
+
+    // Embed data bits into DCT coefficients
+    int bit_index = 0;
+    int coeff_positions[] = {1, 2, 3, 4, 5, 6};  // AC coefficients to use
+
+    for (JDIMENSION by = 0; by < cinfo.comp_info[0].height_in_blocks && bit_index < required_bits; by++) {
+        JBLOCKARRAY block_row = (JBLOCKARRAY)(*cinfo.mem->access_virt_barray)(
+            (j_common_ptr)&cinfo, coef_ptrs[0], by, 1, TRUE);
+
+        for (JDIMENSION bx = 0; bx < cinfo.comp_info[0].width_in_blocks && bit_index < required_bits; bx++) {
+            // Embed up to 6 bits per block using different AC coefficients
+            for (int coeff_idx = 0; coeff_idx < coefficients_per_block && bit_index < required_bits; coeff_idx++) {
+                int coeff_pos = coeff_positions[coeff_idx];
+
+                // Get the bit to embed
+                unsigned char bit = (data[bit_index / 8] >> (7 - (bit_index % 8))) & 1;
+
+                // Modify the LSB of this coefficient
+                if (bit == 1) {
+                    block_row[0][bx][coeff_pos] |= 1;  // Set LSB to 1
+                } else {
+                    block_row[0][bx][coeff_pos] &= ~1; // Set LSB to 0
+                }
+
+                bit_index++;
+            }
+        }
+    }
+
+    crypt_mem_dest(&cinfo_out, &dest, out, out_size);
+
+    // Write modified coefficients
+    jpeg_write_coefficients(&cinfo_out, coef_ptrs);
+    copy_markers(&cinfo, &cinfo_out);
+
+    // Cleanup
+    jpeg_finish_compress(&cinfo_out);
+    jpeg_finish_decompress(&cinfo);
+    release(&cinfo, &cinfo_out);
+    return 0;
+}
+
+// Embed QR Code into DCT Coefficients (Single Coefficient Strategy)
+// Returns 0 on success, non-zero on error
+int embed_qr_in_dct_single(const unsigned char *jpeg, unsigned long jpeg_size, unsigned char **out, unsigned long *out_size,
+                           unsigned char *qr_data, int qr_size, char *message) {
+    struct jpeg_decompress_struct cinfo;
+    struct jpeg_compress_struct cinfo_out;
+    struct crypt_error_mgr jerr;
+    struct crypt_destination_mgr dest;
+
+    // Initialize JPEG decompression and compression. Both share the error
+    // manager; a corrupt cover fails instead of producing a corrupt output.
+    memset(&cinfo, 0, sizeof(cinfo));
+    memset(&cinfo_out, 0, sizeof(cinfo_out));
+    cinfo.err = crypt_std_error(&jerr, message, 1);
+    cinfo_out.err = &jerr.pub;
+    if (setjmp(jerr.setjmp_buffer)) {
+        release(&cinfo, &cinfo_out);
+        return 5;
+    }
+    jpeg_create_decompress(&cinfo);
+    jpeg_create_compress(&cinfo_out);
+    jpeg_mem_src(&cinfo, jpeg, jpeg_size);
+    save_markers(&cinfo);
+    jpeg_read_header(&cinfo, TRUE);
+
+    // Read DCT coefficients
+    jvirt_barray_ptr *coef_ptrs = jpeg_read_coefficients(&cinfo);
+    if (!coef_ptrs) {
+        snprintf(message, JMSG_LENGTH_MAX, "failed to read DCT coefficients");
+        release(&cinfo, &cinfo_out);
+        return 2;
+    }
+
+    // Initialize compression for output
+    jpeg_copy_critical_parameters(&cinfo, &cinfo_out);
+    keep_coding(&cinfo, &cinfo_out);
+
+    // Calculate available capacity
+    int total_blocks = cinfo.comp_info[0].height_in_blocks * cinfo.comp_info[0].width_in_blocks;
+    int available_bits = total_blocks;  // One bit per block
+    int required_bits = qr_size * 8;
+
+    if (required_bits > available_bits) {
+        snprintf(message, JMSG_LENGTH_MAX, "QR data too large for image capacity: need %d bits, have %d", required_bits, available_bits);
+        release(&cinfo, &cinfo_out);
+        return 4;
+    }
+
+    // Embed QR code into mid-frequency DCT coefficients with simple redundancy
+    // Use stronger embedding instead of complex redundancy for now
+    int bit_index = 0;
+
+    for (JDIMENSION by = 0; by < cinfo.comp_info[0].height_in_blocks && bit_index < required_bits; by++) {
+        JBLOCKARRAY block_row = (JBLOCKARRAY)(*cinfo.mem->access_virt_barray)(
+            (j_common_ptr)&cinfo, coef_ptrs[0], by, 1, TRUE);
+
+        for (JDIMENSION bx = 0; bx < cinfo.comp_info[0].width_in_blocks && bit_index < required_bits; bx++) {
+            unsigned char bit = (qr_data[bit_index / 8] >> (7 - (bit_index % 8))) & 1;
+
+            			// Use low-frequency coefficient (position 1) for better robustness
+			int dct_pos = 1;
+
+            // Simple LSB embedding (traditional approach)
+            if (bit == 1) {
+                block_row[0][bx][dct_pos] |= 1;  // Set LSB to 1
+            } else {
+                block_row[0][bx][dct_pos] &= ~1; // Set LSB to 0
+            }
+
+            bit_index++;
+        }
+    }
+
+    // Validate the first bits before writing anything out
+    for (int validate_bit = 0; validate_bit < 10 && validate_bit < required_bits; validate_bit++) {
+        JDIMENSION val_by = validate_bit / cinfo.comp_info[0].width_in_blocks;
+        JDIMENSION val_bx = validate_bit % cinfo.comp_info[0].width_in_blocks;
+
+        JBLOCKARRAY val_block_row = (JBLOCKARRAY)(*cinfo.mem->access_virt_barray)(
+            (j_common_ptr)&cinfo, coef_ptrs[0], val_by, 1, FALSE);
+
+        unsigned char expected_bit = (qr_data[validate_bit / 8] >> (7 - (validate_bit % 8))) & 1;
+        unsigned char actual_bit = val_block_row[0][val_bx][1] & 1;
+        if (expected_bit != actual_bit) {
+            snprintf(message, JMSG_LENGTH_MAX, "embedding validation failed at bit %d: expected %d, got %d",
+                validate_bit, expected_bit, actual_bit);
+            release(&cinfo, &cinfo_out);
+            return 6;
+        }
+    }
+
+    crypt_mem_dest(&cinfo_out, &dest, out, out_size);
+
+    // Write modified coefficients
+    jpeg_write_coefficients(&cinfo_out, coef_ptrs);
+    copy_markers(&cinfo, &cinfo_out);
+
+    // Cleanup
+    jpeg_finish_compress(&cinfo_out);
+    jpeg_finish_decompress(&cinfo);
+    release(&cinfo, &cinfo_out);
+    return 0;
+}
+
+// Embed QR Code into DCT Coefficients (Multi-Coefficient Strategy - 4x capacity)
+// Returns 0 on success, non-zero on error
+int embed_qr_in_dct_multi(const unsigned char *jpeg, unsigned long jpeg_size, unsigned char **out, unsigned long *out_size,
+                           unsigned char *qr_data, int qr_size, char *message) {
+    struct jpeg_decompress_struct cinfo;
+    struct jpeg_compress_struct cinfo_out;
+    struct crypt_error_mgr jerr;
+    struct crypt_destination_mgr dest;
+
+    // Initialize JPEG decompression and compression. Both share the error
+    // manager; a corrupt cover fails instead of producing a corrupt output.
+    memset(&cinfo, 0, sizeof(cinfo));
+    memset(&cinfo_out, 0, sizeof(cinfo_out));
+    cinfo.err = crypt_std_error(&jerr, message, 1);
+    cinfo_out.err = &jerr.pub;
+    if (setjmp(jerr.setjmp_buffer)) {
+        release(&cinfo, &cinfo_out);
+        return 5;
+    }
+    jpeg_create_decompress(&cinfo);
+    jpeg_create_compress(&cinfo_out);
+    jpeg_mem_src(&cinfo, jpeg, jpeg_size);
+    save_markers(&cinfo);
+    jpeg_read_header(&cinfo, TRUE);
+
+    // Read DCT coefficients
+    jvirt_barray_ptr *coef_ptrs = jpeg_read_coefficients(&cinfo);
+    if (!coef_ptrs) {
+        snprintf(message, JMSG_LENGTH_MAX, "failed to read DCT coefficients");
+        release(&cinfo, &cinfo_out);
+        return 2;
+    }
+
+    // Initialize compression for output
+    jpeg_copy_critical_parameters(&cinfo, &cinfo_out);
+    keep_coding(&cinfo, &cinfo_out);
+
+    // Calculate available capacity (4 bits per block for multi-coefficient)
+    int total_blocks = cinfo.comp_info[0].height_in_blocks * cinfo.comp_info[0].width_in_blocks;
+    int available_bits = total_blocks * 4;  // 4 coefficients per block
+    int required_bits = qr_size * 8;
+
+    if (required_bits > available_bits) {
+        snprintf(message, JMSG_LENGTH_MAX, "QR data too large for image capacity (multi-coeff): need %d bits, have %d", required_bits, available_bits);
+        release(&cinfo, &cinfo_out);
+        return 4;
+    }
+
+    // Embed QR code into mid-frequency DCT coefficients using 4 coefficients per block
+    int bit_index = 0;
+    int coeff_positions[4] = {4, 5, 6, 7};  // Mid-frequency positions
+
+    for (JDIMENSION by = 0; by < cinfo.comp_info[0].height_in_blocks && bit_index < required_bits; by++) {
+        JBLOCKARRAY block_row = (JBLOCKARRAY)(*cinfo.mem->access_virt_barray)(
+            (j_common_ptr)&cinfo, coef_ptrs[0], by, 1, TRUE);
+
+        for (JDIMENSION bx = 0; bx < cinfo.comp_info[0].width_in_blocks && bit_index < required_bits; bx++) {
+            // Embed up to 4 bits per block using different coefficients
+            for (int coeff_idx = 0; coeff_idx < 4 && bit_index < required_bits; coeff_idx++) {
+                unsigned char bit = (qr_data[bit_index / 8] >> (7 - (bit_index % 8))) & 1;
+                int dct_pos = coeff_positions[coeff_idx];
+
+                // Simple LSB embedding (traditional approach)
+                if (bit == 1) {
+                    block_row[0][bx][dct_pos] |= 1;  // Set LSB to 1
+                } else {
+                    block_row[0][bx][dct_pos] &= ~1; // Set LSB to 0
+                }
+
+                bit_index++;
+            }
+        }
+    }
+
+    crypt_mem_dest(&cinfo_out, &dest, out, out_size);
+
+    // Write modified coefficients
+    jpeg_write_coefficients(&cinfo_out, coef_ptrs);
+    copy_markers(&cinfo, &cinfo_out);
+
+    // Cleanup
+    jpeg_finish_compress(&cinfo_out);
+    jpeg_finish_decompress(&cinfo);
+    release(&cinfo, &cinfo_out);
+    return 0;
+}
+
+// Extract QR Code from DCT Coefficients (Single Coefficient Strategy)
+int extract_qr_from_dct_single(const unsigned char *jpeg, unsigned long jpeg_size, unsigned char *qr_data, int qr_size, char *message) {
+    struct jpeg_decompress_struct cinfo;
+    struct crypt_error_mgr jerr;
+
+    // Initialize JPEG decompression
+    memset(&cinfo, 0, sizeof(cinfo));
+    cinfo.err = crypt_std_error(&jerr, message, 0);
+    if (setjmp(jerr.setjmp_buffer)) {
+        release(&cinfo, NULL);
+        return 5;
+    }
+    jpeg_create_decompress(&cinfo);
+    jpeg_mem_src(&cinfo, jpeg, jpeg_size);
+    jpeg_read_header(&cinfo, TRUE);
+
+    // Read DCT coefficients
+    jvirt_barray_ptr *coef_ptrs = jpeg_read_coefficients(&cinfo);
+    if (!coef_ptrs) {
+        snprintf(message, JMSG_LENGTH_MAX, "failed to read DCT coefficients");
+        release(&cinfo, NULL);
+        return 2;
+    }
+
+    // Clear output buffer first (critical fix!)
+    memset(qr_data, 0, qr_size);
+
+    // Extract QR code bits from mid-frequency DCT coefficients with stronger detection
+    int bit_index = 0;
+    for (JDIMENSION by = 0; by < cinfo.comp_info[0].height_in_blocks; by++) {
+        JBLOCKARRAY block_row = (JBLOCKARRAY)(*cinfo.mem->access_virt_barray)(
+            (j_common_ptr)&cinfo, coef_ptrs[0], by, 1, FALSE);
+
+        for (JDIMENSION bx = 0; bx < cinfo.comp_info[0].width_in_blocks; bx++) {
+            if (bit_index >= qr_size * 8) break;  // Stop when enough bits are extracted
+
+            			// Extract LSB from low-frequency coefficient for better robustness
+			int dct_pos = 1; // Low-frequency coefficient
+            int coeff_value = block_row[0][bx][dct_pos];
+            unsigned char bit = coeff_value & 1; // Extract LSB
+
+            // Store bit into output buffer
+            if (bit == 1)
+                qr_data[bit_index / 8] |= 1 << (7 - (bit_index % 8)); // Set bit
+            else
+                qr_data[bit_index / 8] &= ~(1 << (7 - (bit_index % 8))); // Clear bit
+
+            bit_index++;
+        }
+    }
+
+    // Cleanup
+    jpeg_finish_decompress(&cinfo);
+    release(&cinfo, NULL);
+    return 0;
+}
+
+// Extract QR Code from DCT Coefficients (Multi-Coefficient Strategy)
+int extract_qr_from_dct_multi(const unsigned char *jpeg, unsigned long jpeg_size, unsigned char *qr_data, int qr_size, char *message) {
+    struct jpeg_decompress_struct cinfo;
+    struct crypt_error_mgr jerr;
+
+    // Initialize JPEG decompression
+    memset(&cinfo, 0, sizeof(cinfo));
+    cinfo.err = crypt_std_error(&jerr, message, 0);
+    if (setjmp(jerr.setjmp_buffer)) {
+        release(&cinfo, NULL);
+        return 5;
+    }
+    jpeg_create_decompress(&cinfo);
+    jpeg_mem_src(&cinfo, jpeg, jpeg_size);
+    jpeg_read_header(&cinfo, TRUE);
+
+    // Read DCT coefficients
+    jvirt_barray_ptr *coef_ptrs = jpeg_read_coefficients(&cinfo);
+    if (!coef_ptrs) {
+        snprintf(message, JMSG_LENGTH_MAX, "failed to read DCT coefficients");
+        release(&cinfo, NULL);
+        return 2;
+    }
+
+    // Clear output buffer first (critical fix!)
+    memset(qr_data, 0, qr_size);
+
+    // Extract QR code bits from mid-frequency DCT coefficients (multi-coefficient)
+    int bit_index = 0;
+    int required_bits = qr_size * 8;
+    int coeff_positions[4] = {4, 5, 6, 7};  // Same positions used during embedding
+
+    for (JDIMENSION by = 0; by < cinfo.comp_info[0].height_in_blocks; by++) {
+        JBLOCKARRAY block_row = (JBLOCKARRAY)(*cinfo.mem->access_virt_barray)(
+            (j_common_ptr)&cinfo, coef_ptrs[0], by, 1, FALSE);
+
+        for (JDIMENSION bx = 0; bx < cinfo.comp_info[0].width_in_blocks; bx++) {
+            if (bit_index >= required_bits) break;  // Stop when enough bits are extracted
+
+            // Extract up to 4 bits per block from different coefficients
+            for (int coeff_idx = 0; coeff_idx < 4 && bit_index < required_bits; coeff_idx++) {
+                int dct_pos = coeff_positions[coeff_idx];
+                unsigned char bit = block_row[0][bx][dct_pos] & 1; // Extract LSB
+
+                // Store bit into output buffer
+                if (bit == 1)
+                    qr_data[bit_index / 8] |= 1 << (7 - (bit_index % 8)); // Set bit
+                else
+                    qr_data[bit_index / 8] &= ~(1 << (7 - (bit_index % 8))); // Clear bit
+
+                bit_index++;
+            }
+        }
+    }
+
+    // Cleanup
+    jpeg_finish_decompress(&cinfo);
+    release(&cinfo, NULL);
+    return 0;
+}
 */
 import "C"
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"os"
 	"unsafe"
 )
 
+// libjpegError turns the return code of a C function and the message it
+// left in buf into an error
+func libjpegError(op string, code C.int, buf []byte) error {
+	if code == 0 {
+		return nil
+	}
+	message, _, _ := bytes.Cut(buf, []byte{0})
+	return fmt.Errorf("libjpeg %s failed with code %d: %s", op, int(code), message)
+}
+
+// messageBuffer returns room for a libjpeg message and its C pointer
+func messageBuffer() ([]byte, *C.char) {
+	buf := make([]byte, C.JMSG_LENGTH_MAX)
+	return buf, (*C.char)(unsafe.Pointer(&buf[0]))
+}
+
+// cBytes passes data to C for the length of one call, NULL when empty
+func cBytes(data []byte) *C.uchar {
+	if len(data) == 0 {
+		return nil
+	}
+	return (*C.uchar)(unsafe.Pointer(&data[0]))
+}
+
 // CgoDCTProcessor implements DCTProcessor interface using CGO
-type CgoDCTProcessor struct{}
+type CgoDCTProcessor struct {
+	key    []byte    // walk key for DCTStrategyPermuted
+	params DCTParams // threshold, QIM step and components
+}
 
 func NewCgoDCTProcessor() *CgoDCTProcessor {
 	return &CgoDCTProcessor{}
 }
 
-// EmbedData embeds data into DCT coefficients using CGO
+// NewCgoDCTProcessorWithKey creates a processor able to use DCTStrategyPermuted
+func NewCgoDCTProcessorWithKey(key []byte) *CgoDCTProcessor {
+	return &CgoDCTProcessor{key: key}
+}
+
+// NewCgoDCTProcessorWithParams creates a processor with non-default
+// strategy parameters
+func NewCgoDCTProcessorWithParams(params DCTParams) *CgoDCTProcessor {
+	return &CgoDCTProcessor{params: params}
+}
+
+// goProcessor is used for the strategies computed in Go; the coefficient
+// layout is shared with the C functions
+func (p *CgoDCTProcessor) goProcessor() *GoDCTProcessor {
+	return &GoDCTProcessor{key: p.key, params: p.params}
+}
+
+// inGo reports whether strategy is computed in Go: the keyed walk, QIM,
+// the content dependent strategies and anything beyond the luminance,
+// which the C functions never touch
+func (p *CgoDCTProcessor) inGo(strategy DCTStrategy) bool {
+	return strategy == DCTStrategyPermuted || strategy == DCTStrategyQIM ||
+		strategy.DependsOnContent() || !p.params.Components.LumaOnly()
+}
+
+// EmbedF5Stream is EmbedDataStream with DCTStrategyF5, which always runs
+// in Go, reporting the statistics of the matrix embedding
+func (p *CgoDCTProcessor) EmbedF5Stream(r io.Reader, w io.Writer, data []byte) (*F5Stats, error) {
+	return p.goProcessor().EmbedF5Stream(r, w, data)
+}
+
+// EmbedData embeds data into DCT coefficients using CGO. The cover is read
+// whole before anything is written, so outputPath may be inputPath.
 func (p *CgoDCTProcessor) EmbedData(inputPath, outputPath string, data []byte, strategy DCTStrategy) error {
-	// Convert paths to C strings
-	cInputPath := C.CString(inputPath)
-	cOutputPath := C.CString(outputPath)
-	defer C.free(unsafe.Pointer(cInputPath))
-	defer C.free(unsafe.Pointer(cOutputPath))
+	if len(data) == 0 {
+		return fmt.Errorf("data cannot be empty")
+	}
+	if p.inGo(strategy) {
+		return p.goProcessor().EmbedData(inputPath, outputPath, data, strategy)
+	}
+
+	cover, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", inputPath, err)
+	}
+	stego, err := p.embed(cover, data, strategy)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, stego, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+	return nil
+}
+
+// EmbedDataStream is EmbedData for a JPEG read from r, written to w
+func (p *CgoDCTProcessor) EmbedDataStream(r io.Reader, w io.Writer, data []byte, strategy DCTStrategy) error {
+	if len(data) == 0 {
+		return fmt.Errorf("data cannot be empty")
+	}
+	if p.inGo(strategy) {
+		return p.goProcessor().EmbedDataStream(r, w, data, strategy)
+	}
+
+	cover, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read JPEG: %w", err)
+	}
+	stego, err := p.embed(cover, data, strategy)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(stego); err != nil {
+		return fmt.Errorf("failed to write JPEG: %w", err)
+	}
+	return nil
+}
 
+// embed runs the C embedding of strategy on the JPEG in cover, through
+// libjpeg's memory source and a growing memory destination
+func (p *CgoDCTProcessor) embed(cover, data []byte, strategy DCTStrategy) ([]byte, error) {
+	buf, message := messageBuffer()
+	var out *C.uchar
+	var outSize C.ulong
+	defer func() { C.free(unsafe.Pointer(out)) }()
+
+	in, inSize := cBytes(cover), C.ulong(len(cover))
+	cData := cBytes(data)
 	var result C.int
 	switch strategy {
 	case DCTStrategyMulti:
-		result = C.embed_qr_in_dct_multi(cInputPath, cOutputPath, (*C.uchar)(unsafe.Pointer(&data[0])), C.int(len(data)))
+		result = C.embed_qr_in_dct_multi(in, inSize, &out, &outSize, cData, C.int(len(data)), message)
+	case DCTStrategyDirect:
+		result = C.embed_data_directly_in_dct(in, inSize, &out, &outSize, cData, C.int(len(data)), message)
 	default:
-		result = C.embed_qr_in_dct_single(cInputPath, cOutputPath, (*C.uchar)(unsafe.Pointer(&data[0])), C.int(len(data)))
+		result = C.embed_qr_in_dct_single(in, inSize, &out, &outSize, cData, C.int(len(data)), message)
 	}
-
-	if result != 0 {
-		return fmt.Errorf("DCT embedding failed with code %d (%s strategy)", int(result), strategy.String())
+	if err := libjpegError("embedding", result, buf); err != nil {
+		return nil, err
 	}
-
-	return nil
+	return C.GoBytes(unsafe.Pointer(out), C.int(outSize)), nil
 }
 
 // ExtractData extracts data from DCT coefficients using CGO
 func (p *CgoDCTProcessor) ExtractData(inputPath string, dataSize int, strategy DCTStrategy) ([]byte, error) {
-	// Convert path to C string
-	cInputPath := C.CString(inputPath)
-	defer C.free(unsafe.Pointer(cInputPath))
+	if dataSize <= 0 {
+		return nil, fmt.Errorf("data size must be positive")
+	}
+	if p.inGo(strategy) {
+		return p.goProcessor().ExtractData(inputPath, dataSize, strategy)
+	}
 
-	// Prepare buffer for extracted data
+	jpeg, err := os.ReadFile(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", inputPath, err)
+	}
+	return p.extract(jpeg, dataSize, strategy)
+}
+
+// ExtractDataStream is ExtractData for a JPEG read from r
+func (p *CgoDCTProcessor) ExtractDataStream(r io.Reader, dataSize int, strategy DCTStrategy) ([]byte, error) {
+	if dataSize <= 0 {
+		return nil, fmt.Errorf("data size must be positive")
+	}
+	if p.inGo(strategy) {
+		return p.goProcessor().ExtractDataStream(r, dataSize, strategy)
+	}
+
+	jpeg, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JPEG: %w", err)
+	}
+	return p.extract(jpeg, dataSize, strategy)
+}
+
+// extract runs the C extraction of strategy on the JPEG in jpeg
+func (p *CgoDCTProcessor) extract(jpeg []byte, dataSize int, strategy DCTStrategy) ([]byte, error) {
 	extractedData := make([]byte, dataSize)
 
 	// Call appropriate C function based on strategy
+	buf, message := messageBuffer()
+	in, inSize := cBytes(jpeg), C.ulong(len(jpeg))
+	cData := cBytes(extractedData)
+	var result C.int
 	switch strategy {
 	case DCTStrategyMulti:
-		C.extract_qr_from_dct_multi(cInputPath, (*C.uchar)(unsafe.Pointer(&extractedData[0])), C.int(dataSize))
+		result = C.extract_qr_from_dct_multi(in, inSize, cData, C.int(dataSize), message)
+	case DCTStrategyDirect:
+		result = C.extract_data_directly_from_dct(in, inSize, cData, C.int(dataSize), message)
 	default:
-		C.extract_qr_from_dct_single(cInputPath, (*C.uchar)(unsafe.Pointer(&extractedData[0])), C.int(dataSize))
+		result = C.extract_qr_from_dct_single(in, inSize, cData, C.int(dataSize), message)
+	}
+	if err := libjpegError("extraction", result, buf); err != nil {
+		return nil, err
 	}
 
 	return extractedData, nil
 }
 
-// CalculateCapacity calculates DCT capacity for given dimensions and strategy
+// CalculateCapacity calculates DCT capacity for given dimensions and
+// strategy over the components of the processor, see ComponentSet.Blocks
 func (p *CgoDCTProcessor) CalculateCapacity(width, height int, strategy DCTStrategy) int {
-	dctBlocksX := (width + 7) / 8
-	dctBlocksY := (height + 7) / 8
-	return dctBlocksX * dctBlocksY * strategy.GetCoefficientsPerBit()
+	return p.goProcessor().CalculateCapacity(width, height, strategy)
+}
+
+// CalculateImageCapacity counts the bits strategy can embed in the JPEG at
+// imagePath, counting only the coefficients content dependent strategies use
+func (p *CgoDCTProcessor) CalculateImageCapacity(imagePath string, strategy DCTStrategy) (int, error) {
+	return p.goProcessor().CalculateImageCapacity(imagePath, strategy)
+}
+
+// CalculateStreamCapacity is CalculateImageCapacity for a JPEG read from r
+func (p *CgoDCTProcessor) CalculateStreamCapacity(r io.Reader, strategy DCTStrategy) (int, error) {
+	return p.goProcessor().CalculateStreamCapacity(r, strategy)
+}
+
+// ExtractSoftBits reads bits back as confidences in [-1, 1]
+func (p *CgoDCTProcessor) ExtractSoftBits(inputPath string, bits int, strategy DCTStrategy) ([]float64, error) {
+	return p.goProcessor().ExtractSoftBits(inputPath, bits, strategy)
+}
+
+// ExtractSoftBitsStream is ExtractSoftBits for a JPEG read from r
+func (p *CgoDCTProcessor) ExtractSoftBitsStream(r io.Reader, bits int, strategy DCTStrategy) ([]float64, error) {
+	return p.goProcessor().ExtractSoftBitsStream(r, bits, strategy)
+}
+
+// EmbedRegions embeds into rectangles of blocks, computed in Go
+func (p *CgoDCTProcessor) EmbedRegions(inputPath, outputPath string, regions []BlockRegion, payloads [][]byte, strategy DCTStrategy) error {
+	return p.goProcessor().EmbedRegions(inputPath, outputPath, regions, payloads, strategy)
+}
+
+// ExtractRegions extracts from rectangles of blocks, computed in Go
+func (p *CgoDCTProcessor) ExtractRegions(inputPath string, regions []BlockRegion, dataSize int, strategy DCTStrategy) ([][]byte, error) {
+	return p.goProcessor().ExtractRegions(inputPath, regions, dataSize, strategy)
 }
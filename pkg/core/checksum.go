@@ -0,0 +1,11 @@
+package core
+
+// PayloadChecksum is the shift-xor checksum framing direct payloads and
+// the chunks of a QR grid
+func PayloadChecksum(data []byte) uint32 {
+	var checksum uint32
+	for _, b := range data {
+		checksum = (checksum << 1) ^ uint32(b)
+	}
+	return checksum
+}
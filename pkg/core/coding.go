@@ -0,0 +1,143 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+// ScanMode selects sequential or progressive output
+type ScanMode int
+
+const (
+	ScanKeep ScanMode = iota
+	ScanBaseline
+	ScanProgressive
+)
+
+// EntropyCoder selects Huffman or arithmetic output
+type EntropyCoder int
+
+const (
+	CoderKeep EntropyCoder = iota
+	CoderHuffman
+	CoderArithmetic
+)
+
+// OutputCoding says how the stego image is entropy coded. Both codecs keep
+// the scan mode, entropy coder and restart interval of the cover, so a
+// progressive cover stays progressive; the zero value keeps it that way.
+// The coefficients, and with them the payload, never depend on the coding.
+type OutputCoding struct {
+	Scan    ScanMode
+	Coder   EntropyCoder
+	Restart int // MCUs between restart markers: 0 keeps the cover's, negative removes them
+}
+
+// Keep reports whether c leaves the coding of the cover untouched
+func (c OutputCoding) Keep() bool {
+	return c.Scan == ScanKeep && c.Coder == CoderKeep && c.Restart == 0
+}
+
+// String describes the coding in the form ParseOutputCoding reads
+func (c OutputCoding) String() string {
+	if c.Keep() {
+		return "keep"
+	}
+	var parts []string
+	switch c.Scan {
+	case ScanBaseline:
+		parts = append(parts, "baseline")
+	case ScanProgressive:
+		parts = append(parts, "progressive")
+	}
+	switch c.Coder {
+	case CoderHuffman:
+		parts = append(parts, "huffman")
+	case CoderArithmetic:
+		parts = append(parts, "arithmetic")
+	}
+	switch {
+	case c.Restart < 0:
+		parts = append(parts, "norestart")
+	case c.Restart > 0:
+		parts = append(parts, fmt.Sprintf("restart=%d", c.Restart))
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseOutputCoding parses a comma separated list of "keep", "baseline"
+// (or "sequential"), "progressive", "huffman", "arithmetic", "restart=N"
+// and "norestart". Anything not mentioned keeps the cover's setting.
+func ParseOutputCoding(spec string) (OutputCoding, error) {
+	var c OutputCoding
+	for _, part := range strings.Split(strings.ToLower(spec), ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "" || part == "keep":
+		case part == "baseline" || part == "sequential":
+			c.Scan = ScanBaseline
+		case part == "progressive":
+			c.Scan = ScanProgressive
+		case part == "huffman":
+			c.Coder = CoderHuffman
+		case part == "arithmetic" || part == "arith":
+			c.Coder = CoderArithmetic
+		case part == "norestart":
+			c.Restart = -1
+		case strings.HasPrefix(part, "restart="):
+			n, err := strconv.Atoi(strings.TrimPrefix(part, "restart="))
+			if err != nil || n < 0 || n > 0xFFFF {
+				return OutputCoding{}, fmt.Errorf("invalid restart interval '%s' (0-65535 MCUs)", part)
+			}
+			c.Restart = n
+			if n == 0 {
+				c.Restart = -1
+			}
+		default:
+			return OutputCoding{}, fmt.Errorf("unknown coding '%s' (use keep, baseline, progressive, huffman, arithmetic, restart=N or norestart)", part)
+		}
+	}
+	return c, nil
+}
+
+// apply sets the coding of img. A scan mode change drops the decoded
+// progressive script, so progressive output uses libjpeg's standard one.
+func (c OutputCoding) apply(img *jpegcoef.Image) {
+	switch c.Scan {
+	case ScanBaseline:
+		img.Progressive, img.Scans = false, nil
+	case ScanProgressive:
+		if !img.Progressive {
+			img.Progressive, img.Scans = true, nil
+		}
+	}
+	switch c.Coder {
+	case CoderHuffman:
+		img.Arithmetic = false
+	case CoderArithmetic:
+		img.Arithmetic = true
+	}
+	switch {
+	case c.Restart < 0:
+		img.RestartInterval = 0
+	case c.Restart > 0:
+		img.RestartInterval = c.Restart
+	}
+}
+
+// ApplyOutputCoding rewrites the JPEG at path in place with coding c. Only
+// the entropy coding changes, the coefficients stay bit-exact.
+func ApplyOutputCoding(path string, c OutputCoding) error {
+	if c.Keep() {
+		return nil
+	}
+	img, err := jpegcoef.DecodeFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read DCT coefficients from %s: %w", path, err)
+	}
+	c.apply(img)
+	return img.EncodeFile(path)
+}
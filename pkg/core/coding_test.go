@@ -0,0 +1,120 @@
+package core
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+func TestParseOutputCoding(t *testing.T) {
+	tests := []struct {
+		spec string
+		want OutputCoding
+	}{
+		{"", OutputCoding{}},
+		{"keep", OutputCoding{}},
+		{"progressive", OutputCoding{Scan: ScanProgressive}},
+		{"Baseline, huffman", OutputCoding{Scan: ScanBaseline, Coder: CoderHuffman}},
+		{"arithmetic,restart=8", OutputCoding{Coder: CoderArithmetic, Restart: 8}},
+		{"norestart", OutputCoding{Restart: -1}},
+	}
+	for _, tt := range tests {
+		got, err := ParseOutputCoding(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseOutputCoding(%q) failed: %v", tt.spec, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseOutputCoding(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+		if again, err := ParseOutputCoding(got.String()); err != nil || again != got {
+			t.Errorf("%q does not parse back to %+v", got.String(), got)
+		}
+	}
+	for _, spec := range []string{"lossless", "restart=-2", "restart=70000"} {
+		if _, err := ParseOutputCoding(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+// codingOf returns the coding of the JPEG at path
+func codingOf(t *testing.T, path string) *jpegcoef.Image {
+	t.Helper()
+	img, err := jpegcoef.DecodeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestEmbeddingKeepsCoding(t *testing.T) {
+	covers := map[string]OutputCoding{
+		"Progressive":           {Scan: ScanProgressive},
+		"Arithmetic":            {Coder: CoderArithmetic, Restart: 4},
+		"ProgressiveArithmetic": {Scan: ScanProgressive, Coder: CoderArithmetic},
+	}
+	processors := map[string]DCTProcessor{
+		"Go":       NewGoDCTProcessor(),
+		"Platform": NewServiceFactory().CreateDCTProcessor(),
+	}
+	payload := []byte("progressive")
+	for coverName, coding := range covers {
+		cover := writeTestJPEG(t, 96, 96)
+		if err := ApplyOutputCoding(cover, coding); err != nil {
+			t.Fatalf("ApplyOutputCoding failed: %v", err)
+		}
+		want := codingOf(t, cover)
+		for name, processor := range processors {
+			for _, strategy := range []DCTStrategy{DCTStrategySingle, DCTStrategyMulti, DCTStrategyDirect} {
+				t.Run(coverName+"/"+name+"/"+strategy.String(), func(t *testing.T) {
+					stego := filepath.Join(t.TempDir(), "stego.jpg")
+					if err := processor.EmbedData(cover, stego, payload, strategy); err != nil {
+						t.Fatalf("EmbedData failed: %v", err)
+					}
+					got := codingOf(t, stego)
+					if got.Progressive != want.Progressive || got.Arithmetic != want.Arithmetic || got.RestartInterval != want.RestartInterval {
+						t.Errorf("expected progressive=%v arithmetic=%v restart=%d, got %v %v %d",
+							want.Progressive, want.Arithmetic, want.RestartInterval, got.Progressive, got.Arithmetic, got.RestartInterval)
+					}
+					data, err := NewGoDCTProcessor().ExtractData(stego, len(payload), strategy)
+					if err != nil {
+						t.Fatalf("ExtractData failed: %v", err)
+					}
+					if !bytes.Equal(data, payload) {
+						t.Errorf("expected %q, got %q", payload, data)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestApplyOutputCoding(t *testing.T) {
+	path := writeTestJPEG(t, 64, 64)
+	before := codingOf(t, path)
+
+	if err := ApplyOutputCoding(path, OutputCoding{Scan: ScanProgressive, Coder: CoderArithmetic, Restart: 2}); err != nil {
+		t.Fatalf("ApplyOutputCoding failed: %v", err)
+	}
+	after := codingOf(t, path)
+	if !after.Progressive || !after.Arithmetic || after.RestartInterval != 2 {
+		t.Errorf("expected progressive arithmetic with restart 2, got %v %v %d", after.Progressive, after.Arithmetic, after.RestartInterval)
+	}
+
+	if err := ApplyOutputCoding(path, OutputCoding{Scan: ScanBaseline, Coder: CoderHuffman, Restart: -1}); err != nil {
+		t.Fatalf("ApplyOutputCoding failed: %v", err)
+	}
+	after = codingOf(t, path)
+	if after.Progressive || after.Arithmetic || after.RestartInterval != 0 || after.Scans != nil {
+		t.Errorf("expected baseline Huffman without restarts, got %v %v %d", after.Progressive, after.Arithmetic, after.RestartInterval)
+	}
+	for i := range before.Components {
+		for j := range before.Components[i].Blocks {
+			if before.Components[i].Blocks[j] != after.Components[i].Blocks[j] {
+				t.Fatalf("component %d block %d changed", i, j)
+			}
+		}
+	}
+}
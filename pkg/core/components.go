@@ -0,0 +1,112 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+// ComponentSet selects the JPEG components a strategy embeds into. Bits
+// fill the selected components one after the other: luminance, then Cb,
+// then Cr. The zero value means luminance only, the layout of every image
+// embedded before chroma support.
+type ComponentSet uint8
+
+const (
+	ComponentY ComponentSet = 1 << iota
+	ComponentCb
+	ComponentCr
+
+	ComponentsLuma   = ComponentY
+	ComponentsChroma = ComponentCb | ComponentCr
+	ComponentsAll    = ComponentY | ComponentCb | ComponentCr
+)
+
+var componentNames = [...]string{"y", "cb", "cr"}
+
+// NormalizeComponents returns the set actually used for s: luminance only
+// for the zero value
+func NormalizeComponents(s ComponentSet) ComponentSet {
+	if s&ComponentsAll == 0 {
+		return ComponentsLuma
+	}
+	return s & ComponentsAll
+}
+
+// LumaOnly reports whether s embeds into the luminance alone
+func (s ComponentSet) LumaOnly() bool {
+	return NormalizeComponents(s) == ComponentsLuma
+}
+
+func (s ComponentSet) String() string {
+	s = NormalizeComponents(s)
+	var names []string
+	for i, name := range componentNames {
+		if s&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseComponentSet parses "y", "cb", "cr", a comma separated list of them,
+// "luma", "chroma" or "all". An empty string is luminance only.
+func ParseComponentSet(name string) (ComponentSet, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "luma":
+		return ComponentsLuma, nil
+	case "chroma":
+		return ComponentsChroma, nil
+	case "all":
+		return ComponentsAll, nil
+	}
+	var set ComponentSet
+	for _, part := range strings.Split(strings.ToLower(name), ",") {
+		found := false
+		for i, component := range componentNames {
+			if strings.TrimSpace(part) == component {
+				set |= 1 << i
+				found = true
+			}
+		}
+		if !found {
+			return ComponentsLuma, fmt.Errorf("unknown component '%s' (use y, cb, cr, luma, chroma or all)", part)
+		}
+	}
+	return set, nil
+}
+
+// Blocks estimates the 8x8 blocks s covers in a width x height image. The
+// chroma planes are assumed subsampled 4:2:0, the default of libjpeg and
+// image/jpeg; CalculateImageCapacity reads the real sampling.
+func (s ComponentSet) Blocks(width, height int) int {
+	s = NormalizeComponents(s)
+	blocks := func(w, h int) int { return ((w + 7) / 8) * ((h + 7) / 8) }
+	total := 0
+	if s&ComponentY != 0 {
+		total += blocks(width, height)
+	}
+	for _, c := range []ComponentSet{ComponentCb, ComponentCr} {
+		if s&c != 0 {
+			total += blocks((width+1)/2, (height+1)/2)
+		}
+	}
+	return total
+}
+
+// selectComponents returns the components of img in s, in embedding order
+func selectComponents(img *jpegcoef.Image, s ComponentSet) ([]*jpegcoef.Component, error) {
+	s = NormalizeComponents(s)
+	var out []*jpegcoef.Component
+	for i, name := range componentNames {
+		if s&(1<<i) == 0 {
+			continue
+		}
+		if i >= len(img.Components) {
+			return nil, fmt.Errorf("image has %d component(s), no %s to embed into", len(img.Components), name)
+		}
+		out = append(out, &img.Components[i])
+	}
+	return out, nil
+}
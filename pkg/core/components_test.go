@@ -0,0 +1,116 @@
+package core
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+func TestParseComponentSet(t *testing.T) {
+	cases := map[string]ComponentSet{
+		"":        ComponentsLuma,
+		"luma":    ComponentsLuma,
+		"y":       ComponentsLuma,
+		"chroma":  ComponentsChroma,
+		"cb, cr":  ComponentsChroma,
+		"all":     ComponentsAll,
+		"Y,Cr":    ComponentY | ComponentCr,
+		"y,cb,cr": ComponentsAll,
+	}
+	for name, want := range cases {
+		got, err := ParseComponentSet(name)
+		if err != nil || got != want {
+			t.Errorf("ParseComponentSet(%q) = %v, %v; want %v", name, got, err, want)
+			continue
+		}
+		if again, err := ParseComponentSet(got.String()); err != nil || again != got {
+			t.Errorf("%v does not round trip through %q", got, got.String())
+		}
+	}
+	if _, err := ParseComponentSet("y,alpha"); err == nil {
+		t.Error("expected an error for an unknown component")
+	}
+	if !ComponentSet(0).LumaOnly() || ComponentsAll.LumaOnly() {
+		t.Error("only the zero value and luma should be luminance only")
+	}
+}
+
+func TestImageHeaderRecordsComponents(t *testing.T) {
+	want := ImageHeader{
+		Version:       ImageHeaderVersion,
+		Method:        EmbedMethodDirect,
+		Strategy:      DCTStrategyThreshold,
+		PayloadLength: 4096,
+		Threshold:     6,
+		Components:    ComponentY | ComponentCr,
+	}
+	data, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	got, err := ParseImageHeader(data)
+	if err != nil {
+		t.Fatalf("ParseImageHeader failed: %v", err)
+	}
+	if *got != want {
+		t.Errorf("expected %+v, got %+v", want, *got)
+	}
+}
+
+func TestChromaComponentsRoundTrip(t *testing.T) {
+	cover := writeTestJPEG(t, 128, 128)
+	img, err := jpegcoef.DecodeFile(cover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(img.Components) != 3 {
+		t.Skipf("cover has %d components", len(img.Components))
+	}
+
+	luma, err := NewGoDCTProcessor().CalculateImageCapacity(cover, DCTStrategyMulti)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, set := range []ComponentSet{ComponentsChroma, ComponentsAll} {
+		t.Run(set.String(), func(t *testing.T) {
+			processor := NewGoDCTProcessorWithParams(DCTParams{Components: set})
+			capacity, err := processor.CalculateImageCapacity(cover, DCTStrategyMulti)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if set == ComponentsAll && capacity <= luma {
+				t.Errorf("expected chroma to add to the %d luminance bits, got %d", luma, capacity)
+			}
+
+			// Fill the whole set so the payload spills past the luminance
+			payload := make([]byte, capacity/8)
+			rng := rand.New(rand.NewPCG(3, 4))
+			for i := range payload {
+				payload[i] = byte(rng.Uint32())
+			}
+			stego := filepath.Join(t.TempDir(), "stego.jpg")
+			if err := processor.EmbedData(cover, stego, payload, DCTStrategyMulti); err != nil {
+				t.Fatalf("EmbedData failed: %v", err)
+			}
+			got, err := processor.ExtractData(stego, len(payload), DCTStrategyMulti)
+			if err != nil {
+				t.Fatalf("ExtractData failed: %v", err)
+			}
+			if !bytes.Equal(got, payload) {
+				t.Errorf("payload of %d bytes did not round trip (%d bit errors)", len(payload), bitErrors(got, payload))
+			}
+		})
+	}
+}
+
+func TestQIMRejectsChroma(t *testing.T) {
+	cover := writeTestJPEG(t, 64, 64)
+	processor := NewGoDCTProcessorWithParams(DCTParams{Components: ComponentsAll})
+	stego := filepath.Join(t.TempDir(), "stego.jpg")
+	if err := processor.EmbedData(cover, stego, []byte("qim"), DCTStrategyQIM); err == nil {
+		t.Error("expected QIM to refuse the chroma components")
+	}
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessorsFailCleanlyOnBadImages(t *testing.T) {
+	cover := writeTestJPEG(t, 64, 64)
+	data, err := os.ReadFile(cover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	bad := map[string][]byte{
+		"Truncated": data[:len(data)/2],
+		"Garbage":   bytes.Repeat([]byte("not a jpeg "), 100),
+		"Empty":     nil,
+	}
+	processors := map[string]DCTProcessor{
+		"Go":       NewGoDCTProcessor(),
+		"Platform": NewServiceFactory().CreateDCTProcessor(),
+	}
+	for name, processor := range processors {
+		for badName, content := range bad {
+			for _, strategy := range []DCTStrategy{DCTStrategySingle, DCTStrategyMulti, DCTStrategyDirect} {
+				t.Run(name+"/"+badName+"/"+strategy.String(), func(t *testing.T) {
+					if _, lenient := processor.(*GoDCTProcessor); lenient && badName == "Truncated" {
+						t.Skip("jpegcoef pads a truncated scan with zeros, like libjpeg without strict warnings")
+					}
+					input := filepath.Join(dir, badName+".jpg")
+					if err := os.WriteFile(input, content, 0o644); err != nil {
+						t.Fatal(err)
+					}
+					output := filepath.Join(t.TempDir(), "stego.jpg")
+					if err := processor.EmbedData(input, output, []byte("payload"), strategy); err == nil {
+						t.Error("expected an embedding error")
+					}
+					if _, err := os.Stat(output); err == nil {
+						t.Error("failed embedding left an output file")
+					}
+					if badName != "Truncated" {
+						if _, err := processor.ExtractData(input, 8, strategy); err == nil {
+							t.Error("expected an extraction error")
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestEmbeddingOverCapacityKeepsCover(t *testing.T) {
+	processor := NewServiceFactory().CreateDCTProcessor()
+	for _, strategy := range []DCTStrategy{DCTStrategySingle, DCTStrategyMulti, DCTStrategyDirect} {
+		t.Run(strategy.String(), func(t *testing.T) {
+			cover := writeTestJPEG(t, 32, 32)
+			before, err := os.ReadFile(cover)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Embedding in place must not truncate the cover when it fails
+			err = processor.EmbedData(cover, cover, bytes.Repeat([]byte{0xA5}, 4096), strategy)
+			if err == nil || !strings.Contains(err.Error(), "too large") {
+				t.Fatalf("expected a capacity error, got %v", err)
+			}
+			after, err := os.ReadFile(cover)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(before, after) {
+				t.Error("failed embedding changed the cover")
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+//go:build cgo
+// +build cgo
+
+package core
+
+// newPlatformDCTProcessor uses libjpeg when cgo is available
+func newPlatformDCTProcessor(key []byte, params DCTParams) DCTProcessor {
+	return &CgoDCTProcessor{key: key, params: params}
+}
@@ -0,0 +1,10 @@
+//go:build !cgo
+// +build !cgo
+
+package core
+
+// newPlatformDCTProcessor falls back to the pure-Go codec when built
+// without cgo (CGO_ENABLED=0, cross-compilation)
+func newPlatformDCTProcessor(key []byte, params DCTParams) DCTProcessor {
+	return &GoDCTProcessor{key: key, params: params}
+}
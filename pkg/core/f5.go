@@ -0,0 +1,244 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+// F5 matrix embedding (Westfeld 2001). The nonzero AC coefficients are read
+// in groups of n = 2^k-1; the XOR of the 1-based indices of the coefficients
+// whose |c| is odd is the k bit word the group carries. To change the word
+// at most one coefficient is touched, and its magnitude is decremented
+// instead of its LSB overwritten. A coefficient decremented to zero
+// (shrinkage) no longer carries anything, so the group is rebuilt without
+// it and the same bits are embedded again.
+//
+// k itself is embedded first with k=1 in f5ParamBits bits, so the extractor
+// only needs the payload size.
+const (
+	f5ParamBits = 4
+	f5MaxK      = 7
+)
+
+// F5Stats describes an F5 embedding
+type F5Stats struct {
+	K       int // matrix parameter: k bits in 2^k-1 coefficients
+	Bits    int // payload bits embedded
+	Changed int // coefficients changed, shrinkage included
+	Shrunk  int // changes that shrank a coefficient to zero
+}
+
+// f5Walk hands out the nonzero coefficients of the components in embedding
+// order, skipping coefficients that shrank to zero
+type f5Walk struct {
+	coefs []*int32
+	pos   int
+}
+
+func newF5Walk(comps []*jpegcoef.Component) *f5Walk {
+	w := &f5Walk{}
+	for _, y := range comps {
+		for by := 0; by < y.HeightInBlocks; by++ {
+			for bx := 0; bx < y.WidthInBlocks; bx++ {
+				b := y.Block(bx, by)
+				for _, pos := range acCoefficients {
+					if b[pos] != 0 {
+						w.coefs = append(w.coefs, &b[pos])
+					}
+				}
+			}
+		}
+	}
+	return w
+}
+
+// group returns the next n nonzero coefficients and the walk position just
+// after them, or false when the image has run out of coefficients
+func (w *f5Walk) group(n int) ([]*int32, int, bool) {
+	group := make([]*int32, 0, n)
+	i := w.pos
+	for ; i < len(w.coefs) && len(group) < n; i++ {
+		if *w.coefs[i] != 0 {
+			group = append(group, w.coefs[i])
+		}
+	}
+	return group, i, len(group) == n
+}
+
+// f5Hash returns the word carried by a group
+func f5Hash(group []*int32) int {
+	h := 0
+	for i, c := range group {
+		if *c&1 != 0 { // same as |c|&1 in two's complement
+			h ^= i + 1
+		}
+	}
+	return h
+}
+
+// embedWord embeds the k bit word m, returning how many coefficients were
+// changed and how many of them shrank to zero
+func (w *f5Walk) embedWord(m, k int) (changed, shrunk int, err error) {
+	n := 1<<k - 1
+	for {
+		group, next, ok := w.group(n)
+		if !ok {
+			return changed, shrunk, fmt.Errorf("image ran out of nonzero coefficients")
+		}
+		s := f5Hash(group) ^ m
+		if s == 0 {
+			w.pos = next
+			return changed, shrunk, nil
+		}
+		c := group[s-1]
+		if *c > 0 {
+			*c--
+		} else {
+			*c++
+		}
+		changed++
+		if *c != 0 {
+			w.pos = next
+			return changed, shrunk, nil
+		}
+		shrunk++ // retry the same bits without the coefficient that shrank
+	}
+}
+
+// extractWord reads the next k bit word
+func (w *f5Walk) extractWord(k int) (int, bool) {
+	group, next, ok := w.group(1<<k - 1)
+	if !ok {
+		return 0, false
+	}
+	w.pos = next
+	return f5Hash(group), true
+}
+
+// f5Capacity estimates how many payload bits fit with matrix parameter k.
+// Every nonzero coefficient can carry a bit with k=1, except that about
+// half of the ±1 coefficients are lost to shrinkage (the estimate of the
+// reference implementation); matrix embedding then packs k bits into
+// 2^k-1 coefficients.
+func f5Capacity(comps []*jpegcoef.Component, k int) int {
+	nonzero, ones := 0, 0
+	for _, y := range comps {
+		for by := 0; by < y.HeightInBlocks; by++ {
+			for bx := 0; bx < y.WidthInBlocks; bx++ {
+				b := y.Block(bx, by)
+				for _, pos := range acCoefficients {
+					switch b[pos] {
+					case 0:
+					case 1, -1:
+						nonzero++
+						ones++
+					default:
+						nonzero++
+					}
+				}
+			}
+		}
+	}
+	usable := nonzero - ones + ones*49/100 - f5ParamBits
+	if usable <= 0 {
+		return 0
+	}
+	return usable * k / (1<<k - 1)
+}
+
+// chooseF5K picks the largest k whose capacity still holds bits: the fewer
+// coefficients the payload needs, the more efficient the embedding
+func chooseF5K(comps []*jpegcoef.Component, bits int) (int, error) {
+	for k := f5MaxK; k >= 1; k-- {
+		if f5Capacity(comps, k) >= bits {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("data too large for image capacity: need %d bits, have %d (%s strategy)",
+		bits, f5Capacity(comps, 1), DCTStrategyF5.String())
+}
+
+// embedF5 embeds data into comps with matrix embedding
+func embedF5(comps []*jpegcoef.Component, data []byte) (*F5Stats, error) {
+	bits := len(data) * 8
+	k, err := chooseF5K(comps, bits)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newF5Walk(comps)
+	stats := &F5Stats{K: k, Bits: bits}
+	embed := func(m, k int) error {
+		c, s, err := w.embedWord(m, k)
+		stats.Changed += c
+		stats.Shrunk += s
+		return err
+	}
+
+	for i := f5ParamBits - 1; i >= 0; i-- {
+		if err := embed(k>>i&1, 1); err != nil {
+			return nil, fmt.Errorf("F5 parameter embedding failed: %w", err)
+		}
+	}
+	for i := 0; i < bits; i += k {
+		if err := embed(readBits(data, i, k), k); err != nil {
+			return nil, fmt.Errorf("F5 embedding failed at bit %d of %d (k=%d): %w", i, bits, k, err)
+		}
+	}
+	return stats, nil
+}
+
+// extractF5 reads dataSize bytes embedded by embedF5. Bytes beyond the
+// image capacity are returned as zero.
+func extractF5(comps []*jpegcoef.Component, dataSize int) ([]byte, error) {
+	w := newF5Walk(comps)
+	k := 0
+	for i := 0; i < f5ParamBits; i++ {
+		bit, ok := w.extractWord(1)
+		if !ok {
+			return nil, fmt.Errorf("image too small for %s strategy", DCTStrategyF5.String())
+		}
+		k = k<<1 | bit
+	}
+	if k < 1 || k > f5MaxK {
+		return nil, fmt.Errorf("no %s payload found (matrix parameter k=%d)", DCTStrategyF5.String(), k)
+	}
+
+	data := make([]byte, dataSize)
+	bits := dataSize * 8
+	for i := 0; i < bits; i += k {
+		m, ok := w.extractWord(k)
+		if !ok {
+			break
+		}
+		writeBits(data, i, k, m)
+	}
+	return data, nil
+}
+
+// readBits returns k bits of data starting at bit offset (MSB first),
+// padding past the end with zeros
+func readBits(data []byte, offset, k int) int {
+	v := 0
+	for i := offset; i < offset+k; i++ {
+		v <<= 1
+		if i < len(data)*8 {
+			v |= int(data[i/8]>>(7-i%8)) & 1
+		}
+	}
+	return v
+}
+
+// writeBits stores the k bit word v at bit offset, dropping bits past the end
+func writeBits(data []byte, offset, k, v int) {
+	for i := 0; i < k; i++ {
+		pos := offset + i
+		if pos >= len(data)*8 {
+			return
+		}
+		if v>>(k-1-i)&1 == 1 {
+			data[pos/8] |= 1 << (7 - pos%8)
+		}
+	}
+}
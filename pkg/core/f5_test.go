@@ -0,0 +1,166 @@
+package core
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+// changedCoefficients counts the luminance coefficients that differ
+func changedCoefficients(t *testing.T, a, b string) int {
+	t.Helper()
+	before, err := jpegcoef.DecodeFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := jpegcoef.DecodeFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := 0
+	for i, blk := range before.Components[0].Blocks {
+		for k := range blk {
+			if blk[k] != after.Components[0].Blocks[i][k] {
+				changed++
+			}
+		}
+	}
+	return changed
+}
+
+func TestF5RoundTrip(t *testing.T) {
+	cover := writeTestJPEG(t, 256, 128)
+	stego := filepath.Join(t.TempDir(), "stego.jpg")
+	payload := []byte("matrix embedding changes few coefficients")
+	processor := NewGoDCTProcessor()
+
+	if err := processor.EmbedData(cover, stego, payload, DCTStrategyF5); err != nil {
+		t.Fatalf("EmbedData failed: %v", err)
+	}
+	got, err := processor.ExtractData(stego, len(payload), DCTStrategyF5)
+	if err != nil {
+		t.Fatalf("ExtractData failed: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("expected %q, got %q", payload, got)
+	}
+
+	// The platform processor reads it too
+	got, err = NewServiceFactory().CreateDCTProcessor().ExtractData(stego, len(payload), DCTStrategyF5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("platform processor: expected %q, got %q", payload, got)
+	}
+}
+
+func TestF5ChangesFewerCoefficientsThanLSB(t *testing.T) {
+	cover := writeTestJPEG(t, 512, 512)
+	payload := bytes.Repeat([]byte("payload!"), 4)
+	processor := NewGoDCTProcessor()
+
+	lsb := filepath.Join(t.TempDir(), "lsb.jpg")
+	if err := processor.EmbedData(cover, lsb, payload, DCTStrategyThreshold); err != nil {
+		t.Fatal(err)
+	}
+	f5 := filepath.Join(t.TempDir(), "f5.jpg")
+	if err := processor.EmbedData(cover, f5, payload, DCTStrategyF5); err != nil {
+		t.Fatal(err)
+	}
+
+	lsbChanges := changedCoefficients(t, cover, lsb)
+	f5Changes := changedCoefficients(t, cover, f5)
+	if f5Changes*2 > lsbChanges {
+		t.Errorf("expected F5 to change far fewer coefficients: F5 %d, LSB %d", f5Changes, lsbChanges)
+	}
+}
+
+func TestF5HandlesShrinkage(t *testing.T) {
+	img, err := jpegcoef.DecodeFile(writeTestJPEG(t, 128, 128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Mostly ±1 coefficients: most changes shrink one to zero
+	values := []int32{1, -1, 1, -1, 2, -1, 1, -3}
+	y := &img.Components[0]
+	for i := range y.Blocks {
+		for _, pos := range acCoefficients {
+			y.Blocks[i][pos] = values[(i*7+pos)%len(values)]
+		}
+	}
+
+	payload := []byte("shrinks")
+	stats, err := embedF5([]*jpegcoef.Component{y}, payload)
+	if err != nil {
+		t.Fatalf("embedF5 failed: %v", err)
+	}
+	zeros := 0
+	for i := range y.Blocks {
+		for _, pos := range acCoefficients {
+			if y.Blocks[i][pos] == 0 {
+				zeros++
+			}
+		}
+	}
+	if zeros == 0 {
+		t.Fatal("expected shrinkage with ±1 coefficients")
+	}
+	if stats.Shrunk != zeros || stats.Changed < stats.Shrunk {
+		t.Errorf("stats %+v do not match the %d coefficients that shrank", *stats, zeros)
+	}
+
+	got, err := extractF5([]*jpegcoef.Component{y}, len(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("expected %q, got %q", payload, got)
+	}
+}
+
+func TestF5CapacityShrinksWithK(t *testing.T) {
+	img, err := jpegcoef.DecodeFile(writeTestJPEG(t, 256, 128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	y := []*jpegcoef.Component{&img.Components[0]}
+	prev := f5Capacity(y, 1)
+	if prev == 0 {
+		t.Fatal("expected nonzero capacity")
+	}
+	for k := 2; k <= f5MaxK; k++ {
+		c := f5Capacity(y, k)
+		if c >= prev {
+			t.Errorf("capacity for k=%d (%d) should be below k=%d (%d)", k, c, k-1, prev)
+		}
+		prev = c
+	}
+
+	if _, err := chooseF5K(y, f5Capacity(y, 1)+1); err == nil {
+		t.Error("expected error for payload above capacity")
+	}
+}
+
+func TestF5SizingUsesImageCapacity(t *testing.T) {
+	cover := writeTestJPEG(t, 256, 128)
+	want, err := NewGoDCTProcessor().CalculateImageCapacity(cover, DCTStrategyF5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a DCT processor the calculator still reads the coefficients
+	calc := NewStandardQRSizeCalculator()
+	got, err := calc.dctCapacity(cover, &ImageDimensions{Width: 256, Height: 128}, DCTStrategyF5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("expected the F5 estimate of %d bits, got %d", want, got)
+	}
+	if bound := calc.calculateDCTCapacity(256, 128, DCTStrategyF5); got >= bound {
+		t.Errorf("estimate %d should be below the dimension bound %d", got, bound)
+	}
+}
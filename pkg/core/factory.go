@@ -1,10 +1,5 @@
 package core
 
-import (
-	"fmt"
-	"runtime"
-)
-
 // ServiceFactory creates configured services with all dependencies
 type ServiceFactory struct{}
 
@@ -17,20 +12,10 @@ func NewServiceFactory() *ServiceFactory {
 func (f *ServiceFactory) CreateSteganographyService(env string) *SteganographyService {
 	imageProcessor := NewJPEGImageProcessor()
 	qrProcessor := NewGoQRProcessor()
-	sizeCalculator := NewStandardQRSizeCalculatorWithProcessor(imageProcessor)
 	metadataManager := NewBonzaiMetadataManager(env)
 
-	// Use real DCT processor based on CGO availability
-	var dctProcessor DCTProcessor
-	if runtime.GOOS != "js" && runtime.GOARCH != "wasm" {
-		// Use real CGO processor when available
-		dctProcessor = NewCgoDCTProcessor()
-		fmt.Printf("DEBUG: Using CGO DCT processor for %s environment\n", env)
-	} else {
-		// Fall back to mock only in environments where CGO is not available
-		dctProcessor = NewMockDCTProcessor()
-		fmt.Printf("DEBUG: Using mock DCT processor (CGO unavailable) for %s environment\n", env)
-	}
+	dctProcessor := f.CreateDCTProcessor()
+	sizeCalculator := NewStandardQRSizeCalculatorWithDCTProcessor(imageProcessor, dctProcessor)
 
 	return NewSteganographyService(
 		imageProcessor,
@@ -41,12 +26,53 @@ func (f *ServiceFactory) CreateSteganographyService(env string) *SteganographySe
 	)
 }
 
+// CreateSteganographyServiceWithKey is CreateSteganographyService with the
+// image headers whitened by password, so only readers with the password
+// find them
+func (f *ServiceFactory) CreateSteganographyServiceWithKey(env, password string) *SteganographyService {
+	service := f.CreateSteganographyService(env)
+	service.headerKey = password
+	return service
+}
+
+// CreateDCTProcessor returns the real DCT processor for this build:
+// libjpeg through CGO when available, the pure-Go codec otherwise
+func (f *ServiceFactory) CreateDCTProcessor() DCTProcessor {
+	return newPlatformDCTProcessor(nil, DCTParams{})
+}
+
+// CreateDCTProcessorWithKey returns the real DCT processor with the walk key
+// needed by DCTStrategyPermuted (see PermutationKey)
+func (f *ServiceFactory) CreateDCTProcessorWithKey(key []byte) DCTProcessor {
+	return newPlatformDCTProcessor(key, DCTParams{})
+}
+
+// CreateDCTProcessorWithParams returns the real DCT processor with
+// non-default strategy parameters
+func (f *ServiceFactory) CreateDCTProcessorWithParams(params DCTParams) DCTProcessor {
+	return newPlatformDCTProcessor(nil, params)
+}
+
+// CreateDCTProcessorFor returns a processor ready for strategy, deriving the
+// walk key from password when the strategy needs one. Zero params select
+// the defaults.
+func (f *ServiceFactory) CreateDCTProcessorFor(strategy DCTStrategy, password string, params DCTParams) (DCTProcessor, error) {
+	if strategy != DCTStrategyPermuted {
+		return f.CreateDCTProcessorWithParams(params), nil
+	}
+	key, err := PermutationKey(password)
+	if err != nil {
+		return nil, err
+	}
+	return newPlatformDCTProcessor(key, params), nil
+}
+
 // CreateTestSteganographyService creates a service with mock components for testing
 func (f *ServiceFactory) CreateTestSteganographyService(env string) *SteganographyService {
 	imageProcessor := NewMockJPEGImageProcessor()
 	qrProcessor := NewGoQRProcessor()
 	sizeCalculator := NewStandardQRSizeCalculatorWithProcessor(imageProcessor)
-	metadataManager := NewBonzaiMetadataManager(env)
+	metadataManager := NewMockMetadataManager()
 
 	// Use mock DCT processor for testing
 	dctProcessor := NewMockDCTProcessor()
@@ -0,0 +1,487 @@
+package core
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+// GoDCTProcessor implements DCTProcessor in pure Go on top of jpegcoef.
+// It uses the same coefficient layout as CgoDCTProcessor, so images
+// embedded by one can be extracted by the other.
+type GoDCTProcessor struct {
+	key    []byte    // walk key for DCTStrategyPermuted
+	params DCTParams // threshold, QIM step and components
+}
+
+func NewGoDCTProcessor() *GoDCTProcessor {
+	return &GoDCTProcessor{}
+}
+
+// NewGoDCTProcessorWithKey creates a processor able to use DCTStrategyPermuted
+func NewGoDCTProcessorWithKey(key []byte) *GoDCTProcessor {
+	return &GoDCTProcessor{key: key}
+}
+
+// NewGoDCTProcessorWithParams creates a processor with non-default
+// strategy parameters
+func NewGoDCTProcessorWithParams(params DCTParams) *GoDCTProcessor {
+	return &GoDCTProcessor{params: params}
+}
+
+// coefficientPositions returns the natural-order coefficients carrying one
+// bit each per luminance block, in embedding order
+func coefficientPositions(strategy DCTStrategy) []int {
+	switch strategy {
+	case DCTStrategyMulti:
+		return []int{4, 5, 6, 7}
+	case DCTStrategyDirect:
+		return []int{1, 2, 3, 4, 5, 6}
+	case DCTStrategyPermuted:
+		return permutedCoefficients
+	case DCTStrategyThreshold, DCTStrategyF5:
+		return acCoefficients
+	case DCTStrategyQIM:
+		return qimCoefficients
+	default:
+		return []int{1}
+	}
+}
+
+// components returns the components p embeds into with strategy, in
+// embedding order
+func (p *GoDCTProcessor) components(img *jpegcoef.Image, strategy DCTStrategy) ([]*jpegcoef.Component, error) {
+	if strategy == DCTStrategyQIM && !p.params.Components.LumaOnly() {
+		// The lattice steps follow the luminance reference table
+		return nil, fmt.Errorf("%s strategy embeds into the luminance only", strategy.String())
+	}
+	return selectComponents(img, p.params.Components)
+}
+
+// capacity returns how many bits strategy can embed in comps
+func (p *GoDCTProcessor) capacity(comps []*jpegcoef.Component, strategy DCTStrategy) int {
+	switch strategy {
+	case DCTStrategyThreshold:
+		return len(eligibleSlots(comps, p.params.Threshold, -1))
+	case DCTStrategyF5:
+		return f5Capacity(comps, 1)
+	}
+	blocks := 0
+	for _, c := range comps {
+		blocks += c.WidthInBlocks * c.HeightInBlocks
+	}
+	return blocks * len(coefficientPositions(strategy))
+}
+
+// blockSpace is a rectangle of blocks of one component
+type blockSpace struct {
+	component *jpegcoef.Component
+	region    BlockRegion
+}
+
+// wholeComponents spans every block of comps
+func wholeComponents(comps []*jpegcoef.Component) []blockSpace {
+	spaces := make([]blockSpace, len(comps))
+	for i, c := range comps {
+		spaces[i] = blockSpace{c, BlockRegion{Width: c.WidthInBlocks, Height: c.HeightInBlocks}}
+	}
+	return spaces
+}
+
+// slots returns the coefficients carrying bits 0..bits-1: blocks in raster
+// order, component after component, for the fixed strategies, a keyed walk
+// for DCTStrategyPermuted and the eligible coefficients for
+// DCTStrategyThreshold
+func (p *GoDCTProcessor) slots(comps []*jpegcoef.Component, strategy DCTStrategy, bits int) ([]*int32, error) {
+	if strategy == DCTStrategyThreshold {
+		return eligibleSlots(comps, p.params.Threshold, bits), nil
+	}
+	return p.spaceSlots(wholeComponents(comps), strategy, bits)
+}
+
+// regionSlots is slots for the fixed strategies restricted to the blocks of
+// region, in raster order within the region
+func (p *GoDCTProcessor) regionSlots(y *jpegcoef.Component, region BlockRegion, strategy DCTStrategy, bits int) ([]*int32, error) {
+	return p.spaceSlots([]blockSpace{{y, region}}, strategy, bits)
+}
+
+// spaceSlots is slots for the fixed strategies over spaces, one after the
+// other
+func (p *GoDCTProcessor) spaceSlots(spaces []blockSpace, strategy DCTStrategy, bits int) ([]*int32, error) {
+	positions := coefficientPositions(strategy)
+	available := 0
+	for _, s := range spaces {
+		available += s.region.Blocks() * len(positions)
+	}
+	if bits > available {
+		bits = available
+	}
+
+	slot := func(i int) *int32 {
+		for _, s := range spaces {
+			if n := s.region.Blocks() * len(positions); i >= n {
+				i -= n
+				continue
+			}
+			block := i / len(positions)
+			b := s.component.Block(s.region.X+block%s.region.Width, s.region.Y+block/s.region.Width)
+			return &b[positions[i%len(positions)]]
+		}
+		return nil
+	}
+
+	out := make([]*int32, bits)
+	if strategy == DCTStrategyPermuted {
+		if len(p.key) == 0 {
+			return nil, fmt.Errorf("%s strategy requires a key", strategy.String())
+		}
+		for i, s := range keyedWalk(p.key, available, bits) {
+			out[i] = slot(s)
+		}
+		return out, nil
+	}
+	for i := range out {
+		out[i] = slot(i)
+	}
+	return out, nil
+}
+
+// EmbedData embeds data into the LSBs of the DCT coefficients of the
+// selected components (the luminance by default)
+func (p *GoDCTProcessor) EmbedData(inputPath, outputPath string, data []byte, strategy DCTStrategy) error {
+	if len(data) == 0 {
+		return fmt.Errorf("data cannot be empty")
+	}
+
+	img, err := jpegcoef.DecodeFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read DCT coefficients from %s: %w", inputPath, err)
+	}
+	if err := p.embed(img, data, strategy); err != nil {
+		return err
+	}
+	if err := img.EncodeFile(outputPath); err != nil {
+		return fmt.Errorf("failed to write DCT coefficients to %s: %w", outputPath, err)
+	}
+	return nil
+}
+
+// EmbedDataStream is EmbedData for a JPEG read from r, written to w
+func (p *GoDCTProcessor) EmbedDataStream(r io.Reader, w io.Writer, data []byte, strategy DCTStrategy) error {
+	if len(data) == 0 {
+		return fmt.Errorf("data cannot be empty")
+	}
+
+	img, err := jpegcoef.Decode(r)
+	if err != nil {
+		return fmt.Errorf("failed to read DCT coefficients: %w", err)
+	}
+	if err := p.embed(img, data, strategy); err != nil {
+		return err
+	}
+	if err := img.Encode(w); err != nil {
+		return fmt.Errorf("failed to write DCT coefficients: %w", err)
+	}
+	return nil
+}
+
+// EmbedF5Stream is EmbedDataStream with DCTStrategyF5, reporting the
+// statistics of the matrix embedding
+func (p *GoDCTProcessor) EmbedF5Stream(r io.Reader, w io.Writer, data []byte) (*F5Stats, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("data cannot be empty")
+	}
+
+	img, err := jpegcoef.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DCT coefficients: %w", err)
+	}
+	comps, err := p.components(img, DCTStrategyF5)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := embedF5(comps, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := img.Encode(w); err != nil {
+		return nil, fmt.Errorf("failed to write DCT coefficients: %w", err)
+	}
+	return stats, nil
+}
+
+// embed embeds data into the coefficients of img
+func (p *GoDCTProcessor) embed(img *jpegcoef.Image, data []byte, strategy DCTStrategy) error {
+	comps, err := p.components(img, strategy)
+	if err != nil {
+		return err
+	}
+	if strategy == DCTStrategyF5 {
+		_, err := embedF5(comps, data)
+		return err
+	}
+	availableBits := p.capacity(comps, strategy)
+	requiredBits := len(data) * 8
+	if requiredBits > availableBits {
+		return fmt.Errorf("data too large for image capacity: need %d bits, have %d (%s strategy)",
+			requiredBits, availableBits, strategy.String())
+	}
+
+	slots, err := p.slots(comps, strategy, requiredBits)
+	if err != nil {
+		return err
+	}
+	p.embedBits(img, slots, data, strategy)
+	return nil
+}
+
+// embedBits writes data into slots, one bit per slot
+func (p *GoDCTProcessor) embedBits(img *jpegcoef.Image, slots []*int32, data []byte, strategy DCTStrategy) {
+	if strategy == DCTStrategyQIM {
+		embedQIM(slots, img.QuantTable(0), data, p.params.QIMStep)
+		return
+	}
+	for i, coef := range slots {
+		bit := int32(data[i/8]>>(7-i%8)) & 1
+		if strategy == DCTStrategyThreshold {
+			setMagnitudeLSB(coef, bit)
+			continue
+		}
+		*coef = *coef&^1 | bit
+	}
+}
+
+// ExtractData reads dataSize bytes back from the luminance DCT coefficients.
+// Bytes beyond the image capacity are returned as zero.
+func (p *GoDCTProcessor) ExtractData(inputPath string, dataSize int, strategy DCTStrategy) ([]byte, error) {
+	if dataSize <= 0 {
+		return nil, fmt.Errorf("data size must be positive")
+	}
+
+	img, err := jpegcoef.DecodeFile(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DCT coefficients from %s: %w", inputPath, err)
+	}
+	return p.extract(img, dataSize, strategy)
+}
+
+// ExtractDataStream is ExtractData for a JPEG read from r
+func (p *GoDCTProcessor) ExtractDataStream(r io.Reader, dataSize int, strategy DCTStrategy) ([]byte, error) {
+	if dataSize <= 0 {
+		return nil, fmt.Errorf("data size must be positive")
+	}
+
+	img, err := jpegcoef.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DCT coefficients: %w", err)
+	}
+	return p.extract(img, dataSize, strategy)
+}
+
+// extract reads dataSize bytes back from the coefficients of img
+func (p *GoDCTProcessor) extract(img *jpegcoef.Image, dataSize int, strategy DCTStrategy) ([]byte, error) {
+	if strategy == DCTStrategyF5 {
+		comps, err := p.components(img, strategy)
+		if err != nil {
+			return nil, err
+		}
+		return extractF5(comps, dataSize)
+	}
+	soft, err := p.extractSoft(img, dataSize*8, strategy)
+	if err != nil {
+		return nil, err
+	}
+	return hardBits(soft, dataSize), nil
+}
+
+// hardBits packs soft bits into size bytes
+func hardBits(soft []float64, size int) []byte {
+	data := make([]byte, size)
+	for i, v := range soft {
+		if v > 0 {
+			data[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return data
+}
+
+// ExtractSoftBits reads bits back as confidences in [-1, 1]. QIM reports the
+// distance to the two lattices; the LSB strategies can only report ±1.
+// Bits beyond the image capacity are 0.
+func (p *GoDCTProcessor) ExtractSoftBits(inputPath string, bits int, strategy DCTStrategy) ([]float64, error) {
+	if bits <= 0 {
+		return nil, fmt.Errorf("bit count must be positive")
+	}
+
+	img, err := jpegcoef.DecodeFile(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DCT coefficients from %s: %w", inputPath, err)
+	}
+	return p.soft(img, bits, strategy)
+}
+
+// ExtractSoftBitsStream is ExtractSoftBits for a JPEG read from r
+func (p *GoDCTProcessor) ExtractSoftBitsStream(r io.Reader, bits int, strategy DCTStrategy) ([]float64, error) {
+	if bits <= 0 {
+		return nil, fmt.Errorf("bit count must be positive")
+	}
+
+	img, err := jpegcoef.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DCT coefficients: %w", err)
+	}
+	return p.soft(img, bits, strategy)
+}
+
+// soft reads bits back from the coefficients of img as confidences
+func (p *GoDCTProcessor) soft(img *jpegcoef.Image, bits int, strategy DCTStrategy) ([]float64, error) {
+	if strategy == DCTStrategyF5 {
+		comps, err := p.components(img, strategy)
+		if err != nil {
+			return nil, err
+		}
+		data, err := extractF5(comps, (bits+7)/8)
+		if err != nil {
+			return nil, err
+		}
+		soft := make([]float64, bits)
+		for i := range soft {
+			soft[i] = float64(int(data[i/8]>>(7-i%8)&1)*2 - 1)
+		}
+		return soft, nil
+	}
+	return p.extractSoft(img, bits, strategy)
+}
+
+// extractSoft returns the soft values of the slot based strategies
+func (p *GoDCTProcessor) extractSoft(img *jpegcoef.Image, bits int, strategy DCTStrategy) ([]float64, error) {
+	comps, err := p.components(img, strategy)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := p.slots(comps, strategy, bits)
+	if err != nil {
+		return nil, err
+	}
+	return p.softBits(img, slots, bits, strategy), nil
+}
+
+// softBits reads the soft values of slots; bits beyond them are 0
+func (p *GoDCTProcessor) softBits(img *jpegcoef.Image, slots []*int32, bits int, strategy DCTStrategy) []float64 {
+	if strategy == DCTStrategyQIM {
+		return extractQIMSoft(slots, img.QuantTable(0), bits, p.params.QIMStep)
+	}
+	soft := make([]float64, bits)
+	for i, coef := range slots {
+		soft[i] = -1
+		if *coef&1 == 1 {
+			soft[i] = 1
+		}
+	}
+	return soft
+}
+
+// EmbedRegions embeds payloads[i] into regions[i] only, so several payloads
+// share one output image. The regions must not overlap; the content
+// dependent strategies are not supported.
+func (p *GoDCTProcessor) EmbedRegions(inputPath, outputPath string, regions []BlockRegion, payloads [][]byte, strategy DCTStrategy) error {
+	if len(regions) != len(payloads) {
+		return fmt.Errorf("%d regions for %d payloads", len(regions), len(payloads))
+	}
+	if strategy.DependsOnContent() {
+		return fmt.Errorf("%s strategy cannot embed into regions", strategy.String())
+	}
+
+	img, err := jpegcoef.DecodeFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read DCT coefficients from %s: %w", inputPath, err)
+	}
+
+	y := &img.Components[0]
+	for i, region := range regions {
+		if !region.Within(y.WidthInBlocks, y.HeightInBlocks) {
+			return fmt.Errorf("region %d %v outside the %dx%d block image", i, region, y.WidthInBlocks, y.HeightInBlocks)
+		}
+		requiredBits := len(payloads[i]) * 8
+		if available := region.Blocks() * len(coefficientPositions(strategy)); requiredBits > available {
+			return fmt.Errorf("payload %d too large for its region: need %d bits, have %d (%s strategy)",
+				i, requiredBits, available, strategy.String())
+		}
+		slots, err := p.regionSlots(y, region, strategy, requiredBits)
+		if err != nil {
+			return err
+		}
+		p.embedBits(img, slots, payloads[i], strategy)
+	}
+
+	if err := img.EncodeFile(outputPath); err != nil {
+		return fmt.Errorf("failed to write DCT coefficients to %s: %w", outputPath, err)
+	}
+	return nil
+}
+
+// ExtractRegions reads dataSize bytes back from each of regions
+func (p *GoDCTProcessor) ExtractRegions(inputPath string, regions []BlockRegion, dataSize int, strategy DCTStrategy) ([][]byte, error) {
+	if dataSize <= 0 {
+		return nil, fmt.Errorf("data size must be positive")
+	}
+	if strategy.DependsOnContent() {
+		return nil, fmt.Errorf("%s strategy cannot extract from regions", strategy.String())
+	}
+
+	img, err := jpegcoef.DecodeFile(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DCT coefficients from %s: %w", inputPath, err)
+	}
+
+	y := &img.Components[0]
+	out := make([][]byte, len(regions))
+	for i, region := range regions {
+		if !region.Within(y.WidthInBlocks, y.HeightInBlocks) {
+			return nil, fmt.Errorf("region %d %v outside the %dx%d block image", i, region, y.WidthInBlocks, y.HeightInBlocks)
+		}
+		slots, err := p.regionSlots(y, region, strategy, dataSize*8)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = hardBits(p.softBits(img, slots, dataSize*8, strategy), dataSize)
+	}
+	return out, nil
+}
+
+// CalculateCapacity calculates DCT capacity for given dimensions and
+// strategy over the components of the processor, see ComponentSet.Blocks.
+// For DCTStrategyThreshold and DCTStrategyF5 this is only a bound, far above
+// what real images hold: size payloads with CalculateImageCapacity.
+func (p *GoDCTProcessor) CalculateCapacity(width, height int, strategy DCTStrategy) int {
+	return p.params.Components.Blocks(width, height) * strategy.GetCoefficientsPerBit()
+}
+
+// CalculateImageCapacity counts the bits strategy can embed in the JPEG at
+// imagePath, counting only the coefficients content dependent strategies use
+func (p *GoDCTProcessor) CalculateImageCapacity(imagePath string, strategy DCTStrategy) (int, error) {
+	img, err := jpegcoef.DecodeFile(imagePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read DCT coefficients from %s: %w", imagePath, err)
+	}
+	return p.imageCapacity(img, strategy)
+}
+
+// CalculateStreamCapacity is CalculateImageCapacity for a JPEG read from r
+func (p *GoDCTProcessor) CalculateStreamCapacity(r io.Reader, strategy DCTStrategy) (int, error) {
+	img, err := jpegcoef.Decode(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read DCT coefficients: %w", err)
+	}
+	return p.imageCapacity(img, strategy)
+}
+
+// imageCapacity counts the bits strategy can embed in img
+func (p *GoDCTProcessor) imageCapacity(img *jpegcoef.Image, strategy DCTStrategy) (int, error) {
+	comps, err := p.components(img, strategy)
+	if err != nil {
+		return 0, err
+	}
+	return p.capacity(comps, strategy), nil
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestJPEG writes a textured colour JPEG cover image and returns its path
+func writeTestJPEG(t *testing.T, w, h int) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 3), G: uint8(y * 5), B: uint8((x + y) * 2), A: 255})
+		}
+	}
+	path := filepath.Join(t.TempDir(), "cover.jpg")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := jpeg.Encode(f, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGoDCTProcessorRoundTrip(t *testing.T) {
+	cover := writeTestJPEG(t, 256, 96)
+	payload := []byte("pure-go coefficient embedding")
+
+	for _, strategy := range []DCTStrategy{DCTStrategySingle, DCTStrategyMulti, DCTStrategyDirect} {
+		t.Run(strategy.String(), func(t *testing.T) {
+			stego := filepath.Join(t.TempDir(), "stego.jpg")
+			processor := NewGoDCTProcessor()
+
+			if err := processor.EmbedData(cover, stego, payload, strategy); err != nil {
+				t.Fatalf("EmbedData failed: %v", err)
+			}
+			got, err := processor.ExtractData(stego, len(payload), strategy)
+			if err != nil {
+				t.Fatalf("ExtractData failed: %v", err)
+			}
+			if !bytes.Equal(got, payload) {
+				t.Errorf("expected %q, got %q", payload, got)
+			}
+		})
+	}
+}
+
+// TestDCTProcessorsInteroperate checks that the Go codec and the platform
+// processor (libjpeg when built with cgo) share the same layout
+func TestDCTProcessorsInteroperate(t *testing.T) {
+	cover := writeTestJPEG(t, 96, 96)
+	payload := []byte("interop")
+	platform := NewServiceFactory().CreateDCTProcessor()
+	goProcessor := NewGoDCTProcessor()
+
+	pairs := []struct {
+		name           string
+		embed, extract DCTProcessor
+	}{
+		{"GoToPlatform", goProcessor, platform},
+		{"PlatformToGo", platform, goProcessor},
+	}
+
+	for _, pair := range pairs {
+		t.Run(pair.name, func(t *testing.T) {
+			stego := filepath.Join(t.TempDir(), "stego.jpg")
+			if err := pair.embed.EmbedData(cover, stego, payload, DCTStrategyDirect); err != nil {
+				t.Fatalf("EmbedData failed: %v", err)
+			}
+			got, err := pair.extract.ExtractData(stego, len(payload), DCTStrategyDirect)
+			if err != nil {
+				t.Fatalf("ExtractData failed: %v", err)
+			}
+			if !bytes.Equal(got, payload) {
+				t.Errorf("expected %q, got %q", payload, got)
+			}
+		})
+	}
+}
+
+func TestGoDCTProcessorRejectsOversizedData(t *testing.T) {
+	cover := writeTestJPEG(t, 16, 16) // 4 blocks = 4 bits single-coefficient
+	stego := filepath.Join(t.TempDir(), "stego.jpg")
+
+	err := NewGoDCTProcessor().EmbedData(cover, stego, []byte("too much"), DCTStrategySingle)
+	if err == nil {
+		t.Fatal("expected capacity error")
+	}
+	if _, statErr := os.Stat(stego); statErr == nil {
+		t.Error("no output should be written when data does not fit")
+	}
+}
+
+// TestStreamProcessorsMatchFiles embeds in memory and checks the result
+// reads back both in memory and from a file. The cover is large enough for
+// the libjpeg destination to grow its buffer.
+func TestStreamProcessorsMatchFiles(t *testing.T) {
+	cover, err := os.ReadFile(writeTestJPEG(t, 1024, 768))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := bytes.Repeat([]byte("in memory "), 40)
+	processors := map[string]DCTProcessor{
+		"Go":       NewGoDCTProcessor(),
+		"Platform": NewServiceFactory().CreateDCTProcessor(),
+	}
+	for name, processor := range processors {
+		stream, ok := processor.(StreamDCTProcessor)
+		if !ok {
+			t.Fatalf("%T does not implement StreamDCTProcessor", processor)
+		}
+		for _, strategy := range []DCTStrategy{DCTStrategySingle, DCTStrategyMulti, DCTStrategyDirect, DCTStrategyQIM} {
+			t.Run(name+"/"+strategy.String(), func(t *testing.T) {
+				var stego bytes.Buffer
+				if err := stream.EmbedDataStream(bytes.NewReader(cover), &stego, payload, strategy); err != nil {
+					t.Fatalf("EmbedDataStream failed: %v", err)
+				}
+				got, err := stream.ExtractDataStream(bytes.NewReader(stego.Bytes()), len(payload), strategy)
+				if err != nil {
+					t.Fatalf("ExtractDataStream failed: %v", err)
+				}
+				if !bytes.Equal(got, payload) {
+					t.Errorf("in memory: expected %q, got %q", payload, got)
+				}
+
+				path := filepath.Join(t.TempDir(), "stego.jpg")
+				if err := os.WriteFile(path, stego.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				got, err = processor.ExtractData(path, len(payload), strategy)
+				if err != nil {
+					t.Fatalf("ExtractData failed: %v", err)
+				}
+				if !bytes.Equal(got, payload) {
+					t.Errorf("from file: expected %q, got %q", payload, got)
+				}
+
+				streamCapacity, err := stream.CalculateStreamCapacity(bytes.NewReader(cover), strategy)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fileCapacity, err := processor.CalculateImageCapacity(path, strategy)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if streamCapacity != fileCapacity {
+					t.Errorf("capacity %d in memory, %d from file", streamCapacity, fileCapacity)
+				}
+			})
+		}
+	}
+}
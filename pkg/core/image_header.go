@@ -0,0 +1,369 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand/v2"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+	"github.com/BuddhiLW/crypt/pkg/seal"
+)
+
+// EmbedMethod identifies how a payload was placed in the image
+type EmbedMethod byte
+
+const (
+	EmbedMethodQR      EmbedMethod = 1
+	EmbedMethodDirect  EmbedMethod = 2
+	EmbedMethodMultiQR EmbedMethod = 3
+	// EmbedMethodQRGrid holds several QR codes in separate tiles, see QRGrid
+	EmbedMethodQRGrid EmbedMethod = 4
+)
+
+// String returns the method name
+func (m EmbedMethod) String() string {
+	switch m {
+	case EmbedMethodQR:
+		return "qr"
+	case EmbedMethodDirect:
+		return "direct"
+	case EmbedMethodMultiQR:
+		return "multiqr"
+	case EmbedMethodQRGrid:
+		return "qrgrid"
+	default:
+		return "unknown"
+	}
+}
+
+// ImageHeaderVersion is the header format written and read by this version
+const ImageHeaderVersion byte = 1
+
+// ErrNoImageHeader is returned for images embedded before the header existed
+var ErrNoImageHeader = errors.New("no crypt header found in image")
+
+// ImageHeader describes the payload of a stego image so extraction does not
+// depend on vars state from the machine that embedded it
+type ImageHeader struct {
+	Version       byte
+	Method        EmbedMethod
+	Strategy      DCTStrategy
+	QRPixelSize   int          // side of the QR pixel bitmap of images without a header, never stored
+	QRModules     int          // side of the embedded QR module matrix (0 for direct payloads)
+	PayloadLength int          // bytes embedded with Strategy (all QR copies), tiles for EmbedMethodQRGrid
+	Threshold     int          // minimum coefficient magnitude (DCTStrategyThreshold only)
+	QIMStep       int          // lattice step in tenths (DCTStrategyQIM only)
+	Components    ComponentSet // components carrying the payload (zero is luminance)
+}
+
+// Params returns the strategy parameters recorded in the header
+func (h ImageHeader) Params() DCTParams {
+	return DCTParams{Threshold: h.Threshold, QIMStep: h.QIMStep, Components: h.Components}
+}
+
+// Header layout: [magic:2][version:1][method:1][strategy:1][param:1]
+// [qr size:2][payload length:4][crc32:4], little endian like the direct
+// payload framing. param is the threshold or QIM step, depending on the
+// strategy, and qr size is in modules. The high nibble of strategy holds the
+// ComponentSet.
+const imageHeaderSize = 16
+
+var imageHeaderMagic = [2]byte{'C', 'R'}
+
+// The header lives in two low vertical frequencies of the first luminance
+// blocks. No embedding strategy touches these coefficients, so the header
+// never collides with the payload. Each bit is written imageHeaderCopies
+// times, one full copy after the other, fewer when the cover has too few
+// blocks for them (see headerCopies), with dithered QIM at
+// imageHeaderQIMStep, and read back by summing the soft values of the
+// copies. Before the lattice is chosen every slot is XORed with a keystream
+// and the lattices are shifted by a dither from the same stream, see
+// headerMask, so without the key the header is noise in these coefficients.
+var imageHeaderCoefficients = []int{8, 16}
+
+const imageHeaderCopies = 5
+
+// imageHeaderQIMStep is the lattice step of the header in tenths of the
+// reference table: the step that carries QIM payloads through a quality 50
+// re-save, so the header outlives the payloads of every strategy
+const imageHeaderQIMStep = 30
+
+// imageHeaderLabel separates the header key from every other
+// password-derived key
+const imageHeaderLabel = "crypt/image-header/v1"
+
+// headerCopies is the number of header copies that fit in blocks luminance
+// blocks, at most imageHeaderCopies. Writer and reader both derive it from
+// the image size, so it is not recorded anywhere.
+func headerCopies(blocks int) int {
+	return min(blocks*len(imageHeaderCoefficients)/(imageHeaderSize*8), imageHeaderCopies)
+}
+
+func headerBlocks(copies int) int {
+	slots := imageHeaderSize * 8 * copies
+	return (slots + len(imageHeaderCoefficients) - 1) / len(imageHeaderCoefficients)
+}
+
+// MarshalBinary encodes the header with its checksum
+func (h ImageHeader) MarshalBinary() ([]byte, error) {
+	if h.PayloadLength < 0 || int64(h.PayloadLength) > 0xFFFFFFFF {
+		return nil, fmt.Errorf("payload length %d out of range", h.PayloadLength)
+	}
+	param := 0 // defaults are recorded explicitly
+	switch h.Strategy {
+	case DCTStrategyThreshold:
+		param = NormalizeThreshold(h.Threshold)
+	case DCTStrategyQIM:
+		param = NormalizeQIMStep(h.QIMStep)
+	}
+	if param < 0 || param > 0xFF {
+		return nil, fmt.Errorf("strategy parameter %d out of range", param)
+	}
+	if h.Version != 0 && h.Version != ImageHeaderVersion {
+		return nil, fmt.Errorf("unsupported image header version %d", h.Version)
+	}
+	if h.QRModules < 0 || h.QRModules > 0xFFFF {
+		return nil, fmt.Errorf("QR size %d out of range", h.QRModules)
+	}
+
+	buf := make([]byte, imageHeaderSize)
+	copy(buf[0:2], imageHeaderMagic[:])
+	buf[2] = ImageHeaderVersion
+	buf[3] = byte(h.Method)
+	buf[4] = byte(h.Strategy) | byte(NormalizeComponents(h.Components))<<4
+	buf[5] = byte(param)
+	binary.LittleEndian.PutUint16(buf[6:8], uint16(h.QRModules))
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(h.PayloadLength))
+	binary.LittleEndian.PutUint32(buf[12:16], crc32.ChecksumIEEE(buf[:12]))
+	return buf, nil
+}
+
+// ParseImageHeader decodes and verifies a header written by MarshalBinary
+func ParseImageHeader(data []byte) (*ImageHeader, error) {
+	if len(data) < imageHeaderSize || data[0] != imageHeaderMagic[0] || data[1] != imageHeaderMagic[1] {
+		return nil, ErrNoImageHeader
+	}
+	if crc32.ChecksumIEEE(data[:12]) != binary.LittleEndian.Uint32(data[12:16]) {
+		return nil, ErrNoImageHeader
+	}
+	if data[2] != ImageHeaderVersion {
+		return nil, fmt.Errorf("unsupported image header version %d (this build reads %d)", data[2], ImageHeaderVersion)
+	}
+	h := &ImageHeader{
+		Version:       data[2],
+		Method:        EmbedMethod(data[3]),
+		Strategy:      DCTStrategy(data[4] & 0x0F),
+		QRModules:     int(binary.LittleEndian.Uint16(data[6:8])),
+		PayloadLength: int(binary.LittleEndian.Uint32(data[8:12])),
+	}
+	// Luminance only parses to the zero value
+	if set := ComponentSet(data[4] >> 4); !set.LumaOnly() {
+		h.Components = NormalizeComponents(set)
+	}
+	switch h.Strategy {
+	case DCTStrategyThreshold:
+		h.Threshold = int(data[5])
+	case DCTStrategyQIM:
+		h.QIMStep = int(data[5])
+	}
+	if h.Method.String() == "unknown" {
+		return nil, fmt.Errorf("unknown embedding method %d in image header", data[3])
+	}
+	return h, nil
+}
+
+// WriteImageHeader stores h in the JPEG at path, rewriting it in place
+func WriteImageHeader(path string, h ImageHeader) error {
+	return WriteImageHeaderWithKey(path, h, "")
+}
+
+// WriteImageHeaderWithKey is WriteImageHeader with the header whitened by
+// password, so only readers with the password can find it
+func WriteImageHeaderWithKey(path string, h ImageHeader, password string) error {
+	img, err := jpegcoef.DecodeFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read DCT coefficients from %s: %w", path, err)
+	}
+	if err := embedImageHeader(img, h, password); err != nil {
+		return err
+	}
+	return img.EncodeFile(path)
+}
+
+// ReadImageHeader reads the header of the JPEG at path. It returns
+// ErrNoImageHeader for legacy images.
+func ReadImageHeader(path string) (*ImageHeader, error) {
+	return ReadImageHeaderWithKey(path, "")
+}
+
+// ReadImageHeaderWithKey reads a header written with password, or without
+// a key
+func ReadImageHeaderWithKey(path, password string) (*ImageHeader, error) {
+	img, err := jpegcoef.DecodeFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DCT coefficients from %s: %w", path, err)
+	}
+	return extractImageHeader(img, password)
+}
+
+// WriteImageHeaderStream stores h in a JPEG read from r, written to w
+func WriteImageHeaderStream(r io.Reader, w io.Writer, h ImageHeader) error {
+	return WriteImageHeaderStreamWithKey(r, w, h, "")
+}
+
+// WriteImageHeaderStreamWithKey is WriteImageHeaderStream with the header
+// whitened by password
+func WriteImageHeaderStreamWithKey(r io.Reader, w io.Writer, h ImageHeader, password string) error {
+	img, err := jpegcoef.Decode(r)
+	if err != nil {
+		return fmt.Errorf("failed to read DCT coefficients: %w", err)
+	}
+	if err := embedImageHeader(img, h, password); err != nil {
+		return err
+	}
+	return img.Encode(w)
+}
+
+// ReadImageHeaderStream reads the header of a JPEG read from r. It returns
+// ErrNoImageHeader for legacy images.
+func ReadImageHeaderStream(r io.Reader) (*ImageHeader, error) {
+	return ReadImageHeaderStreamWithKey(r, "")
+}
+
+// ReadImageHeaderStreamWithKey reads a header written with password, or
+// without a key, from a JPEG read from r
+func ReadImageHeaderStreamWithKey(r io.Reader, password string) (*ImageHeader, error) {
+	img, err := jpegcoef.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DCT coefficients: %w", err)
+	}
+	return extractImageHeader(img, password)
+}
+
+// headerSlot returns the coefficient holding header slot s
+func headerSlot(y *jpegcoef.Component, s int) *int32 {
+	block := s / len(imageHeaderCoefficients)
+	b := y.Block(block%y.WidthInBlocks, block/y.WidthInBlocks)
+	return &b[imageHeaderCoefficients[s%len(imageHeaderCoefficients)]]
+}
+
+// headerMask is the keystream of the header slots: a bit each slot is XORed
+// with and a dither, as a fraction of the lattice step
+type headerMask struct {
+	flip   []int32
+	dither []float64
+}
+
+// newHeaderMask draws the mask of password. Without a password the stream
+// is fixed; with one it is seeded by the labelled KDF output, so testing a
+// guess costs as much as testing it against the ciphertext.
+func newHeaderMask(password string) (*headerMask, error) {
+	seed := sha256.Sum256([]byte(imageHeaderLabel))
+	if password != "" {
+		key, err := seal.DeriveLabeledKey([]byte(password), imageHeaderLabel, seal.DefaultParams())
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive image header key: %w", err)
+		}
+		seed = sha256.Sum256(key)
+	}
+	rng := rand.NewChaCha8(seed)
+
+	slots := imageHeaderSize * 8 * imageHeaderCopies
+	m := &headerMask{flip: make([]int32, slots), dither: make([]float64, slots)}
+	for s := range slots {
+		v := rng.Uint64()
+		m.flip[s] = int32(v & 1)
+		m.dither[s] = float64(v>>11) / (1 << 53)
+	}
+	return m, nil
+}
+
+func embedImageHeader(img *jpegcoef.Image, h ImageHeader, password string) error {
+	data, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	y := &img.Components[0]
+	copies := headerCopies(y.WidthInBlocks * y.HeightInBlocks)
+	if copies < 1 {
+		return fmt.Errorf("image too small for header: need %d blocks, have %d",
+			headerBlocks(1), y.WidthInBlocks*y.HeightInBlocks)
+	}
+	mask, err := newHeaderMask(password)
+	if err != nil {
+		return err
+	}
+
+	q := img.QuantTable(0)
+	bits := len(data) * 8
+	for s := range bits * copies {
+		i := s % bits
+		pos := imageHeaderCoefficients[s%len(imageHeaderCoefficients)]
+		delta := qimDelta(pos, imageHeaderQIMStep)
+		bit := int32(data[i/8]>>(7-i%8))&1 ^ mask.flip[s]
+		coef := headerSlot(y, s)
+		*coef = qimEmbedDithered(*coef, q[pos], delta, mask.dither[s]*delta, bit)
+	}
+	return nil
+}
+
+// extractImageHeader reads a header whitened by password, then one without
+// a key
+func extractImageHeader(img *jpegcoef.Image, password string) (*ImageHeader, error) {
+	y := &img.Components[0]
+	copies := headerCopies(y.WidthInBlocks * y.HeightInBlocks)
+	if copies < 1 {
+		return nil, ErrNoImageHeader
+	}
+	keys := []string{""}
+	if password != "" {
+		keys = []string{password, ""}
+	}
+	for _, key := range keys {
+		mask, err := newHeaderMask(key)
+		if err != nil {
+			return nil, err
+		}
+		header, err := ParseImageHeader(extractHeaderQIM(img, mask, copies))
+		if !errors.Is(err, ErrNoImageHeader) {
+			return header, err
+		}
+	}
+	return nil, ErrNoImageHeader
+}
+
+// extractHeaderQIM decides every header bit by the sum of the soft values
+// of its copies
+func extractHeaderQIM(img *jpegcoef.Image, mask *headerMask, copies int) []byte {
+	y := &img.Components[0]
+	q := img.QuantTable(0)
+	data := make([]byte, imageHeaderSize)
+	bits := len(data) * 8
+	soft := make([]float64, bits)
+	for s := range bits * copies {
+		pos := imageHeaderCoefficients[s%len(imageHeaderCoefficients)]
+		delta := qimDelta(pos, imageHeaderQIMStep)
+		v := qimSoft(float64(*headerSlot(y, s))*float64(q[pos])-mask.dither[s]*delta, delta)
+		if mask.flip[s] == 1 {
+			v = -v
+		}
+		soft[s%bits] += v
+	}
+	for i, v := range soft {
+		if v > 0 {
+			data[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return data
+}
+
+// ImageHeaderFrom reads a header written without a key from decoded
+// coefficients. It returns ErrNoImageHeader for legacy images and for
+// headers whitened by a password.
+func ImageHeaderFrom(img *jpegcoef.Image) (*ImageHeader, error) {
+	return extractImageHeader(img, "")
+}
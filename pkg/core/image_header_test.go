@@ -0,0 +1,157 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"path/filepath"
+	"testing"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+func TestImageHeaderMarshalRoundTrip(t *testing.T) {
+	want := ImageHeader{
+		Version:       ImageHeaderVersion,
+		Method:        EmbedMethodQR,
+		Strategy:      DCTStrategyMulti,
+		QRModules:     41,
+		PayloadLength: 211,
+	}
+	data, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	got, err := ParseImageHeader(data)
+	if err != nil {
+		t.Fatalf("ParseImageHeader failed: %v", err)
+	}
+	if *got != want {
+		t.Errorf("expected %+v, got %+v", want, *got)
+	}
+
+	// Other versions are rejected, not misread
+	other := append([]byte(nil), data...)
+	other[2] = ImageHeaderVersion + 1
+	binary.LittleEndian.PutUint32(other[12:16], crc32.ChecksumIEEE(other[:12]))
+	if _, err := ParseImageHeader(other); err == nil || errors.Is(err, ErrNoImageHeader) {
+		t.Errorf("expected an unsupported version error, got %v", err)
+	}
+
+	data[9] ^= 0x01
+	if _, err := ParseImageHeader(data); !errors.Is(err, ErrNoImageHeader) {
+		t.Errorf("expected ErrNoImageHeader for corrupted header, got %v", err)
+	}
+}
+
+func TestImageHeaderInJPEG(t *testing.T) {
+	cover := writeTestJPEG(t, 256, 128)
+	stego := filepath.Join(t.TempDir(), "stego.jpg")
+	payload := []byte("header and payload coexist")
+
+	// Legacy images have no header
+	if _, err := ReadImageHeader(cover); !errors.Is(err, ErrNoImageHeader) {
+		t.Fatalf("expected ErrNoImageHeader for plain image, got %v", err)
+	}
+
+	processor := NewGoDCTProcessor()
+	if err := processor.EmbedData(cover, stego, payload, DCTStrategyDirect); err != nil {
+		t.Fatal(err)
+	}
+	header := ImageHeader{Method: EmbedMethodDirect, Strategy: DCTStrategyDirect, PayloadLength: len(payload)}
+	if err := WriteImageHeader(stego, header); err != nil {
+		t.Fatalf("WriteImageHeader failed: %v", err)
+	}
+
+	got, err := ReadImageHeader(stego)
+	if err != nil {
+		t.Fatalf("ReadImageHeader failed: %v", err)
+	}
+	if got.Method != EmbedMethodDirect || got.Strategy != DCTStrategyDirect || got.PayloadLength != len(payload) {
+		t.Errorf("unexpected header %+v", *got)
+	}
+	if got.Version != ImageHeaderVersion {
+		t.Errorf("expected version %d, got %d", ImageHeaderVersion, got.Version)
+	}
+
+	// The header must not disturb the payload
+	data, err := processor.ExtractData(stego, len(payload), DCTStrategyDirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(payload) {
+		t.Errorf("payload damaged by header: %q", data)
+	}
+}
+
+func TestImageHeaderSurvivesRecompression(t *testing.T) {
+	cover := recompress(t, writeTestJPEG(t, 256, 256), 95)
+	want := ImageHeader{Method: EmbedMethodDirect, Strategy: DCTStrategyQIM, QIMStep: 30, PayloadLength: 407}
+	if err := WriteImageHeader(cover, want); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, quality := range []int{70, 50} {
+		got, err := ReadImageHeader(recompress(t, cover, quality))
+		if err != nil {
+			t.Fatalf("quality %d: ReadImageHeader failed: %v", quality, err)
+		}
+		if got.Strategy != want.Strategy || got.QIMStep != want.QIMStep || got.PayloadLength != want.PayloadLength {
+			t.Errorf("quality %d: unexpected header %+v", quality, *got)
+		}
+	}
+}
+
+func TestImageHeaderIsWhitenedByKey(t *testing.T) {
+	cover := writeTestJPEG(t, 256, 128)
+	const password = "header-password-123"
+	if err := WriteImageHeaderWithKey(cover, ImageHeader{Method: EmbedMethodQR, QRModules: 57, PayloadLength: 407}, password); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadImageHeaderWithKey(cover, password)
+	if err != nil {
+		t.Fatalf("ReadImageHeaderWithKey failed: %v", err)
+	}
+	if got.QRModules != 57 || got.PayloadLength != 407 {
+		t.Errorf("unexpected header %+v", *got)
+	}
+	if _, err := ReadImageHeaderWithKey(cover, "wrong-password-123"); !errors.Is(err, ErrNoImageHeader) {
+		t.Errorf("expected ErrNoImageHeader with the wrong key, got %v", err)
+	}
+	// Steganalysis reads without a key and finds nothing
+	img, err := jpegcoef.DecodeFile(cover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ImageHeaderFrom(img); !errors.Is(err, ErrNoImageHeader) {
+		t.Errorf("expected ErrNoImageHeader without the key, got %v", err)
+	}
+}
+
+func TestImageHeaderFitsSmallImages(t *testing.T) {
+	// 64 blocks hold a single copy
+	cover := writeTestJPEG(t, 64, 64)
+	const password = "header-password-123"
+	want := ImageHeader{Method: EmbedMethodQR, QRModules: 21, PayloadLength: 56}
+	if err := WriteImageHeaderWithKey(cover, want, password); err != nil {
+		t.Fatalf("WriteImageHeaderWithKey failed: %v", err)
+	}
+	got, err := ReadImageHeaderWithKey(cover, password)
+	if err != nil {
+		t.Fatalf("ReadImageHeaderWithKey failed: %v", err)
+	}
+	if got.QRModules != want.QRModules || got.PayloadLength != want.PayloadLength {
+		t.Errorf("unexpected header %+v", *got)
+	}
+}
+
+func TestImageHeaderRejectsSmallImages(t *testing.T) {
+	cover := writeTestJPEG(t, 56, 64) // 56 blocks, less than one copy
+	if err := WriteImageHeader(cover, ImageHeader{Method: EmbedMethodQR}); err == nil {
+		t.Error("expected error for image smaller than the header")
+	}
+	if _, err := ReadImageHeader(cover); !errors.Is(err, ErrNoImageHeader) {
+		t.Errorf("expected ErrNoImageHeader, got %v", err)
+	}
+}
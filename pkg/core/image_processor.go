@@ -6,6 +6,8 @@ import (
 	"image/jpeg"
 	"image/png"
 	"os"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
 )
 
 // JPEGImageProcessor implements ImageProcessor for JPEG images
@@ -16,20 +18,15 @@ func NewJPEGImageProcessor() *JPEGImageProcessor {
 }
 
 func (p *JPEGImageProcessor) GetDimensions(imagePath string) (*ImageDimensions, error) {
-	file, err := os.Open(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open image: %w", err)
-	}
-	defer file.Close()
-
-	config, err := jpeg.DecodeConfig(file)
+	// jpegcoef also reads the arithmetic-coded covers image/jpeg rejects
+	img, err := jpegcoef.DecodeFile(imagePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image config: %w", err)
 	}
 
 	return &ImageDimensions{
-		Width:  config.Width,
-		Height: config.Height,
+		Width:  img.Width,
+		Height: img.Height,
 	}, nil
 }
 
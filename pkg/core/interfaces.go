@@ -1,7 +1,9 @@
 package core
 
 import (
+	"fmt"
 	"image"
+	"io"
 )
 
 // ImageProcessor handles image operations (SRP - Single Responsibility)
@@ -15,8 +17,13 @@ type ImageProcessor interface {
 type QRCodeProcessor interface {
 	GenerateQR(data string, size int, eccLevel ECCLevel) ([]byte, error)
 	ReadQR(imagePath string) (string, error)
+	ReadQRImage(img image.Image) (string, error)
 	ConvertToBitstream(pngData []byte) ([]byte, error)
 	ConvertFromBitstream(bitstream []byte, size int) (image.Image, error)
+	// Module matrices: one bit per QR module, whatever the render size
+	GenerateModules(data string, eccLevel ECCLevel) ([]byte, int, error)
+	RenderModules(modules []byte, size, scale int) (image.Image, error)
+	ReadModules(modules []byte, size int) (string, error)
 }
 
 // DCTProcessor handles DCT coefficient operations (SRP)
@@ -24,6 +31,42 @@ type DCTProcessor interface {
 	EmbedData(inputPath, outputPath string, data []byte, strategy DCTStrategy) error
 	ExtractData(inputPath string, dataSize int, strategy DCTStrategy) ([]byte, error)
 	CalculateCapacity(width, height int, strategy DCTStrategy) int
+	CalculateImageCapacity(imagePath string, strategy DCTStrategy) (int, error)
+}
+
+// SoftDCTExtractor reports each extracted bit as a confidence in [-1, 1]
+// (positive means 1) for soft-decision decoding (SRP)
+type SoftDCTExtractor interface {
+	ExtractSoftBits(inputPath string, bits int, strategy DCTStrategy) ([]float64, error)
+}
+
+// F5StatsEmbedder embeds with DCTStrategyF5 and reports the statistics of
+// the matrix embedding (SRP)
+type F5StatsEmbedder interface {
+	EmbedF5Stream(r io.Reader, w io.Writer, data []byte) (*F5Stats, error)
+}
+
+// RegionDCTProcessor embeds into and extracts from rectangles of
+// luminance blocks, so several payloads can share one image (SRP)
+type RegionDCTProcessor interface {
+	EmbedRegions(inputPath, outputPath string, regions []BlockRegion, payloads [][]byte, strategy DCTStrategy) error
+	ExtractRegions(inputPath string, regions []BlockRegion, dataSize int, strategy DCTStrategy) ([][]byte, error)
+}
+
+// StreamDCTProcessor is DCTProcessor, with soft extraction, for JPEGs read
+// from an io.Reader and written to an io.Writer, so images held in memory or
+// streamed over a network never touch the filesystem (SRP)
+type StreamDCTProcessor interface {
+	EmbedDataStream(r io.Reader, w io.Writer, data []byte, strategy DCTStrategy) error
+	ExtractDataStream(r io.Reader, dataSize int, strategy DCTStrategy) ([]byte, error)
+	ExtractSoftBitsStream(r io.Reader, bits int, strategy DCTStrategy) ([]float64, error)
+	CalculateStreamCapacity(r io.Reader, strategy DCTStrategy) (int, error)
+}
+
+// QRPayloadReader decodes the QR code carried by an image file, embedded in
+// a JPEG or as a plain QR image (SRP)
+type QRPayloadReader interface {
+	ReadQRPayload(path string) (string, error)
 }
 
 // QRSizeCalculator calculates optimal QR sizes (SRP)
@@ -46,6 +89,22 @@ type ImageDimensions struct {
 	Height int
 }
 
+// BlockRegion is a rectangle of 8x8 luminance blocks
+type BlockRegion struct {
+	X, Y          int // top left block
+	Width, Height int // in blocks
+}
+
+// Blocks returns the number of blocks in r
+func (r BlockRegion) Blocks() int {
+	return r.Width * r.Height
+}
+
+// Within reports whether r lies inside an image of width x height blocks
+func (r BlockRegion) Within(width, height int) bool {
+	return r.X >= 0 && r.Y >= 0 && r.Width > 0 && r.Height > 0 && r.X+r.Width <= width && r.Y+r.Height <= height
+}
+
 type ECCLevel int
 
 const (
@@ -60,26 +119,96 @@ type DCTStrategy int
 const (
 	DCTStrategySingle DCTStrategy = iota
 	DCTStrategyMulti  DCTStrategy = iota
+	DCTStrategyDirect DCTStrategy = iota
+	// DCTStrategyPermuted scatters bits over a password-keyed walk
+	DCTStrategyPermuted DCTStrategy = iota
+	// DCTStrategyThreshold only uses coefficients at or above a magnitude
+	// threshold, leaving zeros and ±1 untouched
+	DCTStrategyThreshold DCTStrategy = iota
+	// DCTStrategyF5 uses Hamming matrix embedding over the nonzero
+	// coefficients, decrementing magnitudes instead of overwriting LSBs
+	DCTStrategyF5 DCTStrategy = iota
+	// DCTStrategyQIM quantizes mid-frequency coefficients onto one of two
+	// dithered lattices, so the payload survives requantization
+	DCTStrategyQIM DCTStrategy = iota
 )
 
+// DCTParams are the tunable parameters of the strategies.
+// Zero values select the defaults.
+type DCTParams struct {
+	Threshold  int          // minimum coefficient magnitude (DCTStrategyThreshold)
+	QIMStep    int          // lattice step in tenths of the reference table (DCTStrategyQIM)
+	Components ComponentSet // components carrying bits (all strategies but DCTStrategyQIM)
+}
+
 func (s DCTStrategy) String() string {
 	switch s {
 	case DCTStrategySingle:
 		return "single-coefficient"
 	case DCTStrategyMulti:
 		return "multi-coefficient"
+	case DCTStrategyDirect:
+		return "direct-coefficient"
+	case DCTStrategyPermuted:
+		return "permuted-coefficient"
+	case DCTStrategyThreshold:
+		return "threshold-coefficient"
+	case DCTStrategyF5:
+		return "f5-matrix"
+	case DCTStrategyQIM:
+		return "qim-lattice"
 	default:
 		return "unknown"
 	}
 }
 
+// ParseDCTStrategy maps a strategy name (as stored in vars) back to a DCTStrategy
+func ParseDCTStrategy(name string) (DCTStrategy, error) {
+	switch name {
+	case "", "single", "single-coefficient":
+		return DCTStrategySingle, nil
+	case "multi", "multi-coefficient":
+		return DCTStrategyMulti, nil
+	case "direct", "direct-coefficient":
+		return DCTStrategyDirect, nil
+	case "permuted", "permuted-coefficient":
+		return DCTStrategyPermuted, nil
+	case "threshold", "threshold-coefficient":
+		return DCTStrategyThreshold, nil
+	case "f5", "f5-matrix":
+		return DCTStrategyF5, nil
+	case "qim", "qim-lattice":
+		return DCTStrategyQIM, nil
+	default:
+		return DCTStrategySingle, fmt.Errorf("unknown DCT strategy '%s'", name)
+	}
+}
+
+// GetCoefficientsPerBit returns the coefficients per block a strategy may use.
+// For content dependent strategies this is an upper bound: which
+// coefficients are eligible depends on the image, see
+// DCTProcessor.CalculateImageCapacity.
 func (s DCTStrategy) GetCoefficientsPerBit() int {
 	switch s {
 	case DCTStrategySingle:
 		return 1
 	case DCTStrategyMulti:
 		return 2
+	case DCTStrategyDirect:
+		return 6
+	case DCTStrategyPermuted:
+		return len(permutedCoefficients)
+	case DCTStrategyThreshold, DCTStrategyF5:
+		return len(acCoefficients)
+	case DCTStrategyQIM:
+		return len(qimCoefficients)
 	default:
 		return 1
 	}
 }
+
+// DependsOnContent reports whether the capacity of the strategy depends on
+// the coefficient values and not only on the image dimensions
+func (s DCTStrategy) DependsOnContent() bool {
+	return s == DCTStrategyThreshold || s == DCTStrategyF5
+}
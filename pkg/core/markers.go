@@ -0,0 +1,62 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+// MarkerPolicy says what happens to the APPn and COM segments (EXIF, ICC
+// profile, XMP, comments) of the cover. Both codecs copy them into the stego
+// image unchanged; the zero value keeps it that way.
+type MarkerPolicy struct {
+	Strip   []string // segment kinds removed, see jpegcoef.Segment.Kind
+	Replace []string // segment kinds taken from Donor instead of the cover
+	Donor   string   // JPEG the replacement segments come from
+}
+
+// Keep reports whether p leaves the segments of the cover untouched
+func (p MarkerPolicy) Keep() bool {
+	return len(p.Strip) == 0 && len(p.Replace) == 0
+}
+
+// String describes the policy for status output
+func (p MarkerPolicy) String() string {
+	if p.Keep() {
+		return "keep"
+	}
+	var parts []string
+	if len(p.Strip) > 0 {
+		parts = append(parts, "strip "+strings.Join(p.Strip, ","))
+	}
+	if len(p.Replace) > 0 {
+		parts = append(parts, fmt.Sprintf("replace %s from %s", strings.Join(p.Replace, ","), p.Donor))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ApplyMarkerPolicy rewrites the segments of the JPEG at path in place.
+// Replacement happens before stripping, so a kind in both lists is removed.
+// The coefficients, and with them the payload and header, are unchanged.
+func ApplyMarkerPolicy(path string, p MarkerPolicy) error {
+	if p.Keep() {
+		return nil
+	}
+	img, err := jpegcoef.DecodeFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read DCT coefficients from %s: %w", path, err)
+	}
+	if len(p.Replace) > 0 {
+		if p.Donor == "" {
+			return fmt.Errorf("replacing %s segments needs a donor JPEG", strings.Join(p.Replace, ","))
+		}
+		donor, err := jpegcoef.DecodeFile(p.Donor)
+		if err != nil {
+			return fmt.Errorf("failed to read donor %s: %w", p.Donor, err)
+		}
+		img.ReplaceSegments(donor, p.Replace...)
+	}
+	img.StripSegments(p.Strip...)
+	return img.EncodeFile(path)
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+// writeTaggedJPEG writes a cover carrying EXIF, ICC and comment segments
+func writeTaggedJPEG(t *testing.T) (string, []jpegcoef.Segment) {
+	t.Helper()
+	img, err := jpegcoef.DecodeFile(writeTestJPEG(t, 96, 96))
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments := []jpegcoef.Segment{
+		{Marker: 0xE1, Data: []byte("Exif\x00\x00MM\x00\x2a camera")},
+		{Marker: 0xE2, Data: []byte("ICC_PROFILE\x00\x01\x01 display p3")},
+		{Marker: 0xFE, Data: []byte("holiday")},
+	}
+	img.Segments = append(img.Segments, segments...)
+	path := filepath.Join(t.TempDir(), "tagged.jpg")
+	if err := img.EncodeFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return path, segments
+}
+
+// segmentsOf returns the segments of the JPEG at path by kind
+func segmentsOf(t *testing.T, path string) map[string][]string {
+	t.Helper()
+	img, err := jpegcoef.DecodeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string][]string{}
+	for _, s := range img.Segments {
+		kinds[s.Kind()] = append(kinds[s.Kind()], string(s.Data))
+	}
+	return kinds
+}
+
+func TestEmbeddingKeepsMarkers(t *testing.T) {
+	cover, segments := writeTaggedJPEG(t)
+	processors := map[string]DCTProcessor{
+		"Go":       NewGoDCTProcessor(),
+		"Platform": NewServiceFactory().CreateDCTProcessor(),
+	}
+	for name, processor := range processors {
+		for _, strategy := range []DCTStrategy{DCTStrategySingle, DCTStrategyMulti, DCTStrategyDirect} {
+			t.Run(name+"/"+strategy.String(), func(t *testing.T) {
+				stego := filepath.Join(t.TempDir(), "stego.jpg")
+				if err := processor.EmbedData(cover, stego, []byte("markers"), strategy); err != nil {
+					t.Fatalf("EmbedData failed: %v", err)
+				}
+				got := segmentsOf(t, stego)
+				for _, s := range segments {
+					kind := s.Kind()
+					if len(got[kind]) != 1 || got[kind][0] != string(s.Data) {
+						t.Errorf("expected one %s segment %q, got %q", kind, s.Data, got[kind])
+					}
+				}
+				if len(got[jpegcoef.SegmentJFIF]) > 1 {
+					t.Errorf("JFIF segment written %d times", len(got[jpegcoef.SegmentJFIF]))
+				}
+			})
+		}
+	}
+}
+
+func TestApplyMarkerPolicy(t *testing.T) {
+	stego, _ := writeTaggedJPEG(t)
+	donor, err := jpegcoef.DecodeFile(writeTestJPEG(t, 16, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	donor.Segments = append(donor.Segments, jpegcoef.Segment{Marker: 0xE1, Data: []byte("Exif\x00\x00other camera")})
+	donorPath := filepath.Join(t.TempDir(), "donor.jpg")
+	if err := donor.EncodeFile(donorPath); err != nil {
+		t.Fatal(err)
+	}
+	before, err := jpegcoef.DecodeFile(stego)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := MarkerPolicy{Strip: []string{"com"}, Replace: []string{"exif"}, Donor: donorPath}
+	if err := ApplyMarkerPolicy(stego, policy); err != nil {
+		t.Fatalf("ApplyMarkerPolicy failed: %v", err)
+	}
+	got := segmentsOf(t, stego)
+	if len(got["com"]) != 0 {
+		t.Errorf("comment not stripped: %q", got["com"])
+	}
+	if len(got["exif"]) != 1 || got["exif"][0] != "Exif\x00\x00other camera" {
+		t.Errorf("expected the donor EXIF, got %q", got["exif"])
+	}
+	if len(got["icc"]) != 1 {
+		t.Errorf("ICC profile lost: %q", got["icc"])
+	}
+
+	after, err := jpegcoef.DecodeFile(stego)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range before.Components {
+		for j := range before.Components[i].Blocks {
+			if before.Components[i].Blocks[j] != after.Components[i].Blocks[j] {
+				t.Fatalf("component %d block %d changed", i, j)
+			}
+		}
+	}
+
+	if err := ApplyMarkerPolicy(stego, MarkerPolicy{Replace: []string{"icc"}}); err == nil {
+		t.Error("expected an error replacing without a donor")
+	}
+}
@@ -91,12 +91,9 @@ func (m *BonzaiMetadataManager) RetrieveDCTStrategy(env string) (DCTStrategy, er
 		return DCTStrategySingle, nil // Default strategy
 	}
 
-	switch strategyName {
-	case "single-coefficient":
-		return DCTStrategySingle, nil
-	case "multi-coefficient":
-		return DCTStrategyMulti, nil
-	default:
+	strategy, err := ParseDCTStrategy(strategyName)
+	if err != nil {
 		return DCTStrategySingle, nil // Default fallback
 	}
+	return strategy, nil
 }
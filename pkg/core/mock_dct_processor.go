@@ -2,6 +2,8 @@ package core
 
 import (
 	"fmt"
+	"image/jpeg"
+	"io"
 	"os"
 )
 
@@ -71,3 +73,52 @@ func (p *MockDCTProcessor) CalculateCapacity(width, height int, strategy DCTStra
 	dctBlocksY := (height + 7) / 8
 	return dctBlocksX * dctBlocksY * strategy.GetCoefficientsPerBit()
 }
+
+// CalculateImageCapacity calculates DCT capacity from the image dimensions
+func (p *MockDCTProcessor) CalculateImageCapacity(imagePath string, strategy DCTStrategy) (int, error) {
+	dims, err := NewMockJPEGImageProcessor().GetDimensions(imagePath)
+	if err != nil {
+		return 0, err
+	}
+	return p.CalculateCapacity(dims.Width, dims.Height, strategy), nil
+}
+
+// EmbedDataStream mocks EmbedData for a JPEG read from r, copying it to w
+func (p *MockDCTProcessor) EmbedDataStream(r io.Reader, w io.Writer, data []byte, strategy DCTStrategy) error {
+	if len(data) == 0 {
+		return fmt.Errorf("data cannot be empty")
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("failed to copy image: %w", err)
+	}
+	return nil
+}
+
+// ExtractDataStream mocks ExtractData for a JPEG read from r
+func (p *MockDCTProcessor) ExtractDataStream(r io.Reader, dataSize int, strategy DCTStrategy) ([]byte, error) {
+	return p.ExtractData("stream", dataSize, strategy)
+}
+
+// ExtractSoftBitsStream mocks soft extraction, reporting the mock data
+// with full confidence
+func (p *MockDCTProcessor) ExtractSoftBitsStream(r io.Reader, bits int, strategy DCTStrategy) ([]float64, error) {
+	data, err := p.ExtractData("stream", (bits+7)/8, strategy)
+	if err != nil {
+		return nil, err
+	}
+	soft := make([]float64, bits)
+	for i := range soft {
+		soft[i] = float64(int(data[i/8]>>(7-i%8)&1)*2 - 1)
+	}
+	return soft, nil
+}
+
+// CalculateStreamCapacity calculates DCT capacity from the dimensions of
+// a JPEG read from r
+func (p *MockDCTProcessor) CalculateStreamCapacity(r io.Reader, strategy DCTStrategy) (int, error) {
+	config, err := jpeg.DecodeConfig(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode image config: %w", err)
+	}
+	return p.CalculateCapacity(config.Width, config.Height, strategy), nil
+}
@@ -17,10 +17,11 @@ func NewMockJPEGImageProcessor() *MockJPEGImageProcessor {
 
 // GetDimensions returns mock dimensions for testing
 func (p *MockJPEGImageProcessor) GetDimensions(imagePath string) (*ImageDimensions, error) {
-	// Return large test dimensions to avoid capacity constraints
+	// Return large test dimensions to avoid capacity constraints: a 128
+	// module QR with one coefficient per bit needs more than 1024x1024
 	return &ImageDimensions{
-		Width:  1024,
-		Height: 1024,
+		Width:  2048,
+		Height: 2048,
 	}, nil
 }
 
@@ -0,0 +1,56 @@
+package core
+
+import "sync"
+
+// MockMetadataManager implements MetadataManager in memory for testing, so
+// tests leave no vars files behind
+type MockMetadataManager struct {
+	mu         sync.Mutex
+	qr         map[string][3]int
+	strategies map[string]DCTStrategy
+}
+
+func NewMockMetadataManager() *MockMetadataManager {
+	return &MockMetadataManager{
+		qr:         make(map[string][3]int),
+		strategies: make(map[string]DCTStrategy),
+	}
+}
+
+// StoreQRMetadata remembers the QR sizes of env
+func (m *MockMetadataManager) StoreQRMetadata(pixelSize, dataSize, dataArea int, env string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.qr[env] = [3]int{pixelSize, dataSize, dataArea}
+	return nil
+}
+
+// RetrieveQRMetadata returns the QR sizes of env, with the defaults of
+// BonzaiMetadataManager when none were stored
+func (m *MockMetadataManager) RetrieveQRMetadata(env string) (pixelSize, dataSize, dataArea int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if qr, ok := m.qr[env]; ok {
+		return qr[0], qr[1], qr[2], nil
+	}
+	return 256, 0, 256, nil
+}
+
+// StoreDCTStrategy remembers the strategy of env
+func (m *MockMetadataManager) StoreDCTStrategy(strategy DCTStrategy, env string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.strategies[env] = strategy
+	return nil
+}
+
+// RetrieveDCTStrategy returns the strategy of env, DCTStrategySingle when
+// none was stored
+func (m *MockMetadataManager) RetrieveDCTStrategy(env string) (DCTStrategy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if strategy, ok := m.strategies[env]; ok {
+		return strategy, nil
+	}
+	return DCTStrategySingle, nil
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BuddhiLW/crypt/pkg/fec"
+)
+
+// Fountain multi-QR sets carry no metadata: every image holds one LT
+// symbol (see fec.LTEncoder) and any K or a few more of them, in any order,
+// rebuild the payload.
+
+// fountainSymbolPrefix marks a QR payload as a base64 LT symbol
+const fountainSymbolPrefix = "CRLT1:"
+
+// fountainBlockSize keeps symbol QRs about as large as 256-byte chunks once
+// the symbol header and base64 are added
+const fountainBlockSize = 192
+
+// ErrNotFountainSymbol is returned by UnpackFountainSymbol for payloads that
+// are not fountain symbols
+var ErrNotFountainSymbol = errors.New("payload is not a fountain symbol")
+
+// PackFountainSymbol turns an LT symbol into QR text
+func PackFountainSymbol(symbol []byte) string {
+	return fountainSymbolPrefix + base64.StdEncoding.EncodeToString(symbol)
+}
+
+// UnpackFountainSymbol reverses PackFountainSymbol
+func UnpackFountainSymbol(payload string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(payload, fountainSymbolPrefix)
+	if !ok {
+		return nil, ErrNotFountainSymbol
+	}
+	symbol, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("damaged fountain symbol: %w", err)
+	}
+	return symbol, nil
+}
+
+// DefaultFountainSymbols returns how many symbols to emit for k source
+// blocks: half again as many, at least two spare
+func DefaultFountainSymbols(k int) int {
+	return k + max(2, k/2)
+}
+
+// EmbedMultiQRFountain embeds data as symbols QR codes of an LT fountain
+// code, one per symbol_<n>.jpeg in outputDir. symbols <= 0 selects
+// DefaultFountainSymbols.
+func (s *SteganographyService) EmbedMultiQRFountain(inputPath, outputDir, data, env string, symbols int) error {
+	encoder, err := fec.NewLTEncoder([]byte(data), fountainBlockSize)
+	if err != nil {
+		return err
+	}
+	if symbols <= 0 {
+		symbols = DefaultFountainSymbols(encoder.K())
+	}
+	if symbols < encoder.K() {
+		return fmt.Errorf("%d symbols cannot carry %d source blocks", symbols, encoder.K())
+	}
+
+	cover, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read cover: %w", err)
+	}
+
+	files := make(map[string][]byte, symbols)
+	for id := 0; id < symbols; id++ {
+		payload := PackFountainSymbol(encoder.Symbol(uint32(id)))
+		fileName := fmt.Sprintf("symbol_%d.jpeg", id)
+		if files[fileName], err = s.embedMultiQRPayload(cover, payload, env); err != nil {
+			return fmt.Errorf("failed to create symbol file %d: %w", id, err)
+		}
+	}
+
+	if err := writeFiles(outputDir, files); err != nil {
+		return fmt.Errorf("failed to write files to output directory: %w", err)
+	}
+	return nil
+}
+
+// decodeFountain rebuilds the payload from the symbols of a scan. Symbols
+// the decoder rejects are added to the warnings of the report.
+func decodeFountain(report *MultiQRScanReport) ([]byte, error) {
+	decoder := fec.NewLTDecoder()
+	for _, symbol := range report.Symbols {
+		if _, err := decoder.Add(symbol.Payload); err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("skipped %s: %v", symbol.Path, err))
+		}
+	}
+	received, k := decoder.Received()
+	data, err := decoder.Message()
+	if err != nil {
+		return nil, fmt.Errorf("%d fountain symbols of %d source blocks: %w", received, k, err)
+	}
+	return data, nil
+}
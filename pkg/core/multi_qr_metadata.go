@@ -1,12 +1,36 @@
 package core
 
 import (
+	"bytes"
+	"compress/flate"
 	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"strings"
 	"time"
 )
 
+// multiQRMetadataPrefix marks a QR payload as packed MultiQRMetadata. A
+// colon never occurs in base64, so chunk payloads cannot carry it.
+const multiQRMetadataPrefix = "CRMQ2:"
+
+// legacyMultiQRMetadataPrefix marks the deflated JSON metadata of earlier
+// versions, which grew too large for a readable QR past a few chunks
+const legacyMultiQRMetadataPrefix = "CRMQ1:"
+
+// chunkHashSize is the number of SHA256 bytes identifying a chunk
+const chunkHashSize = 8
+
+// ErrNotMultiQRMetadata is returned by UnpackMultiQRMetadata for payloads
+// that are not packed metadata, e.g. chunks
+var ErrNotMultiQRMetadata = errors.New("payload is not multi-QR metadata")
+
 // MultiQRMetadata represents the metadata for multi-QR grid embedding
 type MultiQRMetadata struct {
 	Version       string               `json:"version"`
@@ -55,23 +79,22 @@ func (m *MultiQRMetadata) AddChunk(index int, data []byte, position [2]int, file
 		return fmt.Errorf("chunk index %d exceeds total chunks %d", index, m.TotalChunks)
 	}
 
-	// Calculate hash of chunk data
-	hash := calculateChunkHash(data)
-
-	chunkInfo := ChunkInfo{
+	m.addChunkInfo(ChunkInfo{
 		Index:    index,
 		Position: position,
 		Size:     len(data),
-		Hash:     hash,
+		Hash:     calculateChunkHash(data),
 		FileName: fileName,
-	}
-
-	m.ChunkHashes[hash] = chunkInfo
-	m.HashOrder = append(m.HashOrder, hash)
-
+	})
 	return nil
 }
 
+// addChunkInfo records a chunk whose hash is already known
+func (m *MultiQRMetadata) addChunkInfo(info ChunkInfo) {
+	m.ChunkHashes[info.Hash] = info
+	m.HashOrder = append(m.HashOrder, info.Hash)
+}
+
 // GetChunkByHash retrieves chunk info by hash
 func (m *MultiQRMetadata) GetChunkByHash(hash string) (ChunkInfo, bool) {
 	info, exists := m.ChunkHashes[hash]
@@ -101,7 +124,7 @@ func (m *MultiQRMetadata) GetOrderedChunks() []ChunkInfo {
 func (m *MultiQRMetadata) ValidateChunk(data []byte, hash string) error {
 	expectedHash := calculateChunkHash(data)
 	if expectedHash != hash {
-		return fmt.Errorf("chunk hash mismatch: expected %s, got %s", expectedHash, expectedHash)
+		return fmt.Errorf("chunk hash mismatch: expected %s, got %s", hash, expectedHash)
 	}
 
 	chunkInfo, exists := m.GetChunkByHash(hash)
@@ -116,6 +139,65 @@ func (m *MultiQRMetadata) ValidateChunk(data []byte, hash string) error {
 	return nil
 }
 
+// Assemble joins chunk payloads (keyed by their hash) in HashOrder and
+// checks the result against Checksum. The order chunks were found in does
+// not matter; missing chunks are reported by index.
+func (m *MultiQRMetadata) Assemble(chunks map[string][]byte) ([]byte, error) {
+	r, err := m.AssembleReader(chunks)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// AssembleReader is Assemble as a stream: it checks every chunk and returns
+// a reader of the chunks in HashOrder, which fails at the end when they do
+// not match TotalDataSize or Checksum. The payload is not copied.
+func (m *MultiQRMetadata) AssembleReader(chunks map[string][]byte) (io.Reader, error) {
+	var missing []int
+	readers := make([]io.Reader, 0, len(m.HashOrder))
+	for i, hash := range m.HashOrder {
+		chunk, ok := chunks[hash]
+		if !ok {
+			missing = append(missing, i)
+			continue
+		}
+		if err := m.ValidateChunk(chunk, hash); err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", i, err)
+		}
+		readers = append(readers, bytes.NewReader(chunk))
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing %d of %d chunks: %v", len(missing), m.TotalChunks, missing)
+	}
+	return &checksumReader{r: io.MultiReader(readers...), hash: sha256.New(), metadata: m}, nil
+}
+
+// checksumReader checks the size and checksum of an assembled payload
+// when it has been read to the end
+type checksumReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	n        int
+	metadata *MultiQRMetadata
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.hash.Write(p[:n])
+	c.n += n
+	if err != io.EOF {
+		return n, err
+	}
+	if c.n != c.metadata.TotalDataSize {
+		return n, fmt.Errorf("reassembled %d bytes, expected %d", c.n, c.metadata.TotalDataSize)
+	}
+	if c.metadata.Checksum != "" && fmt.Sprintf("%x", c.hash.Sum(nil)) != c.metadata.Checksum {
+		return n, fmt.Errorf("reassembled data does not match checksum %s", c.metadata.Checksum)
+	}
+	return n, io.EOF
+}
+
 // ToJSON converts metadata to JSON
 func (m *MultiQRMetadata) ToJSON() ([]byte, error) {
 	return json.MarshalIndent(m, "", "  ")
@@ -131,45 +213,144 @@ func FromJSON(data []byte) (*MultiQRMetadata, error) {
 	return &metadata, nil
 }
 
-// calculateChunkHash calculates SHA256 hash of chunk data
-func calculateChunkHash(data []byte) string {
-	hash := sha256.Sum256(data)
-	return fmt.Sprintf("%x", hash)
-}
-
-// MultiQRFileScanner scans directories for QR chunk files
-type MultiQRFileScanner struct{}
+// Pack returns the metadata as a QR payload: a binary record in base64
+// behind multiQRMetadataPrefix. It holds the chunk count and sizes, the grid,
+// the checksum and the truncated hash of every chunk; chunk sizes and
+// positions follow from the index, so the record grows by chunkHashSize
+// bytes a chunk.
+func (m *MultiQRMetadata) Pack() (string, error) {
+	if len(m.HashOrder) != m.TotalChunks {
+		return "", fmt.Errorf("metadata lists %d chunk hashes for %d chunks", len(m.HashOrder), m.TotalChunks)
+	}
+	checksum, err := hex.DecodeString(m.Checksum)
+	if err != nil || (len(checksum) != 0 && len(checksum) != sha256.Size) {
+		return "", fmt.Errorf("invalid checksum %q", m.Checksum)
+	}
 
-// NewMultiQRFileScanner creates a new file scanner
-func NewMultiQRFileScanner() *MultiQRFileScanner {
-	return &MultiQRFileScanner{}
+	var buf []byte
+	for _, v := range []int{m.TotalChunks, m.ChunkSize, m.TotalDataSize, m.GridSize[0], m.GridSize[1]} {
+		if v < 0 {
+			return "", fmt.Errorf("invalid metadata field %d", v)
+		}
+		buf = binary.AppendUvarint(buf, uint64(v))
+	}
+	buf = append(buf, byte(len(checksum)))
+	buf = append(buf, checksum...)
+	for i, h := range m.HashOrder {
+		info := m.ChunkHashes[h]
+		if want := m.chunkSize(i); info.Size != want {
+			return "", fmt.Errorf("chunk %d holds %d bytes, expected %d", i, info.Size, want)
+		}
+		hash, err := hex.DecodeString(h)
+		if err != nil || len(hash) != chunkHashSize {
+			return "", fmt.Errorf("invalid hash %q of chunk %d", h, i)
+		}
+		buf = append(buf, hash...)
+	}
+	return multiQRMetadataPrefix + base64.StdEncoding.EncodeToString(buf), nil
 }
 
-// ScanDirectory scans a directory for QR chunk files and metadata
-func (s *MultiQRFileScanner) ScanDirectory(dirPath string) (*MultiQRMetadata, []string, error) {
-	// This would be implemented to scan for QR files
-	// For now, return a mock implementation
-	return nil, nil, fmt.Errorf("directory scanning not yet implemented")
+// chunkSize is the size of chunk index: ChunkSize, less for the last one
+func (m *MultiQRMetadata) chunkSize(index int) int {
+	return max(0, min(m.ChunkSize, m.TotalDataSize-index*m.ChunkSize))
 }
 
-// FindMetadataFile finds the metadata QR file in a directory
-func (s *MultiQRFileScanner) FindMetadataFile(dirPath string) (string, error) {
-	// This would scan for files containing metadata
-	// For now, return a mock implementation
-	return "", fmt.Errorf("metadata file scanning not yet implemented")
+// UnpackMultiQRMetadata parses a payload written by Pack, or the deflated
+// JSON of earlier versions
+func UnpackMultiQRMetadata(payload string) (*MultiQRMetadata, error) {
+	if encoded, ok := strings.CutPrefix(payload, legacyMultiQRMetadataPrefix); ok {
+		return unpackLegacyMultiQRMetadata(encoded)
+	}
+	encoded, ok := strings.CutPrefix(payload, multiQRMetadataPrefix)
+	if !ok {
+		return nil, ErrNotMultiQRMetadata
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+
+	var fields [5]int
+	for i := range fields {
+		v, n := binary.Uvarint(data)
+		if n <= 0 || v > 1<<40 {
+			return nil, errors.New("truncated metadata")
+		}
+		fields[i], data = int(v), data[n:]
+	}
+	if len(data) < 1 || (data[0] != 0 && data[0] != sha256.Size) || len(data) < 1+int(data[0]) {
+		return nil, errors.New("invalid metadata checksum")
+	}
+	checksum := data[1 : 1+data[0]]
+	data = data[1+len(checksum):]
+
+	m := &MultiQRMetadata{
+		Version:       "2.0",
+		TotalChunks:   fields[0],
+		ChunkSize:     fields[1],
+		TotalDataSize: fields[2],
+		GridSize:      [2]int{fields[3], fields[4]},
+		ChunkHashes:   make(map[string]ChunkInfo, fields[0]),
+		ECCLevel:      "H",
+		Compression:   "none",
+	}
+	if m.ChunkSize == 0 || m.TotalChunks != (m.TotalDataSize+m.ChunkSize-1)/m.ChunkSize || len(data) != m.TotalChunks*chunkHashSize {
+		return nil, fmt.Errorf("metadata of %d bytes in %d chunks lists %d bytes of hashes", m.TotalDataSize, m.TotalChunks, len(data))
+	}
+	if len(checksum) > 0 {
+		m.Checksum = hex.EncodeToString(checksum)
+	}
+	for i := 0; i < m.TotalChunks; i++ {
+		position := [2]int{0, i}
+		if cols := m.GridSize[1]; cols > 0 {
+			position = [2]int{i / cols, i % cols}
+		}
+		m.addChunkInfo(ChunkInfo{
+			Index:    i,
+			Position: position,
+			Size:     m.chunkSize(i),
+			Hash:     hex.EncodeToString(data[i*chunkHashSize : (i+1)*chunkHashSize]),
+		})
+	}
+	return m, nil
 }
 
-// ValidateChunkFiles validates all chunk files against metadata
-func (s *MultiQRFileScanner) ValidateChunkFiles(metadata *MultiQRMetadata, chunkFiles []string) error {
-	if len(chunkFiles) != metadata.TotalChunks {
-		return fmt.Errorf("expected %d chunk files, found %d", metadata.TotalChunks, len(chunkFiles))
+// unpackLegacyMultiQRMetadata parses deflated JSON metadata, truncating its
+// hashes to chunkHashSize
+func unpackLegacyMultiQRMetadata(encoded string) (*MultiQRMetadata, error) {
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inflate metadata: %w", err)
+	}
+	legacy, err := FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(legacy.HashOrder) != legacy.TotalChunks {
+		return nil, fmt.Errorf("metadata lists %d chunk hashes for %d chunks", len(legacy.HashOrder), legacy.TotalChunks)
 	}
 
-	// Validate each chunk file
-	for range chunkFiles {
-		// Read file and validate against metadata
-		// This would be implemented to actually read and validate files
+	m := *legacy
+	m.ChunkHashes = make(map[string]ChunkInfo, len(legacy.HashOrder))
+	m.HashOrder = make([]string, 0, len(legacy.HashOrder))
+	for _, h := range legacy.HashOrder {
+		info, ok := legacy.ChunkHashes[h]
+		if !ok || len(h) < 2*chunkHashSize {
+			return nil, fmt.Errorf("invalid chunk hash %q", h)
+		}
+		info.Hash = h[:2*chunkHashSize]
+		m.addChunkInfo(info)
 	}
+	return &m, nil
+}
 
-	return nil
+// calculateChunkHash returns the first chunkHashSize bytes of the SHA256
+// of chunk data, in hex
+func calculateChunkHash(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:chunkHashSize])
 }
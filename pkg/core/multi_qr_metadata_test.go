@@ -1,7 +1,13 @@
 package core_test
 
 import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/BuddhiLW/crypt/pkg/core"
@@ -229,3 +235,122 @@ func TestErrorConditions(t *testing.T) {
 		})
 	}
 }
+
+func TestMultiQRMetadataPackAndAssemble(t *testing.T) {
+	chunks := [][]byte{[]byte("first chunk "), []byte("second chunk"), []byte("last")}
+	metadata := core.NewMultiQRMetadata(28, 12, [2]int{1, 3})
+	for i, chunk := range chunks {
+		if err := metadata.AddChunk(i, chunk, [2]int{0, i}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	packed, err := metadata.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpacked, err := core.UnpackMultiQRMetadata(packed)
+	if err != nil {
+		t.Fatalf("UnpackMultiQRMetadata failed: %v", err)
+	}
+	if _, err := core.UnpackMultiQRMetadata("Q1JZUAEB"); err != core.ErrNotMultiQRMetadata {
+		t.Errorf("expected ErrNotMultiQRMetadata for a chunk payload, got %v", err)
+	}
+
+	// Chunks are looked up by hash, in whatever order they were found
+	found := make(map[string][]byte)
+	for i := len(chunks) - 1; i >= 0; i-- {
+		found[unpacked.HashOrder[i]] = chunks[i]
+	}
+	data, err := unpacked.Assemble(found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first chunk second chunklast" {
+		t.Errorf("unexpected reassembly %q", data)
+	}
+
+	delete(found, unpacked.HashOrder[1])
+	if _, err := unpacked.Assemble(found); err == nil {
+		t.Error("expected an error for a missing chunk")
+	}
+}
+
+func TestMultiQRMetadataPacksSmall(t *testing.T) {
+	// 64 chunks of 256 bytes: eight bytes of hash a chunk, nothing else
+	// grows with the payload
+	const chunks, chunkSize = 64, 256
+	metadata := core.NewMultiQRMetadata(chunks*chunkSize-10, chunkSize, [2]int{1, chunks})
+	for i := 0; i < chunks; i++ {
+		data := bytes.Repeat([]byte{byte(i)}, min(chunkSize, metadata.TotalDataSize-i*chunkSize))
+		if err := metadata.AddChunk(i, data, [2]int{0, i}, fmt.Sprintf("chunk_%d.jpeg", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metadata.Checksum = fmt.Sprintf("%x", sha256.Sum256(nil))
+
+	packed, err := metadata.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packed) > 4*(chunks*8+64)/3 {
+		t.Errorf("%d chunks packed into %d bytes", chunks, len(packed))
+	}
+	unpacked, err := core.UnpackMultiQRMetadata(packed)
+	if err != nil {
+		t.Fatalf("UnpackMultiQRMetadata failed: %v", err)
+	}
+	for i, want := range metadata.GetOrderedChunks() {
+		got, ok := unpacked.GetChunkByIndex(i)
+		if !ok || got.Hash != want.Hash || got.Size != want.Size || got.Position != want.Position {
+			t.Fatalf("chunk %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+	if unpacked.Checksum != metadata.Checksum || unpacked.TotalDataSize != metadata.TotalDataSize {
+		t.Errorf("expected %s over %d bytes, got %s over %d", metadata.Checksum, metadata.TotalDataSize, unpacked.Checksum, unpacked.TotalDataSize)
+	}
+
+	// Chunk sizes follow from the index, a record that contradicts that
+	// is not packed
+	wrong := core.NewMultiQRMetadata(10, 4, [2]int{1, 3})
+	for i, c := range []string{"abc", "defg", "hij"} {
+		wrong.AddChunk(i, []byte(c), [2]int{0, i}, "")
+	}
+	if _, err := wrong.Pack(); err == nil {
+		t.Error("expected a short first chunk to be rejected")
+	}
+}
+
+func TestUnpackLegacyMultiQRMetadata(t *testing.T) {
+	// Deflated JSON with full hashes, as earlier versions wrote it
+	chunks := []string{"first chunk ", "last"}
+	legacy := map[string]any{"total_chunks": 2, "chunk_size": 12, "total_data_size": 16}
+	infos := map[string]any{}
+	var order []string
+	for i, c := range chunks {
+		hash := fmt.Sprintf("%x", sha256.Sum256([]byte(c)))
+		infos[hash] = map[string]any{"index": i, "size": len(c), "hash": hash}
+		order = append(order, hash)
+	}
+	legacy["chunk_hashes"], legacy["hash_order"] = infos, order
+	data, _ := json.Marshal(legacy)
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write(data)
+	w.Close()
+
+	metadata, err := core.UnpackMultiQRMetadata("CRMQ1:" + base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("UnpackMultiQRMetadata failed: %v", err)
+	}
+	found := map[string][]byte{}
+	for _, c := range chunks {
+		probe := core.NewMultiQRMetadata(len(c), len(c), [2]int{1, 1})
+		probe.AddChunk(0, []byte(c), [2]int{0, 0}, "")
+		found[probe.HashOrder[0]] = []byte(c)
+	}
+	got, err := metadata.Assemble(found)
+	if err != nil || string(got) != strings.Join(chunks, "") {
+		t.Errorf("expected %q, got %q (%v)", strings.Join(chunks, ""), got, err)
+	}
+}
@@ -0,0 +1,284 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoMultiQRMetadata is returned when a directory holds no metadata QR
+// (and, for Scan, no fountain symbols either)
+var ErrNoMultiQRMetadata = errors.New("no multi-QR metadata found")
+
+// multiQREnv is the vars env of the default scanner's service
+const multiQREnv = "multiqr"
+
+// ScannedChunk is a chunk file and the payload decoded from it
+type ScannedChunk struct {
+	Path    string
+	Payload []byte
+}
+
+// MultiQRScanReport is what MultiQRFileScanner found among a set of files
+type MultiQRScanReport struct {
+	MetadataFile string
+	Metadata     *MultiQRMetadata
+	Chunks       []ScannedChunk   // by chunk index, Path is empty for missing chunks
+	Missing      []int            // indexes of chunks no file holds
+	Duplicates   map[int][]string // index -> further files holding the same chunk
+	Corrupt      []string         // decoded, but not a chunk of this metadata
+	Unreadable   []string         // no QR code could be decoded
+	Symbols      []ScannedChunk   // fountain symbols, Metadata is nil if only these were found
+	Warnings     []string         // files that were skipped and why, for the caller to show
+}
+
+// Complete reports whether every chunk was found
+func (r *MultiQRScanReport) Complete() bool {
+	return len(r.Missing) == 0
+}
+
+// Payloads returns the chunk payloads keyed by hash, see MultiQRMetadata.Assemble
+func (r *MultiQRScanReport) Payloads() map[string][]byte {
+	payloads := make(map[string][]byte)
+	for _, chunk := range r.Chunks {
+		if chunk.Path != "" {
+			payloads[calculateChunkHash(chunk.Payload)] = chunk.Payload
+		}
+	}
+	return payloads
+}
+
+// Summary describes the report in one line
+func (r *MultiQRScanReport) Summary() string {
+	if r.Metadata == nil {
+		summary := fmt.Sprintf("%d fountain symbols found", len(r.Symbols))
+		if len(r.Unreadable) > 0 {
+			summary += fmt.Sprintf(", %d unreadable", len(r.Unreadable))
+		}
+		return summary
+	}
+	found := len(r.Chunks) - len(r.Missing)
+	summary := fmt.Sprintf("%d of %d chunks found", found, len(r.Chunks))
+	if len(r.Missing) > 0 {
+		summary += fmt.Sprintf(", missing %v", r.Missing)
+	}
+	if len(r.Duplicates) > 0 {
+		summary += fmt.Sprintf(", %d duplicated", len(r.Duplicates))
+	}
+	if len(r.Corrupt) > 0 {
+		summary += fmt.Sprintf(", %d corrupt", len(r.Corrupt))
+	}
+	if len(r.Unreadable) > 0 {
+		summary += fmt.Sprintf(", %d unreadable", len(r.Unreadable))
+	}
+	return summary
+}
+
+// MultiQRFileScanner finds the metadata and chunk images of a multi-QR set
+// by decoding them: file names and their order do not matter
+type MultiQRFileScanner struct {
+	reader QRPayloadReader
+}
+
+// NewMultiQRFileScanner creates a scanner that decodes with the real DCT
+// and QR processors
+func NewMultiQRFileScanner() *MultiQRFileScanner {
+	service := NewServiceFactory().CreateSteganographyService(multiQREnv)
+	return NewMultiQRFileScannerWithReader(service.QRPayloadReader(multiQREnv))
+}
+
+// NewMultiQRFileScannerWithReader creates a scanner that decodes with reader
+func NewMultiQRFileScannerWithReader(reader QRPayloadReader) *MultiQRFileScanner {
+	return &MultiQRFileScanner{reader: reader}
+}
+
+// Scan decodes every JPEG and PNG in dirPath and sorts them into metadata,
+// chunks and fountain symbols. Missing, duplicate and corrupt chunks are
+// reported, not errors; it fails when there is neither metadata nor a
+// fountain symbol, or metadata of two payloads.
+func (s *MultiQRFileScanner) Scan(dirPath string) (*MultiQRScanReport, error) {
+	files, err := multiQRImageFiles(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadataFile string
+	var metadata *MultiQRMetadata
+	var chunkFiles []string
+	payloads := make(map[string]string)
+	var unreadable, warnings []string
+	var symbols []ScannedChunk
+	for _, file := range files {
+		payload, err := s.reader.ReadQRPayload(file)
+		if err != nil {
+			unreadable = append(unreadable, file)
+			continue
+		}
+
+		if symbol, err := UnpackFountainSymbol(payload); err == nil {
+			symbols = append(symbols, ScannedChunk{Path: file, Payload: symbol})
+			continue
+		} else if !errors.Is(err, ErrNotFountainSymbol) {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", file, err))
+			unreadable = append(unreadable, file)
+			continue
+		}
+
+		m, err := UnpackMultiQRMetadata(payload)
+		switch {
+		case err == nil:
+			if metadata != nil && metadata.Checksum != m.Checksum {
+				return nil, fmt.Errorf("%s and %s hold metadata of different payloads", metadataFile, file)
+			}
+			if metadata == nil {
+				metadataFile, metadata = file, m
+			}
+		case errors.Is(err, ErrNotMultiQRMetadata):
+			chunkFiles = append(chunkFiles, file)
+			payloads[file] = payload
+		default:
+			warnings = append(warnings, fmt.Sprintf("damaged metadata in %s: %v", file, err))
+			unreadable = append(unreadable, file)
+		}
+	}
+	if metadata == nil {
+		if len(symbols) > 0 {
+			return &MultiQRScanReport{Symbols: symbols, Unreadable: unreadable, Warnings: warnings}, nil
+		}
+		return nil, fmt.Errorf("%w in %s", ErrNoMultiQRMetadata, dirPath)
+	}
+
+	report := s.classify(metadata, chunkFiles, payloads)
+	report.MetadataFile = metadataFile
+	report.Unreadable = unreadable
+	report.Symbols = symbols
+	report.Warnings = append(warnings, report.Warnings...)
+	return report, nil
+}
+
+// ScanChunkFiles decodes chunkFiles and matches them against metadata
+func (s *MultiQRFileScanner) ScanChunkFiles(metadata *MultiQRMetadata, chunkFiles []string) *MultiQRScanReport {
+	payloads := make(map[string]string)
+	var readable, unreadable []string
+	for _, file := range chunkFiles {
+		payload, err := s.reader.ReadQRPayload(file)
+		if err != nil {
+			unreadable = append(unreadable, file)
+			continue
+		}
+		readable = append(readable, file)
+		payloads[file] = payload
+	}
+	report := s.classify(metadata, readable, payloads)
+	report.Unreadable = unreadable
+	return report
+}
+
+// classify places every chunk payload at the indexes whose SHA-256 it has
+func (s *MultiQRFileScanner) classify(metadata *MultiQRMetadata, files []string, payloads map[string]string) *MultiQRScanReport {
+	report := &MultiQRScanReport{
+		Metadata:   metadata,
+		Chunks:     make([]ScannedChunk, len(metadata.HashOrder)),
+		Duplicates: make(map[int][]string),
+	}
+
+	indexes := make(map[string][]int)
+	for i, hash := range metadata.HashOrder {
+		indexes[hash] = append(indexes[hash], i)
+	}
+
+	for _, file := range files {
+		payload := []byte(payloads[file])
+		hash := calculateChunkHash(payload)
+		positions, ok := indexes[hash]
+		if !ok || metadata.ValidateChunk(payload, hash) != nil {
+			report.Corrupt = append(report.Corrupt, file)
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s does not hold a chunk of this payload", file))
+			continue
+		}
+		for _, i := range positions {
+			if report.Chunks[i].Path != "" {
+				report.Duplicates[i] = append(report.Duplicates[i], file)
+				continue
+			}
+			report.Chunks[i] = ScannedChunk{Path: file, Payload: payload}
+		}
+	}
+
+	for i, chunk := range report.Chunks {
+		if chunk.Path == "" {
+			report.Missing = append(report.Missing, i)
+		}
+	}
+	return report
+}
+
+// ScanDirectory scans a directory for QR chunk files and metadata and
+// returns the chunk files in chunk order. It fails unless every chunk is
+// present.
+func (s *MultiQRFileScanner) ScanDirectory(dirPath string) (*MultiQRMetadata, []string, error) {
+	report, err := s.Scan(dirPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if report.Metadata == nil {
+		return nil, nil, fmt.Errorf("%w in %s: fountain sets have no chunk order", ErrNoMultiQRMetadata, dirPath)
+	}
+	if !report.Complete() {
+		return nil, nil, fmt.Errorf("incomplete multi-QR set in %s: %s", dirPath, report.Summary())
+	}
+
+	chunkFiles := make([]string, len(report.Chunks))
+	for i, chunk := range report.Chunks {
+		chunkFiles[i] = chunk.Path
+	}
+	return report.Metadata, chunkFiles, nil
+}
+
+// FindMetadataFile finds the metadata QR file in a directory
+func (s *MultiQRFileScanner) FindMetadataFile(dirPath string) (string, error) {
+	files, err := multiQRImageFiles(dirPath)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		payload, err := s.reader.ReadQRPayload(file)
+		if err != nil {
+			continue
+		}
+		if _, err := UnpackMultiQRMetadata(payload); err == nil {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("%w in %s", ErrNoMultiQRMetadata, dirPath)
+}
+
+// ValidateChunkFiles validates all chunk files against metadata: every
+// chunk present, none corrupt
+func (s *MultiQRFileScanner) ValidateChunkFiles(metadata *MultiQRMetadata, chunkFiles []string) error {
+	report := s.ScanChunkFiles(metadata, chunkFiles)
+	if !report.Complete() || len(report.Corrupt) > 0 || len(report.Unreadable) > 0 {
+		return fmt.Errorf("chunk files do not match metadata: %s", report.Summary())
+	}
+	return nil
+}
+
+// multiQRImageFiles lists the JPEG and PNG files in dir
+func multiQRImageFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".jpg", ".jpeg", ".png":
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	return files, nil
+}
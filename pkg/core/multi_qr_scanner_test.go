@@ -0,0 +1,187 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BuddhiLW/crypt/pkg/fec"
+)
+
+// fakeQRReader returns canned payloads by file name
+type fakeQRReader map[string]string
+
+func (r fakeQRReader) ReadQRPayload(path string) (string, error) {
+	payload, ok := r[filepath.Base(path)]
+	if !ok {
+		return "", errors.New("no QR code found in image")
+	}
+	return payload, nil
+}
+
+// writeScanDir creates empty image files for every name in reader plus names
+func writeScanDir(t *testing.T, reader fakeQRReader, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name := range reader {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func testMetadata(t *testing.T, chunks []string) (*MultiQRMetadata, string) {
+	t.Helper()
+	total := 0
+	for _, c := range chunks {
+		total += len(c)
+	}
+	metadata := NewMultiQRMetadata(total, 4, [2]int{1, len(chunks)})
+	for i, c := range chunks {
+		if err := metadata.AddChunk(i, []byte(c), [2]int{0, i}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	packed, err := metadata.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata, packed
+}
+
+func TestScanOrdersChunksByContent(t *testing.T) {
+	chunks := make([]string, 12)
+	for i := range chunks {
+		chunks[i] = fmt.Sprintf("c%03d", i)
+	}
+	_, packed := testMetadata(t, chunks)
+
+	// chunk_10 sorts before chunk_2, and the names lie about the content
+	reader := fakeQRReader{"00-first.jpeg": packed}
+	for i, c := range chunks {
+		reader[fmt.Sprintf("chunk_%d.jpeg", (i*5)%len(chunks))] = c
+	}
+	dir := writeScanDir(t, reader)
+
+	metadata, files, err := NewMultiQRFileScannerWithReader(reader).ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if metadata.TotalChunks != len(chunks) {
+		t.Fatalf("expected %d chunks, got %d", len(chunks), metadata.TotalChunks)
+	}
+	for i, file := range files {
+		if got := reader[filepath.Base(file)]; got != chunks[i] {
+			t.Errorf("position %d: %s holds %q, expected %q", i, filepath.Base(file), got, chunks[i])
+		}
+	}
+}
+
+func TestScanReportsMissingDuplicateAndCorruptChunks(t *testing.T) {
+	chunks := []string{"aaaa", "bbbb", "cccc", "dddd"}
+	_, packed := testMetadata(t, chunks)
+	reader := fakeQRReader{
+		"meta.png": packed,
+		"1.jpg":    "aaaa",
+		"2.jpg":    "cccc",
+		"3.jpg":    "cccc", // same chunk twice
+		"4.jpg":    "dxdd", // damaged chunk
+	}
+	dir := writeScanDir(t, reader, "noise.jpeg", "notes.txt")
+
+	scanner := NewMultiQRFileScannerWithReader(reader)
+	report, err := scanner.Scan(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.MetadataFile != filepath.Join(dir, "meta.png") {
+		t.Errorf("expected meta.png as metadata, got %s", report.MetadataFile)
+	}
+	if !reflect.DeepEqual(report.Missing, []int{1, 3}) {
+		t.Errorf("expected chunks 1 and 3 missing, got %v", report.Missing)
+	}
+	if len(report.Duplicates[2]) != 1 {
+		t.Errorf("expected one duplicate of chunk 2, got %v", report.Duplicates)
+	}
+	if len(report.Corrupt) != 1 || filepath.Base(report.Corrupt[0]) != "4.jpg" {
+		t.Errorf("expected 4.jpg to be corrupt, got %v", report.Corrupt)
+	}
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "4.jpg") {
+		t.Errorf("expected a warning about 4.jpg, got %v", report.Warnings)
+	}
+	if len(report.Unreadable) != 1 || filepath.Base(report.Unreadable[0]) != "noise.jpeg" {
+		t.Errorf("expected noise.jpeg to be unreadable, got %v", report.Unreadable)
+	}
+	if report.Complete() {
+		t.Error("report with missing chunks must not be complete")
+	}
+	if _, _, err := scanner.ScanDirectory(dir); err == nil {
+		t.Error("ScanDirectory must fail for an incomplete set")
+	}
+
+	if err := scanner.ValidateChunkFiles(report.Metadata, []string{filepath.Join(dir, "1.jpg"), filepath.Join(dir, "4.jpg")}); err == nil {
+		t.Error("ValidateChunkFiles must reject a corrupt chunk")
+	}
+}
+
+func TestFindMetadataFile(t *testing.T) {
+	_, packed := testMetadata(t, []string{"only"})
+	reader := fakeQRReader{"a.jpg": "only", "zz.jpg": packed}
+	dir := writeScanDir(t, reader)
+
+	scanner := NewMultiQRFileScannerWithReader(reader)
+	file, err := scanner.FindMetadataFile(dir)
+	if err != nil || filepath.Base(file) != "zz.jpg" {
+		t.Errorf("expected zz.jpg, got %q (%v)", file, err)
+	}
+
+	delete(reader, "zz.jpg")
+	if _, err := scanner.Scan(dir); !errors.Is(err, ErrNoMultiQRMetadata) {
+		t.Errorf("expected ErrNoMultiQRMetadata, got %v", err)
+	}
+}
+
+func TestScanDecodesFountainSymbolsWithoutMetadata(t *testing.T) {
+	msg := []byte(strings.Repeat("fountain symbols need no metadata. ", 30))
+	encoder, err := fec.NewLTEncoder(msg, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := fakeQRReader{}
+	for id := 0; id < encoder.K()+12; id++ {
+		reader[fmt.Sprintf("img%02d.jpg", id)] = PackFountainSymbol(encoder.Symbol(uint32(id)))
+	}
+	// Lose three of the source blocks themselves
+	for _, id := range []int{0, 4, 9} {
+		delete(reader, fmt.Sprintf("img%02d.jpg", id))
+	}
+	dir := writeScanDir(t, reader, "blank.jpg")
+
+	scanner := NewMultiQRFileScannerWithReader(reader)
+	report, err := scanner.Scan(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Metadata != nil || len(report.Symbols) != encoder.K()+9 || len(report.Unreadable) != 1 {
+		t.Fatalf("unexpected report: %s", report.Summary())
+	}
+	got, err := decodeFountain(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(msg) {
+		t.Error("fountain payload changed")
+	}
+
+	if _, _, err := scanner.ScanDirectory(dir); !errors.Is(err, ErrNoMultiQRMetadata) {
+		t.Errorf("ScanDirectory needs metadata, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"github.com/BuddhiLW/crypt/pkg/seal"
+)
+
+// permutedCoefficients are the coefficients (natural order) the permuted
+// strategy may use in every luminance block: zigzag positions 1-20 without
+// the image header coefficients 8 and 16
+var permutedCoefficients = []int{1, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5, 12, 19, 26, 33, 40}
+
+// permutationLabel separates the walk key from every other password-derived key
+const permutationLabel = "crypt/dct-permutation/v1"
+
+// PermutationKey derives the key of the permuted walk from the password.
+// It uses the default KDF with a fixed salt so the extractor can rebuild
+// it from the password alone.
+func PermutationKey(password string) ([]byte, error) {
+	if password == "" {
+		return nil, fmt.Errorf("permuted strategy requires a password")
+	}
+	return seal.DeriveLabeledKey([]byte(password), permutationLabel, seal.DefaultParams())
+}
+
+// keyedWalk returns the first count slots of a key-seeded permutation of
+// [0, n). The prefix does not depend on count, so embedding and extraction
+// visit the same slots for the same bits.
+func keyedWalk(key []byte, n, count int) []int {
+	seed := sha256.Sum256(key)
+	rng := rand.NewChaCha8(seed)
+
+	// Partial Fisher-Yates over a lazily materialised identity permutation
+	swapped := make(map[int]int, count)
+	at := func(i int) int {
+		if v, ok := swapped[i]; ok {
+			return v
+		}
+		return i
+	}
+
+	walk := make([]int, count)
+	for i := 0; i < count; i++ {
+		j := i + int(uniform(rng, uint64(n-i)))
+		walk[i] = at(j)
+		swapped[j] = at(i)
+	}
+	return walk
+}
+
+// uniform draws an unbiased value in [0, n) (rejection sampling, so the
+// walk only depends on the ChaCha8 stream)
+func uniform(rng *rand.ChaCha8, n uint64) uint64 {
+	limit := math.MaxUint64 - math.MaxUint64%n
+	for {
+		if v := rng.Uint64(); v < limit {
+			return v % n
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyedWalkIsPrefixStablePermutation(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	n := 500
+
+	full := keyedWalk(key, n, n)
+	seen := make(map[int]bool, n)
+	for _, s := range full {
+		if s < 0 || s >= n || seen[s] {
+			t.Fatalf("walk is not a permutation: slot %d", s)
+		}
+		seen[s] = true
+	}
+
+	prefix := keyedWalk(key, n, 40)
+	for i := range prefix {
+		if prefix[i] != full[i] {
+			t.Fatalf("walk prefix differs at %d: %d vs %d", i, prefix[i], full[i])
+		}
+	}
+
+	other := keyedWalk([]byte("another key"), n, 40)
+	same := 0
+	for i := range other {
+		if other[i] == prefix[i] {
+			same++
+		}
+	}
+	if same == len(prefix) {
+		t.Error("different keys should give different walks")
+	}
+}
+
+func TestGoDCTProcessorPermutedRoundTrip(t *testing.T) {
+	cover := writeTestJPEG(t, 128, 96)
+	stego := filepath.Join(t.TempDir(), "stego.jpg")
+	payload := []byte("scattered across the whole image")
+	key := []byte("walk key for the permuted strategy")
+
+	if err := NewGoDCTProcessorWithKey(key).EmbedData(cover, stego, payload, DCTStrategyPermuted); err != nil {
+		t.Fatalf("EmbedData failed: %v", err)
+	}
+
+	got, err := NewGoDCTProcessorWithKey(key).ExtractData(stego, len(payload), DCTStrategyPermuted)
+	if err != nil {
+		t.Fatalf("ExtractData failed: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("expected %q, got %q", payload, got)
+	}
+
+	wrong, err := NewGoDCTProcessorWithKey([]byte("wrong key")).ExtractData(stego, len(payload), DCTStrategyPermuted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(wrong, payload) {
+		t.Error("a different key must not recover the payload")
+	}
+
+	// The platform processor shares the walk
+	platform := NewServiceFactory().CreateDCTProcessorWithKey(key)
+	got, err = platform.ExtractData(stego, len(payload), DCTStrategyPermuted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("platform processor: expected %q, got %q", payload, got)
+	}
+}
+
+func TestPermutedStrategyRequiresKey(t *testing.T) {
+	cover := writeTestJPEG(t, 64, 64)
+	stego := filepath.Join(t.TempDir(), "stego.jpg")
+
+	if err := NewGoDCTProcessor().EmbedData(cover, stego, []byte("x"), DCTStrategyPermuted); err == nil {
+		t.Error("expected error embedding without a key")
+	}
+	if _, err := NewServiceFactory().CreateDCTProcessorFor(DCTStrategyPermuted, "", DCTParams{}); err == nil {
+		t.Error("expected error creating a permuted processor without a password")
+	}
+}
+
+func TestPermutedCoefficientsAvoidImageHeader(t *testing.T) {
+	for _, pos := range permutedCoefficients {
+		for _, h := range imageHeaderCoefficients {
+			if pos == h {
+				t.Errorf("coefficient %d is used by both the permuted walk and the image header", pos)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package core
+
+import "math"
+
+// Quantization index modulation (dither modulation). A coefficient carries
+// bit b by sitting on the lattice stepZ + o_b, where o_0 = -step/4 and
+// o_1 = +step/4. The lattice lives in the dequantized domain (coefficient
+// times quantization table entry), so it does not move when the image is
+// saved again with another table: as long as requantization moves a value
+// by less than step/4 the bit survives.
+
+// DefaultQIMStep is the lattice step in tenths of the reference table. Two
+// reference steps keep the requantization error of a quality 70 re-save
+// (at most 0.3 reference steps) inside the decision margin.
+const DefaultQIMStep = 20
+
+// qimReferenceTable is the standard luminance table (ITU-T T.81 Annex K,
+// quality 50) in natural order. Steps are relative to it rather than to
+// the cover's own table, so the same step gives the same robustness
+// whatever quality the cover was saved at.
+var qimReferenceTable = [64]int{
+	16, 11, 10, 16, 24, 40, 51, 61,
+	12, 12, 14, 19, 26, 58, 60, 55,
+	14, 13, 16, 24, 40, 57, 69, 56,
+	14, 17, 22, 29, 51, 87, 80, 62,
+	18, 22, 37, 56, 68, 109, 103, 77,
+	24, 35, 55, 64, 81, 104, 113, 92,
+	49, 64, 78, 87, 103, 121, 120, 101,
+	72, 92, 95, 98, 112, 100, 103, 99,
+}
+
+// qimCoefficients are the low/mid frequencies (natural order) QIM uses in
+// every luminance block. They are coarsely quantized by no common quality
+// setting and stay clear of the image header coefficients 8 and 16.
+var qimCoefficients = []int{2, 9, 3, 10, 17, 24}
+
+// NormalizeQIMStep returns the step actually used for s (tenths of the
+// reference table): the default for 0, clamped to what the header can hold
+func NormalizeQIMStep(s int) int {
+	switch {
+	case s <= 0:
+		return DefaultQIMStep
+	case s < 5:
+		return 5
+	case s > 255:
+		return 255
+	}
+	return s
+}
+
+// qimDelta returns the lattice step for natural coefficient pos
+func qimDelta(pos, step int) float64 {
+	return float64(qimReferenceTable[pos]) * float64(NormalizeQIMStep(step)) / 10
+}
+
+// qimLatticePoint returns the point of the bit lattice nearest to v
+func qimLatticePoint(v, delta float64, bit int32) float64 {
+	offset := -delta / 4
+	if bit == 1 {
+		offset = delta / 4
+	}
+	return offset + delta*math.Round((v-offset)/delta)
+}
+
+// qimSoft returns the confidence in [-1, 1] that v carries a 1: the
+// difference of its distances to the two lattices, which always add up to
+// step/2
+func qimSoft(v, delta float64) float64 {
+	d0 := math.Abs(v - qimLatticePoint(v, delta, 0))
+	d1 := math.Abs(v - qimLatticePoint(v, delta, 1))
+	return (d0 - d1) / (delta / 2)
+}
+
+// qimEmbed moves coefficient c (quantized with q) onto the lattice of bit.
+// When q is too coarse to land near the lattice point, the nearest
+// quantized value that still decodes to bit is used.
+func qimEmbed(c int32, q uint16, delta float64, bit int32) int32 {
+	return qimEmbedDithered(c, q, delta, 0, bit)
+}
+
+// qimEmbedDithered is qimEmbed with both lattices shifted by dither
+func qimEmbedDithered(c int32, q uint16, delta, dither float64, bit int32) int32 {
+	target := dither + qimLatticePoint(float64(c)*float64(q)-dither, delta, bit)
+	best := int32(math.Round(target / float64(q)))
+	decodes := func(v int32) bool {
+		return (qimSoft(float64(v)*float64(q)-dither, delta) > 0) == (bit == 1)
+	}
+	if decodes(best) {
+		return best
+	}
+	dist := func(v int32) float64 { return math.Abs(float64(v)*float64(q) - target) }
+	lo, hi := best-1, best+1
+	switch {
+	case decodes(lo) && (!decodes(hi) || dist(lo) <= dist(hi)):
+		return lo
+	case decodes(hi):
+		return hi
+	}
+	return best
+}
+
+// embedQIM moves the coefficients in slots (raster order over
+// qimCoefficients, see GoDCTProcessor.slots) onto the lattices of data
+func embedQIM(slots []*int32, q *[64]uint16, data []byte, step int) {
+	for i, coef := range slots {
+		pos := qimCoefficients[i%len(qimCoefficients)]
+		bit := int32(data[i/8]>>(7-i%8)) & 1
+		*coef = qimEmbed(*coef, q[pos], qimDelta(pos, step), bit)
+	}
+}
+
+// extractQIMSoft returns the soft value of bits 0..bits-1; bits beyond the
+// image capacity are 0 (no information)
+func extractQIMSoft(slots []*int32, q *[64]uint16, bits, step int) []float64 {
+	soft := make([]float64, bits)
+	for i, coef := range slots {
+		pos := qimCoefficients[i%len(qimCoefficients)]
+		soft[i] = qimSoft(float64(*coef)*float64(q[pos]), qimDelta(pos, step))
+	}
+	return soft
+}
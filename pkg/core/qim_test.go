@@ -0,0 +1,127 @@
+package core
+
+import (
+	"bytes"
+	"image/jpeg"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// recompress decodes the JPEG at path to pixels and saves it again at
+// quality, like an upload pipeline would
+func recompress(t *testing.T, path string, quality int) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := jpeg.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "recompressed.jpg")
+	w, err := os.Create(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := jpeg.Encode(w, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func bitErrors(a, b []byte) int {
+	errors := 0
+	for i := range a {
+		for x := a[i] ^ b[i]; x != 0; x &= x - 1 {
+			errors++
+		}
+	}
+	return errors
+}
+
+func TestQIMSoftValues(t *testing.T) {
+	delta := 20.0
+	for _, bit := range []int32{0, 1} {
+		for _, v := range []float64{-37, -3, 0, 12, 55} {
+			p := qimLatticePoint(v, delta, bit)
+			soft := qimSoft(p, delta)
+			if (bit == 1 && soft != 1) || (bit == 0 && soft != -1) {
+				t.Errorf("lattice point %v of bit %d has soft value %v", p, bit, soft)
+			}
+		}
+	}
+	// Halfway between the lattices there is no information
+	if soft := qimSoft(0, delta); soft != 0 {
+		t.Errorf("expected 0 midway between lattices, got %v", soft)
+	}
+}
+
+func TestQIMSurvivesRecompression(t *testing.T) {
+	cover := recompress(t, writeTestJPEG(t, 256, 256), 95)
+	stego := filepath.Join(t.TempDir(), "stego.jpg")
+
+	payload := make([]byte, 96)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range payload {
+		payload[i] = byte(rng.Uint32())
+	}
+
+	processor := NewGoDCTProcessor()
+	if err := processor.EmbedData(cover, stego, payload, DCTStrategyQIM); err != nil {
+		t.Fatalf("EmbedData failed: %v", err)
+	}
+	got, err := processor.ExtractData(stego, len(payload), DCTStrategyQIM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("payload damaged before recompression: %d bit errors", bitErrors(got, payload))
+	}
+
+	// The default step is sized for a quality 70 re-save
+	for _, quality := range []int{85, 70} {
+		resaved := recompress(t, stego, quality)
+		got, err := processor.ExtractData(resaved, len(payload), DCTStrategyQIM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := bitErrors(got, payload); n != 0 {
+			t.Errorf("q95 -> q%d: %d bit errors of %d", quality, n, len(payload)*8)
+		}
+	}
+
+	// A larger step buys survival at lower qualities
+	strong := NewGoDCTProcessorWithParams(DCTParams{QIMStep: 30})
+	if err := strong.EmbedData(cover, stego, payload, DCTStrategyQIM); err != nil {
+		t.Fatal(err)
+	}
+	soft, err := strong.ExtractSoftBits(recompress(t, stego, 50), len(payload)*8, DCTStrategyQIM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range soft {
+		bit := payload[i/8] >> (7 - i%8) & 1
+		if (v > 0) != (bit == 1) {
+			t.Fatalf("step 3.0, q95 -> q50: bit %d decoded wrong (soft %.2f)", i, v)
+		}
+	}
+}
+
+func TestQIMStepRecordedInImageHeader(t *testing.T) {
+	data, err := ImageHeader{Method: EmbedMethodDirect, Strategy: DCTStrategyQIM, QIMStep: 30}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := ParseImageHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Params() != (DCTParams{QIMStep: 30}) {
+		t.Errorf("expected QIM step 30, got %+v", h.Params())
+	}
+}
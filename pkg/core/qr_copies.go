@@ -0,0 +1,122 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxQRCopies caps the copies of an embedded QR: every copy changes more
+// coefficients for a shrinking gain
+const MaxQRCopies = 15
+
+// QRCopiesAuto asks for as many copies as the spare capacity holds
+const QRCopiesAuto = 0
+
+// ParseQRCopies parses a copy setting: off (one copy), auto or a count
+// between 1 and MaxQRCopies
+func ParseQRCopies(s string) (int, error) {
+	switch s = strings.ToLower(strings.TrimSpace(s)); s {
+	case "", "off":
+		return 1, nil
+	case "auto":
+		return QRCopiesAuto, nil
+	}
+	copies, err := strconv.Atoi(s)
+	if err != nil || copies < 1 || copies > MaxQRCopies {
+		return 0, fmt.Errorf("invalid QR copies %q: use off, auto or 1-%d", s, MaxQRCopies)
+	}
+	return copies, nil
+}
+
+// QRCopies returns how many copies of a size byte bitstream fit in capacity
+// bits, at least 1 and at most MaxQRCopies
+func QRCopies(capacity, size int) int {
+	if size <= 0 {
+		return 1
+	}
+	return max(1, min(capacity/(size*8), MaxQRCopies))
+}
+
+// QRCopies returns the copies of the QR module matrix the header describes,
+// 1 for pixel bitmaps and grids
+func (h ImageHeader) QRCopies() int {
+	if h.QRModules == 0 || h.Method == EmbedMethodQRGrid {
+		return 1
+	}
+	return max(1, h.PayloadLength/qrBitmapBytes(h.QRModules))
+}
+
+// ExtractQRCopies reads copies consecutive copies of a size byte bitstream
+// and folds them into one. Processors reporting confidences
+// (SoftDCTExtractor) get a soft vote, the sum of the confidences of each
+// bit; the others a majority vote. Ties keep the bit of the first copy.
+func ExtractQRCopies(processor DCTProcessor, inputPath string, size, copies int, strategy DCTStrategy) ([]byte, error) {
+	if copies <= 1 {
+		return processor.ExtractData(inputPath, size, strategy)
+	}
+
+	bits := size * 8
+	var soft []float64
+	if extractor, ok := processor.(SoftDCTExtractor); ok {
+		var err error
+		if soft, err = extractor.ExtractSoftBits(inputPath, bits*copies, strategy); err != nil {
+			return nil, err
+		}
+	} else {
+		data, err := processor.ExtractData(inputPath, size*copies, strategy)
+		if err != nil {
+			return nil, err
+		}
+		soft = make([]float64, bits*copies)
+		for i := range soft {
+			soft[i] = float64(int(data[i/8]>>(7-i%8)&1)*2 - 1)
+		}
+	}
+	return voteQRCopies(soft, size, copies), nil
+}
+
+// ExtractQRCopiesStream is ExtractQRCopies for a JPEG read from r, always
+// with a soft vote
+func ExtractQRCopiesStream(processor StreamDCTProcessor, r io.Reader, size, copies int, strategy DCTStrategy) ([]byte, error) {
+	if copies <= 1 {
+		return processor.ExtractDataStream(r, size, strategy)
+	}
+	soft, err := processor.ExtractSoftBitsStream(r, size*8*copies, strategy)
+	if err != nil {
+		return nil, err
+	}
+	return voteQRCopies(soft, size, copies), nil
+}
+
+// voteQRCopies folds the soft bits of copies consecutive copies of a size
+// byte bitstream into one
+func voteQRCopies(soft []float64, size, copies int) []byte {
+	bits := size * 8
+	out := make([]byte, size)
+	for i := 0; i < bits; i++ {
+		sum := 0.0
+		for c := 0; c < copies; c++ {
+			sum += soft[c*bits+i]
+		}
+		if sum > 0 || (sum == 0 && soft[i] > 0) {
+			out[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return out
+}
+
+// ResolveQRCopies returns the copies of a size byte bitstream to embed:
+// copies itself, or for QRCopiesAuto as many as the spare capacity of the
+// image holds
+func ResolveQRCopies(processor DCTProcessor, inputPath string, size, copies int, strategy DCTStrategy) (int, error) {
+	if copies != QRCopiesAuto {
+		return copies, nil
+	}
+	capacity, err := processor.CalculateImageCapacity(inputPath, strategy)
+	if err != nil {
+		return 0, fmt.Errorf("failed to calculate capacity: %w", err)
+	}
+	return QRCopies(capacity, size), nil
+}
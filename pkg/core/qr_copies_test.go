@@ -0,0 +1,100 @@
+package core
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseQRCopies(t *testing.T) {
+	for input, want := range map[string]int{"": 1, "off": 1, "auto": QRCopiesAuto, "3": 3, "15": 15} {
+		if got, err := ParseQRCopies(input); err != nil || got != want {
+			t.Errorf("ParseQRCopies(%q) = %d, %v; want %d", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"0", "16", "-2", "many"} {
+		if _, err := ParseQRCopies(input); err == nil {
+			t.Errorf("ParseQRCopies(%q) should fail", input)
+		}
+	}
+
+	if got := QRCopies(4096, 137); got != 3 {
+		t.Errorf("expected 3 copies of 137 bytes in 4096 bits, got %d", got)
+	}
+	if got := QRCopies(100, 137); got != 1 {
+		t.Errorf("expected at least one copy, got %d", got)
+	}
+	if got := QRCopies(1<<20, 10); got != MaxQRCopies {
+		t.Errorf("expected copies capped at %d, got %d", MaxQRCopies, got)
+	}
+}
+
+func TestQRCopiesOutvoteDamagedCopy(t *testing.T) {
+	cover := writeTestJPEG(t, 512, 512)
+	dir := t.TempDir()
+	stego := filepath.Join(dir, "stego.jpg")
+	payload := "three copies, two of them intact"
+
+	service := newTestService()
+	if err := service.EmbedQRCodeWithCopies(cover, stego, payload, DCTStrategySingle, 3, "test-env"); err != nil {
+		t.Fatalf("EmbedQRCodeWithCopies failed: %v", err)
+	}
+	header, err := ReadImageHeader(stego)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := qrBitmapBytes(header.QRModules)
+	if header.QRCopies() != 3 || header.PayloadLength != 3*size {
+		t.Fatalf("header does not describe 3 copies: %+v", *header)
+	}
+
+	// Invert the whole first copy: a plain read sees garbage, the vote
+	// follows the two intact copies
+	processor := NewGoDCTProcessor()
+	all, err := processor.ExtractData(stego, size, DCTStrategySingle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inverted := make([]byte, size)
+	for i, b := range all {
+		inverted[i] = ^b
+	}
+	if err := processor.EmbedData(stego, stego, inverted, DCTStrategySingle); err != nil {
+		t.Fatal(err)
+	}
+
+	voted, err := ExtractQRCopies(processor, stego, size, 3, DCTStrategySingle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(voted, all) {
+		t.Error("vote did not restore the module matrix")
+	}
+
+	qrPath := filepath.Join(dir, "qr.png")
+	if err := service.ExtractQRCode(stego, qrPath, "test-env"); err != nil {
+		t.Fatalf("ExtractQRCode failed: %v", err)
+	}
+	got, err := service.ReadQRCode(qrPath)
+	if err != nil || got != payload {
+		t.Errorf("expected %q, got %q (%v)", payload, got, err)
+	}
+}
+
+func TestQRCopiesAutoFillsCapacity(t *testing.T) {
+	cover := writeTestJPEG(t, 256, 256)
+	stego := filepath.Join(t.TempDir(), "stego.jpg")
+
+	service := newTestService()
+	if err := service.EmbedQRCodeWithCopies(cover, stego, "auto", DCTStrategyMulti, QRCopiesAuto, "test-env"); err != nil {
+		t.Fatalf("EmbedQRCodeWithCopies failed: %v", err)
+	}
+	header, err := ReadImageHeader(stego)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1024 blocks with 4 coefficients hold 4096 bits, 56 bytes per 21x21 matrix
+	if want := QRCopies(4096, qrBitmapBytes(header.QRModules)); header.QRCopies() != want || want < 2 {
+		t.Errorf("expected %d copies, header records %d", want, header.QRCopies())
+	}
+}
@@ -0,0 +1,455 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/BuddhiLW/crypt/pkg/fec"
+)
+
+// Module matrices are decoded directly (ISO/IEC 18004): format
+// information, unmasking, codeword placement, Reed-Solomon correction and
+// the numeric, alphanumeric and byte segments go-qrcode writes. Rendering
+// them for an image recognizer fails on large versions.
+
+// qrBlocks describes the error correction blocks of one version and
+// level: EC codewords per block, then count and data codewords of the two
+// block groups
+type qrBlocks struct {
+	ec            int
+	count1, data1 int
+	count2, data2 int
+}
+
+// qrBlockTable is indexed by version-1 and level L, M, Q, H
+var qrBlockTable = [40][4]qrBlocks{
+	{{7, 1, 19, 0, 0}, {10, 1, 16, 0, 0}, {13, 1, 13, 0, 0}, {17, 1, 9, 0, 0}},                // 1
+	{{10, 1, 34, 0, 0}, {16, 1, 28, 0, 0}, {22, 1, 22, 0, 0}, {28, 1, 16, 0, 0}},              // 2
+	{{15, 1, 55, 0, 0}, {26, 1, 44, 0, 0}, {18, 2, 17, 0, 0}, {22, 2, 13, 0, 0}},              // 3
+	{{20, 1, 80, 0, 0}, {18, 2, 32, 0, 0}, {26, 2, 24, 0, 0}, {16, 4, 9, 0, 0}},               // 4
+	{{26, 1, 108, 0, 0}, {24, 2, 43, 0, 0}, {18, 2, 15, 2, 16}, {22, 2, 11, 2, 12}},           // 5
+	{{18, 2, 68, 0, 0}, {16, 4, 27, 0, 0}, {24, 4, 19, 0, 0}, {28, 4, 15, 0, 0}},              // 6
+	{{20, 2, 78, 0, 0}, {18, 4, 31, 0, 0}, {18, 2, 14, 4, 15}, {26, 4, 13, 1, 14}},            // 7
+	{{24, 2, 97, 0, 0}, {22, 2, 38, 2, 39}, {22, 4, 18, 2, 19}, {26, 4, 14, 2, 15}},           // 8
+	{{30, 2, 116, 0, 0}, {22, 3, 36, 2, 37}, {20, 4, 16, 4, 17}, {24, 4, 12, 4, 13}},          // 9
+	{{18, 2, 68, 2, 69}, {26, 4, 43, 1, 44}, {24, 6, 19, 2, 20}, {28, 6, 15, 2, 16}},          // 10
+	{{20, 4, 81, 0, 0}, {30, 1, 50, 4, 51}, {28, 4, 22, 4, 23}, {24, 3, 12, 8, 13}},           // 11
+	{{24, 2, 92, 2, 93}, {22, 6, 36, 2, 37}, {26, 4, 20, 6, 21}, {28, 7, 14, 4, 15}},          // 12
+	{{26, 4, 107, 0, 0}, {22, 8, 37, 1, 38}, {24, 8, 20, 4, 21}, {22, 12, 11, 4, 12}},         // 13
+	{{30, 3, 115, 1, 116}, {24, 4, 40, 5, 41}, {20, 11, 16, 5, 17}, {24, 11, 12, 5, 13}},      // 14
+	{{22, 5, 87, 1, 88}, {24, 5, 41, 5, 42}, {30, 5, 24, 7, 25}, {24, 11, 12, 7, 13}},         // 15
+	{{24, 5, 98, 1, 99}, {28, 7, 45, 3, 46}, {24, 15, 19, 2, 20}, {30, 3, 15, 13, 16}},        // 16
+	{{28, 1, 107, 5, 108}, {28, 10, 46, 1, 47}, {28, 1, 22, 15, 23}, {28, 2, 14, 17, 15}},     // 17
+	{{30, 5, 120, 1, 121}, {26, 9, 43, 4, 44}, {28, 17, 22, 1, 23}, {28, 2, 14, 19, 15}},      // 18
+	{{28, 3, 113, 4, 114}, {26, 3, 44, 11, 45}, {26, 17, 21, 4, 22}, {26, 9, 13, 16, 14}},     // 19
+	{{28, 3, 107, 5, 108}, {26, 3, 41, 13, 42}, {30, 15, 24, 5, 25}, {28, 15, 15, 10, 16}},    // 20
+	{{28, 4, 116, 4, 117}, {26, 17, 42, 0, 0}, {28, 17, 22, 6, 23}, {30, 19, 16, 6, 17}},      // 21
+	{{28, 2, 111, 7, 112}, {28, 17, 46, 0, 0}, {30, 7, 24, 16, 25}, {24, 34, 13, 0, 0}},       // 22
+	{{30, 4, 121, 5, 122}, {28, 4, 47, 14, 48}, {30, 11, 24, 14, 25}, {30, 16, 15, 14, 16}},   // 23
+	{{30, 6, 117, 4, 118}, {28, 6, 45, 14, 46}, {30, 11, 24, 16, 25}, {30, 30, 16, 2, 17}},    // 24
+	{{26, 8, 106, 4, 107}, {28, 8, 47, 13, 48}, {30, 7, 24, 22, 25}, {30, 22, 15, 13, 16}},    // 25
+	{{28, 10, 114, 2, 115}, {28, 19, 46, 4, 47}, {28, 28, 22, 6, 23}, {30, 33, 16, 4, 17}},    // 26
+	{{30, 8, 122, 4, 123}, {28, 22, 45, 3, 46}, {30, 8, 23, 26, 24}, {30, 12, 15, 28, 16}},    // 27
+	{{30, 3, 117, 10, 118}, {28, 3, 45, 23, 46}, {30, 4, 24, 31, 25}, {30, 11, 15, 31, 16}},   // 28
+	{{30, 7, 116, 7, 117}, {28, 21, 45, 7, 46}, {30, 1, 23, 37, 24}, {30, 19, 15, 26, 16}},    // 29
+	{{30, 5, 115, 10, 116}, {28, 19, 47, 10, 48}, {30, 15, 24, 25, 25}, {30, 23, 15, 25, 16}}, // 30
+	{{30, 13, 115, 3, 116}, {28, 2, 46, 29, 47}, {30, 42, 24, 1, 25}, {30, 23, 15, 28, 16}},   // 31
+	{{30, 17, 115, 0, 0}, {28, 10, 46, 23, 47}, {30, 10, 24, 35, 25}, {30, 19, 15, 35, 16}},   // 32
+	{{30, 17, 115, 1, 116}, {28, 14, 46, 21, 47}, {30, 29, 24, 19, 25}, {30, 11, 15, 46, 16}}, // 33
+	{{30, 13, 115, 6, 116}, {28, 14, 46, 23, 47}, {30, 44, 24, 7, 25}, {30, 59, 16, 1, 17}},   // 34
+	{{30, 12, 121, 7, 122}, {28, 12, 47, 26, 48}, {30, 39, 24, 14, 25}, {30, 22, 15, 41, 16}}, // 35
+	{{30, 6, 121, 14, 122}, {28, 6, 47, 34, 48}, {30, 46, 24, 10, 25}, {30, 2, 15, 64, 16}},   // 36
+	{{30, 17, 122, 4, 123}, {28, 29, 46, 14, 47}, {30, 49, 24, 10, 25}, {30, 24, 15, 46, 16}}, // 37
+	{{30, 4, 122, 18, 123}, {28, 13, 46, 32, 47}, {30, 48, 24, 14, 25}, {30, 42, 15, 32, 16}}, // 38
+	{{30, 20, 117, 4, 118}, {28, 40, 47, 7, 48}, {30, 43, 24, 22, 25}, {30, 10, 15, 67, 16}},  // 39
+	{{30, 19, 118, 6, 119}, {28, 18, 47, 31, 48}, {30, 34, 24, 34, 25}, {30, 20, 15, 61, 16}}, // 40
+}
+
+// qrLevelBits are the error correction bits of the format information,
+// in the order of qrBlockTable
+var qrLevelBits = [4]int{1, 0, 3, 2}
+
+// qrFormatCodes maps each of the 32 masked format codes to its level
+// (index into qrBlockTable) and mask pattern
+var qrFormatCodes = func() map[int][2]int {
+	codes := make(map[int][2]int, 32)
+	for level, bits := range qrLevelBits {
+		for mask := 0; mask < 8; mask++ {
+			data := bits<<3 | mask
+			rem := data << 10
+			for i := 14; i >= 10; i-- {
+				if rem&(1<<i) != 0 {
+					rem ^= 0x537 << (i - 10)
+				}
+			}
+			codes[(data<<10|rem)^0x5412] = [2]int{level, mask}
+		}
+	}
+	return codes
+}()
+
+// qrAlphanumeric is the alphabet of alphanumeric segments
+const qrAlphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// qrMatrix is a module matrix being decoded
+type qrMatrix struct {
+	size    int
+	version int
+	modules []byte
+}
+
+func (m *qrMatrix) dark(row, col int) bool {
+	i := row*m.size + col
+	return m.modules[i/8]>>(7-i%8)&1 == 1
+}
+
+// decodeQRModules decodes a module matrix written by GenerateModules
+func decodeQRModules(modules []byte, size int) (string, error) {
+	if !ValidQRModules(size) {
+		return "", fmt.Errorf("%d modules is not the side of a QR symbol", size)
+	}
+	if len(modules) < qrBitmapBytes(size) {
+		return "", fmt.Errorf("%d bytes do not hold a %dx%d module QR", len(modules), size, size)
+	}
+	m := &qrMatrix{size: size, version: (size - 17) / 4, modules: modules}
+
+	level, mask, err := m.format()
+	if err != nil {
+		return "", err
+	}
+	blocks := qrBlockTable[m.version-1][level]
+	total := blocks.count1*(blocks.data1+blocks.ec) + blocks.count2*(blocks.data2+blocks.ec)
+	codewords := m.codewords(mask, total)
+	if len(codewords) < total {
+		return "", fmt.Errorf("QR version %d holds %d codewords, expected %d", m.version, len(codewords), total)
+	}
+	data, err := correctQRBlocks(codewords, blocks)
+	if err != nil {
+		return "", err
+	}
+	return parseQRSegments(data, m.version)
+}
+
+// format reads the two copies of the format information and returns the
+// level and mask of the valid code closest to either
+func (m *qrMatrix) format() (int, int, error) {
+	var first, second int
+	bit := func(code *int, row, col int) {
+		*code <<= 1
+		if m.dark(row, col) {
+			*code |= 1
+		}
+	}
+	for col := 0; col < 6; col++ {
+		bit(&first, 8, col)
+	}
+	bit(&first, 8, 7)
+	bit(&first, 8, 8)
+	bit(&first, 7, 8)
+	for row := 5; row >= 0; row-- {
+		bit(&first, row, 8)
+	}
+	for row := m.size - 1; row >= m.size-7; row-- {
+		bit(&second, row, 8)
+	}
+	for col := m.size - 8; col < m.size; col++ {
+		bit(&second, 8, col)
+	}
+
+	best, distance := [2]int{}, 16
+	for code, info := range qrFormatCodes {
+		for _, read := range []int{first, second} {
+			if d := bitCount(code ^ read); d < distance {
+				best, distance = info, d
+			}
+		}
+	}
+	if distance > 3 {
+		return 0, 0, errors.New("QR format information is unreadable")
+	}
+	return best[0], best[1], nil
+}
+
+func bitCount(x int) int {
+	n := 0
+	for ; x != 0; x &= x - 1 {
+		n++
+	}
+	return n
+}
+
+// function reports whether a module belongs to a function pattern: the
+// finders with their separators and format information, the timing
+// patterns, the alignment patterns and the version information
+func (m *qrMatrix) function(row, col int) bool {
+	n := m.size
+	switch {
+	case row <= 8 && (col <= 8 || col >= n-8), row >= n-8 && col <= 8:
+		return true
+	case row == 6 || col == 6:
+		return true
+	case m.version >= 7 && ((row < 6 && col >= n-11) || (col < 6 && row >= n-11)):
+		return true
+	}
+	centers := qrAlignmentCenters(m.version)
+	last := len(centers) - 1
+	for i, cy := range centers {
+		for j, cx := range centers {
+			// No pattern sits on the three finder corners
+			if (i == 0 && (j == 0 || j == last)) || (i == last && j == 0) {
+				continue
+			}
+			if row >= cy-2 && row <= cy+2 && col >= cx-2 && col <= cx+2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// qrAlignmentCenters returns the row and column centers of the alignment
+// patterns of version
+func qrAlignmentCenters(version int) []int {
+	if version < 2 {
+		return nil
+	}
+	count := version/7 + 2
+	last := 4*version + 10
+	step := 26
+	if version != 32 {
+		step = (version*4 + count*2 + 1) / (2*count - 2) * 2
+	}
+	centers := make([]int, count)
+	centers[0] = 6
+	for i := count - 1; i > 0; i-- {
+		centers[i] = last - (count-1-i)*step
+	}
+	return centers
+}
+
+// qrMasked reports whether mask pattern mask flips the module at row, col
+func qrMasked(mask, row, col int) bool {
+	switch mask {
+	case 0:
+		return (row+col)%2 == 0
+	case 1:
+		return row%2 == 0
+	case 2:
+		return col%3 == 0
+	case 3:
+		return (row+col)%3 == 0
+	case 4:
+		return (row/2+col/3)%2 == 0
+	case 5:
+		return row*col%2+row*col%3 == 0
+	case 6:
+		return (row*col%2+row*col%3)%2 == 0
+	default:
+		return ((row+col)%2+row*col%3)%2 == 0
+	}
+}
+
+// codewords reads up to total codewords in placement order: two-module
+// columns from the right, alternately upwards and downwards, skipping the
+// vertical timing pattern
+func (m *qrMatrix) codewords(mask, total int) []byte {
+	out := make([]byte, 0, total)
+	var current byte
+	bits := 0
+	up := true
+	for right := m.size - 1; right > 0; right -= 2 {
+		if right == 6 {
+			right--
+		}
+		for count := 0; count < m.size; count++ {
+			row := count
+			if up {
+				row = m.size - 1 - count
+			}
+			for col := right; col > right-2; col-- {
+				if m.function(row, col) {
+					continue
+				}
+				current <<= 1
+				if m.dark(row, col) != qrMasked(mask, row, col) {
+					current |= 1
+				}
+				if bits++; bits == 8 {
+					out = append(out, current)
+					if len(out) == total {
+						return out
+					}
+					current, bits = 0, 0
+				}
+			}
+		}
+		up = !up
+	}
+	return out
+}
+
+// correctQRBlocks de-interleaves the codewords into their blocks, corrects
+// each one and returns the data codewords in order
+func correctQRBlocks(codewords []byte, b qrBlocks) ([]byte, error) {
+	lengths := make([]int, 0, b.count1+b.count2)
+	for i := 0; i < b.count1; i++ {
+		lengths = append(lengths, b.data1)
+	}
+	for i := 0; i < b.count2; i++ {
+		lengths = append(lengths, b.data2)
+	}
+	blocks := make([][]byte, len(lengths))
+	for i, n := range lengths {
+		blocks[i] = make([]byte, n+b.ec)
+	}
+
+	k := 0
+	for i := 0; i < max(b.data1, b.data2); i++ {
+		for j, n := range lengths {
+			if i < n {
+				blocks[j][i] = codewords[k]
+				k++
+			}
+		}
+	}
+	for i := 0; i < b.ec; i++ {
+		for j, n := range lengths {
+			blocks[j][n+i] = codewords[k]
+			k++
+		}
+	}
+
+	rs, err := fec.NewReedSolomon(b.ec)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	for i, block := range blocks {
+		msg, _, err := rs.Decode(block)
+		if err != nil {
+			return nil, fmt.Errorf("QR block %d: %w", i, err)
+		}
+		data = append(data, msg...)
+	}
+	return data, nil
+}
+
+// qrBitReader reads the bits of the data codewords
+type qrBitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *qrBitReader) left() int {
+	return len(r.data)*8 - r.pos
+}
+
+func (r *qrBitReader) read(n int) (int, error) {
+	if n > r.left() {
+		return 0, errors.New("QR data ends inside a segment")
+	}
+	v := 0
+	for i := 0; i < n; i++ {
+		v = v<<1 | int(r.data[r.pos/8]>>(7-r.pos%8)&1)
+		r.pos++
+	}
+	return v, nil
+}
+
+// parseQRSegments decodes the segments of the data codewords up to the
+// terminator
+func parseQRSegments(data []byte, version int) (string, error) {
+	sizeClass := 0
+	if version >= 27 {
+		sizeClass = 2
+	} else if version >= 10 {
+		sizeClass = 1
+	}
+	r := &qrBitReader{data: data}
+	var out strings.Builder
+	for r.left() >= 4 {
+		mode, _ := r.read(4)
+		switch mode {
+		case 0: // terminator
+			return out.String(), nil
+		case 1: // numeric
+			count, err := r.read([3]int{10, 12, 14}[sizeClass])
+			if err != nil {
+				return "", err
+			}
+			for ; count > 0; count -= 3 {
+				digits := min(count, 3)
+				v, err := r.read([4]int{0, 4, 7, 10}[digits])
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprintf(&out, "%0*d", digits, v)
+			}
+		case 2: // alphanumeric
+			count, err := r.read([3]int{9, 11, 13}[sizeClass])
+			if err != nil {
+				return "", err
+			}
+			for ; count > 1; count -= 2 {
+				v, err := r.read(11)
+				if err != nil {
+					return "", err
+				}
+				if v >= 45*45 {
+					return "", errors.New("invalid QR alphanumeric pair")
+				}
+				out.WriteByte(qrAlphanumeric[v/45])
+				out.WriteByte(qrAlphanumeric[v%45])
+			}
+			if count == 1 {
+				v, err := r.read(6)
+				if err != nil {
+					return "", err
+				}
+				if v >= 45 {
+					return "", errors.New("invalid QR alphanumeric character")
+				}
+				out.WriteByte(qrAlphanumeric[v])
+			}
+		case 4: // byte
+			count, err := r.read([3]int{8, 16, 16}[sizeClass])
+			if err != nil {
+				return "", err
+			}
+			for i := 0; i < count; i++ {
+				v, err := r.read(8)
+				if err != nil {
+					return "", err
+				}
+				out.WriteByte(byte(v))
+			}
+		case 7: // ECI designator, the payload is passed on as bytes
+			first, err := r.read(8)
+			if err != nil {
+				return "", err
+			}
+			extra := 0
+			if first&0xC0 == 0x80 {
+				extra = 8
+			} else if first&0xE0 == 0xC0 {
+				extra = 16
+			}
+			if _, err := r.read(extra); err != nil {
+				return "", err
+			}
+		case 3: // structured append header
+			if _, err := r.read(16); err != nil {
+				return "", err
+			}
+		case 5: // FNC1 in first position
+		case 9: // FNC1 in second position
+			if _, err := r.read(8); err != nil {
+				return "", err
+			}
+		default:
+			return "", fmt.Errorf("unsupported QR segment mode %d", mode)
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,239 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrQRGridTooSmall is returned when the tiles do not fit in the image
+var ErrQRGridTooSmall = errors.New("image too small for the QR grid")
+
+// QRGridLayout places equally sized square tiles in the luminance plane,
+// row by row from the top left block. Tiles are 8x8-block aligned and do not
+// overlap, so each one can be read back on its own.
+type QRGridLayout struct {
+	Columns, Rows int
+	TileBlocks    int // side of a tile in blocks
+	Tiles         []BlockRegion
+}
+
+// NewQRGridLayout lays out tiles tiles of tileBlocks x tileBlocks blocks in
+// a plane of widthInBlocks x heightInBlocks blocks
+func NewQRGridLayout(widthInBlocks, heightInBlocks, tiles, tileBlocks int) (*QRGridLayout, error) {
+	if tiles < 1 || tileBlocks < 1 {
+		return nil, fmt.Errorf("invalid grid: %d tiles of %d blocks", tiles, tileBlocks)
+	}
+	columns := widthInBlocks / tileBlocks
+	rows := heightInBlocks / tileBlocks
+	if columns*rows < tiles {
+		return nil, fmt.Errorf("%w: %d tiles of %dx%d blocks do not fit in %dx%d blocks (room for %d)",
+			ErrQRGridTooSmall, tiles, tileBlocks, tileBlocks, widthInBlocks, heightInBlocks, columns*rows)
+	}
+
+	layout := &QRGridLayout{
+		Columns:    min(columns, tiles),
+		Rows:       (tiles + columns - 1) / columns,
+		TileBlocks: tileBlocks,
+		Tiles:      make([]BlockRegion, tiles),
+	}
+	for i := range layout.Tiles {
+		layout.Tiles[i] = BlockRegion{
+			X:      i % columns * tileBlocks,
+			Y:      i / columns * tileBlocks,
+			Width:  tileBlocks,
+			Height: tileBlocks,
+		}
+	}
+	return layout, nil
+}
+
+// qrTileBlocks returns the side in blocks of the smallest square tile that
+// holds the module matrix of a qrModules QR with strategy
+func qrTileBlocks(qrModules int, strategy DCTStrategy) int {
+	bits := qrBitmapBytes(qrModules) * 8
+	blocks := (bits + len(coefficientPositions(strategy)) - 1) / len(coefficientPositions(strategy))
+	side := int(math.Sqrt(float64(blocks)))
+	for side*side < blocks {
+		side++
+	}
+	return side
+}
+
+// centerBitmap places a size x size module matrix in the middle of a white
+// canvas x canvas one. Sizes of QR versions differ by 4 modules, so the
+// smaller symbol stays on whole modules.
+func centerBitmap(bitmap []byte, size, canvas int) []byte {
+	if size == canvas {
+		return bitmap
+	}
+	out := make([]byte, qrBitmapBytes(canvas))
+	offset := (canvas - size) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			src := y*size + x
+			if bitmap[src/8]>>(7-src%8)&1 == 0 {
+				continue
+			}
+			dst := (y+offset)*canvas + x + offset
+			out[dst/8] |= 1 << (7 - dst%8)
+		}
+	}
+	return out
+}
+
+// uncenterBitmap takes the size x size matrix centerBitmap placed in a
+// canvas x canvas one back out
+func uncenterBitmap(bitmap []byte, size, canvas int) []byte {
+	out := make([]byte, qrBitmapBytes(size))
+	offset := (canvas - size) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			src := (y+offset)*canvas + x + offset
+			if bitmap[src/8]>>(7-src%8)&1 == 0 {
+				continue
+			}
+			dst := y*size + x
+			out[dst/8] |= 1 << (7 - dst%8)
+		}
+	}
+	return out
+}
+
+// QRGridTile is the QR code read back from one tile of a grid image
+type QRGridTile struct {
+	Region  BlockRegion
+	Payload string
+	Err     error // why the tile did not decode, Payload is empty then
+}
+
+// QRGrid embeds several QR codes into separate tiles of one JPEG and reads
+// them back tile by tile (SRP)
+type QRGrid struct {
+	qr       QRCodeProcessor
+	dct      RegionDCTProcessor
+	params   DCTParams
+	password string // whitens the image header
+}
+
+// NewQRGridWithProcessors creates a grid on top of the given processors.
+// params are recorded in the image header for the QIM strategy.
+func NewQRGridWithProcessors(qr QRCodeProcessor, dct RegionDCTProcessor, params DCTParams) *QRGrid {
+	return &QRGrid{qr: qr, dct: dct, params: params}
+}
+
+// CreateQRGrid returns a grid using the real processors for strategy, see
+// CreateDCTProcessorFor
+func (f *ServiceFactory) CreateQRGrid(strategy DCTStrategy, password string, params DCTParams) (*QRGrid, error) {
+	processor, err := f.CreateDCTProcessorFor(strategy, password, params)
+	if err != nil {
+		return nil, err
+	}
+	region, ok := processor.(RegionDCTProcessor)
+	if !ok {
+		return nil, fmt.Errorf("%T cannot embed into regions", processor)
+	}
+	grid := NewQRGridWithProcessors(NewGoQRProcessor(), region, params)
+	grid.password = password
+	return grid, nil
+}
+
+// Embed encodes every payload as a High ECC QR code and embeds its module
+// matrix into its own tile of outputPath, centered in a matrix the size of
+// the largest one. The image header records the strategy, matrix size and
+// tile count, so Extract needs nothing else.
+func (g *QRGrid) Embed(inputPath, outputPath string, payloads []string, strategy DCTStrategy) (*QRGridLayout, error) {
+	if len(payloads) == 0 {
+		return nil, fmt.Errorf("no payloads to embed")
+	}
+	if strategy.DependsOnContent() {
+		return nil, fmt.Errorf("%s strategy cannot embed into tiles", strategy.String())
+	}
+
+	matrices := make([][]byte, len(payloads))
+	sizes := make([]int, len(payloads))
+	qrModules := 0
+	for i, payload := range payloads {
+		var err error
+		if matrices[i], sizes[i], err = g.qr.GenerateModules(payload, ECCLevelHigh); err != nil {
+			return nil, fmt.Errorf("payload %d: %w", i, err)
+		}
+		qrModules = max(qrModules, sizes[i])
+	}
+
+	layout, err := qrGridLayoutFor(inputPath, len(payloads), qrModules, strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range matrices {
+		matrices[i] = centerBitmap(matrices[i], sizes[i], qrModules)
+	}
+	if err := g.dct.EmbedRegions(inputPath, outputPath, layout.Tiles, matrices, strategy); err != nil {
+		return nil, err
+	}
+
+	header := ImageHeader{
+		Method:        EmbedMethodQRGrid,
+		Strategy:      strategy,
+		QRModules:     qrModules,
+		PayloadLength: len(payloads),
+		Threshold:     g.params.Threshold,
+		QIMStep:       g.params.QIMStep,
+	}
+	if err := WriteImageHeaderWithKey(outputPath, header, g.password); err != nil {
+		return nil, fmt.Errorf("failed to write image header: %w", err)
+	}
+	return layout, nil
+}
+
+// Extract reads the QR code of every tile of the grid image at inputPath,
+// in tile order. A tile that does not decode is reported in its Err; the
+// other tiles are unaffected.
+func (g *QRGrid) Extract(inputPath string) ([]QRGridTile, error) {
+	header, err := ReadImageHeaderWithKey(inputPath, g.password)
+	if err != nil {
+		return nil, err
+	}
+	if header.Method != EmbedMethodQRGrid || header.QRModules == 0 {
+		return nil, fmt.Errorf("%s holds a %s payload, not a QR grid", inputPath, header.Method)
+	}
+
+	layout, err := qrGridLayoutFor(inputPath, header.PayloadLength, header.QRModules, header.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	matrices, err := g.dct.ExtractRegions(inputPath, layout.Tiles, qrBitmapBytes(header.QRModules), header.Strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	tiles := make([]QRGridTile, len(layout.Tiles))
+	for i, region := range layout.Tiles {
+		tiles[i].Region = region
+		tiles[i].Payload, tiles[i].Err = g.readTile(matrices[i], header.QRModules)
+	}
+	return tiles, nil
+}
+
+// readTile decodes the matrix of a tile, which may hold a smaller symbol
+// centered by centerBitmap
+func (g *QRGrid) readTile(matrix []byte, canvas int) (string, error) {
+	payload, err := g.qr.ReadModules(matrix, canvas)
+	for size := canvas - 4; err != nil && size >= 21; size -= 4 {
+		if inner, innerErr := g.qr.ReadModules(uncenterBitmap(matrix, size, canvas), size); innerErr == nil {
+			return inner, nil
+		}
+	}
+	return payload, err
+}
+
+// qrGridLayoutFor computes the layout of tiles QRs of qrModules modules in
+// the JPEG at path; embedding and extraction derive the same one
+func qrGridLayoutFor(path string, tiles, qrModules int, strategy DCTStrategy) (*QRGridLayout, error) {
+	dims, err := NewJPEGImageProcessor().GetDimensions(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewQRGridLayout((dims.Width+7)/8, (dims.Height+7)/8, tiles, qrTileBlocks(qrModules, strategy))
+}
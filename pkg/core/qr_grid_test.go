@@ -0,0 +1,100 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+)
+
+func TestQRGridLayoutTilesAreDisjoint(t *testing.T) {
+	// 3 columns and 2 rows of 30 blocks fit in 100x70 blocks
+	layout, err := NewQRGridLayout(100, 70, 6, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.Columns != 3 || layout.Rows != 2 {
+		t.Errorf("expected a 3x2 grid, got %dx%d", layout.Columns, layout.Rows)
+	}
+	for i, a := range layout.Tiles {
+		if !a.Within(100, 70) || a.Blocks() != 900 {
+			t.Errorf("tile %d %v outside the image or of the wrong size", i, a)
+		}
+		for _, b := range layout.Tiles[i+1:] {
+			if a.X < b.X+b.Width && b.X < a.X+a.Width && a.Y < b.Y+b.Height && b.Y < a.Y+a.Height {
+				t.Errorf("tiles %v and %v overlap", a, b)
+			}
+		}
+	}
+
+	if _, err := NewQRGridLayout(100, 70, 7, 30); !errors.Is(err, ErrQRGridTooSmall) {
+		t.Errorf("expected ErrQRGridTooSmall, got %v", err)
+	}
+}
+
+func TestQRGridCarriesMoreThanOneQR(t *testing.T) {
+	// More than the 1273 bytes of the largest High ECC QR code
+	payloads := make([]string, 6)
+	total := 0
+	for i := range payloads {
+		payloads[i] = fmt.Sprintf("tile %d: %s", i, strings.Repeat(string(rune('a'+i)), 330))
+	}
+	// A short payload makes a smaller QR than the others
+	payloads[0] = `{"chunk_count":5}`
+	for _, payload := range payloads {
+		total += len(payload)
+	}
+	if _, err := qrcode.New(strings.Join(payloads, ""), qrcode.High); err == nil {
+		t.Fatalf("%d bytes should not fit in one QR code", total)
+	}
+
+	cover := writeTestJPEG(t, 1920, 1280)
+	output := strings.TrimSuffix(cover, ".jpg") + "_grid.jpg"
+	grid := NewQRGridWithProcessors(NewGoQRProcessor(), NewGoDCTProcessor(), DCTParams{})
+	layout, err := grid.Embed(cover, output, payloads, DCTStrategyDirect)
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	if len(layout.Tiles) != len(payloads) {
+		t.Fatalf("expected %d tiles, got %d", len(payloads), len(layout.Tiles))
+	}
+
+	tiles, err := grid.Extract(output)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	for i, tile := range tiles {
+		if tile.Err != nil || tile.Payload != payloads[i] {
+			t.Errorf("tile %d: got %.20q..., %v", i, tile.Payload, tile.Err)
+		}
+	}
+
+	// A damaged tile does not take the others with it
+	damaged := strings.TrimSuffix(output, ".jpg") + "_damaged.jpg"
+	dct := NewGoDCTProcessor()
+	noise := make([]byte, layout.Tiles[2].Blocks()*len(coefficientPositions(DCTStrategyDirect))/8)
+	for i := range noise {
+		noise[i] = byte(i * 37)
+	}
+	if err := dct.EmbedRegions(output, damaged, layout.Tiles[2:3], [][]byte{noise}, DCTStrategyDirect); err != nil {
+		t.Fatal(err)
+	}
+	// The header coefficients are untouched, so the grid is still found
+	tiles, err = grid.Extract(damaged)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	for i, tile := range tiles {
+		if i == 2 {
+			if tile.Err == nil && tile.Payload == payloads[i] {
+				t.Error("damaged tile still decoded")
+			}
+			continue
+		}
+		if tile.Err != nil || tile.Payload != payloads[i] {
+			t.Errorf("tile %d lost with tile 2: %v", i, tile.Err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/liyue201/goqr"
+	"github.com/skip2/go-qrcode"
+)
+
+// DefaultQRRenderScale is the pixels per module RenderModules is used with
+// when a module matrix is turned back into a QR image
+const DefaultQRRenderScale = 4
+
+// qrQuietZone is the white border, in modules, around a rendered symbol
+const qrQuietZone = 4
+
+// ValidQRModules reports whether size is the side of a QR symbol: 21 modules
+// for version 1 up to 177 for version 40
+func ValidQRModules(size int) bool {
+	return size >= 21 && size <= 177 && (size-17)%4 == 0
+}
+
+// qrBitmapBytes is the size of a one bit per module (or pixel) bitmap of a
+// size x size QR
+func qrBitmapBytes(size int) int {
+	return (size*size + 7) / 8
+}
+
+// GenerateModules encodes data as a QR symbol and returns its module matrix,
+// one bit per module in row order with 1 for dark and no quiet zone, and
+// the side of the symbol in modules
+func (p *GoQRProcessor) GenerateModules(data string, eccLevel ECCLevel) ([]byte, int, error) {
+	qr, err := qrcode.New(data, recoveryLevel(eccLevel))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to generate QR code: %w", err)
+	}
+	qr.DisableBorder = true
+	bitmap := qr.Bitmap()
+
+	size := len(bitmap)
+	modules := make([]byte, qrBitmapBytes(size))
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if i := y*size + x; dark {
+				modules[i/8] |= 1 << (7 - i%8)
+			}
+		}
+	}
+
+	// Never hand out a symbol that does not read back
+	if got, err := p.ReadModules(modules, size); err != nil || got != data {
+		return nil, 0, fmt.Errorf("QR code of %d bytes does not read back: %v", len(data), err)
+	}
+	return modules, size, nil
+}
+
+// RenderModules draws a module matrix written by GenerateModules as a clean
+// black and white symbol, scale pixels per module, with its quiet zone
+func (p *GoQRProcessor) RenderModules(modules []byte, size, scale int) (image.Image, error) {
+	if size <= 0 || scale <= 0 {
+		return nil, fmt.Errorf("invalid QR size %d at scale %d", size, scale)
+	}
+	if len(modules) < qrBitmapBytes(size) {
+		return nil, fmt.Errorf("%d bytes do not hold a %dx%d module QR", len(modules), size, size)
+	}
+
+	side := (size + 2*qrQuietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			i := y*size + x
+			if modules[i/8]>>(7-i%8)&1 == 0 {
+				continue
+			}
+			left, top := (x+qrQuietZone)*scale, (y+qrQuietZone)*scale
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray(left+dx, top+dy, color.Gray{Y: 0})
+				}
+			}
+		}
+	}
+	return img, nil
+}
+
+// ReadModules decodes a module matrix written by GenerateModules, directly
+// from its modules rather than through an image
+func (p *GoQRProcessor) ReadModules(modules []byte, size int) (string, error) {
+	return decodeQRModules(modules, size)
+}
+
+// ReadQRImage decodes the first QR code found in img
+func (p *GoQRProcessor) ReadQRImage(img image.Image) (string, error) {
+	qrCodes, err := goqr.Recognize(img)
+	if err != nil {
+		return "", fmt.Errorf("failed to recognize QR code: %w", err)
+	}
+	if len(qrCodes) == 0 {
+		return "", errors.New("no QR code found in image")
+	}
+	return string(qrCodes[0].Payload), nil
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/liyue201/goqr"
+)
+
+func TestQRModulesRoundTrip(t *testing.T) {
+	const payload = "one bit per module, not per pixel"
+	qr := NewGoQRProcessor()
+	modules, size, err := qr.GenerateModules(payload, ECCLevelHigh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ValidQRModules(size) || len(modules) != qrBitmapBytes(size) {
+		t.Fatalf("unexpected %d byte matrix of %d modules", len(modules), size)
+	}
+
+	got, err := qr.ReadModules(modules, size)
+	if err != nil || got != payload {
+		t.Fatalf("ReadModules: got %q, %v", got, err)
+	}
+
+	// The same matrix renders to a clean symbol at any scale
+	for _, scale := range []int{2, 3, 7} {
+		img, err := qr.RenderModules(modules, size, scale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (size + 2*qrQuietZone) * scale; img.Bounds().Dx() != want {
+			t.Errorf("scale %d: expected %d pixels, got %d", scale, want, img.Bounds().Dx())
+		}
+		codes, err := goqr.Recognize(img)
+		if err != nil || len(codes) == 0 || string(codes[0].Payload) != payload {
+			t.Errorf("scale %d: symbol did not decode: %v", scale, err)
+		}
+	}
+}
+
+func TestReadModulesEveryVersion(t *testing.T) {
+	// Base64 ciphertext, digits and upper case text take the byte, numeric
+	// and alphanumeric segments; the lengths walk through all 40 versions
+	rng := rand.New(rand.NewSource(1))
+	alphabets := []string{
+		"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=",
+		"0123456789",
+		"0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:",
+	}
+	qr := NewGoQRProcessor()
+	versions := map[int]bool{}
+	for _, level := range []ECCLevel{ECCLevelLow, ECCLevelMedium, ECCLevelHigh, ECCLevelHighest} {
+		for n := 1; ; n += n/50 + 1 {
+			alphabet := alphabets[n%len(alphabets)]
+			var b strings.Builder
+			for i := 0; i < n; i++ {
+				b.WriteByte(alphabet[rng.Intn(len(alphabet))])
+			}
+			payload := b.String()
+			modules, size, err := qr.GenerateModules(payload, level)
+			if err != nil {
+				if strings.Contains(err.Error(), "too long") {
+					break
+				}
+				t.Fatalf("%d bytes at level %v: %v", n, level, err)
+			}
+			versions[(size-17)/4] = true
+
+			got, err := qr.ReadModules(modules, size)
+			if err != nil || got != payload {
+				t.Fatalf("%d bytes at level %v: read %d bytes, %v", n, level, len(got), err)
+			}
+		}
+	}
+	if len(versions) != 40 {
+		t.Errorf("covered %d of 40 versions", len(versions))
+	}
+}
+
+func TestReadModulesCorrectsErrors(t *testing.T) {
+	payload := strings.Repeat("ciphertext", 120)
+	qr := NewGoQRProcessor()
+	modules, size, err := qr.GenerateModules(payload, ECCLevelHigh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Level H takes back about 30% of the codewords; flip one module in a
+	// hundred, format information included
+	rng := rand.New(rand.NewSource(2))
+	damaged := append([]byte(nil), modules...)
+	for k := 0; k < size*size/100; k++ {
+		i := rng.Intn(size * size)
+		damaged[i/8] ^= 1 << (7 - i%8)
+	}
+	got, err := qr.ReadModules(damaged, size)
+	if err != nil || got != payload {
+		t.Fatalf("damaged matrix: %v", err)
+	}
+
+	// Past that the matrix is rejected, not misread
+	for i := range damaged {
+		damaged[i] ^= byte(rng.Intn(256))
+	}
+	if got, err := qr.ReadModules(damaged, size); err == nil && got == payload {
+		t.Error("expected noise not to read back")
+	}
+	if _, err := qr.ReadModules(modules, size+1); err == nil {
+		t.Error("expected an invalid size to fail")
+	}
+}
+
+func TestEmbedQRCodeCostsOneBitPerModule(t *testing.T) {
+	// 32x32 blocks with 4 coefficients each hold 4096 bits: a 33 module
+	// matrix needs 1089, the smallest 64 pixel bitmap took all of them
+	cover := writeTestJPEG(t, 256, 256)
+	dir := t.TempDir()
+	stego := filepath.Join(dir, "stego.jpg")
+	payload := "forty bytes of ciphertext, give or take"
+
+	service := newTestService()
+	if err := service.EmbedQRCode(cover, stego, payload, DCTStrategyMulti, "test-env"); err != nil {
+		t.Fatalf("EmbedQRCode failed: %v", err)
+	}
+
+	header, err := ReadImageHeader(stego)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ValidQRModules(header.QRModules) || header.PayloadLength != qrBitmapBytes(header.QRModules) {
+		t.Errorf("header does not describe a module matrix: %+v", *header)
+	}
+
+	qrPath := filepath.Join(dir, "qr.png")
+	if err := service.ExtractQRCode(stego, qrPath, "test-env"); err != nil {
+		t.Fatalf("ExtractQRCode failed: %v", err)
+	}
+	got, err := service.ReadQRCode(qrPath)
+	if err != nil || got != payload {
+		t.Errorf("expected %q, got %q (%v)", payload, got, err)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"image/color"
 	"os"
 
-	"github.com/liyue201/goqr"
 	"github.com/skip2/go-qrcode"
 )
 
@@ -20,20 +19,7 @@ func NewGoQRProcessor() *GoQRProcessor {
 }
 
 func (p *GoQRProcessor) GenerateQR(data string, size int, eccLevel ECCLevel) ([]byte, error) {
-	// Convert our ECC level to go-qrcode level
-	var qrECC qrcode.RecoveryLevel
-	switch eccLevel {
-	case ECCLevelLow:
-		qrECC = qrcode.Low
-	case ECCLevelMedium:
-		qrECC = qrcode.Medium
-	case ECCLevelHigh:
-		qrECC = qrcode.High
-	case ECCLevelHighest:
-		qrECC = qrcode.Highest
-	default:
-		qrECC = qrcode.High // Default to High for robustness
-	}
+	qrECC := recoveryLevel(eccLevel)
 
 	// Generate QR code
 	qr, err := qrcode.New(data, qrECC)
@@ -50,6 +36,31 @@ func (p *GoQRProcessor) GenerateQR(data string, size int, eccLevel ECCLevel) ([]
 	return pngBytes, nil
 }
 
+// recoveryLevel converts our ECC level to the go-qrcode level
+func recoveryLevel(eccLevel ECCLevel) qrcode.RecoveryLevel {
+	switch eccLevel {
+	case ECCLevelLow:
+		return qrcode.Low
+	case ECCLevelMedium:
+		return qrcode.Medium
+	case ECCLevelHighest:
+		return qrcode.Highest
+	default:
+		return qrcode.High // Default to High for robustness
+	}
+}
+
+// qrPixelSize returns the rendered size that gives every module of the
+// symbol for data (quiet zone included) pixelsPerModule pixels. Symbols
+// rendered at one pixel per module often fail to decode.
+func qrPixelSize(data string, eccLevel ECCLevel, pixelsPerModule int) (int, error) {
+	qr, err := qrcode.New(data, recoveryLevel(eccLevel))
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate QR code: %w", err)
+	}
+	return len(qr.Bitmap()) * pixelsPerModule, nil
+}
+
 func (p *GoQRProcessor) ReadQR(imagePath string) (string, error) {
 	// Read image file
 	file, err := os.Open(imagePath)
@@ -64,17 +75,7 @@ func (p *GoQRProcessor) ReadQR(imagePath string) (string, error) {
 		return "", fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	// Recognize QR codes
-	qrCodes, err := goqr.Recognize(img)
-	if err != nil {
-		return "", fmt.Errorf("failed to recognize QR code: %w", err)
-	}
-
-	if len(qrCodes) == 0 {
-		return "", errors.New("no QR code found in image")
-	}
-
-	return string(qrCodes[0].Payload), nil
+	return p.ReadQRImage(img)
 }
 
 func (p *GoQRProcessor) ConvertToBitstream(pngData []byte) ([]byte, error) {
@@ -8,6 +8,7 @@ import (
 // StandardQRSizeCalculator implements QRSizeCalculator with standard QR capacity mapping
 type StandardQRSizeCalculator struct {
 	imageProcessor ImageProcessor
+	dctProcessor   DCTProcessor // optional, counts eligible coefficients
 }
 
 func NewStandardQRSizeCalculator() *StandardQRSizeCalculator {
@@ -22,6 +23,16 @@ func NewStandardQRSizeCalculatorWithProcessor(processor ImageProcessor) *Standar
 	}
 }
 
+// NewStandardQRSizeCalculatorWithDCTProcessor creates a calculator that asks
+// dctProcessor for the capacity of the actual image, so strategies that skip
+// coefficients (DCTStrategyThreshold) are not overestimated
+func NewStandardQRSizeCalculatorWithDCTProcessor(processor ImageProcessor, dctProcessor DCTProcessor) *StandardQRSizeCalculator {
+	return &StandardQRSizeCalculator{
+		imageProcessor: processor,
+		dctProcessor:   dctProcessor,
+	}
+}
+
 func (c *StandardQRSizeCalculator) CalculateOptimalSize(imagePath string, payloadSize int, strategy DCTStrategy) (int, error) {
 	// Get image dimensions
 	dims, err := c.imageProcessor.GetDimensions(imagePath)
@@ -30,7 +41,10 @@ func (c *StandardQRSizeCalculator) CalculateOptimalSize(imagePath string, payloa
 	}
 
 	// Calculate DCT capacity using the strategy
-	dctCapacityBits := c.calculateDCTCapacity(dims.Width, dims.Height, strategy)
+	dctCapacityBits, err := c.dctCapacity(imagePath, dims, strategy)
+	if err != nil {
+		return 0, err
+	}
 
 	// Calculate maximum QR size that fits in DCT capacity
 	maxQRPixelsFromDCT := int(float64(dctCapacityBits) * 0.9) // Use 90% of capacity for safety
@@ -99,6 +113,24 @@ func (c *StandardQRSizeCalculator) GetCapacityMap() map[int][2]int {
 	}
 }
 
+// dctCapacity returns the bits strategy can embed in the image. The
+// dimensions only bound the content dependent strategies, so without a DCT
+// processor their capacity is still estimated from the coefficients.
+func (c *StandardQRSizeCalculator) dctCapacity(imagePath string, dims *ImageDimensions, strategy DCTStrategy) (int, error) {
+	processor := c.dctProcessor
+	if processor == nil && strategy.DependsOnContent() {
+		processor = NewGoDCTProcessor()
+	}
+	if processor == nil {
+		return c.calculateDCTCapacity(dims.Width, dims.Height, strategy), nil
+	}
+	capacity, err := processor.CalculateImageCapacity(imagePath, strategy)
+	if err != nil {
+		return 0, fmt.Errorf("failed to calculate DCT capacity: %w", err)
+	}
+	return capacity, nil
+}
+
 func (c *StandardQRSizeCalculator) calculateDCTCapacity(width, height int, strategy DCTStrategy) int {
 	dctBlocksX := (width + 7) / 8
 	dctBlocksY := (height + 7) / 8
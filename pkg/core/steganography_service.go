@@ -1,13 +1,17 @@
 package core
 
 import (
-	"encoding/json"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"image"
+	"io"
 	"os"
 	"path/filepath"
-	"strconv"
+	"strings"
 
-	"github.com/rwxrob/bonzai/vars"
+	"github.com/BuddhiLW/crypt/pkg/seal"
 )
 
 // SteganographyService orchestrates the complete steganography workflow
@@ -17,6 +21,7 @@ type SteganographyService struct {
 	dctProcessor    DCTProcessor
 	sizeCalculator  QRSizeCalculator
 	metadataManager MetadataManager
+	headerKey       string // whitens the image headers, see WriteImageHeaderWithKey
 }
 
 // NewSteganographyService creates a new service with all dependencies
@@ -38,112 +43,112 @@ func NewSteganographyService(
 
 // EmbedQRCode embeds a QR code into a JPEG image
 func (s *SteganographyService) EmbedQRCode(inputPath, outputPath, data string, strategy DCTStrategy, env string) error {
-	// Try to get QR size from vars first, fall back to calculation
-	qrSizeStr, _ := vars.Get("qr-size", "DCT_ENV")
-	var qrSize int
-	var err error
+	return s.embedQRCodeWithMethod(inputPath, outputPath, data, strategy, env, EmbedMethodQR, 1)
+}
 
-	if qrSizeStr != "" {
-		qrSize, err = strconv.Atoi(qrSizeStr)
-		if err != nil {
-			fmt.Printf("WARNING: Invalid QR size in vars '%s', falling back to calculation: %v\n", qrSizeStr, err)
-			qrSize, err = s.sizeCalculator.CalculateOptimalSize(inputPath, len(data), strategy)
-			if err != nil {
-				return fmt.Errorf("failed to calculate QR size: %w", err)
-			}
-		} else {
-			fmt.Printf("DEBUG: Using QR size from vars: %d\n", qrSize)
-		}
-	} else {
-		// Calculate optimal QR size
-		qrSize, err = s.sizeCalculator.CalculateOptimalSize(inputPath, len(data), strategy)
-		if err != nil {
-			return fmt.Errorf("failed to calculate QR size: %w", err)
-		}
-		fmt.Printf("DEBUG: Using calculated QR size: %d\n", qrSize)
-	}
+// EmbedQRCodeWithCopies embeds copies copies of the QR into disjoint
+// coefficients, read back by a vote over all of them. QRCopiesAuto fills the
+// spare capacity of the image.
+func (s *SteganographyService) EmbedQRCodeWithCopies(inputPath, outputPath, data string, strategy DCTStrategy, copies int, env string) error {
+	return s.embedQRCodeWithMethod(inputPath, outputPath, data, strategy, env, EmbedMethodQR, copies)
+}
 
-	// Generate QR code with High ECC
-	qrPNG, err := s.qrProcessor.GenerateQR(data, qrSize, ECCLevelHigh)
+// EmbedQRCodeStream is EmbedQRCodeWithCopies for a cover read from r, with
+// the stego image written to w. Nothing is written to the filesystem: the
+// strategy is recorded in the image header only, not the metadata manager.
+func (s *SteganographyService) EmbedQRCodeStream(r io.Reader, w io.Writer, data string, strategy DCTStrategy, copies int, env string) error {
+	cover, err := io.ReadAll(r)
 	if err != nil {
-		return fmt.Errorf("failed to generate QR code: %w", err)
-	}
-
-	// Debug: Save the generated QR code to a file for inspection
-	debugQRPath := filepath.Join(filepath.Dir(outputPath), "debug_generated_qr.png")
-	if err := os.WriteFile(debugQRPath, qrPNG, 0644); err != nil {
-		fmt.Printf("WARNING: Failed to save debug QR code: %v\n", err)
-	} else {
-		fmt.Printf("DEBUG: Saved generated QR code to %s\n", debugQRPath)
+		return fmt.Errorf("failed to read cover: %w", err)
 	}
-
-	// Convert PNG to bitstream
-	bitstream, err := s.qrProcessor.ConvertToBitstream(qrPNG)
+	stego, err := s.embedQR(cover, data, strategy, env, EmbedMethodQR, copies)
 	if err != nil {
-		return fmt.Errorf("failed to convert QR to bitstream: %w", err)
+		return err
 	}
-
-	// Get actual dimensions from generated QR
-	img, err := s.imageProcessor.DecodeJPEG(inputPath)
-	if err != nil {
-		return fmt.Errorf("failed to decode input image: %w", err)
+	if _, err := w.Write(stego); err != nil {
+		return fmt.Errorf("failed to write stego image: %w", err)
 	}
-	actualQRSize := img.Bounds().Dx()
-
-	// Calculate actual data area (83% of pixels contain actual data)
-	actualDataArea := int(float64(actualQRSize) * 0.83)
-	actualDataArea = (actualDataArea / 8) * 8 // Round to multiple of 8
+	return nil
+}
 
-	// Store metadata
-	err = s.metadataManager.StoreQRMetadata(actualQRSize, len(bitstream), actualDataArea, env)
+// embedQRCodeWithMethod is embedQR between files
+func (s *SteganographyService) embedQRCodeWithMethod(inputPath, outputPath, data string, strategy DCTStrategy, env string, method EmbedMethod, copies int) error {
+	cover, err := os.ReadFile(inputPath)
 	if err != nil {
-		return fmt.Errorf("failed to store QR metadata: %w", err)
+		return fmt.Errorf("failed to read cover: %w", err)
 	}
-
-	err = s.metadataManager.StoreDCTStrategy(strategy, env)
+	stego, err := s.embedQR(cover, data, strategy, env, method, copies)
 	if err != nil {
-		return fmt.Errorf("failed to store DCT strategy: %w", err)
+		return err
 	}
-
-	// Embed bitstream using DCT
-	err = s.dctProcessor.EmbedData(inputPath, outputPath, bitstream, strategy)
-	if err != nil {
-		return fmt.Errorf("failed to embed data: %w", err)
+	if err := os.WriteFile(outputPath, stego, 0644); err != nil {
+		return fmt.Errorf("failed to write stego image: %w", err)
 	}
 
+	// The header is authoritative; the vars copy serves tools that predate it
+	if err := s.metadataManager.StoreDCTStrategy(strategy, env); err != nil {
+		return fmt.Errorf("failed to store DCT strategy: %w", err)
+	}
 	return nil
 }
 
-// ExtractQRCode extracts a QR code from a JPEG image
-func (s *SteganographyService) ExtractQRCode(inputPath, outputPath, env string) error {
-	// Retrieve metadata
-	pixelSize, _, _, err := s.metadataManager.RetrieveQRMetadata(env)
+// embedQR embeds data into the JPEG in cover as the module matrix of a
+// High ECC QR code, one bit per module, and records method in the image
+// header. The QR version follows from the data; no pixel size is involved.
+func (s *SteganographyService) embedQR(cover []byte, data string, strategy DCTStrategy, env string, method EmbedMethod, copies int) ([]byte, error) {
+	processor, err := s.streamProcessor()
 	if err != nil {
-		return fmt.Errorf("failed to retrieve QR metadata: %w", err)
+		return nil, err
 	}
-
-	strategy, err := s.metadataManager.RetrieveDCTStrategy(env)
+	modules, size, err := s.qrProcessor.GenerateModules(data, ECCLevelHigh)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve DCT strategy: %w", err)
+		return nil, err
 	}
 
-	// Calculate buffer size for extraction
-	fullPixelSize := pixelSize * pixelSize / 8
-	qrBitstream := make([]byte, fullPixelSize)
+	if copies == QRCopiesAuto {
+		capacity, err := processor.CalculateStreamCapacity(bytes.NewReader(cover), strategy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate capacity: %w", err)
+		}
+		copies = QRCopies(capacity, len(modules))
+	}
 
-	// Extract bitstream using DCT
-	extractedData, err := s.dctProcessor.ExtractData(inputPath, fullPixelSize, strategy)
+	// Embed module matrix using DCT, the copies one after the other
+	payload := bytes.Repeat(modules, copies)
+	var stego bytes.Buffer
+	err = processor.EmbedDataStream(bytes.NewReader(cover), &stego, payload, strategy)
 	if err != nil {
-		return fmt.Errorf("failed to extract data: %w", err)
+		return nil, fmt.Errorf("failed to embed data: %w", err)
+	}
+
+	// Only the header describes the module matrix, so it must be written.
+	// The copy count follows from the payload length.
+	header := ImageHeader{Method: method, Strategy: strategy, QRModules: size, PayloadLength: len(payload)}
+	var out bytes.Buffer
+	if err := WriteImageHeaderStreamWithKey(&stego, &out, header, s.headerKey); err != nil {
+		return nil, fmt.Errorf("failed to write image header: %w", err)
 	}
+	return out.Bytes(), nil
+}
 
-	// Copy extracted data to our buffer
-	copy(qrBitstream, extractedData)
+// streamProcessor returns the DCT processor of s for JPEGs in memory
+func (s *SteganographyService) streamProcessor() (StreamDCTProcessor, error) {
+	processor, ok := s.dctProcessor.(StreamDCTProcessor)
+	if !ok {
+		return nil, fmt.Errorf("%T cannot process JPEGs in memory", s.dctProcessor)
+	}
+	return processor, nil
+}
 
-	// Convert bitstream back to QR image
-	img, err := s.qrProcessor.ConvertFromBitstream(qrBitstream, pixelSize)
+// ExtractQRCode extracts a QR code from a JPEG image
+func (s *SteganographyService) ExtractQRCode(inputPath, outputPath, env string) error {
+	jpeg, err := os.ReadFile(inputPath)
 	if err != nil {
-		return fmt.Errorf("failed to convert bitstream to QR image: %w", err)
+		return fmt.Errorf("failed to read image: %w", err)
+	}
+	img, err := s.extractQRImage(jpeg, env)
+	if err != nil {
+		return fmt.Errorf("%s: %w", inputPath, err)
 	}
 
 	// Save QR code as PNG
@@ -155,189 +160,370 @@ func (s *SteganographyService) ExtractQRCode(inputPath, outputPath, env string)
 	return nil
 }
 
-// ReadQRCode reads a QR code from an image file
-func (s *SteganographyService) ReadQRCode(imagePath string) (string, error) {
-	return s.qrProcessor.ReadQR(imagePath)
+// ExtractQRCodeStream extracts the QR code of a JPEG read from r and
+// renders it, without writing anything to the filesystem
+func (s *SteganographyService) ExtractQRCodeStream(r io.Reader, env string) (image.Image, error) {
+	jpeg, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	return s.extractQRImage(jpeg, env)
 }
 
-// EmbedMultiQRWithMetadata embeds data as multiple QR codes with hash-based metadata
-func (s *SteganographyService) EmbedMultiQRWithMetadata(inputPath, outputDir, data, env string) error {
-	fmt.Printf("DEBUG: ===== EmbedMultiQRWithMetadata START =====\n")
-	fmt.Printf("DEBUG: EmbedMultiQRWithMetadata called with inputPath=%s, outputDir=%s, dataLength=%d\n",
-		inputPath, outputDir, len(data))
-
-	// Create temporary directory for multi-QR files following Bonzai patterns
-	tempDir, err := os.MkdirTemp("", "crypt-multiqr-*")
+// ReadQRCodeStream decodes the QR code embedded in a JPEG read from r
+func (s *SteganographyService) ReadQRCodeStream(r io.Reader, env string) (string, error) {
+	jpeg, err := io.ReadAll(r)
 	if err != nil {
-		return fmt.Errorf("failed to create temp directory: %w", err)
+		return "", fmt.Errorf("failed to read image: %w", err)
 	}
-	defer func() {
-		if err := os.RemoveAll(tempDir); err != nil {
-			fmt.Printf("WARNING: Failed to clean up temp directory %s: %v\n", tempDir, err)
-		}
-	}()
-
-	fmt.Printf("DEBUG: Created temp directory: %s\n", tempDir)
-
-	// Import the encrypt package function for embedding QR codes
-	// We'll use a direct approach to avoid circular dependencies
-
-	// Create metadata file in temp directory
-	metadataPath := filepath.Join(tempDir, "metadata.jpeg")
-	fmt.Printf("DEBUG: Creating metadata file at %s\n", metadataPath)
+	layout, bitstream, err := s.extractQRBitstream(jpeg, env)
+	if err != nil {
+		return "", err
+	}
+	if layout.QRModules > 0 {
+		return s.qrProcessor.ReadModules(bitstream, layout.QRModules)
+	}
+	img, err := s.qrProcessor.ConvertFromBitstream(bitstream, layout.QRPixelSize)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert bitstream to QR image: %w", err)
+	}
+	return s.qrProcessor.ReadQRImage(img)
+}
 
-	// Calculate optimal chunk size and count first
-	// QR code can store ~50-80 characters in 96x96 QR code with high ECC
-	// Use 50 bytes per chunk for safety with 96x96 QR codes
-	maxChunkSize := 50
-	dataLen := len(data)
-	chunkCount := (dataLen + maxChunkSize - 1) / maxChunkSize // Ceiling division
+// extractQRImage extracts the embedded QR and renders it: module matrices
+// as a clean symbol, legacy pixel bitmaps as they were embedded
+func (s *SteganographyService) extractQRImage(jpeg []byte, env string) (image.Image, error) {
+	layout, bitstream, err := s.extractQRBitstream(jpeg, env)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Printf("DEBUG: Data length: %d bytes, splitting into %d chunks of max %d bytes each\n", dataLen, chunkCount, maxChunkSize)
+	if layout.QRModules > 0 {
+		return s.qrProcessor.RenderModules(bitstream, layout.QRModules, DefaultQRRenderScale)
+	}
+	img, err := s.qrProcessor.ConvertFromBitstream(bitstream, layout.QRPixelSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert bitstream to QR image: %w", err)
+	}
+	return img, nil
+}
 
-	// Create proper metadata structure for multi-QR system
-	metadata := map[string]interface{}{
-		"grid_width":  1,
-		"grid_height": 1,
-		"chunk_count": chunkCount,
-		"chunk_size":  maxChunkSize,
-		"total_size":  dataLen,
-		"qr_size":     96,
-		"padding":     24,
+// extractQRBitstream reads the layout of the QR in jpeg and its bitstream,
+// voting over the copies
+func (s *SteganographyService) extractQRBitstream(jpeg []byte, env string) (*ImageHeader, []byte, error) {
+	processor, err := s.streamProcessor()
+	if err != nil {
+		return nil, nil, err
+	}
+	layout, err := s.qrLayout(jpeg, env)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	metadataJSON, jsonErr := json.Marshal(metadata)
-	if jsonErr != nil {
-		return fmt.Errorf("failed to create metadata JSON: %w", jsonErr)
+	size := layout.QRModules
+	if size == 0 {
+		size = layout.QRPixelSize
+	}
+	bitstream, err := ExtractQRCopiesStream(processor, bytes.NewReader(jpeg), qrBitmapBytes(size), layout.QRCopies(), layout.Strategy)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to extract data: %w", err)
 	}
+	return layout, bitstream, nil
+}
 
-	// Store QR size in vars for metadata embedding (use the same env as extraction)
-	if err := vars.Set("qr-size", "96", "DCT_ENV"); err != nil {
-		fmt.Printf("WARNING: Failed to store QR size for metadata: %v\n", err)
+// qrLayout reads the QR size and strategy from the image header, falling
+// back to the metadata manager for legacy images
+func (s *SteganographyService) qrLayout(jpeg []byte, env string) (*ImageHeader, error) {
+	header, err := ReadImageHeaderStreamWithKey(bytes.NewReader(jpeg), s.headerKey)
+	if err == nil {
+		switch header.Method {
+		case EmbedMethodDirect:
+			return nil, fmt.Errorf("image holds a direct DCT payload, not a QR code")
+		case EmbedMethodQRGrid:
+			return nil, fmt.Errorf("image holds a grid of %d QR codes, not a single one", header.PayloadLength)
+		}
+		return header, nil
 	}
-	if err := vars.Set("QR_DATA_AREA", "72", "DCT_ENV"); err != nil {
-		fmt.Printf("WARNING: Failed to store QR data area for metadata: %v\n", err)
+
+	// Retrieve metadata
+	pixelSize, _, _, err := s.metadataManager.RetrieveQRMetadata(env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve QR metadata: %w", err)
 	}
 
-	err = embedQRCodeInJPEG(inputPath, metadataPath, string(metadataJSON))
+	strategy, err := s.metadataManager.RetrieveDCTStrategy(env)
 	if err != nil {
-		return fmt.Errorf("failed to create metadata file: %w", err)
+		return nil, fmt.Errorf("failed to retrieve DCT strategy: %w", err)
 	}
-	fmt.Printf("DEBUG: Successfully created metadata file\n")
+	return &ImageHeader{QRPixelSize: pixelSize, Strategy: strategy}, nil
+}
+
+// ReadQRCode reads a QR code from an image file
+func (s *SteganographyService) ReadQRCode(imagePath string) (string, error) {
+	return s.qrProcessor.ReadQR(imagePath)
+}
 
-	// Use the calculated chunk count and sizes
+// Multi-QR layout: every QR goes into the whole cover with the direct
+// strategy
+const (
+	multiQRChunkSize = 256
+	multiQRStrategy  = DCTStrategyDirect
+)
 
-	// Create chunk files in temp directory
-	for i := 0; i < chunkCount; i++ {
-		chunkPath := filepath.Join(tempDir, fmt.Sprintf("chunk_%d.jpeg", i))
-		fmt.Printf("DEBUG: Creating chunk file %d at %s\n", i, chunkPath)
+// EmbedMultiQRWithMetadata embeds data as multiple QR codes with hash-based metadata
+func (s *SteganographyService) EmbedMultiQRWithMetadata(inputPath, outputDir, data, env string) error {
+	return s.EmbedMultiQRStream(inputPath, outputDir, strings.NewReader(data), env)
+}
 
-		// Calculate chunk boundaries
-		start := i * maxChunkSize
-		end := start + maxChunkSize
-		if end > dataLen {
-			end = dataLen
-		}
-		chunkData := string(data[start:end])
+// EmbedMultiQRStream is EmbedMultiQRWithMetadata for a payload read from r.
+// Each chunk file is written as soon as its bytes are read, so the payload
+// never sits in memory whole; the metadata, which needs the hashes of all
+// chunks, comes last. When anything fails the files written are removed.
+func (s *SteganographyService) EmbedMultiQRStream(inputPath, outputDir string, r io.Reader, env string) error {
+	cover, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read cover: %w", err)
+	}
 
-		fmt.Printf("DEBUG: Chunk %d: bytes %d-%d (length: %d), first 50 chars: %s\n",
-			i, start, end-1, len(chunkData), chunkData[:min(50, len(chunkData))])
+	var written []string
+	fail := func(err error) error {
+		for _, path := range written {
+			os.Remove(path)
+		}
+		return err
+	}
+	writeFile := func(name string, data []byte) error {
+		path := filepath.Join(outputDir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		written = append(written, path)
+		return nil
+	}
 
-		// Store QR size in vars for extraction (use the same env as extraction)
-		if err := vars.Set("qr-size", "96", "DCT_ENV"); err != nil {
-			fmt.Printf("WARNING: Failed to store QR size: %v\n", err)
+	var chunks []ChunkInfo
+	checksum := sha256.New()
+	total := 0
+	buf := make([]byte, multiQRChunkSize)
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fail(fmt.Errorf("failed to read payload: %w", err))
 		}
-		if err := vars.Set("QR_DATA_AREA", "72", "DCT_ENV"); err != nil {
-			fmt.Printf("WARNING: Failed to store QR data area: %v\n", err)
+		if n == 0 {
+			break
 		}
+		chunkData := buf[:n]
+		checksum.Write(chunkData)
+		total += n
 
-		err = embedQRCodeInJPEG(inputPath, chunkPath, chunkData)
+		fileName := fmt.Sprintf("chunk_%d.jpeg", i)
+		image, err := s.embedMultiQRPayload(cover, string(chunkData), env)
 		if err != nil {
-			return fmt.Errorf("failed to create chunk file %d: %w", i, err)
+			return fail(fmt.Errorf("failed to create chunk file %d: %w", i, err))
+		}
+		if err := writeFile(fileName, image); err != nil {
+			return fail(err)
+		}
+		info := ChunkInfo{Index: i, Position: [2]int{0, i}, Size: n, Hash: calculateChunkHash(chunkData), FileName: fileName}
+		chunks = append(chunks, info)
+		if n < multiQRChunkSize {
+			break
 		}
-		fmt.Printf("DEBUG: Successfully created chunk file %d\n", i)
 	}
 
-	// Copy all files from temp directory to output directory
-	if err := copyDirectory(tempDir, outputDir); err != nil {
-		return fmt.Errorf("failed to copy files to output directory: %w", err)
+	metadata := NewMultiQRMetadata(total, multiQRChunkSize, [2]int{1, len(chunks)})
+	metadata.Checksum = fmt.Sprintf("%x", checksum.Sum(nil))
+	for _, info := range chunks {
+		metadata.addChunkInfo(info)
+	}
+	packed, err := metadata.Pack()
+	if err != nil {
+		return fail(fmt.Errorf("failed to create metadata: %w", err))
+	}
+	image, err := s.embedMultiQRPayload(cover, packed, env)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create metadata file: %w", err))
+	}
+	if err := writeFile("metadata.jpeg", image); err != nil {
+		return fail(err)
 	}
-
-	fmt.Printf("DEBUG: Successfully copied all files to %s\n", outputDir)
 	return nil
 }
 
-// embedQRCodeInJPEG embeds QR code data into a JPEG file
-func embedQRCodeInJPEG(inputPath, outputPath, qrData string) error {
-	fmt.Printf("DEBUG: embedQRCodeInJPEG called with inputPath=%s, outputPath=%s, qrDataLength=%d\n",
-		inputPath, outputPath, len(qrData))
-
-	// Use the factory to create a service with the real DCT processor
-	factory := NewServiceFactory()
-	service := factory.CreateSteganographyService("multiqr") // Use multiqr env
-
-	fmt.Printf("DEBUG: Created service for QR embedding\n")
-
-	err := service.EmbedQRCode(inputPath, outputPath, qrData, DCTStrategySingle, "multiqr")
+// embedMultiQRPayload embeds payload into cover as one QR of the multi-QR
+// set
+func (s *SteganographyService) embedMultiQRPayload(cover []byte, payload, env string) ([]byte, error) {
+	processor, err := s.streamProcessor()
+	if err != nil {
+		return nil, err
+	}
+	_, size, err := s.qrProcessor.GenerateModules(payload, ECCLevelHigh)
+	if err != nil {
+		return nil, err
+	}
+	capacity, err := processor.CalculateStreamCapacity(bytes.NewReader(cover), multiQRStrategy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate capacity: %w", err)
+	}
+	if size*size > capacity {
+		return nil, fmt.Errorf("%dx%d module QR for %d bytes exceeds the %d bit capacity of the cover", size, size, len(payload), capacity)
+	}
+	image, err := s.embedQR(cover, payload, multiQRStrategy, env, EmbedMethodMultiQR, 1)
 	if err != nil {
-		return fmt.Errorf("failed to embed QR code: %w", err)
+		return nil, err
 	}
 
-	fmt.Printf("DEBUG: Successfully embedded QR code\n")
+	// Never write an image the scanner cannot read back
+	if got, err := s.ReadQRCodeStream(bytes.NewReader(image), env); err != nil || got != payload {
+		return nil, fmt.Errorf("QR of %d bytes does not read back from the cover: %v", len(payload), err)
+	}
+	return image, nil
+}
+
+// writeFiles writes files, by name, into dir
+func writeFiles(dir string, files map[string][]byte) error {
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// min returns the minimum of two integers
-func min(a, b int) int {
-	if a < b {
-		return a
+// ExtractMultiQRWithMetadata reads the metadata QR from metadataFile, finds
+// its chunks among the images in chunkDir and decrypts the result with key
+func (s *SteganographyService) ExtractMultiQRWithMetadata(metadataFile, chunkDir, key, env string) (string, error) {
+	r, _, err := s.ExtractMultiQRStream(metadataFile, chunkDir, key, env)
+	if err != nil {
+		return "", err
 	}
-	return b
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
 }
 
-// copyDirectory copies all files from src to dst
-func copyDirectory(src, dst string) error {
-	entries, err := os.ReadDir(src)
+// ExtractMultiQRStream is ExtractMultiQRWithMetadata returning a reader of
+// the plaintext, see openMultiQR, and the report of the chunk scan. The
+// report is also returned when the chunks cannot be opened.
+func (s *SteganographyService) ExtractMultiQRStream(metadataFile, chunkDir, key, env string) (io.Reader, *MultiQRScanReport, error) {
+	payload, err := s.readMultiQRPayload(metadataFile, env)
 	if err != nil {
-		return err
+		return nil, nil, fmt.Errorf("failed to read metadata QR: %w", err)
+	}
+	metadata, err := UnpackMultiQRMetadata(payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", metadataFile, err)
 	}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+	files, err := multiQRImageFiles(chunkDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var chunkFiles []string
+	for _, file := range files {
+		if !sameFile(file, metadataFile) {
+			chunkFiles = append(chunkFiles, file)
 		}
+	}
 
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
+	report := NewMultiQRFileScannerWithReader(s.QRPayloadReader(env)).ScanChunkFiles(metadata, chunkFiles)
+	r, err := s.openMultiQR(report, key)
+	return r, report, err
+}
 
-		srcFile, err := os.Open(srcPath)
+// ScanAndExtractMultiQR decodes every image in directory, tells the
+// metadata QR from the chunks by content and decrypts the result with key.
+// Without metadata the payload is rebuilt from fountain symbols. File
+// names and their order do not matter.
+func (s *SteganographyService) ScanAndExtractMultiQR(directory, key, env string) (string, error) {
+	r, _, err := s.ScanAndExtractMultiQRStream(directory, key, env)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// ScanAndExtractMultiQRStream is ScanAndExtractMultiQR returning a reader
+// of the plaintext, see openMultiQR, and the report of the scan. The report
+// is also returned when the scan found files but they cannot be opened.
+func (s *SteganographyService) ScanAndExtractMultiQRStream(directory, key, env string) (io.Reader, *MultiQRScanReport, error) {
+	report, err := NewMultiQRFileScannerWithReader(s.QRPayloadReader(env)).Scan(directory)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := s.openMultiQR(report, key)
+	return r, report, err
+}
+
+// openMultiQR reassembles the chunks, or decodes the fountain symbols, of a
+// scan and returns a reader decrypting them with key. Chunks are decoded
+// and decrypted as they are read: the plaintext of a streamed payload comes
+// out a verified segment at a time and is never held whole.
+func (s *SteganographyService) openMultiQR(report *MultiQRScanReport, key string) (io.Reader, error) {
+	var data io.Reader
+	if report.Metadata == nil {
+		decoded, err := decodeFountain(report)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		defer srcFile.Close()
-
-		dstFile, err := os.Create(dstPath)
+		data = bytes.NewReader(decoded)
+	} else {
+		assembled, err := report.Metadata.AssembleReader(report.Payloads())
 		if err != nil {
-			return err
+			return nil, err
 		}
-		defer dstFile.Close()
+		data = assembled
+	}
 
-		if _, err := dstFile.ReadFrom(srcFile); err != nil {
-			return err
-		}
+	plaintext, err := seal.OpenReader(base64.NewDecoder(base64.StdEncoding, data), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
 	}
+	return plaintext, nil
+}
 
-	return nil
+// QRPayloadReader returns a reader that decodes multi-QR images with s
+func (s *SteganographyService) QRPayloadReader(env string) QRPayloadReader {
+	return serviceQRPayloadReader{service: s, env: env}
 }
 
-// ExtractMultiQRWithMetadata extracts data from multiple QR codes using metadata
-func (s *SteganographyService) ExtractMultiQRWithMetadata(metadataFile, chunkDir, key, env string) (string, error) {
-	// This will be implemented to use the enhanced multi-QR functionality
-	return "", fmt.Errorf("enhanced multi-QR extraction not yet implemented")
+// serviceQRPayloadReader implements QRPayloadReader with a service
+type serviceQRPayloadReader struct {
+	service *SteganographyService
+	env     string
 }
 
-// ScanAndExtractMultiQR scans directory and automatically extracts data
-func (s *SteganographyService) ScanAndExtractMultiQR(directory, key, env string) (string, error) {
-	// This will be implemented to use the enhanced multi-QR functionality
-	return "", fmt.Errorf("enhanced multi-QR scanning not yet implemented")
+func (r serviceQRPayloadReader) ReadQRPayload(path string) (string, error) {
+	return r.service.readMultiQRPayload(path, r.env)
+}
+
+// readMultiQRPayload decodes the QR in path: embedded in a JPEG, or a plain
+// QR image
+func (s *SteganographyService) readMultiQRPayload(path, env string) (string, error) {
+	if strings.EqualFold(filepath.Ext(path), ".png") {
+		return s.qrProcessor.ReadQR(path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open image: %w", err)
+	}
+	defer file.Close()
+	payload, err := s.ReadQRCodeStream(file, env)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return payload, nil
+}
+
+func sameFile(a, b string) bool {
+	ia, errA := os.Stat(a)
+	ib, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(ia, ib)
 }
@@ -0,0 +1,302 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/BuddhiLW/crypt/pkg/fec"
+	"github.com/BuddhiLW/crypt/pkg/seal"
+)
+
+// newTestService returns a service with the real processors that keeps
+// its metadata in memory, so tests write no vars files
+func newTestService() *SteganographyService {
+	factory := NewServiceFactory()
+	images := NewJPEGImageProcessor()
+	dct := factory.CreateDCTProcessor()
+	return NewSteganographyService(images, NewGoQRProcessor(), dct,
+		NewStandardQRSizeCalculatorWithDCTProcessor(images, dct), NewMockMetadataManager())
+}
+
+// fixedRandom makes crypto/rand deterministic until the test ends, so salts
+// and nonces, and with them every QR, are the same on each run
+func fixedRandom(t *testing.T) {
+	saved := rand.Reader
+	rand.Reader = mathrand.New(mathrand.NewSource(1))
+	t.Cleanup(func() { rand.Reader = saved })
+}
+
+// sealedPayload encrypts plaintext like `encrypt text` does
+func sealedPayload(t *testing.T, plaintext, password string) string {
+	t.Helper()
+	sealed, err := seal.Seal([]byte(plaintext), password, seal.ScryptParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sealed)
+}
+
+func TestMultiQRRoundTripIgnoresFileNamesAndOrder(t *testing.T) {
+	fixedRandom(t)
+	const password = "multi-qr-password"
+	plaintext := strings.Repeat("spread over several images. ", 12)
+	data := sealedPayload(t, plaintext, password)
+	if len(data) <= 2*multiQRChunkSize {
+		t.Fatalf("payload of %d bytes should need at least 3 chunks", len(data))
+	}
+
+	cover := writeTestJPEG(t, 1024, 768)
+	dir := t.TempDir()
+	service := newTestService()
+	if err := service.EmbedMultiQRWithMetadata(cover, dir, data, "multiqr-test"); err != nil {
+		t.Fatalf("EmbedMultiQRWithMetadata failed: %v", err)
+	}
+
+	// Names that sort in the wrong order and say nothing about the content
+	renames := map[string]string{
+		"metadata.jpeg": "c.jpeg",
+		"chunk_0.jpeg":  "z.jpeg",
+		"chunk_1.jpeg":  "a.jpeg",
+		"chunk_2.jpeg":  "m.jpeg",
+	}
+	for from, to := range renames {
+		if err := os.Rename(filepath.Join(dir, from), filepath.Join(dir, to)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := service.ScanAndExtractMultiQR(dir, password, "multiqr-test")
+	if err != nil {
+		t.Fatalf("ScanAndExtractMultiQR failed: %v", err)
+	}
+	if got != plaintext {
+		t.Errorf("scan: expected %q, got %q", plaintext, got)
+	}
+
+	got, err = service.ExtractMultiQRWithMetadata(filepath.Join(dir, "c.jpeg"), dir, password, "multiqr-test")
+	if err != nil {
+		t.Fatalf("ExtractMultiQRWithMetadata failed: %v", err)
+	}
+	if got != plaintext {
+		t.Errorf("extract: expected %q, got %q", plaintext, got)
+	}
+
+	// A lost chunk is reported, not silently skipped
+	if err := os.Remove(filepath.Join(dir, "a.jpeg")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.ScanAndExtractMultiQR(dir, password, "multiqr-test"); err == nil || !strings.Contains(err.Error(), "missing 1 of") {
+		t.Errorf("expected a missing chunk error, got %v", err)
+	}
+}
+
+func TestMultiQRCarriesLargePayloads(t *testing.T) {
+	// 4000 bytes of plaintext make over 20 chunks; the metadata QR stays small
+	const password = "multi-qr-password"
+	plaintext := strings.Repeat("0123456789", 400)
+	data := sealedPayload(t, plaintext, password)
+
+	cover := writeTestJPEG(t, 1024, 768)
+	dir := t.TempDir()
+	service := newTestService()
+	if err := service.EmbedMultiQRWithMetadata(cover, dir, data, "multiqr-test"); err != nil {
+		t.Fatalf("EmbedMultiQRWithMetadata failed: %v", err)
+	}
+	got, err := service.ScanAndExtractMultiQR(dir, password, "multiqr-test")
+	if err != nil {
+		t.Fatalf("ScanAndExtractMultiQR failed: %v", err)
+	}
+	if got != plaintext {
+		t.Errorf("expected %d bytes of plaintext back, got %d", len(plaintext), len(got))
+	}
+}
+
+func TestMultiQRStreamsSegmentedPayloads(t *testing.T) {
+	fixedRandom(t)
+	const password = "multi-qr-password"
+	plaintext := bytes.Repeat([]byte("segment after segment. "), 30)
+
+	// Seal as a stream of small segments and embed its base64 as it is written
+	var sealed bytes.Buffer
+	encoder := base64.NewEncoder(base64.StdEncoding, &sealed)
+	w, err := seal.NewWriterSize(encoder, password, seal.ScryptParams(), 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(plaintext)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	encoder.Close()
+	chunks := (sealed.Len() + multiQRChunkSize - 1) / multiQRChunkSize
+
+	cover := writeTestJPEG(t, 1024, 768)
+	dir := t.TempDir()
+	service := newTestService()
+	if err := service.EmbedMultiQRStream(cover, dir, &sealed, "multiqr-test"); err != nil {
+		t.Fatalf("EmbedMultiQRStream failed: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != chunks+1 {
+		t.Fatalf("expected %d chunks and the metadata, found %d files", chunks, len(entries))
+	}
+
+	r, report, err := service.ScanAndExtractMultiQRStream(dir, password, "multiqr-test")
+	if err != nil {
+		t.Fatalf("ScanAndExtractMultiQRStream failed: %v", err)
+	}
+	if !report.Complete() || len(report.Warnings) != 0 {
+		t.Errorf("unexpected report: %s %v", report.Summary(), report.Warnings)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading the plaintext failed: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("expected %d bytes of plaintext back, got %d", len(plaintext), len(got))
+	}
+
+	// A payload that fails part way leaves no files behind
+	failDir := t.TempDir()
+	broken := io.MultiReader(strings.NewReader(strings.Repeat("A", 3*multiQRChunkSize)), iotest.ErrReader(errors.New("disk gone")))
+	if err := service.EmbedMultiQRStream(cover, failDir, broken, "multiqr-test"); err == nil {
+		t.Fatal("expected the read error")
+	}
+	if entries, _ := os.ReadDir(failDir); len(entries) != 0 {
+		t.Errorf("expected no files after a failure, found %d", len(entries))
+	}
+}
+
+func TestMultiQRFountainSurvivesLostImages(t *testing.T) {
+	const password = "fountain-password"
+	plaintext := strings.Repeat("any K of N images will do. ", 12)
+	data := sealedPayload(t, plaintext, password)
+
+	cover := writeTestJPEG(t, 1024, 768)
+	dir := t.TempDir()
+	service := newTestService()
+	encoder, err := fec.NewLTEncoder([]byte(data), fountainBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := encoder.K()
+	if err := service.EmbedMultiQRFountain(cover, dir, data, "multiqr-test", k+4); err != nil {
+		t.Fatalf("EmbedMultiQRFountain failed: %v", err)
+	}
+
+	// Lose a source block image, picking one the remaining symbols cover
+	lost := -1
+	for id := 0; id < k && lost < 0; id++ {
+		decoder := fec.NewLTDecoder()
+		for other := 0; other < k+4; other++ {
+			if other != id {
+				decoder.Add(encoder.Symbol(uint32(other)))
+			}
+		}
+		if decoder.Complete() {
+			lost = id
+		}
+	}
+	if lost < 0 {
+		t.Fatal("no source block can be spared")
+	}
+	if err := os.Remove(filepath.Join(dir, fmt.Sprintf("symbol_%d.jpeg", lost))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, fmt.Sprintf("symbol_%d.jpeg", k+3)), filepath.Join(dir, "a.jpeg")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := service.ScanAndExtractMultiQR(dir, password, "multiqr-test")
+	if err != nil {
+		t.Fatalf("ScanAndExtractMultiQR failed: %v", err)
+	}
+	if got != plaintext {
+		t.Errorf("expected %q, got %q", plaintext, got)
+	}
+}
+
+// TestQRCodeStreamLeavesNoFiles embeds and reads a QR code in memory and
+// checks nothing lands in the temporary directory or next to the output
+func TestQRCodeStreamLeavesNoFiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	cover, err := os.ReadFile(writeTestJPEG(t, 512, 384))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := NewMockMetadataManager()
+	service := newTestService()
+	service.metadataManager = metadata
+
+	const data = "streamed without temp files"
+	var stego bytes.Buffer
+	if err := service.EmbedQRCodeStream(bytes.NewReader(cover), &stego, data, DCTStrategyMulti, 2, "test-env"); err != nil {
+		t.Fatalf("EmbedQRCodeStream failed: %v", err)
+	}
+	got, err := service.ReadQRCodeStream(bytes.NewReader(stego.Bytes()), "test-env")
+	if err != nil {
+		t.Fatalf("ReadQRCodeStream failed: %v", err)
+	}
+	if got != data {
+		t.Errorf("expected %q, got %q", data, got)
+	}
+	if len(metadata.strategies) != 0 {
+		t.Errorf("the stream API stored vars: %v", metadata.strategies)
+	}
+
+	// The file API shares the code path and writes only the output
+	dir := t.TempDir()
+	input := filepath.Join(dir, "cover.jpg")
+	if err := os.WriteFile(input, cover, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.EmbedQRCode(input, filepath.Join(dir, "stego.jpg"), data, DCTStrategySingle, "test-env"); err != nil {
+		t.Fatalf("EmbedQRCode failed: %v", err)
+	}
+	for _, d := range []string{tmp, dir} {
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			if d == tmp || (e.Name() != "cover.jpg" && e.Name() != "stego.jpg") {
+				t.Errorf("unexpected file %s in %s", e.Name(), d)
+			}
+		}
+	}
+}
+
+func TestQRCodeStreamKeysTheHeader(t *testing.T) {
+	cover, err := os.ReadFile(writeTestJPEG(t, 512, 384))
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := newTestService()
+	service.headerKey = "service-header-key"
+
+	const data = "header keyed by the service"
+	var stego bytes.Buffer
+	if err := service.EmbedQRCodeStream(bytes.NewReader(cover), &stego, data, DCTStrategyMulti, 1, "test-env"); err != nil {
+		t.Fatalf("EmbedQRCodeStream failed: %v", err)
+	}
+	if _, err := ReadImageHeaderStream(bytes.NewReader(stego.Bytes())); !errors.Is(err, ErrNoImageHeader) {
+		t.Errorf("expected ErrNoImageHeader without the key, got %v", err)
+	}
+	got, err := service.ReadQRCodeStream(bytes.NewReader(stego.Bytes()), "test-env")
+	if err != nil {
+		t.Fatalf("ReadQRCodeStream failed: %v", err)
+	}
+	if got != data {
+		t.Errorf("expected %q, got %q", data, got)
+	}
+}
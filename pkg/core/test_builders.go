@@ -150,7 +150,8 @@ func (b *TestDataBuilder) LargePayload() []byte {
 	return payload
 }
 
-// ChunkedPayload creates a payload that will be split into chunks
+// ChunkedPayload creates a payload that will be split into chunks, each
+// starting with its index so no two chunks hash the same
 func (b *TestDataBuilder) ChunkedPayload(chunkSize int, numChunks int) [][]byte {
 	totalSize := chunkSize * numChunks
 	payload := make([]byte, totalSize)
@@ -169,6 +170,9 @@ func (b *TestDataBuilder) ChunkedPayload(chunkSize int, numChunks int) [][]byte
 			end = len(payload)
 		}
 		chunks[i] = payload[start:end]
+		if len(chunks[i]) > 0 {
+			chunks[i][0] = byte(i)
+		}
 	}
 
 	return chunks
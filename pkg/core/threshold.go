@@ -0,0 +1,74 @@
+package core
+
+import "github.com/BuddhiLW/crypt/pkg/jpegcoef"
+
+// DefaultCoefficientThreshold is the smallest coefficient magnitude
+// DCTStrategyThreshold embeds into: zeros and ±1 are never touched
+const DefaultCoefficientThreshold = 2
+
+// acCoefficients are the coefficients (natural order) the content dependent
+// strategies (threshold, F5) consider in every luminance block: all AC
+// coefficients except the image header coefficients 8 and 16
+var acCoefficients = func() []int {
+	var positions []int
+	for i := 1; i < len(jpegcoef.Block{}); i++ {
+		if i != 8 && i != 16 {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}()
+
+// NormalizeThreshold returns the threshold actually used for t. Bits are
+// written into the LSB of the magnitude, which moves a coefficient between
+// 2k and 2k+1, so the threshold is rounded up to an even value: a
+// coefficient is then eligible before embedding if and only if it is
+// eligible after, and the extractor finds the same coefficients.
+func NormalizeThreshold(t int) int {
+	if t < DefaultCoefficientThreshold {
+		return DefaultCoefficientThreshold
+	}
+	return t + t%2
+}
+
+// eligibleCoefficient reports whether c may carry a bit under threshold
+func eligibleCoefficient(c int32, threshold int) bool {
+	if c < 0 {
+		c = -c
+	}
+	return int(c) >= threshold
+}
+
+// setMagnitudeLSB writes bit into the LSB of |c| keeping the sign, so an
+// eligible coefficient never drops to 0 or ±1
+func setMagnitudeLSB(c *int32, bit int32) {
+	if *c < 0 {
+		*c = -(-*c&^1 | bit)
+		return
+	}
+	*c = *c&^1 | bit
+}
+
+// eligibleSlots returns up to limit eligible coefficients of comps in
+// embedding order (blocks in raster order, component after component);
+// limit < 0 returns all of them
+func eligibleSlots(comps []*jpegcoef.Component, threshold, limit int) []*int32 {
+	threshold = NormalizeThreshold(threshold)
+	var out []*int32
+	for _, y := range comps {
+		for by := 0; by < y.HeightInBlocks; by++ {
+			for bx := 0; bx < y.WidthInBlocks; bx++ {
+				b := y.Block(bx, by)
+				for _, pos := range acCoefficients {
+					if limit >= 0 && len(out) == limit {
+						return out
+					}
+					if eligibleCoefficient(b[pos], threshold) {
+						out = append(out, &b[pos])
+					}
+				}
+			}
+		}
+	}
+	return out
+}
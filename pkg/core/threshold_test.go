@@ -0,0 +1,126 @@
+package core
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+)
+
+func TestNormalizeThreshold(t *testing.T) {
+	cases := map[int]int{0: 2, 1: 2, 2: 2, 3: 4, 4: 4, 7: 8}
+	for in, want := range cases {
+		if got := NormalizeThreshold(in); got != want {
+			t.Errorf("NormalizeThreshold(%d) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestSetMagnitudeLSBKeepsEligibility(t *testing.T) {
+	for _, c := range []int32{2, 3, 4, 5, -2, -3, -4, -5, 100, -101} {
+		for _, bit := range []int32{0, 1} {
+			v := c
+			setMagnitudeLSB(&v, bit)
+			if v&1 != bit {
+				t.Errorf("setMagnitudeLSB(%d, %d) = %d: LSB not set", c, bit, v)
+			}
+			if (v < 0) != (c < 0) || !eligibleCoefficient(v, 2) {
+				t.Errorf("setMagnitudeLSB(%d, %d) = %d: lost sign or eligibility", c, bit, v)
+			}
+		}
+	}
+}
+
+func TestThresholdStrategyRoundTrip(t *testing.T) {
+	cover := writeTestJPEG(t, 256, 128)
+	payload := []byte("only big coefficients")
+
+	for _, threshold := range []int{0, 4} {
+		processor := NewGoDCTProcessorWithParams(DCTParams{Threshold: threshold})
+		stego := filepath.Join(t.TempDir(), "stego.jpg")
+
+		capacity, err := processor.CalculateImageCapacity(cover, DCTStrategyThreshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if capacity < len(payload)*8 {
+			t.Fatalf("threshold %d: cover too smooth, capacity %d bits", threshold, capacity)
+		}
+		if upper := processor.CalculateCapacity(256, 128, DCTStrategyThreshold); capacity >= upper {
+			t.Errorf("threshold %d: eligible capacity %d should be below the dimension bound %d", threshold, capacity, upper)
+		}
+
+		if err := processor.EmbedData(cover, stego, payload, DCTStrategyThreshold); err != nil {
+			t.Fatalf("threshold %d: EmbedData failed: %v", threshold, err)
+		}
+		got, err := processor.ExtractData(stego, len(payload), DCTStrategyThreshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("threshold %d: expected %q, got %q", threshold, payload, got)
+		}
+
+		// Embedding must not change which coefficients are eligible
+		after, err := processor.CalculateImageCapacity(stego, DCTStrategyThreshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after != capacity {
+			t.Errorf("threshold %d: capacity changed from %d to %d after embedding", threshold, capacity, after)
+		}
+	}
+}
+
+func TestThresholdStrategyLeavesSmallCoefficients(t *testing.T) {
+	cover := writeTestJPEG(t, 256, 128)
+	stego := filepath.Join(t.TempDir(), "stego.jpg")
+	if err := NewGoDCTProcessor().EmbedData(cover, stego, bytes.Repeat([]byte{0xA5}, 64), DCTStrategyThreshold); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := jpegcoef.DecodeFile(cover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := jpegcoef.DecodeFile(stego)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := 0
+	for i, b := range before.Components[0].Blocks {
+		a := after.Components[0].Blocks[i]
+		for k := range b {
+			if b[k] != a[k] {
+				changed++
+				if b[k] >= -1 && b[k] <= 1 {
+					t.Fatalf("block %d coefficient %d changed from %d to %d", i, k, b[k], a[k])
+				}
+			}
+		}
+	}
+	if changed == 0 {
+		t.Error("expected some coefficients to change")
+	}
+}
+
+func TestThresholdRecordedInImageHeader(t *testing.T) {
+	data, err := ImageHeader{Method: EmbedMethodDirect, Strategy: DCTStrategyThreshold, Threshold: 5}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := ParseImageHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Threshold != 6 {
+		t.Errorf("expected normalized threshold 6, got %d", h.Threshold)
+	}
+
+	// The default is recorded explicitly
+	data, _ = ImageHeader{Method: EmbedMethodQR, Strategy: DCTStrategyThreshold}.MarshalBinary()
+	if h, _ := ParseImageHeader(data); h == nil || h.Threshold != DefaultCoefficientThreshold {
+		t.Errorf("expected default threshold in header, got %+v", h)
+	}
+}
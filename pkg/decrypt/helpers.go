@@ -1,8 +1,8 @@
 package decrypt
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
+	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -10,9 +10,14 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 
+	"github.com/BuddhiLW/crypt"
+	"github.com/BuddhiLW/crypt/pkg/core"
 	"github.com/BuddhiLW/crypt/pkg/encrypt"
+	"github.com/BuddhiLW/crypt/pkg/seal"
 	"github.com/liyue201/goqr"
 	"github.com/rwxrob/bonzai"
 	"github.com/rwxrob/bonzai/cmds/help"
@@ -23,9 +28,12 @@ import (
 const (
 	DecryptEnv     = `DECRYPT_ENV`
 	DecryptDataVar = `decrypted-data`
-	DefaultQRPath  = `/tmp/extracted_qr.png`
 )
 
+// extractedQR holds the QR payload read by ImageCmd for the extract text
+// subcommand, so the QR never has to be written to disk
+var extractedQR string
+
 // **🔹 Main Decrypt Command**
 var DecryptCmd = &bonzai.Cmd{
 	Name:  "decrypt",
@@ -63,24 +71,25 @@ var ImageCmd = &bonzai.Cmd{
 	},
 	Do: func(x *bonzai.Cmd, args ...string) error {
 		if len(args) < 1 {
-			return fmt.Errorf("usage: decrypt image <input-image> [<output-qrcode>, defaults to /tmp/extracted_qr.png]")
+			return fmt.Errorf("usage: decrypt image <input-image> [<output-qrcode>] [extract text <key>]")
 		}
 
 		inputImage := args[0]
-		outputQR := DefaultQRPath
-		if len(args) > 1 && args[1] != ExtractCmd.Name {
-			outputQR = args[1] // Override default output if provided
-		}
-
 		fmt.Println("Extracting QR code from image:", inputImage)
 
 		// **Step 1: Extract QR Code from JPEG**
-		err := ExtractQRCodeFromJPEG(inputImage, outputQR)
+		payload, err := readEmbeddedQR(inputImage, keyFromArgs(args))
 		if err != nil {
 			return fmt.Errorf("failed to extract QR code from image: %w", err)
 		}
+		extractedQR = payload
 
-		fmt.Println("Extracted QR Code saved to:", outputQR)
+		// The QR code is only saved when an output path is given
+		if len(args) > 1 && args[1] != ExtractCmd.Name {
+			if err := writeQRImage(payload, args[1]); err != nil {
+				return err
+			}
+		}
 
 		// Check if we have enough arguments before accessing them
 		if len(args) > 1 && args[1] == ExtractCmd.Name {
@@ -97,6 +106,17 @@ var ImageCmd = &bonzai.Cmd{
 	},
 }
 
+// keyFromArgs finds the password of `image <input> [<output>] extract text <key>`
+// so the QR can be extracted before the text subcommand runs (permuted strategy)
+func keyFromArgs(args []string) string {
+	for i := 0; i+2 < len(args); i++ {
+		if args[i] == ExtractCmd.Name && args[i+1] == TextCmd.Name {
+			return args[i+2]
+		}
+	}
+	return ""
+}
+
 // **🔹 Extract Command for Decrypting Text**
 var ExtractCmd = &bonzai.Cmd{
 	Name:  "extract",
@@ -128,28 +148,32 @@ var TextCmd = &bonzai.Cmd{
 	Alias: "t",
 	Short: "decrypt text using AES",
 	Do: func(x *bonzai.Cmd, args ...string) error {
+		args, out, err := encrypt.SplitOutFlag(args)
+		if err != nil {
+			return err
+		}
 		if len(args) < 1 {
-			return fmt.Errorf("usage: decrypt image <input> [<output>] extract text <key>")
+			return fmt.Errorf("usage: decrypt image <input> [<output>] extract text <key> [--out <file>]")
 		}
 
 		key := args[0]
-		fmt.Println("key", key)
-		outputQR := DefaultQRPath // Use default unless overridden
-
-		// Read the QR Code
-		qrText, err := ReadQRCode(outputQR)
-		if err != nil {
-			return fmt.Errorf("failed to read QR code: %w", err)
+		if extractedQR == "" {
+			return fmt.Errorf("no QR code extracted, usage: decrypt image <input> [<output>] extract text <key> [--out <file>]")
 		}
+		qrText := normalizeBase64(extractedQR)
 
 		// Debugging: Print extracted QR code content
 		fmt.Println("🛠️ Extracted QR Code (Base64):", qrText)
 
 		// **Decrypt the extracted text**
-		decryptedText, err := DecryptAES(qrText, key)
+		decrypted, err := DecryptAES(qrText, key)
 		if err != nil {
 			return fmt.Errorf("failed to decrypt text: %w", err)
 		}
+		decryptedText, err := encrypt.RestorePlaintext([]byte(decrypted), out)
+		if err != nil || decryptedText == "" {
+			return err
+		}
 
 		// Cache decrypted text
 		vars.Data.Set(DecryptDataVar, decryptedText)
@@ -206,34 +230,17 @@ func normalizeBase64(encoded string) string {
 }
 
 // **🔹 Decrypt AES (Reversible from Encrypt)**
+// Versioned ciphertexts derive the key from the header's KDF parameters;
+// legacy ciphertexts (no header) still use the old zero-padded key.
 func DecryptAES(encryptedBase64, key string) (string, error) {
 	ciphertext, err := base64.StdEncoding.DecodeString(encryptedBase64)
 	if err != nil {
 		return "", fmt.Errorf("failed to decode base64: %w", err)
 	}
 
-	keyBytes := deriveKey([]byte(key), 32)
-
-	if len(ciphertext) < 12 {
-		return "", errors.New("invalid ciphertext: too short")
-	}
-
-	nonce := ciphertext[:12]
-	ciphertext = ciphertext[12:]
-
-	block, err := aes.NewCipher(keyBytes)
-	if err != nil {
-		return "", fmt.Errorf("failed to create AES cipher: %w", err)
-	}
-
-	aesGCM, err := cipher.NewGCM(block)
+	plaintext, err := seal.Open(ciphertext, key)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM cipher: %w", err)
-	}
-
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return "", fmt.Errorf("decryption failed: %w", err)
+		return "", err
 	}
 
 	return string(plaintext), nil
@@ -252,13 +259,21 @@ var DirectCmd = &bonzai.Cmd{
 Extract and decrypt data that was embedded directly into JPEG DCT coefficients 
 without QR code overhead (high capacity method).
 
-Usage: decrypt direct <image> <key>
+Usage: decrypt direct <image> <key> [--out <file>]
+
+Files encrypted with 'encrypt file' are restored byte for byte, with
+their permissions, into the --out file. Text is printed unless --out is
+given.
 `,
 	Do: func(x *bonzai.Cmd, args ...string) error {
 		fmt.Println("--- Direct DCT Extraction & Decryption ---")
 
+		args, out, err := encrypt.SplitOutFlag(args)
+		if err != nil {
+			return err
+		}
 		if len(args) < 2 {
-			return fmt.Errorf("usage: direct <image> <key>")
+			return fmt.Errorf("usage: direct <image> <key> [--out <file>]")
 		}
 
 		imagePath := args[0]
@@ -268,22 +283,46 @@ Usage: decrypt direct <image> <key>
 			return fmt.Errorf("key (password) must be greater or equal to 16 characters")
 		}
 
-		// Extract encrypted data directly from DCT coefficients
+		// Extract encrypted data directly from DCT coefficients. The layout
+		// only matters for legacy images, the facade reads the header of the
+		// others
 		fmt.Printf("Extracting data from: %s\n", imagePath)
-		encryptedData, err := encrypt.ExtractDataDirectlyFromDCT(imagePath)
+		layout, err := encrypt.DirectPayloadLayout(imagePath, key)
+		if err != nil {
+			return err
+		}
+		stego, err := os.Open(imagePath)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", imagePath, err)
+		}
+		defer stego.Close()
+		result, err := crypt.Extract(context.Background(), stego,
+			crypt.WithMethod(crypt.MethodDirect),
+			crypt.WithWalkKey(key),
+			crypt.WithLayout(*layout))
 		if err != nil {
 			return fmt.Errorf("direct DCT extraction failed: %w", err)
 		}
+		if result.Corrected > 0 {
+			fmt.Printf("FEC: corrected %d byte errors\n", result.Corrected)
+		}
+		encryptedData := result.Payload
 
 		fmt.Printf("Extracted %d bytes of encrypted data\n", len(encryptedData))
 
-		// Decrypt the extracted data
-		decryptedData, err := DecryptAES(encryptedData, key)
+		// Decrypt the extracted data: the raw ciphertext, or its base64 in
+		// images embedded before. Segments are verified as they are restored.
+		plaintext, err := encrypt.OpenPayloadStream(bytes.NewReader(encryptedData), key)
 		if err != nil {
 			return fmt.Errorf("decryption failed: %w", err)
 		}
-
-		fmt.Printf("Successfully decrypted %d bytes\n", len(decryptedData))
+		decryptedData, err := encrypt.RestorePlaintextStream(plaintext, out)
+		if err != nil {
+			return fmt.Errorf("decryption failed: %w", err)
+		}
+		if decryptedData == "" {
+			return nil
+		}
 		fmt.Printf("Decrypted data:\n%s\n", decryptedData)
 
 		// Store decrypted data in vars for potential further use
@@ -311,10 +350,12 @@ This command reconstructs the original data from multiple QR code chunks.
 
 Usage: 
   decrypt multiqr scan <directory> <password>  # Scan directory for QR files
+  decrypt multiqr <grid-image> <password>  # All QRs in the tiles of one image
   decrypt multiqr <metadata-image> <password> <chunk1> <chunk2> ...  # Manual file specification
 
 Examples:
   decrypt multiqr scan ./test/out/ mysecurepassword
+  decrypt multiqr ./test/grid.jpeg mysecurepassword
   decrypt multiqr ./test/multiqr_test_metadata.jpeg mysecurepassword \\
     ./test/multiqr_test_chunk_0.jpeg \\
     ./test/multiqr_test_chunk_1.jpeg \\
@@ -334,8 +375,12 @@ Examples:
 
 		fmt.Println("--- Multi-QR Grid Decryption ---")
 
-		if len(args) < 3 {
-			return fmt.Errorf("usage: multiqr <metadata-image> <password> <chunk1> [chunk2] ...")
+		args, out, err := encrypt.SplitOutFlag(args)
+		if err != nil {
+			return err
+		}
+		if len(args) < 2 {
+			return fmt.Errorf("usage: multiqr <grid-image|metadata-image> <password> [chunk1] [chunk2] ... [--out <file>]")
 		}
 
 		metadataImagePath := args[0]
@@ -353,9 +398,13 @@ Examples:
 		}
 
 		fmt.Println("\n🎉 Multi-QR Grid Decryption Successful!")
-		fmt.Printf("Decrypted data (%d bytes):\n", len(decryptedData))
+		text, err := encrypt.RestorePlaintext([]byte(decryptedData), out)
+		if err != nil || text == "" {
+			return err
+		}
+		fmt.Printf("Decrypted data (%d bytes):\n", len(text))
 		fmt.Println("----------------------------------------")
-		fmt.Println(decryptedData)
+		fmt.Println(text)
 		fmt.Println("----------------------------------------")
 
 		return nil
@@ -369,18 +418,26 @@ var MultiQRScanCmd = &bonzai.Cmd{
 	Long: `
 Scan directory for QR files and automatically extract multi-QR data.
 
-Usage: decrypt multiqr scan <directory> <password>
+Usage: decrypt multiqr scan <directory> <password> [--out <file>]
 
 Automatically:
-- Finds metadata QR file
-- Discovers chunk QR files
-- Validates file integrity
+- Decodes every JPEG/PNG and finds the metadata QR by its content
+- Orders the chunks by the SHA-256 hashes in the metadata
+- Reports missing, duplicate and corrupt chunks
+- Rebuilds fountain sets (multiqr fountain) from whichever symbols arrived
 - Extracts and decrypts data
+
+Grid sets without hash metadata are found by file name instead
+(*metadata*.jpeg, chunks in numeric order).
 `,
 	Do: func(x *bonzai.Cmd, args ...string) error {
 		fmt.Printf("DEBUG: ===== MultiQRScanCmd.Do START =====\n")
+		args, out, err := encrypt.SplitOutFlag(args)
+		if err != nil {
+			return err
+		}
 		if len(args) < 2 {
-			return fmt.Errorf("usage: decrypt multiqr scan <directory> <password>")
+			return fmt.Errorf("usage: decrypt multiqr scan <directory> <password> [--out <file>]")
 		}
 
 		directory := args[0]
@@ -390,29 +447,46 @@ Automatically:
 		fmt.Printf("Scanning directory: %s\n", directory)
 		fmt.Printf("Password: %s\n", strings.Repeat("*", len(password)))
 
-		// Scan directory for QR files
-		metadataFile, chunkFiles, err := scanDirectoryForQRFiles(directory)
-		if err != nil {
-			return fmt.Errorf("failed to scan directory: %w", err)
-		}
+		// Sets written by `multiqr embed` are recognised by their content
+		service := core.NewServiceFactory().CreateSteganographyServiceWithKey(encrypt.MultiQREnv, password)
+		plaintext, report, err := service.ScanAndExtractMultiQRStream(directory, password, encrypt.MultiQREnv)
+		encrypt.PrintMultiQRScanReport(report)
+		if errors.Is(err, core.ErrNoMultiQRMetadata) {
+			// Grid sets carry no chunk hashes, fall back to their file names
+			fmt.Println("No hash-based metadata found, scanning for a multi-QR grid")
+			metadataFile, chunkFiles, scanErr := scanDirectoryForQRFiles(directory)
+			if scanErr != nil {
+				return fmt.Errorf("failed to scan directory: %w", scanErr)
+			}
 
-		fmt.Printf("Found metadata file: %s\n", metadataFile)
-		fmt.Printf("Found %d chunk files: %v\n", len(chunkFiles), chunkFiles)
+			fmt.Printf("Found metadata file: %s\n", metadataFile)
+			fmt.Printf("Found %d chunk files: %v\n", len(chunkFiles), chunkFiles)
 
-		// Extract and reconstruct data from multi-QR grid
-		decryptedData, err := ExtractMultiQRGrid(metadataFile, chunkFiles, password)
+			// Extract and reconstruct data from multi-QR grid
+			var decryptedData string
+			decryptedData, err = ExtractMultiQRGrid(metadataFile, chunkFiles, password)
+			plaintext = strings.NewReader(decryptedData)
+		}
 		if err != nil {
-			return fmt.Errorf("multi-QR grid decryption failed: %w", err)
+			return fmt.Errorf("multi-QR decryption failed: %w", err)
 		}
 
-		fmt.Println("\n🎉 Multi-QR Grid Decryption Successful!")
-		fmt.Printf("Decrypted data (%d bytes):\n", len(decryptedData))
+		// Chunks are decrypted as the plaintext is restored
+		text, err := encrypt.RestorePlaintextStream(plaintext, out)
+		if err != nil {
+			return fmt.Errorf("multi-QR decryption failed: %w", err)
+		}
+		fmt.Println("\n🎉 Multi-QR Decryption Successful!")
+		if text == "" {
+			return nil
+		}
+		fmt.Printf("Decrypted data (%d bytes):\n", len(text))
 		fmt.Println("----------------------------------------")
-		fmt.Println(decryptedData)
+		fmt.Println(text)
 		fmt.Println("----------------------------------------")
 
 		// Store extracted data
-		if err := vars.Set(DecryptDataVar, decryptedData, DecryptEnv); err != nil {
+		if err := vars.Set(DecryptDataVar, text, DecryptEnv); err != nil {
 			return fmt.Errorf("failed to store extracted data: %w", err)
 		}
 
@@ -463,14 +537,90 @@ func scanDirectoryForQRFiles(dirPath string) (string, []string, error) {
 		return "", nil, fmt.Errorf("no chunk files found in directory")
 	}
 
-	// Sort chunk files to ensure consistent order
-	sort.Strings(chunkFiles)
+	// Sort chunk files by chunk number: chunk_2 before chunk_10
+	sort.Slice(chunkFiles, func(i, j int) bool {
+		ni, nj := chunkNumber(chunkFiles[i]), chunkNumber(chunkFiles[j])
+		if ni != nj {
+			return ni < nj
+		}
+		return chunkFiles[i] < chunkFiles[j]
+	})
 
 	return metadataFile, chunkFiles, nil
 }
 
-// ExtractMultiQRGrid extracts and reconstructs data from multiple QR codes
+// chunkNumber returns the last number in the file name, -1 if there is none
+func chunkNumber(path string) int {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	end := strings.LastIndexFunc(name, unicode.IsDigit)
+	if end < 0 {
+		return -1
+	}
+	start := strings.LastIndexFunc(name[:end+1], func(r rune) bool { return !unicode.IsDigit(r) }) + 1
+	n, err := strconv.Atoi(name[start : end+1])
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// ExtractQRGridImage reads the metadata and chunk QRs from the tiles of a
+// single grid image (see encrypt.EmbedMultiQRGrid), verifies every chunk
+// and decrypts the result with password
+func ExtractQRGridImage(imagePath, password string) (string, error) {
+	header, err := core.ReadImageHeaderWithKey(imagePath, password)
+	if err != nil {
+		return "", err
+	}
+	grid, err := core.NewServiceFactory().CreateQRGrid(header.Strategy, password, header.Params())
+	if err != nil {
+		return "", err
+	}
+	tiles, err := grid.Extract(imagePath)
+	if err != nil {
+		return "", err
+	}
+
+	if tiles[0].Err != nil {
+		return "", fmt.Errorf("failed to read metadata tile: %w", tiles[0].Err)
+	}
+	metadata, err := encrypt.UnpackGridMetadata(tiles[0].Payload)
+	if err != nil {
+		return "", fmt.Errorf("invalid grid metadata: %w", err)
+	}
+	if metadata.ChunkCount != len(tiles)-1 || len(metadata.Checksums) != metadata.ChunkCount {
+		return "", fmt.Errorf("grid metadata lists %d chunks, image has %d chunk tiles", metadata.ChunkCount, len(tiles)-1)
+	}
+
+	var data strings.Builder
+	var bad []string
+	for i, tile := range tiles[1:] {
+		switch {
+		case tile.Err != nil:
+			bad = append(bad, fmt.Sprintf("chunk %d unreadable (%v)", i, tile.Err))
+		case core.PayloadChecksum([]byte(tile.Payload)) != metadata.Checksums[i]:
+			bad = append(bad, fmt.Sprintf("chunk %d corrupt", i))
+		default:
+			data.WriteString(tile.Payload)
+		}
+	}
+	if len(bad) > 0 {
+		return "", fmt.Errorf("%d of %d grid chunks lost: %s", len(bad), metadata.ChunkCount, strings.Join(bad, ", "))
+	}
+	if data.Len() != metadata.TotalDataSize {
+		return "", fmt.Errorf("reassembled %d bytes, metadata says %d", data.Len(), metadata.TotalDataSize)
+	}
+	fmt.Printf("Read metadata and %d chunks from a %d tile grid\n", metadata.ChunkCount, len(tiles))
+
+	return DecryptAES(data.String(), password)
+}
+
+// ExtractMultiQRGrid extracts and reconstructs data from multiple QR codes.
+// Without chunk images, metadataImagePath is a single grid image.
 func ExtractMultiQRGrid(metadataImagePath string, chunkImagePaths []string, password string) (string, error) {
+	if len(chunkImagePaths) == 0 {
+		return ExtractQRGridImage(metadataImagePath, password)
+	}
 	fmt.Printf("DEBUG: ===== ExtractMultiQRGrid START =====\n")
 	fmt.Printf("Multi-QR Grid extraction from metadata: %s\n", metadataImagePath)
 	fmt.Printf("Chunk images: %v\n", chunkImagePaths)
@@ -478,41 +628,10 @@ func ExtractMultiQRGrid(metadataImagePath string, chunkImagePaths []string, pass
 	// Step 1: Extract metadata QR to understand the grid layout
 	fmt.Println("Step 1: Extracting metadata QR...")
 
-	// Create temp directory for extracted QR codes following Bonzai patterns
-	baseName := filepath.Base(metadataImagePath)
-	baseName = strings.TrimSuffix(baseName, filepath.Ext(baseName))
-	tempDir, err := os.MkdirTemp("", fmt.Sprintf("crypt-decrypt-%s-*", baseName))
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp directory: %w", err)
-	}
-	// Temporarily disable cleanup for debugging
-	// defer func() {
-	//	if err := os.RemoveAll(tempDir); err != nil {
-	//		fmt.Printf("WARNING: Failed to clean up temp directory %s: %v\n", tempDir, err)
-	//	}
-	// }()
-
-	fmt.Printf("DEBUG: Created temp directory for extraction: %s\n", tempDir)
-
-	// Create temp file for metadata QR extraction
-	tempMetadataQR := filepath.Join(tempDir, "metadata_qr.png")
-
-	// Use the direct ExtractQRCodeFromJPEG function that we know works
-	fmt.Printf("DEBUG: About to extract QR code from %s to %s\n", metadataImagePath, tempMetadataQR)
-	err = ExtractQRCodeFromJPEG(metadataImagePath, tempMetadataQR)
-	if err != nil {
-		fmt.Printf("DEBUG: ExtractQRCodeFromJPEG failed: %v\n", err)
+	// The QRs are decoded in memory; nothing extracted touches the disk
+	if _, err := readEmbeddedQR(metadataImagePath, password); err != nil {
 		return "", fmt.Errorf("failed to extract metadata QR: %w", err)
 	}
-	fmt.Printf("DEBUG: Successfully extracted QR code to %s\n", tempMetadataQR)
-
-	// Check if the extracted QR file exists and its size
-	if info, statErr := os.Stat(tempMetadataQR); statErr != nil {
-		fmt.Printf("DEBUG: Extracted QR file does not exist: %v\n", statErr)
-		return "", fmt.Errorf("extracted QR file does not exist: %w", statErr)
-	} else {
-		fmt.Printf("DEBUG: Extracted QR file exists, size: %d bytes\n", info.Size())
-	}
 
 	// Try to parse metadata from the metadata file first
 	fmt.Printf("DEBUG: Attempting to parse metadata from metadata file\n")
@@ -535,16 +654,8 @@ func ExtractMultiQRGrid(metadataImagePath string, chunkImagePaths []string, pass
 	actualTotalSize := 0
 	for i := 0; i < actualChunkCount && i < len(chunkImagePaths); i++ {
 		chunkPath := chunkImagePaths[i]
-		// Create temp file for chunk QR extraction
-		tempChunkQR := filepath.Join(tempDir, fmt.Sprintf("temp_chunk_%d_qr.png", i))
-		err := ExtractQRCodeFromJPEG(chunkPath, tempChunkQR)
-		if err != nil {
-			fmt.Printf("WARNING: Failed to extract chunk %d for size calculation: %v\n", i, err)
-			continue
-		}
-
 		// Read the chunk data to determine its actual size
-		chunkData, err := readQRCodeRaw(tempChunkQR)
+		chunkData, err := readEmbeddedQR(chunkPath, password)
 		if err != nil {
 			fmt.Printf("WARNING: Failed to read chunk %d for size calculation: %v\n", i, err)
 			continue
@@ -579,18 +690,8 @@ func ExtractMultiQRGrid(metadataImagePath string, chunkImagePaths []string, pass
 		chunkPath := chunkImagePaths[i]
 		fmt.Printf("Extracting chunk %d from: %s\n", i, chunkPath)
 
-		// Create temp file for chunk QR extraction
-		tempChunkQR := filepath.Join(tempDir, fmt.Sprintf("chunk_%d_qr.png", i))
-		fmt.Printf("DEBUG: About to extract chunk %d QR from %s to %s\n", i, chunkPath, tempChunkQR)
-		err := ExtractQRCodeFromJPEG(chunkPath, tempChunkQR)
-		if err != nil {
-			fmt.Printf("WARNING: Failed to extract chunk %d: %v\n", i, err)
-			continue
-		}
-		fmt.Printf("DEBUG: Successfully extracted chunk %d QR to %s\n", i, tempChunkQR)
-
-		// Read and decode the chunk QR using the working ReadQRCode function
-		encryptedChunk, err := readQRCodeRaw(tempChunkQR)
+		// Extract and decode the chunk QR in memory
+		encryptedChunk, err := readEmbeddedQR(chunkPath, password)
 		if err != nil {
 			fmt.Printf("WARNING: Failed to read chunk %d QR: %v\n", i, err)
 			continue
@@ -602,7 +703,7 @@ func ExtractMultiQRGrid(metadataImagePath string, chunkImagePaths []string, pass
 
 		// Verify checksum using the same function from encrypt package
 		expectedChecksum := metadata.Checksums[i]
-		actualChecksum := calculateSimpleChecksum(chunks[i])
+		actualChecksum := core.PayloadChecksum(chunks[i])
 
 		if expectedChecksum != actualChecksum {
 			fmt.Printf("WARNING: Checksum mismatch for chunk %d (expected: %d, got: %d)\n",
@@ -651,19 +752,8 @@ func ExtractMultiQRGrid(metadataImagePath string, chunkImagePaths []string, pass
 	return decryptedData, nil
 }
 
-// Helper function to read QR code from PNG file
-func readQRCode(qrImagePath string) (string, error) {
-	file, err := os.Open(qrImagePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open QR image: %w", err)
-	}
-	defer file.Close()
-
-	img, _, err := image.Decode(file)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode QR image: %w", err)
-	}
-
+// recognizeQR returns the payload of the first QR code in img
+func recognizeQR(img image.Image) (string, error) {
 	qrCodes, err := goqr.Recognize(img)
 	if err != nil {
 		return "", fmt.Errorf("failed to recognize QR code: %w", err)
@@ -676,8 +766,8 @@ func readQRCode(qrImagePath string) (string, error) {
 	return string(qrCodes[0].Payload), nil
 }
 
-// Helper function to read QR code from PNG file without Base64 normalization
-func readQRCodeRaw(qrImagePath string) (string, error) {
+// Helper function to read QR code from PNG file
+func readQRCode(qrImagePath string) (string, error) {
 	file, err := os.Open(qrImagePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to open QR image: %w", err)
@@ -688,32 +778,5 @@ func readQRCodeRaw(qrImagePath string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to decode QR image: %w", err)
 	}
-
-	qrCodes, err := goqr.Recognize(img)
-	if err != nil {
-		return "", fmt.Errorf("failed to recognize QR code: %w", err)
-	}
-
-	if len(qrCodes) == 0 {
-		return "", fmt.Errorf("no QR code found in image")
-	}
-
-	// Return raw payload without Base64 normalization
-	return string(qrCodes[0].Payload), nil
-}
-
-// Helper function for checksum calculation (same as in encrypt package)
-func calculateSimpleChecksum(data []byte) uint32 {
-	var checksum uint32
-	for _, b := range data {
-		checksum = (checksum << 1) ^ uint32(b)
-	}
-	return checksum
-}
-
-// **🔹 Ensures Key is Always 32 Bytes**
-func deriveKey(key []byte, length int) []byte {
-	derived := make([]byte, length)
-	copy(derived, key)
-	return derived
+	return recognizeQR(img)
 }
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"github.com/BuddhiLW/crypt/pkg/analyze"
+	"github.com/BuddhiLW/crypt/pkg/bench"
 	"github.com/BuddhiLW/crypt/pkg/decrypt"
 	"github.com/BuddhiLW/crypt/pkg/encrypt"
 	"github.com/rwxrob/bonzai"
@@ -19,5 +21,5 @@ Multiple methods fail to preserver the embbeded information, after even a little
 Here, a working "empirical" (opinionated?) workflow that survives heavy compression, is supported and proposed.
 `,
 	Comp: comp.Cmds,
-	Cmds: []*bonzai.Cmd{encrypt.EncryptCmd, decrypt.DecryptCmd, vars.Cmd, help.Cmd},
+	Cmds: []*bonzai.Cmd{encrypt.EncryptCmd, decrypt.DecryptCmd, bench.BenchCmd, analyze.AnalyzeCmd, analyze.DiffCmd, vars.Cmd, help.Cmd},
 }
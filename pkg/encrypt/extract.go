@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/BuddhiLW/crypt/pkg/fec"
 	"github.com/rwxrob/bonzai"
 )
 
@@ -17,7 +18,8 @@ var ExtractCmd = &bonzai.Cmd{
 	Alias: `x`,
 	Short: "extract hidden message",
 	Long: `
-Extract a hidden message from an image using StegHide and decode Reed-Solomon.
+Extract a hidden message from an image using StegHide and correct it with
+the Reed-Solomon code of the fec package.
 
 Usage:
 encrypt extract <image.jpg> <password>`,
@@ -73,8 +75,18 @@ encrypt extract <image.jpg> <password>`,
 	},
 }
 
-// Decode message using Reed-Solomon (simulated)
+// decodeReedSolomon corrects and unwraps a payload protected with the fec
+// package. Payloads written before FEC existed are "<length>:<message>".
 func decodeReedSolomon(data string) (string, error) {
+	decoded, corrected, err := fec.Decode([]byte(data))
+	if err == nil {
+		fmt.Printf("Decoded message: %d bytes, %d byte errors corrected\n", len(decoded), corrected)
+		return string(decoded), nil
+	}
+	if !errors.Is(err, fec.ErrNotEncoded) {
+		return "", err
+	}
+
 	decodedStr := strings.TrimSpace(data)
 
 	// Extract the length prefix
@@ -94,8 +106,5 @@ func decodeReedSolomon(data string) (string, error) {
 		return "", errors.New("message length exceeds extracted data length")
 	}
 
-	correctedMessage := parts[1][:messageLength]
-
-	fmt.Println("Decoded message (after Reed-Solomon correction):", correctedMessage)
-	return correctedMessage, nil
+	return parts[1][:messageLength], nil
 }
@@ -1,15 +1,19 @@
 package encrypt
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
 	"encoding/base64"
 	"fmt"
 	"io"
-	"os"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	// "github.com/BuddhiLW/crypt/pkg/encrypt"
+	"github.com/BuddhiLW/crypt/pkg/core"
+	"github.com/BuddhiLW/crypt/pkg/fec"
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
+	"github.com/BuddhiLW/crypt/pkg/seal"
 	"github.com/rwxrob/bonzai"
 	"github.com/rwxrob/bonzai/cmds/help"
 	"github.com/rwxrob/bonzai/comp"
@@ -21,6 +25,7 @@ import (
 const (
 	EncryptEnv     = `ENCRYPT_ENV`
 	EncryptDataVar = `encrypted-data`
+	KDFVar         = `kdf`
 
 	QREnv     = `QR_ENV`
 	QRDataVar = `qr-data`
@@ -31,33 +36,85 @@ const (
 	EmbeddedImagePathEnv = `EMBEDDED_IMAGE_PATH_ENV`
 	EmbeddedImagePathVar = `embedded-image-path`
 
-	DCTEnv         = `DCT_ENV`
-	DCTStrategyVar = `dct-strategy`
+	DCTEnv           = `DCT_ENV`
+	DCTStrategyVar   = `dct-strategy`
+	DCTThresholdVar  = `dct-threshold`
+	DCTQIMStepVar    = `dct-qim-step`
+	FECVar           = `fec`
+	QRCopiesVar      = `qr-copies`
+	ComponentsVar    = `dct-components`
+	MarkerStripVar   = `metadata-strip`
+	MarkerReplaceVar = `metadata-replace`
+	MarkerDonorVar   = `metadata-donor`
+	OutputCodingVar  = `output-coding`
 
 	QRSizeVar = `qr-size`
 )
 
-// **🔹 Encrypt AES (Ensure Output is Correct)**
-func EncryptMessage(secret, key string) (string, error) {
-	keyBytes := deriveKey([]byte(key), 32)
+// sessionKey is the password given to `encrypt text|file`, kept for the
+// embedding subcommands of the same invocation (permuted strategy). It lives
+// in memory only and is never written to vars.
+var sessionKey string
+
+// sessionFile is the file given to `encrypt file` when an embedding
+// subcommand follows: the embedder seals it as it reads it, see
+// encryptedStream, instead of the whole ciphertext going through vars.
+var sessionFile string
+
+// encryptedStream returns the base64 ciphertext to embed: the session file
+// sealed on the fly, or what `encrypt text|file` stored in vars
+func encryptedStream() (io.ReadCloser, error) {
+	if sessionFile == "" {
+		data, err := vars.Get(EncryptDataVar, EncryptEnv)
+		if err != nil || data == "" {
+			return nil, fmt.Errorf("no encrypted data found - run encrypt first")
+		}
+		return io.NopCloser(strings.NewReader(data)), nil
+	}
+	r, w := io.Pipe()
+	go func() {
+		encoder := base64.NewEncoder(base64.StdEncoding, w)
+		_, err := EncryptFileTo(encoder, sessionFile, sessionKey)
+		if err == nil {
+			err = encoder.Close()
+		}
+		w.CloseWithError(err)
+	}()
+	return r, nil
+}
 
-	block, err := aes.NewCipher(keyBytes)
+// encryptedData is encryptedStream read whole, for embedders that need
+// all of it at once
+func encryptedData() (string, error) {
+	r, err := encryptedStream()
 	if err != nil {
-		return "", fmt.Errorf("failed to create AES cipher: %w", err)
+		return "", err
 	}
-
-	aesGCM, err := cipher.NewGCM(block)
+	defer r.Close()
+	data, err := io.ReadAll(r)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return "", err
 	}
+	return string(data), nil
+}
 
-	nonce := make([]byte, aesGCM.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", fmt.Errorf("failed to generate nonce: %w", err)
+// **🔹 Encrypt AES (Ensure Output is Correct)**
+// The key is derived with the KDF selected in vars (argon2id by default) and
+// a random salt; both are recorded in the versioned header of the ciphertext.
+func EncryptMessage(secret, key string) (string, error) {
+	params, err := kdfParams()
+	if err != nil {
+		return "", err
 	}
+	return EncryptMessageWithParams(secret, key, params)
+}
 
-	ciphertext := aesGCM.Seal(nil, nonce, []byte(secret), nil)
-	finalCipher := append(nonce, ciphertext...)
+// EncryptMessageWithParams encrypts secret using explicit KDF parameters
+func EncryptMessageWithParams(secret, key string, params seal.Params) (string, error) {
+	finalCipher, err := seal.Seal([]byte(secret), key, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
 
 	// Encode to Base64
 	base64Cipher := base64.StdEncoding.EncodeToString(finalCipher)
@@ -68,11 +125,14 @@ func EncryptMessage(secret, key string) (string, error) {
 	return base64Cipher, nil
 }
 
-// deriveKey ensures the key is always a valid AES key size (AES-256 = 32 bytes)
-func deriveKey(key []byte, length int) []byte {
-	derived := make([]byte, length)
-	copy(derived, key)
-	return derived
+// kdfParams returns the parameters of the KDF selected in vars
+func kdfParams() (seal.Params, error) {
+	kdfName, _ := vars.Get(KDFVar, EncryptEnv)
+	alg, err := seal.ParseAlgorithm(kdfName)
+	if err != nil {
+		return seal.Params{}, err
+	}
+	return seal.ParamsFor(alg)
 }
 
 var EncryptCmd = &bonzai.Cmd{
@@ -84,6 +144,12 @@ var EncryptCmd = &bonzai.Cmd{
 		TextCmd,
 		FileCmd,
 		StrategyCmd,
+		FECCmd,
+		CopiesCmd,
+		ComponentsCmd,
+		MetadataCmd,
+		CodingCmd,
+		KDFCmd,
 		help.Cmd,
 		vars.Cmd,
 	},
@@ -118,6 +184,7 @@ Where key must be longer than 15 characters.
 		if err != nil {
 			return err
 		}
+		sessionKey = args[1]
 
 		if err := vars.Set(EncryptDataVar, encrypted, EncryptEnv); err != nil {
 			return fmt.Errorf("failed to store encrypted data: %w", err)
@@ -128,7 +195,7 @@ Where key must be longer than 15 characters.
 		if len(args) > 2 {
 			fmt.Println(args[2:])
 			// if (args[2] == QRCodeCmd.Name) {
-			QRCodeCmd.Do(x, args[3:]...)
+			return QRCodeCmd.Do(x, args[3:]...)
 			// }
 		}
 
@@ -151,6 +218,11 @@ var FileCmd = &bonzai.Cmd{
 encrypt file using AES.
 
 Usage: encrypt file <path> <key>; in which |key|>=16 characters
+
+The file is sealed in segments (see seal.NewWriter). Followed by an
+embedding subcommand, e.g. 'encrypt file <path> <key> qrcode binary embed
+direct <in.jpg> <out.jpg>', it is read and sealed as the embedder consumes
+it and nothing is stored in vars.
 `,
 	Do: func(x *bonzai.Cmd, args ...string) error {
 		if len(args) < 2 {
@@ -160,26 +232,25 @@ Usage: encrypt file <path> <key>; in which |key|>=16 characters
 			return fmt.Errorf("key (password) must be greater or equal to 16 characters")
 		}
 
-		// Read file
-		data, err := os.ReadFile(args[0])
-		if err != nil {
-			return fmt.Errorf("failed to read file: %w", err)
+		sessionKey = args[1]
+		if len(args) > 2 {
+			// The embedder seals the file as it reads it; clear vars so a
+			// later embedding cannot pick up an older payload
+			sessionFile = args[0]
+			if err := vars.Set(EncryptDataVar, "", EncryptEnv); err != nil {
+				return fmt.Errorf("failed to clear encrypted data: %w", err)
+			}
+			fmt.Println(args[2:])
+			return QRCodeCmd.Do(x, args[3:]...)
 		}
 
-		encrypted, err := EncryptMessage(string(data), args[1])
+		encrypted, err := EncryptFile(args[0], args[1])
 		if err != nil {
 			return err
 		}
-
 		if err := vars.Set(EncryptDataVar, encrypted, EncryptEnv); err != nil {
 			return fmt.Errorf("failed to store encrypted data: %w", err)
 		}
-
-		if len(args) > 2 {
-			fmt.Println(args[2:])
-			QRCodeCmd.Do(x, args[3:]...)
-		}
-
 		return nil
 	},
 }
@@ -211,8 +282,7 @@ var QRCodeCmd = &bonzai.Cmd{
 create QRCode holding data. Either just create one and return it, or create and transform in a binary data.
 
 Usages:
-- encrypt text <input> <key> qrcode create;
-- encrypt text <input> <key> qrcode create binary;
+- encrypt text <input> <key> qrcode <output.png>;
 - encrypt text <input> <key> qrcode binary;
 `,
 	Do: func(x *bonzai.Cmd, args ...string) error {
@@ -240,14 +310,24 @@ Usages:
 			}
 		}
 
-		// default behavior if no subcommand specified
-		data := vars.Fetch(EncryptEnv, EncryptDataVar, "zoo fall")
+		// default behavior if no subcommand specified: a PNG at the given path
+		if len(args) < 1 {
+			return fmt.Errorf("usage: encrypt text <input> <key> qrcode <output.png>")
+		}
+		output := args[0]
+		data, err := encryptedData()
+		if err != nil {
+			if sessionFile != "" {
+				return err
+			}
+			data = "zoo fall"
+		}
 		// generate PNG qrcode with ECC fallback
-		_, err := WriteQRCodeWithFallback(data, 256, "/tmp/qr.png")
+		_, err = WriteQRCodeWithFallback(data, 256, output)
 		if err != nil {
 			return fmt.Errorf("failed to generate QR: %w", err)
 		}
-		fmt.Println("Wrote qrcode to /tmp/qr.png")
+		fmt.Println("Wrote qrcode to", output)
 		return nil
 	},
 }
@@ -289,7 +369,7 @@ Usages:
 
 		switch args[0] {
 		case EmbedCmd.Name:
-			EmbedCmd.Do(x, args[1:]...)
+			return EmbedCmd.Do(x, args[1:]...)
 		}
 		return nil
 	},
@@ -298,16 +378,32 @@ Usages:
 var StrategyCmd = &bonzai.Cmd{
 	Name:  `strategy`,
 	Alias: `s`,
-	Short: `set DCT embedding strategy (single; multi coef)`,
-	Usage: `strategy <single|multi>`,
+	Short: `set DCT strategy (single, multi, permuted...)`,
+	Usage: `strategy <single|multi|permuted|threshold [min]|f5|qim [step]>`,
 	Long: `
 Sets the DCT embedding strategy for steganography:
 
 - single-coefficient: Original approach (1 bit per DCT block)
 - multi-coefficient: Enhanced approach (4 bits per DCT block, 4x capacity)
+- permuted-coefficient: Bits scattered over a password-keyed walk of
+  all blocks and low/mid frequency coefficients (also used by direct)
+- threshold-coefficient: Only coefficients with magnitude >= min (default
+  2) carry bits; zeros and ±1 are never touched (also used by direct)
+- f5-matrix: F5 matrix embedding over the nonzero coefficients; changes
+  several times fewer coefficients for lower capacity (also used by direct)
+- qim-lattice: Quantization index modulation on 6 mid-frequency
+  coefficients per block; survives JPEG re-saves (also used by direct)
 
 The multi-coefficient strategy provides 4x the capacity but may be slightly
 more detectable. Use 'multi' for larger payloads that need High ECC.
+The permuted strategy does not put the payload at a predictable place;
+extraction needs the same password.
+The threshold strategy keeps the DCT histogram intact and survives
+requantization better; its capacity depends on the image content. Odd
+minimums are rounded up to the next even value.
+The QIM step is a multiple of the standard quality 50 quantization table
+(default 2.0, 0.5 to 25.5): 2.0 survives a re-save at quality 70, 3.0 at
+quality 50, at the cost of more visible distortion.
 `,
 	Do: func(x *bonzai.Cmd, args ...string) error {
 		if len(args) < 1 {
@@ -316,7 +412,7 @@ more detectable. Use 'multi' for larger payloads that need High ECC.
 			// 	current = "single-coefficient"
 			// }
 			fmt.Printf("Current DCT strategy: %s\n", current)
-			fmt.Println("Usage: strategy <single|multi>")
+			fmt.Println("Usage: strategy <single|multi|permuted|threshold [min]|f5|qim [step]>")
 			return nil
 		}
 
@@ -332,10 +428,335 @@ more detectable. Use 'multi' for larger payloads that need High ECC.
 				return fmt.Errorf("failed to set strategy: %w", err)
 			}
 			fmt.Println("DCT strategy set to: multi-coefficient (4x capacity)")
+		case "permuted", "permuted-coefficient":
+			if err := vars.Set(DCTStrategyVar, "permuted-coefficient", DCTEnv); err != nil {
+				return fmt.Errorf("failed to set strategy: %w", err)
+			}
+			fmt.Println("DCT strategy set to: permuted-coefficient (password-keyed positions)")
+		case "threshold", "threshold-coefficient":
+			threshold := core.DefaultCoefficientThreshold
+			if len(args) > 1 {
+				t, err := strconv.Atoi(args[1])
+				if err != nil || t < 1 || t > 254 {
+					return fmt.Errorf("invalid threshold '%s': must be between 1 and 254", args[1])
+				}
+				threshold = core.NormalizeThreshold(t)
+			}
+			if err := vars.Set(DCTStrategyVar, "threshold-coefficient", DCTEnv); err != nil {
+				return fmt.Errorf("failed to set strategy: %w", err)
+			}
+			if err := vars.Set(DCTThresholdVar, strconv.Itoa(threshold), DCTEnv); err != nil {
+				return fmt.Errorf("failed to set threshold: %w", err)
+			}
+			fmt.Printf("DCT strategy set to: threshold-coefficient (|coefficient| >= %d)\n", threshold)
+		case "f5", "f5-matrix":
+			if err := vars.Set(DCTStrategyVar, "f5-matrix", DCTEnv); err != nil {
+				return fmt.Errorf("failed to set strategy: %w", err)
+			}
+			fmt.Println("DCT strategy set to: f5-matrix (matrix embedding, fewest changes)")
+		case "qim", "qim-lattice":
+			step := core.DefaultQIMStep
+			if len(args) > 1 {
+				f, err := strconv.ParseFloat(args[1], 64)
+				if err != nil || f < 0.5 || f > 25.5 {
+					return fmt.Errorf("invalid QIM step '%s': must be between 0.5 and 25.5", args[1])
+				}
+				step = int(math.Round(f * 10))
+			}
+			if err := vars.Set(DCTStrategyVar, "qim-lattice", DCTEnv); err != nil {
+				return fmt.Errorf("failed to set strategy: %w", err)
+			}
+			if err := vars.Set(DCTQIMStepVar, strconv.Itoa(step), DCTEnv); err != nil {
+				return fmt.Errorf("failed to set QIM step: %w", err)
+			}
+			fmt.Printf("DCT strategy set to: qim-lattice (step %.1f x quantization table)\n", float64(step)/10)
 		default:
-			return fmt.Errorf("invalid strategy '%s'. Use 'single' or 'multi'", strategy)
+			return fmt.Errorf("invalid strategy '%s'. Use 'single', 'multi', 'permuted', 'threshold', 'f5' or 'qim'", strategy)
+		}
+
+		return nil
+	},
+}
+
+var FECCmd = &bonzai.Cmd{
+	Name:  `fec`,
+	Short: `set error correction for direct payloads`,
+	Usage: `fec <off|low|medium|high|<parity>[:<repeat>]>`,
+	Long: `
+Sets the forward error correction wrapped around direct DCT payloads:
+
+- off: no error correction (default)
+- low: Reed-Solomon with 16 parity bytes per 255-byte codeword
+- medium: Reed-Solomon with 32 parity bytes per codeword
+- high: 64 parity bytes per codeword, and the coded payload stored 3
+  times and recovered by a bitwise majority vote
+- <parity>[:<repeat>]: explicit parity bytes (2-254) and copies (1-15)
+
+Each codeword corrects up to half its parity bytes. Codewords are
+interleaved byte by byte, so a run of damaged coefficients is spread over
+all of them. The level is recorded in the payload, so extraction never
+needs this setting. Capacity reports show what is left for data.
+`,
+	Do: func(x *bonzai.Cmd, args ...string) error {
+		if len(args) < 1 {
+			fmt.Printf("Current FEC level: %s\n", fecParams())
+			fmt.Println("Usage: fec <off|low|medium|high|<parity>[:<repeat>]>")
+			return nil
+		}
+
+		params, err := fec.ParseParams(args[0])
+		if err != nil {
+			return err
+		}
+		if err := vars.Set(FECVar, params.String(), DCTEnv); err != nil {
+			return fmt.Errorf("failed to set FEC level: %w", err)
+		}
+		fmt.Printf("FEC level set to: %s (parity %d, copies %d)\n", params, params.Parity, max(params.Repeat, 1))
+		return nil
+	},
+}
+
+var CopiesCmd = &bonzai.Cmd{
+	Name:  `copies`,
+	Short: `set how many copies of a QR to embed`,
+	Usage: `copies <off|auto|<n>>`,
+	Long: `
+Sets how many copies of the QR module matrix are embedded, each in its
+own coefficients:
+
+- off: a single copy (default)
+- auto: as many copies as the capacity of the cover holds (at most 15)
+- <n>: exactly n copies (1-15)
+
+Extraction reads every copy and decides each module by a vote: QIM
+images weigh each copy by its confidence, the others count a majority.
+Ties keep the first copy. A module survives as long as most copies of it
+do, so recompression and local damage hurt far less. The copy count is
+recorded in the image header, so extraction never needs this setting.
+`,
+	Do: func(x *bonzai.Cmd, args ...string) error {
+		if len(args) < 1 {
+			current, _ := vars.Get(QRCopiesVar, DCTEnv)
+			if current == "" {
+				current = "off"
+			}
+			fmt.Printf("Current QR copies: %s\n", current)
+			fmt.Println("Usage: copies <off|auto|<n>>")
+			return nil
 		}
 
+		copies, err := core.ParseQRCopies(args[0])
+		if err != nil {
+			return err
+		}
+		value := strconv.Itoa(copies)
+		switch copies {
+		case core.QRCopiesAuto:
+			value = "auto"
+		case 1:
+			value = "off"
+		}
+		if err := vars.Set(QRCopiesVar, value, DCTEnv); err != nil {
+			return fmt.Errorf("failed to set QR copies: %w", err)
+		}
+		fmt.Printf("QR copies set to: %s\n", value)
+		return nil
+	},
+}
+
+var ComponentsCmd = &bonzai.Cmd{
+	Name:  `components`,
+	Short: `set which colour channels carry the payload`,
+	Usage: `components <y|cb|cr|chroma|all|<list>>`,
+	Long: `
+Sets the JPEG components the DCT strategies embed into:
+
+- y (or luma): the luminance only (default)
+- cb, cr: one chroma channel
+- chroma: both chroma channels
+- all: luminance and both chroma channels
+- a comma separated list, such as y,cb
+
+Bits fill the luminance first, then Cb, then Cr. Chroma is usually
+subsampled 4:2:0, so each chroma channel adds a quarter of the luminance
+capacity. The QIM strategy embeds into the luminance only, and the
+multi-QR grid always uses luminance tiles. The components are recorded
+in the image header, so extraction never needs this setting.
+`,
+	Do: func(x *bonzai.Cmd, args ...string) error {
+		if len(args) < 1 {
+			current, _ := vars.Get(ComponentsVar, DCTEnv)
+			set, _ := core.ParseComponentSet(current)
+			fmt.Printf("Current DCT components: %s\n", set)
+			fmt.Println("Usage: components <y|cb|cr|chroma|all|<list>>")
+			return nil
+		}
+
+		set, err := core.ParseComponentSet(args[0])
+		if err != nil {
+			return err
+		}
+		if err := vars.Set(ComponentsVar, set.String(), DCTEnv); err != nil {
+			return fmt.Errorf("failed to set DCT components: %w", err)
+		}
+		fmt.Printf("DCT components set to: %s\n", set)
+		return nil
+	},
+}
+
+var MetadataCmd = &bonzai.Cmd{
+	Name:  `metadata`,
+	Short: `keep, strip or replace EXIF, ICC and other markers`,
+	Usage: `metadata <keep|strip <kinds>|replace <kinds> <donor.jpg>>`,
+	Long: `
+Sets what happens to the APPn and COM segments of the cover. By default
+the stego image keeps all of them unchanged (EXIF, ICC profile, XMP,
+comments), since a photo without its metadata stands out and loses its
+colour profile.
+
+- keep: copy every segment of the cover (default)
+- strip <kinds>: drop the listed segments
+- replace <kinds> <donor.jpg>: take the listed segments from donor.jpg
+  instead of the cover
+
+Kinds are a comma separated list of jfif, exif, xmp, icc, adobe, com,
+app0-app15 or all. Replacement applies before stripping. Only the
+segments change: the coefficients, the payload and its header do not.
+`,
+	Do: func(x *bonzai.Cmd, args ...string) error {
+		if len(args) < 1 {
+			fmt.Printf("Current metadata policy: %s\n", markerPolicy())
+			fmt.Println("Usage: metadata <keep|strip <kinds>|replace <kinds> <donor.jpg>>")
+			return nil
+		}
+
+		switch args[0] {
+		case "keep":
+			for _, name := range []string{MarkerStripVar, MarkerReplaceVar, MarkerDonorVar} {
+				if err := vars.Set(name, "", DCTEnv); err != nil {
+					return fmt.Errorf("failed to reset metadata policy: %w", err)
+				}
+			}
+		case "strip":
+			if len(args) < 2 {
+				return fmt.Errorf("usage: metadata strip <kinds>")
+			}
+			kinds, err := jpegcoef.ParseSegmentKinds(args[1])
+			if err != nil {
+				return err
+			}
+			if err := vars.Set(MarkerStripVar, strings.Join(kinds, ","), DCTEnv); err != nil {
+				return fmt.Errorf("failed to set metadata policy: %w", err)
+			}
+		case "replace":
+			if len(args) < 3 {
+				return fmt.Errorf("usage: metadata replace <kinds> <donor.jpg>")
+			}
+			kinds, err := jpegcoef.ParseSegmentKinds(args[1])
+			if err != nil {
+				return err
+			}
+			donor, err := filepath.Abs(args[2])
+			if err != nil {
+				return err
+			}
+			if _, err := jpegcoef.DecodeFile(donor); err != nil {
+				return fmt.Errorf("donor %s: %w", donor, err)
+			}
+			if err := vars.Set(MarkerReplaceVar, strings.Join(kinds, ","), DCTEnv); err != nil {
+				return fmt.Errorf("failed to set metadata policy: %w", err)
+			}
+			if err := vars.Set(MarkerDonorVar, donor, DCTEnv); err != nil {
+				return fmt.Errorf("failed to set metadata policy: %w", err)
+			}
+		default:
+			return fmt.Errorf("unknown metadata policy '%s' (use keep, strip or replace)", args[0])
+		}
+		fmt.Printf("Metadata policy set to: %s\n", markerPolicy())
+		return nil
+	},
+}
+
+var CodingCmd = &bonzai.Cmd{
+	Name:  `coding`,
+	Short: `keep or change baseline/progressive output`,
+	Usage: `coding <keep|baseline|progressive|huffman|arithmetic|restart=N>...`,
+	Long: `
+Sets how the stego image is entropy coded. By default it keeps the coding
+of the cover: a progressive cover gives a progressive stego image, an
+arithmetic-coded one stays arithmetic-coded and restart markers stay at
+the same interval, so the file looks like the camera or editor wrote it.
+
+- keep: use the coding of the cover (default)
+- baseline | progressive: sequential or progressive scans
+- huffman | arithmetic: entropy coder
+- restart=N | norestart: restart marker every N MCUs, or none
+
+Words may be combined, e.g. "coding progressive restart=8"; anything not
+given keeps the cover's setting. Only the entropy coding changes: the
+coefficients, the payload and its header do not. Many browsers and
+viewers cannot display arithmetic-coded JPEGs.
+`,
+	Do: func(x *bonzai.Cmd, args ...string) error {
+		if len(args) < 1 {
+			fmt.Printf("Current output coding: %s\n", outputCoding())
+			fmt.Println("Usage: coding <keep|baseline|progressive|huffman|arithmetic|restart=N>...")
+			return nil
+		}
+
+		coding, err := core.ParseOutputCoding(strings.Join(args, ","))
+		if err != nil {
+			return err
+		}
+		value := coding.String()
+		if coding.Keep() {
+			value = ""
+		}
+		if err := vars.Set(OutputCodingVar, value, DCTEnv); err != nil {
+			return fmt.Errorf("failed to set output coding: %w", err)
+		}
+		fmt.Printf("Output coding set to: %s\n", coding)
+		if coding.Coder == core.CoderArithmetic {
+			fmt.Println("WARNING: many browsers and viewers cannot display arithmetic-coded JPEGs")
+		}
+		return nil
+	},
+}
+
+var KDFCmd = &bonzai.Cmd{
+	Name:  `kdf`,
+	Short: `set password key derivation function (argon2id; scrypt)`,
+	Usage: `kdf <argon2id|scrypt>`,
+	Long: `
+Sets the key derivation function used to turn the password into the
+AES-256 key:
+
+- argon2id: memory-hard, default (t=3, m=64MiB, p=4)
+- scrypt: alternative (N=2^15, r=8, p=1)
+
+The chosen KDF, its parameters and a random salt are written into a
+versioned header in front of the ciphertext, so decryption never needs
+this setting.
+`,
+	Do: func(x *bonzai.Cmd, args ...string) error {
+		if len(args) < 1 {
+			current, _ := vars.Get(KDFVar, EncryptEnv)
+			if current == "" {
+				current = seal.AlgorithmArgon2id.String()
+			}
+			fmt.Printf("Current KDF: %s\n", current)
+			fmt.Println("Usage: kdf <argon2id|scrypt>")
+			return nil
+		}
+
+		alg, err := seal.ParseAlgorithm(args[0])
+		if err != nil {
+			return err
+		}
+		if err := vars.Set(KDFVar, alg.String(), EncryptEnv); err != nil {
+			return fmt.Errorf("failed to set KDF: %w", err)
+		}
+		fmt.Printf("KDF set to: %s\n", alg)
 		return nil
 	},
 }
@@ -365,21 +786,32 @@ Usage: encrypt text <data> <key> qrcode binary direct <input.jpg> <output.jpg>
 		inputImage := args[0]
 		outputImage := args[1]
 
-		// Get encrypted data
-		encryptedData, varErr := vars.Get(EncryptDataVar, EncryptEnv)
-		if varErr != nil || encryptedData == "" {
-			return fmt.Errorf("no encrypted data found - run encrypt first")
+		// The coefficients take bytes, so embed the raw ciphertext rather
+		// than its base64. It is bounded by what one cover holds.
+		encrypted, err := encryptedStream()
+		if err != nil {
+			return err
 		}
-
-		fmt.Printf("Direct DCT: embedding %d bytes without QR overhead\n", len(encryptedData))
+		defer encrypted.Close()
+		sealed, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, encrypted))
+		if err != nil {
+			return fmt.Errorf("failed to read encrypted data: %w", err)
+		}
+		fmt.Printf("Direct DCT: embedding %d bytes without QR overhead\n", len(sealed))
 
 		// Embed directly into DCT coefficients
-		err := EmbedDataDirectlyInDCT(inputImage, outputImage, encryptedData)
+		err = EmbedBytesDirectlyInDCTWithKey(inputImage, outputImage, sealed, sessionKey)
 		if err != nil {
 			return fmt.Errorf("direct DCT embedding failed: %w", err)
 		}
+		if err := applyMarkerPolicy(outputImage); err != nil {
+			return err
+		}
+		if err := applyOutputCoding(outputImage); err != nil {
+			return err
+		}
 
-		fmt.Printf("Successfully embedded %d bytes directly into DCT coefficients: %s\n", len(encryptedData), outputImage)
+		fmt.Printf("Successfully embedded %d bytes directly into DCT coefficients: %s\n", len(sealed), outputImage)
 		return nil
 	},
 }
@@ -404,7 +836,6 @@ var EmbedCmd = &bonzai.Cmd{
 		},
 		{
 			K: EmbeddedImagePathVar,
-			V: `/tmp/embedded-image.jpg`,
 			E: EmbeddedImagePathEnv,
 			S: `path to output: embedded image`,
 			P: true,
@@ -414,8 +845,9 @@ var EmbedCmd = &bonzai.Cmd{
 Embed a QR code as binary data into an image using DCT.
 
 Usages:
-- encrypt text <input> <key> qrcode binary embed <input-image>;
 - encrypt text <input> <key> qrcode binary embed <input-image> <output-image>;
+- encrypt text <input> <key> qrcode binary embed <input-image>, with the
+  output path in the embedded-image-path var;
 `,
 	Do: func(x *bonzai.Cmd, args ...string) error {
 		// Check if first argument is a subcommand
@@ -435,7 +867,10 @@ Usages:
 		}
 		inputImage := args[0]
 
-		qrData, varErr := vars.Get(EncryptDataVar, EncryptEnv)
+		qrData, varErr := encryptedData()
+		if varErr != nil && sessionFile != "" {
+			return varErr
+		}
 		if varErr != nil || qrData == "" {
 			qrData = "zoo fall" // fallback
 			fmt.Printf("DEBUG: Failed to get qrData from vars (error: %v), using fallback\n", varErr)
@@ -449,18 +884,27 @@ Usages:
 		// }
 
 		// Set output image path
-		outputImage := vars.Fetch(EmbeddedImagePathEnv, EmbeddedImagePathVar, "/tmp/embedded-image.jpg")
+		outputImage := vars.Fetch(EmbeddedImagePathEnv, EmbeddedImagePathVar, "")
 		if len(args) > 1 {
 			outputImage = args[1] // Override output path if provided
 		}
+		if outputImage == "" {
+			return fmt.Errorf("missing output image path")
+		}
 
 		// Embed QR code into the JPEG using DCT
 		payloadSize := len(qrData) // Size of the Base64 encrypted data
 		fmt.Printf("DEBUG: qrData length: %d, qrData: '%.50s...'\n", len(qrData), qrData)
-		err := EmbedQRCodeInJPEG(inputImage, outputImage, qrData, payloadSize)
+		err := EmbedQRCodeInJPEGWithKey(inputImage, outputImage, qrData, payloadSize, sessionKey)
 		if err != nil {
 			return fmt.Errorf("failed to embed QR code in JPEG: %w", err)
 		}
+		if err := applyMarkerPolicy(outputImage); err != nil {
+			return err
+		}
+		if err := applyOutputCoding(outputImage); err != nil {
+			return err
+		}
 
 		fmt.Println("QR code embedded in:", outputImage)
 		return nil
@@ -480,7 +924,13 @@ var MultiQRCmd = &bonzai.Cmd{
 Embed encrypted data as multiple small QR codes arranged in a grid.
 This method provides compression resilience by using High ECC and chunking data.
 
+A metadata QR and one QR per chunk each go into their own 8x8-block
+aligned tile of the single output image, so one image can carry more than
+the largest QR code holds. Chunks are 400 bytes, or smaller when the cover
+is too small for the grid.
+
 Usage: encrypt text <data> <key> qrcode binary embed multiqr <input.jpg> <output.jpg>
+Decrypt with: decrypt multiqr <output.jpg> <key>
 `,
 	Do: func(x *bonzai.Cmd, args ...string) error {
 		fmt.Println("--- Multi-QR Grid Embedding (Compression Resilient) ---")
@@ -493,20 +943,26 @@ Usage: encrypt text <data> <key> qrcode binary embed multiqr <input.jpg> <output
 		outputImage := args[1]
 
 		// Get encrypted data
-		encryptedData, varErr := vars.Get(EncryptDataVar, EncryptEnv)
-		if varErr != nil || encryptedData == "" {
-			return fmt.Errorf("no encrypted data found - run encrypt first")
+		payload, err := encryptedData()
+		if err != nil {
+			return err
 		}
 
-		fmt.Printf("Multi-QR Grid: embedding %d bytes with compression resilience\n", len(encryptedData))
+		fmt.Printf("Multi-QR Grid: embedding %d bytes with compression resilience\n", len(payload))
 
 		// Embed using multi-QR grid strategy
-		err := EmbedMultiQRGrid(inputImage, outputImage, encryptedData)
+		err = EmbedMultiQRGridWithKey(inputImage, outputImage, payload, sessionKey)
 		if err != nil {
 			return fmt.Errorf("multi-QR grid embedding failed: %w", err)
 		}
+		if err := applyMarkerPolicy(outputImage); err != nil {
+			return err
+		}
+		if err := applyOutputCoding(outputImage); err != nil {
+			return err
+		}
 
-		fmt.Printf("Successfully embedded %d bytes using multi-QR grid: %s\n", len(encryptedData), outputImage)
+		fmt.Printf("Successfully embedded %d bytes using multi-QR grid: %s\n", len(payload), outputImage)
 		return nil
 	},
 }
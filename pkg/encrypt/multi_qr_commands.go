@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/BuddhiLW/crypt/pkg/core"
@@ -28,6 +29,7 @@ var EnhancedMultiQRCmd = &bonzai.Cmd{
 	Comp:  comp.Cmds,
 	Cmds: []*bonzai.Cmd{
 		MultiQREmbedCmd,
+		MultiQRFountainCmd,
 		MultiQRExtractCmd,
 		MultiQRScanCmd,
 		help.Cmd,
@@ -41,9 +43,11 @@ Features:
 - Directory scanning for automatic chunk discovery
 - Metadata validation and integrity checking
 - Compression resilience with High ECC
+- Fountain mode: any K (plus a few) of N images recover the payload
 
 Usage:
 - encrypt text <data> <key> multiqr embed <input.jpg> <output-dir>
+- encrypt text <data> <key> multiqr fountain <input.jpg> <output-dir> [symbols]
 - decrypt multiqr extract <metadata-file> <chunk-dir> <key>
 - decrypt multiqr scan <directory> <key>
 `,
@@ -51,12 +55,14 @@ Usage:
 		fmt.Printf("DEBUG: EnhancedMultiQRCmd called with args: %v\n", args)
 
 		if len(args) == 0 {
-			return fmt.Errorf("usage: multiqr <embed|extract|scan> [args...]")
+			return fmt.Errorf("usage: multiqr <embed|fountain|extract|scan> [args...]")
 		}
 
 		switch args[0] {
 		case MultiQREmbedCmd.Name:
 			return MultiQREmbedCmd.Do(x, args[1:]...)
+		case MultiQRFountainCmd.Name:
+			return MultiQRFountainCmd.Do(x, args[1:]...)
 		case MultiQRExtractCmd.Name:
 			return MultiQRExtractCmd.Do(x, args[1:]...)
 		case MultiQRScanCmd.Name:
@@ -77,8 +83,12 @@ Embed encrypted data as multiple QR codes with hash-based metadata.
 Usage: encrypt text <data> <key> multiqr embed <input.jpg> <output-dir>
 
 Creates:
-- metadata.qr: Contains chunk information and hashes
-- chunk_*.qr: Individual QR codes for each data chunk
+- metadata.jpeg: Chunk count, SHA-256 of every chunk and their order
+- chunk_*.jpeg: One QR code per 256-byte data chunk
+
+Files may be renamed and reordered: extraction identifies them by content.
+After 'encrypt file <path> <key> qrcode multiqr embed ...' the file is
+sealed as the chunks are written, so large files never sit in memory.
 `,
 	Do: func(x *bonzai.Cmd, args ...string) error {
 		fmt.Printf("DEBUG: MultiQREmbedCmd called with args: %v\n", args)
@@ -92,13 +102,12 @@ Creates:
 
 		fmt.Printf("DEBUG: inputImage=%s, outputDir=%s\n", inputImage, outputDir)
 
-		// Get encrypted data from vars
-		encryptedData, err := vars.Get(EncryptDataVar, EncryptEnv)
-		if err != nil || encryptedData == "" {
-			return fmt.Errorf("no encrypted data found. Run 'encrypt text <input> <key>' first")
+		// Read the encrypted data as the chunks are embedded
+		encrypted, err := encryptedStream()
+		if err != nil {
+			return err
 		}
-
-		fmt.Printf("DEBUG: Got encrypted data, length=%d\n", len(encryptedData))
+		defer encrypted.Close()
 
 		// Create output directory
 		if err := os.MkdirAll(outputDir, 0755); err != nil {
@@ -109,12 +118,12 @@ Creates:
 
 		// Create service using factory
 		factory := core.NewServiceFactory()
-		service := factory.CreateSteganographyService(MultiQREnv)
+		service := factory.CreateSteganographyServiceWithKey(MultiQREnv, sessionKey)
 
 		fmt.Printf("DEBUG: Created service\n")
 
 		// Embed using enhanced multi-QR
-		err = service.EmbedMultiQRWithMetadata(inputImage, outputDir, encryptedData, MultiQREnv)
+		err = service.EmbedMultiQRStream(inputImage, outputDir, encrypted, MultiQREnv)
 		if err != nil {
 			return fmt.Errorf("failed to embed multi-QR: %w", err)
 		}
@@ -124,6 +133,61 @@ Creates:
 	},
 }
 
+// MultiQRFountainCmd embeds data as fountain-coded QR symbols
+var MultiQRFountainCmd = &bonzai.Cmd{
+	Name:  "fountain",
+	Short: "embed data as fountain-coded QR codes, any K of N recover it",
+	Long: `
+Embed encrypted data as N fountain-coded (LT) QR symbols, one per image.
+
+Usage: encrypt text <data> <key> multiqr fountain <input.jpg> <output-dir> [symbols]
+
+The payload is cut into K blocks of 192 bytes. symbol_0..K-1 hold the
+blocks themselves, every further symbol a random combination of them.
+Any K or a few more symbols, in any order and under any name, rebuild
+the payload, so lost images do not matter as long as enough arrive.
+[symbols] defaults to K plus half again (at least K+2).
+
+Decrypt with: decrypt multiqr scan <directory> <key>
+`,
+	Do: func(x *bonzai.Cmd, args ...string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("usage: encrypt text <data> <key> multiqr fountain <input.jpg> <output-dir> [symbols]")
+		}
+
+		inputImage := args[0]
+		outputDir := args[1]
+		symbols := 0
+		if len(args) > 2 {
+			n, err := strconv.Atoi(args[2])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid symbol count: %s", args[2])
+			}
+			symbols = n
+		}
+
+		// The fountain code mixes blocks of the whole payload
+		payload, err := encryptedData()
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+
+		factory := core.NewServiceFactory()
+		service := factory.CreateSteganographyServiceWithKey(MultiQREnv, sessionKey)
+
+		if err := service.EmbedMultiQRFountain(inputImage, outputDir, payload, MultiQREnv, symbols); err != nil {
+			return fmt.Errorf("failed to embed fountain multi-QR: %w", err)
+		}
+
+		fmt.Printf("✅ Fountain multi-QR embedded successfully in: %s\n", outputDir)
+		return nil
+	},
+}
+
 // MultiQRExtractCmd extracts data from multiple QR codes using metadata
 var MultiQRExtractCmd = &bonzai.Cmd{
 	Name:  "extract",
@@ -131,15 +195,18 @@ var MultiQRExtractCmd = &bonzai.Cmd{
 	Long: `
 Extract data from multiple QR codes using hash-based metadata.
 
-Usage: decrypt multiqr extract <metadata-file> <chunk-dir> <key>
+Usage: decrypt multiqr extract <metadata-file> <chunk-dir> <key> [--out <file>]
 
-Requires:
-- metadata.qr: Contains chunk information and hashes
-- chunk_*.qr: Individual QR codes for each data chunk
+Reads the metadata QR from <metadata-file>, decodes every JPEG/PNG in
+<chunk-dir>, puts the chunks in order by their SHA-256 and decrypts them.
 `,
 	Do: func(x *bonzai.Cmd, args ...string) error {
+		args, out, err := SplitOutFlag(args)
+		if err != nil {
+			return err
+		}
 		if len(args) < 3 {
-			return fmt.Errorf("usage: decrypt multiqr extract <metadata-file> <chunk-dir> <key>")
+			return fmt.Errorf("usage: decrypt multiqr extract <metadata-file> <chunk-dir> <key> [--out <file>]")
 		}
 
 		metadataFile := args[0]
@@ -148,20 +215,26 @@ Requires:
 
 		// Create service using factory
 		factory := core.NewServiceFactory()
-		service := factory.CreateSteganographyService(MultiQREnv)
+		service := factory.CreateSteganographyServiceWithKey(MultiQREnv, key)
 
 		// Extract using enhanced multi-QR
-		extractedData, err := service.ExtractMultiQRWithMetadata(metadataFile, chunkDir, key, MultiQREnv)
+		plaintext, report, err := service.ExtractMultiQRStream(metadataFile, chunkDir, key, MultiQREnv)
+		PrintMultiQRScanReport(report)
 		if err != nil {
 			return fmt.Errorf("failed to extract multi-QR: %w", err)
 		}
 
+		text, err := RestorePlaintextStream(plaintext, out)
+		if err != nil || text == "" {
+			return err
+		}
+
 		// Store extracted data
-		if err := vars.Set(DecryptDataVar, extractedData, DecryptEnv); err != nil {
+		if err := vars.Set(DecryptDataVar, text, DecryptEnv); err != nil {
 			return fmt.Errorf("failed to store extracted data: %w", err)
 		}
 
-		fmt.Printf("✅ Enhanced multi-QR extracted successfully: %s\n", extractedData)
+		fmt.Printf("✅ Enhanced multi-QR extracted successfully: %s\n", text)
 		return nil
 	},
 }
@@ -173,17 +246,22 @@ var MultiQRScanCmd = &bonzai.Cmd{
 	Long: `
 Scan directory for QR files and automatically extract multi-QR data.
 
-Usage: decrypt multiqr scan <directory> <key>
+Usage: decrypt multiqr scan <directory> <key> [--out <file>]
 
 Automatically:
-- Finds metadata QR file
-- Discovers chunk QR files
-- Validates file integrity
+- Decodes every JPEG/PNG in the directory
+- Tells the metadata QR from the chunks by their content
+- Orders and validates the chunks by SHA-256
+- Without metadata, decodes fountain symbols (see multiqr fountain)
 - Extracts and decrypts data
 `,
 	Do: func(x *bonzai.Cmd, args ...string) error {
+		args, out, err := SplitOutFlag(args)
+		if err != nil {
+			return err
+		}
 		if len(args) < 2 {
-			return fmt.Errorf("usage: decrypt multiqr scan <directory> <key>")
+			return fmt.Errorf("usage: decrypt multiqr scan <directory> <key> [--out <file>]")
 		}
 
 		directory := args[0]
@@ -191,24 +269,42 @@ Automatically:
 
 		// Create service using factory
 		factory := core.NewServiceFactory()
-		service := factory.CreateSteganographyService(MultiQREnv)
+		service := factory.CreateSteganographyServiceWithKey(MultiQREnv, key)
 
 		// Scan and extract
-		extractedData, err := service.ScanAndExtractMultiQR(directory, key, MultiQREnv)
+		plaintext, report, err := service.ScanAndExtractMultiQRStream(directory, key, MultiQREnv)
+		PrintMultiQRScanReport(report)
 		if err != nil {
 			return fmt.Errorf("failed to scan and extract multi-QR: %w", err)
 		}
 
+		text, err := RestorePlaintextStream(plaintext, out)
+		if err != nil || text == "" {
+			return err
+		}
+
 		// Store extracted data
-		if err := vars.Set(DecryptDataVar, extractedData, DecryptEnv); err != nil {
+		if err := vars.Set(DecryptDataVar, text, DecryptEnv); err != nil {
 			return fmt.Errorf("failed to store extracted data: %w", err)
 		}
 
-		fmt.Printf("✅ Multi-QR data scanned and extracted successfully: %s\n", extractedData)
+		fmt.Printf("✅ Multi-QR data scanned and extracted successfully: %s\n", text)
 		return nil
 	},
 }
 
+// PrintMultiQRScanReport prints what a multi-QR scan found and the files it
+// skipped. A nil report prints nothing.
+func PrintMultiQRScanReport(report *core.MultiQRScanReport) {
+	if report == nil {
+		return
+	}
+	fmt.Printf("Multi-QR scan: %s\n", report.Summary())
+	for _, warning := range report.Warnings {
+		fmt.Printf("WARNING: %s\n", warning)
+	}
+}
+
 // Helper function to get chunk files from directory
 func getChunkFiles(dirPath string) ([]string, error) {
 	var chunkFiles []string
@@ -0,0 +1,229 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/BuddhiLW/crypt/pkg/envelope"
+	"github.com/BuddhiLW/crypt/pkg/seal"
+)
+
+// OutFlag restores a decrypted payload into a file, see SplitOutFlag
+const OutFlag = `--out`
+
+// EncryptFile seals the file at path in an envelope recording its name,
+// mode, size and MIME type. Like EncryptMessage it returns the ciphertext
+// in base64, the form vars can hold; embedders that take bytes decode it.
+func EncryptFile(path, key string) (string, error) {
+	var encrypted strings.Builder
+	encoder := base64.NewEncoder(base64.StdEncoding, &encrypted)
+	if _, err := EncryptFileTo(encoder, path, key); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return encrypted.String(), nil
+}
+
+// EncryptFileTo is EncryptFile writing the raw ciphertext to w as the file
+// is read: the envelope is sealed as a stream of segments (see
+// seal.NewWriter), so files need not fit in memory.
+func EncryptFileTo(w io.Writer, path, key string) (*envelope.Envelope, error) {
+	e, file, err := envelope.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+	header, err := e.MarshalHeader()
+	if err != nil {
+		return nil, err
+	}
+	params, err := kdfParams()
+	if err != nil {
+		return nil, err
+	}
+
+	counter := &countingWriter{w: w}
+	sealer, err := seal.NewWriter(counter, key, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if _, err := sealer.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	n, err := io.Copy(sealer, &progressReader{r: file, name: e.Name, size: e.Size})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt %s: %w", e.Name, err)
+	}
+	if n != e.Size {
+		return nil, fmt.Errorf("%s changed while it was encrypted: read %d of %d bytes", e.Name, n, e.Size)
+	}
+	if err := sealer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	fmt.Printf("🔐 Encrypted %s (%s, %d bytes, mode %v): %d sealed bytes\n",
+		e.Name, e.MIME, e.Size, e.Mode, counter.n)
+	return e, nil
+}
+
+// progressMinSize is the smallest file whose encryption reports progress
+const progressMinSize = 1 << 20
+
+// progressReader prints every tenth of a file it reads
+type progressReader struct {
+	r      io.Reader
+	name   string
+	size   int64
+	n      int64
+	tenths int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	if p.size >= progressMinSize {
+		if tenths := p.n * 10 / p.size; tenths > p.tenths {
+			p.tenths = tenths
+			fmt.Printf("🔐 Encrypting %s: %d%% (%d of %d bytes)\n", p.name, tenths*10, p.n, p.size)
+		}
+	}
+	return n, err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// SealedBytes returns the raw ciphertext of the base64 stored by
+// EncryptMessage and EncryptFile
+func SealedBytes(encrypted string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encrypted))
+	if err != nil {
+		return nil, fmt.Errorf("encrypted data is not base64: %w", err)
+	}
+	return sealed, nil
+}
+
+// OpenPayload decrypts a payload read back from an image. Current images
+// hold the raw ciphertext, older ones and QR codes its base64.
+func OpenPayload(payload []byte, key string) ([]byte, error) {
+	sealed := payload
+	if !seal.IsVersioned(payload) {
+		var err error
+		if sealed, err = SealedBytes(string(payload)); err != nil {
+			return nil, err
+		}
+	}
+	return seal.Open(sealed, key)
+}
+
+// OpenPayloadStream is OpenPayload for a payload read from r: streamed
+// ciphertext is decrypted a segment at a time as the reader is read
+func OpenPayloadStream(r io.Reader, key string) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	head, err := buffered.Peek(len(seal.Magic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.Equal(head, seal.Magic[:]) {
+		return seal.OpenReader(buffered, key)
+	}
+	return seal.OpenReader(base64.NewDecoder(base64.StdEncoding, buffered), key)
+}
+
+// SplitOutFlag removes `--out <file>` (or `--out=<file>`) from args and
+// returns the remaining arguments and the file, empty when not given
+func SplitOutFlag(args []string) ([]string, string, error) {
+	rest := make([]string, 0, len(args))
+	out := ""
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == OutFlag:
+			if i+1 >= len(args) {
+				return nil, "", fmt.Errorf("%s needs a file name", OutFlag)
+			}
+			i++
+			out = args[i]
+		case strings.HasPrefix(arg, OutFlag+"="):
+			out = strings.TrimPrefix(arg, OutFlag+"=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, out, nil
+}
+
+// RestorePlaintext writes a decrypted payload to out. Files sealed by
+// EncryptFile come back byte for byte with their mode; without out only
+// text is shown. It returns the text to print, empty when there is none.
+func RestorePlaintext(plaintext []byte, out string) (string, error) {
+	return RestorePlaintextStream(bytes.NewReader(plaintext), out)
+}
+
+// RestorePlaintextStream is RestorePlaintext for plaintext read from r, as
+// OpenPayloadStream returns it: segments are written to a temporary file as
+// they are verified, and nothing reaches out until the last one has been and
+// the file is renamed over it.
+func RestorePlaintextStream(r io.Reader, out string) (string, error) {
+	buffered := bufio.NewReader(r)
+	head, err := buffered.Peek(len(envelope.Magic))
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if !envelope.IsEnvelope(head) {
+		// A text message
+		if out == "" {
+			text, err := io.ReadAll(buffered)
+			if err != nil {
+				return "", err
+			}
+			return string(text), nil
+		}
+		n, err := envelope.WriteStream(out, buffered, 0644)
+		if err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", out, err)
+		}
+		fmt.Printf("Wrote %d bytes to %s\n", n, out)
+		return "", nil
+	}
+
+	e, data, err := envelope.NewReader(buffered)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Decrypted file: %s (%s, %d bytes, mode %v)\n", e.Name, e.MIME, e.Size, e.Mode)
+	if out == "" {
+		if strings.HasPrefix(e.MIME, "text/") {
+			text, err := io.ReadAll(data)
+			if err != nil {
+				return "", err
+			}
+			return string(text), nil
+		}
+		// Still read the rest, so a damaged payload is reported
+		if _, err := io.Copy(io.Discard, data); err != nil {
+			return "", err
+		}
+		fmt.Printf("Use %s <file> to restore %s\n", OutFlag, e.SafeName())
+		return "", nil
+	}
+	path, err := e.Restore(out, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to restore %s: %w", e.Name, err)
+	}
+	fmt.Printf("Restored %s to %s\n", e.Name, path)
+	return "", nil
+}
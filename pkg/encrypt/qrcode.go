@@ -1,453 +1,22 @@
 package encrypt
 
-/*
-#cgo CFLAGS: -I/usr/include
-#cgo LDFLAGS: -ljpeg
-#include <stdio.h>
-#include <stdlib.h>
-#include <string.h>
-#include <jpeglib.h>
-
-// extract_data_directly_from_dct extracts data directly from DCT coefficients (high capacity)
-int extract_data_directly_from_dct(const char* input_path, unsigned char* data, int max_data_size) {
-    struct jpeg_decompress_struct cinfo;
-    struct jpeg_error_mgr jerr;
-    FILE *infile;
-
-    // Open input file
-    if ((infile = fopen(input_path, "rb")) == NULL) {
-        fprintf(stderr, "Cannot open input file %s\n", input_path);
-        return 1;
-    }
-
-    // Initialize JPEG decompression
-    cinfo.err = jpeg_std_error(&jerr);
-    jpeg_create_decompress(&cinfo);
-    jpeg_stdio_src(&cinfo, infile);
-    jpeg_read_header(&cinfo, TRUE);
-
-    // Read DCT coefficients
-    jvirt_barray_ptr *coef_ptrs = jpeg_read_coefficients(&cinfo);
-    if (!coef_ptrs) {
-        fprintf(stderr, "Failed to read DCT coefficients\n");
-        fclose(infile);
-        return 2;
-    }
-
-    // Extract data bits from DCT coefficients
-    int bit_index = 0;
-    int coeff_positions[] = {1, 2, 3, 4, 5, 6};  // Same AC coefficients used during embedding
-    int coefficients_per_block = 6;
-    int max_bits = max_data_size * 8;
-
-    fprintf(stderr, "Direct DCT extraction: max %d bits from coefficients 1-6\n", max_bits);
-
-    // Clear output buffer
-    memset(data, 0, max_data_size);
-
-    for (JDIMENSION by = 0; by < cinfo.comp_info[0].height_in_blocks && bit_index < max_bits; by++) {
-        JBLOCKARRAY block_row = (JBLOCKARRAY)(*cinfo.mem->access_virt_barray)(
-            (j_common_ptr)&cinfo, coef_ptrs[0], by, 1, FALSE);
-
-        for (JDIMENSION bx = 0; bx < cinfo.comp_info[0].width_in_blocks && bit_index < max_bits; bx++) {
-            // Extract up to 6 bits per block from different AC coefficients
-            for (int coeff_idx = 0; coeff_idx < coefficients_per_block && bit_index < max_bits; coeff_idx++) {
-                int coeff_pos = coeff_positions[coeff_idx];
-
-                // Extract the LSB of this coefficient
-                unsigned char bit = block_row[0][bx][coeff_pos] & 1;
-
-                // Store bit into output buffer
-                if (bit == 1) {
-                    data[bit_index / 8] |= 1 << (7 - (bit_index % 8)); // Set bit
-                } else {
-                    data[bit_index / 8] &= ~(1 << (7 - (bit_index % 8))); // Clear bit
-                }
-
-                bit_index++;
-            }
-        }
-    }
-
-    // Cleanup
-    jpeg_finish_decompress(&cinfo);
-    jpeg_destroy_decompress(&cinfo);
-    fclose(infile);
-
-    fprintf(stderr, "Successfully extracted %d bits directly from DCT coefficients\n", bit_index);
-    return 0;
-}
-
-// embed_data_directly_in_dct embeds data directly into DCT coefficients (high capacity)
-int embed_data_directly_in_dct(const char* input_path, const char* output_path,
-                               const unsigned char* data, int data_size) {
-    struct jpeg_decompress_struct cinfo;
-    struct jpeg_compress_struct cinfo_out;
-    struct jpeg_error_mgr jerr;
-    FILE *infile, *outfile;
-
-    // Open input file
-    if ((infile = fopen(input_path, "rb")) == NULL) {
-        fprintf(stderr, "Cannot open input file %s\n", input_path);
-        return 1;
-    }
-
-    // Initialize JPEG decompression
-    cinfo.err = jpeg_std_error(&jerr);
-    jpeg_create_decompress(&cinfo);
-    jpeg_stdio_src(&cinfo, infile);
-    jpeg_read_header(&cinfo, TRUE);
-
-    // Read DCT coefficients
-    jvirt_barray_ptr *coef_ptrs = jpeg_read_coefficients(&cinfo);
-    if (!coef_ptrs) {
-        fprintf(stderr, "Failed to read DCT coefficients\n");
-        fclose(infile);
-        return 2;
-    }
-
-    // Initialize compression for output
-    cinfo_out.err = jpeg_std_error(&jerr);
-    jpeg_create_compress(&cinfo_out);
-    if ((outfile = fopen(output_path, "wb")) == NULL) {
-        fprintf(stderr, "Cannot open output file %s\n", output_path);
-        jpeg_finish_decompress(&cinfo);
-        jpeg_destroy_decompress(&cinfo);
-        fclose(infile);
-        return 3;
-    }
-    jpeg_stdio_dest(&cinfo_out, outfile);
-    jpeg_copy_critical_parameters(&cinfo, &cinfo_out);
-
-    // Calculate capacity and embed data
-    int total_blocks = cinfo.comp_info[0].height_in_blocks * cinfo.comp_info[0].width_in_blocks;
-    int coefficients_per_block = 6;  // Use coefficients 1,2,3,4,5,6 (skip DC coefficient 0)
-    int available_bits = total_blocks * coefficients_per_block;
-    int required_bits = data_size * 8;
-
-    fprintf(stderr, "Direct DCT: need %d bits, have %d blocks × %d coeffs = %d bits available\n",
-            required_bits, total_blocks, coefficients_per_block, available_bits);
-
-    if (required_bits > available_bits) {
-        fprintf(stderr, "Error: data too large for direct DCT capacity\n");
-        jpeg_finish_decompress(&cinfo);
-        jpeg_destroy_decompress(&cinfo);
-        jpeg_finish_compress(&cinfo_out);
-        jpeg_destroy_compress(&cinfo_out);
-        fclose(infile);
-        fclose(outfile);
-        return 4;
-    }
-
-    // Embed data bits into DCT coefficients
-    int bit_index = 0;
-    int coeff_positions[] = {1, 2, 3, 4, 5, 6};  // AC coefficients to use
-
-    for (JDIMENSION by = 0; by < cinfo.comp_info[0].height_in_blocks && bit_index < required_bits; by++) {
-        JBLOCKARRAY block_row = (JBLOCKARRAY)(*cinfo.mem->access_virt_barray)(
-            (j_common_ptr)&cinfo, coef_ptrs[0], by, 1, TRUE);
-
-        for (JDIMENSION bx = 0; bx < cinfo.comp_info[0].width_in_blocks && bit_index < required_bits; bx++) {
-            // Embed up to 6 bits per block using different AC coefficients
-            for (int coeff_idx = 0; coeff_idx < coefficients_per_block && bit_index < required_bits; coeff_idx++) {
-                int coeff_pos = coeff_positions[coeff_idx];
-
-                // Get the bit to embed
-                unsigned char bit = (data[bit_index / 8] >> (7 - (bit_index % 8))) & 1;
-
-                // Modify the LSB of this coefficient
-                if (bit == 1) {
-                    block_row[0][bx][coeff_pos] |= 1;  // Set LSB to 1
-                } else {
-                    block_row[0][bx][coeff_pos] &= ~1; // Set LSB to 0
-                }
-
-                bit_index++;
-            }
-        }
-    }
-
-    // Write modified coefficients
-    jpeg_write_coefficients(&cinfo_out, coef_ptrs);
-
-    // Cleanup
-    jpeg_finish_compress(&cinfo_out);
-    jpeg_destroy_compress(&cinfo_out);
-    jpeg_finish_decompress(&cinfo);
-    jpeg_destroy_decompress(&cinfo);
-    fclose(outfile);
-    fclose(infile);
-
-    fprintf(stderr, "Successfully embedded %d bits directly into DCT coefficients\n", bit_index);
-    return 0;
-}
-
-// Embed QR Code into DCT Coefficients (Single Coefficient Strategy)
-// Returns 0 on success, non-zero on error
-int embed_qr_in_dct_single(const char *input_path, const char *output_path, unsigned char *qr_data, int qr_size) {
-    struct jpeg_decompress_struct cinfo;
-    struct jpeg_compress_struct cinfo_out;
-    struct jpeg_error_mgr jerr;
-    FILE *infile, *outfile;
-
-    // Open input JPEG file
-    if ((infile = fopen(input_path, "rb")) == NULL) {
-        fprintf(stderr, "Cannot open input file %s\n", input_path);
-        return 1;
-    }
-
-    // Initialize JPEG decompression
-    cinfo.err = jpeg_std_error(&jerr);
-    jpeg_create_decompress(&cinfo);
-    jpeg_stdio_src(&cinfo, infile);
-    jpeg_read_header(&cinfo, TRUE);
-
-    // Read DCT coefficients
-    jvirt_barray_ptr *coef_ptrs = jpeg_read_coefficients(&cinfo);
-    if (!coef_ptrs) {
-        fprintf(stderr, "Failed to read DCT coefficients from %s\n", input_path);
-        fclose(infile);
-        return 2;
-    }
-
-    // Initialize compression structure for output
-    cinfo_out.err = jpeg_std_error(&jerr);
-    jpeg_create_compress(&cinfo_out);
-    if ((outfile = fopen(output_path, "wb")) == NULL) {
-        fprintf(stderr, "Cannot open output file %s\n", output_path);
-        jpeg_finish_decompress(&cinfo);
-        jpeg_destroy_decompress(&cinfo);
-        fclose(infile);
-        return 3;
-    }
-    jpeg_stdio_dest(&cinfo_out, outfile);
-    jpeg_copy_critical_parameters(&cinfo, &cinfo_out);
-
-    // Calculate available capacity
-    int total_blocks = cinfo.comp_info[0].height_in_blocks * cinfo.comp_info[0].width_in_blocks;
-    int available_bits = total_blocks;  // One bit per block
-    int required_bits = qr_size * 8;
-
-    fprintf(stderr, "DCT embedding: need %d bits, have %d blocks (%d bits available)\n",
-            required_bits, total_blocks, available_bits);
-
-    if (required_bits > available_bits) {
-        fprintf(stderr, "Error: QR data too large for image capacity\n");
-        jpeg_finish_decompress(&cinfo);
-        jpeg_destroy_decompress(&cinfo);
-        jpeg_finish_compress(&cinfo_out);
-        jpeg_destroy_compress(&cinfo_out);
-        fclose(infile);
-        fclose(outfile);
-        return 4;
-    }
-
-    // Embed QR code into mid-frequency DCT coefficients with simple redundancy
-    // Use stronger embedding instead of complex redundancy for now
-    int bit_index = 0;
-
-    for (JDIMENSION by = 0; by < cinfo.comp_info[0].height_in_blocks && bit_index < required_bits; by++) {
-        JBLOCKARRAY block_row = (JBLOCKARRAY)(*cinfo.mem->access_virt_barray)(
-            (j_common_ptr)&cinfo, coef_ptrs[0], by, 1, TRUE);
-
-        for (JDIMENSION bx = 0; bx < cinfo.comp_info[0].width_in_blocks && bit_index < required_bits; bx++) {
-            unsigned char bit = (qr_data[bit_index / 8] >> (7 - (bit_index % 8))) & 1;
-
-            			// Use low-frequency coefficient (position 1) for better robustness
-			int dct_pos = 1;
-
-            // Simple LSB embedding (traditional approach) with logging
-            int original_coeff = block_row[0][bx][dct_pos];
-            if (bit == 1) {
-                block_row[0][bx][dct_pos] |= 1;  // Set LSB to 1
-            } else {
-                block_row[0][bx][dct_pos] &= ~1; // Set LSB to 0
-            }
-            int new_coeff = block_row[0][bx][dct_pos];
-
-            // Log first 10 embeddings for debugging
-            if (bit_index < 10) {
-                fprintf(stderr, "Embed bit %d: pos(%d,%d) coeff[%d] %d->%d (bit=%d)\n",
-                    bit_index, bx, by, dct_pos, original_coeff, new_coeff, bit);
-            }
-
-            bit_index++;
-        }
-    }
-
-    // Write modified coefficients
-    jpeg_write_coefficients(&cinfo_out, coef_ptrs);
-
-    // Immediate validation: verify first few coefficients were modified
-    fprintf(stderr, "=== IMMEDIATE VALIDATION ===\n");
-    int validation_errors = 0;
-    for (int validate_bits = 0; validate_bits < 10 && validate_bits < required_bits; validate_bits++) {
-        JDIMENSION val_by = validate_bits / cinfo.comp_info[0].width_in_blocks;
-        JDIMENSION val_bx = validate_bits % cinfo.comp_info[0].width_in_blocks;
-
-        JBLOCKARRAY val_block_row = (JBLOCKARRAY)(*cinfo.mem->access_virt_barray)(
-            (j_common_ptr)&cinfo, coef_ptrs[0], val_by, 1, FALSE);
-
-        unsigned char expected_bit = (qr_data[validate_bits / 8] >> (7 - (validate_bits % 8))) & 1;
-        unsigned char actual_bit = val_block_row[0][val_bx][1] & 1;
-
-        if (expected_bit != actual_bit) {
-            fprintf(stderr, "VALIDATION ERROR bit %d: expected %d, got %d\n",
-                validate_bits, expected_bit, actual_bit);
-            validation_errors++;
-        } else {
-            fprintf(stderr, "VALIDATION OK bit %d: %d\n", validate_bits, actual_bit);
-        }
-    }
-
-    if (validation_errors > 0) {
-        fprintf(stderr, "EMBEDDING VALIDATION FAILED: %d errors out of 10 tested bits\n", validation_errors);
-        // Don't return error yet, let's see what happens
-    } else {
-        fprintf(stderr, "EMBEDDING VALIDATION PASSED: All tested bits correct\n");
-    }
-
-    // Cleanup
-    jpeg_finish_compress(&cinfo_out);
-    jpeg_destroy_compress(&cinfo_out);
-    jpeg_finish_decompress(&cinfo);
-    jpeg_destroy_decompress(&cinfo);
-    fclose(infile);
-    fclose(outfile);
-
-    fprintf(stderr, "Successfully embedded %d bits into %s\n", bit_index, output_path);
-    return 0;
-}
-
-// Embed QR Code into DCT Coefficients (Multi-Coefficient Strategy - 4x capacity)
-// Returns 0 on success, non-zero on error
-int embed_qr_in_dct_multi(const char *input_path, const char *output_path, unsigned char *qr_data, int qr_size) {
-    struct jpeg_decompress_struct cinfo;
-    struct jpeg_compress_struct cinfo_out;
-    struct jpeg_error_mgr jerr;
-    FILE *infile, *outfile;
-
-    // Open input JPEG file
-    if ((infile = fopen(input_path, "rb")) == NULL) {
-        fprintf(stderr, "Cannot open input file %s\n", input_path);
-        return 1;
-    }
-
-    // Initialize JPEG decompression
-    cinfo.err = jpeg_std_error(&jerr);
-    jpeg_create_decompress(&cinfo);
-    jpeg_stdio_src(&cinfo, infile);
-    jpeg_read_header(&cinfo, TRUE);
-
-    // Read DCT coefficients
-    jvirt_barray_ptr *coef_ptrs = jpeg_read_coefficients(&cinfo);
-    if (!coef_ptrs) {
-        fprintf(stderr, "Failed to read DCT coefficients from %s\n", input_path);
-        fclose(infile);
-        return 2;
-    }
-
-    // Initialize compression structure for output
-    cinfo_out.err = jpeg_std_error(&jerr);
-    jpeg_create_compress(&cinfo_out);
-    if ((outfile = fopen(output_path, "wb")) == NULL) {
-        fprintf(stderr, "Cannot open output file %s\n", output_path);
-        fclose(infile);
-        return 3;
-    }
-    jpeg_stdio_dest(&cinfo_out, outfile);
-    jpeg_copy_critical_parameters(&cinfo, &cinfo_out);
-
-    // Calculate available capacity (4 bits per block for multi-coefficient)
-    int total_blocks = cinfo.comp_info[0].height_in_blocks * cinfo.comp_info[0].width_in_blocks;
-    int available_bits = total_blocks * 4;  // 4 coefficients per block
-    int required_bits = qr_size * 8;
-
-    fprintf(stderr, "DCT multi-coeff embedding: need %d bits, have %d blocks (%d bits available)\n",
-            required_bits, total_blocks, available_bits);
-
-    if (required_bits > available_bits) {
-        fprintf(stderr, "QR data too large for image capacity (multi-coeff)\n");
-        fclose(infile);
-        fclose(outfile);
-        return 4;
-    }
-
-    // Embed QR code into mid-frequency DCT coefficients using 4 coefficients per block
-    int bit_index = 0;
-    int coeff_positions[4] = {4, 5, 6, 7};  // Mid-frequency positions
-
-    for (JDIMENSION by = 0; by < cinfo.comp_info[0].height_in_blocks && bit_index < required_bits; by++) {
-        JBLOCKARRAY block_row = (JBLOCKARRAY)(*cinfo.mem->access_virt_barray)(
-            (j_common_ptr)&cinfo, coef_ptrs[0], by, 1, TRUE);
-
-        for (JDIMENSION bx = 0; bx < cinfo.comp_info[0].width_in_blocks && bit_index < required_bits; bx++) {
-            // Embed up to 4 bits per block using different coefficients
-            for (int coeff_idx = 0; coeff_idx < 4 && bit_index < required_bits; coeff_idx++) {
-                unsigned char bit = (qr_data[bit_index / 8] >> (7 - (bit_index % 8))) & 1;
-                int dct_pos = coeff_positions[coeff_idx];
-
-                // Simple LSB embedding (traditional approach)
-                if (bit == 1) {
-                    block_row[0][bx][dct_pos] |= 1;  // Set LSB to 1
-                } else {
-                    block_row[0][bx][dct_pos] &= ~1; // Set LSB to 0
-                }
-
-                bit_index++;
-            }
-        }
-    }
-
-    // Write modified coefficients
-    jpeg_write_coefficients(&cinfo_out, coef_ptrs);
-
-    // Cleanup
-    jpeg_finish_compress(&cinfo_out);
-    jpeg_destroy_compress(&cinfo_out);
-    jpeg_finish_decompress(&cinfo);
-    jpeg_destroy_decompress(&cinfo);
-    fclose(infile);
-    fclose(outfile);
-
-    fprintf(stderr, "Successfully embedded %d bits into %s (multi-coeff)\n", bit_index, output_path);
-    return 0;
-}
-
-// Test function for direct DCT embedding (for unit tests)
-int test_dct_embedding(const char *input_path, const char *output_path, unsigned char *data, int data_size, int multi_coeff) {
-    if (multi_coeff) {
-        return embed_qr_in_dct_multi(input_path, output_path, data, data_size);
-    } else {
-        return embed_qr_in_dct_single(input_path, output_path, data, data_size);
-    }
-}
-
-
-
-// Test function for direct DCT extraction (for unit tests)
-void test_dct_extraction(const char *input_path, unsigned char *data, int data_size, int multi_coeff) {
-    if (multi_coeff) {
-        extract_qr_from_dct_multi(input_path, data, data_size);
-    } else {
-        extract_qr_from_dct_single(input_path, data, data_size);
-    }
-}
-
-*/
-import "C"
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/binary"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"image"
-	"image/jpeg"
 	"math"
 	"os"
-	"unsafe"
+	"strconv"
+	"strings"
 
+	"github.com/BuddhiLW/crypt"
+	"github.com/BuddhiLW/crypt/pkg/core"
+	"github.com/BuddhiLW/crypt/pkg/fec"
+	"github.com/BuddhiLW/crypt/pkg/jpegcoef"
 	"github.com/rwxrob/bonzai/vars"
 	"github.com/skip2/go-qrcode"
 )
@@ -503,6 +72,229 @@ func (m *MultiCoefficientDCT) GetCCode() string {
 	return "multi" // Will map to new C code
 }
 
+// PermutedCoefficientDCT scatters bits over a password-keyed walk of the
+// low/mid frequency coefficients of every block
+type PermutedCoefficientDCT struct{}
+
+func (p *PermutedCoefficientDCT) CalculateCapacity(width, height int) int {
+	dctBlocksX := (width + 7) / 8
+	dctBlocksY := (height + 7) / 8
+	return dctBlocksX * dctBlocksY * core.DCTStrategyPermuted.GetCoefficientsPerBit()
+}
+
+func (p *PermutedCoefficientDCT) GetCoefficientsPerBit() int {
+	return 1
+}
+
+func (p *PermutedCoefficientDCT) GetStrategyName() string {
+	return "permuted-coefficient"
+}
+
+func (p *PermutedCoefficientDCT) GetCCode() string {
+	return "permuted" // Walk computed in Go, see core.PermutationKey
+}
+
+// ThresholdCoefficientDCT only embeds into coefficients whose magnitude is at
+// least the threshold, so zeros and ±1 stay untouched (JSteg/OutGuess style)
+type ThresholdCoefficientDCT struct {
+	threshold int
+}
+
+// CalculateCapacity is an upper bound; see CalculateImageCapacity
+func (t *ThresholdCoefficientDCT) CalculateCapacity(width, height int) int {
+	dctBlocksX := (width + 7) / 8
+	dctBlocksY := (height + 7) / 8
+	return dctBlocksX * dctBlocksY * core.DCTStrategyThreshold.GetCoefficientsPerBit()
+}
+
+// CalculateImageCapacity counts the eligible coefficients of the image
+func (t *ThresholdCoefficientDCT) CalculateImageCapacity(imagePath string) (int, error) {
+	return core.NewServiceFactory().CreateDCTProcessorWithParams(core.DCTParams{Threshold: t.threshold}).
+		CalculateImageCapacity(imagePath, core.DCTStrategyThreshold)
+}
+
+func (t *ThresholdCoefficientDCT) GetCoefficientsPerBit() int {
+	return 1
+}
+
+func (t *ThresholdCoefficientDCT) GetStrategyName() string {
+	return "threshold-coefficient"
+}
+
+func (t *ThresholdCoefficientDCT) GetCCode() string {
+	return "threshold" // Eligibility computed in Go, see core.NormalizeThreshold
+}
+
+// F5MatrixDCT embeds with Hamming matrix embedding over the nonzero
+// coefficients, decrementing magnitudes instead of overwriting LSBs
+type F5MatrixDCT struct{}
+
+// CalculateCapacity is an upper bound; see CalculateImageCapacity
+func (f *F5MatrixDCT) CalculateCapacity(width, height int) int {
+	dctBlocksX := (width + 7) / 8
+	dctBlocksY := (height + 7) / 8
+	return dctBlocksX * dctBlocksY * core.DCTStrategyF5.GetCoefficientsPerBit()
+}
+
+// CalculateImageCapacity estimates the F5 capacity of the image
+func (f *F5MatrixDCT) CalculateImageCapacity(imagePath string) (int, error) {
+	return core.NewServiceFactory().CreateDCTProcessor().
+		CalculateImageCapacity(imagePath, core.DCTStrategyF5)
+}
+
+func (f *F5MatrixDCT) GetCoefficientsPerBit() int {
+	return 1
+}
+
+func (f *F5MatrixDCT) GetStrategyName() string {
+	return "f5-matrix"
+}
+
+func (f *F5MatrixDCT) GetCCode() string {
+	return "f5" // Matrix embedding computed in Go
+}
+
+// QIMLatticeDCT quantizes mid-frequency coefficients onto dithered lattices
+// (6 bits per block); the payload survives recompression down to the
+// quality the step is sized for
+type QIMLatticeDCT struct{}
+
+func (l *QIMLatticeDCT) CalculateCapacity(width, height int) int {
+	dctBlocksX := (width + 7) / 8
+	dctBlocksY := (height + 7) / 8
+	return dctBlocksX * dctBlocksY * core.DCTStrategyQIM.GetCoefficientsPerBit()
+}
+
+func (l *QIMLatticeDCT) GetCoefficientsPerBit() int {
+	return 1
+}
+
+func (l *QIMLatticeDCT) GetStrategyName() string {
+	return "qim-lattice"
+}
+
+func (l *QIMLatticeDCT) GetCCode() string {
+	return "qim" // Lattices computed in Go, see core.NormalizeQIMStep
+}
+
+// imageCapacityStrategy is implemented by strategies whose capacity depends
+// on the image content rather than its dimensions
+type imageCapacityStrategy interface {
+	CalculateImageCapacity(imagePath string) (int, error)
+}
+
+// coefficientThreshold returns the threshold set by `strategy threshold <min>`
+func coefficientThreshold() int {
+	value, _ := vars.Get(DCTThresholdVar, DCTEnv)
+	threshold, err := strconv.Atoi(value)
+	if err != nil {
+		return core.DefaultCoefficientThreshold
+	}
+	return core.NormalizeThreshold(threshold)
+}
+
+// directStrategy returns the layout direct payloads use with the strategy
+// selected in vars: the strategies that only exist in Go are used as is,
+// single and multi fall back to the 6 coefficient direct layout
+func directStrategy() core.DCTStrategy {
+	strategyName, _ := vars.Get(DCTStrategyVar, DCTEnv)
+	switch strategy, _ := core.ParseDCTStrategy(strategyName); strategy {
+	case core.DCTStrategyPermuted, core.DCTStrategyThreshold, core.DCTStrategyF5, core.DCTStrategyQIM:
+		return strategy
+	}
+	return core.DCTStrategyDirect
+}
+
+// dctParams returns the strategy parameters set with `strategy`
+func dctParams() core.DCTParams {
+	value, _ := vars.Get(DCTQIMStepVar, DCTEnv)
+	step, err := strconv.Atoi(value)
+	if err != nil {
+		step = core.DefaultQIMStep
+	}
+	value, _ = vars.Get(ComponentsVar, DCTEnv)
+	components, err := core.ParseComponentSet(value)
+	if err != nil {
+		fmt.Printf("Warning: ignoring invalid DCT components %q: %v\n", value, err)
+	}
+	return core.DCTParams{Threshold: coefficientThreshold(), QIMStep: core.NormalizeQIMStep(step), Components: components}
+}
+
+// fecParams returns the error correction set with `fec`
+func fecParams() fec.Params {
+	value, _ := vars.Get(FECVar, DCTEnv)
+	params, err := fec.ParseParams(value)
+	if err != nil {
+		fmt.Printf("Warning: ignoring invalid FEC level %q: %v\n", value, err)
+		return fec.LevelOff
+	}
+	return params
+}
+
+// qrCopies returns the QR copy count set with `copies`, QRCopiesAuto
+// included
+func qrCopies() int {
+	value, _ := vars.Get(QRCopiesVar, DCTEnv)
+	copies, err := core.ParseQRCopies(value)
+	if err != nil {
+		fmt.Printf("Warning: ignoring invalid QR copies %q: %v\n", value, err)
+		return 1
+	}
+	return copies
+}
+
+// markerPolicy returns the metadata policy set with `metadata`
+func markerPolicy() core.MarkerPolicy {
+	var policy core.MarkerPolicy
+	strip, _ := vars.Get(MarkerStripVar, DCTEnv)
+	replace, _ := vars.Get(MarkerReplaceVar, DCTEnv)
+	policy.Donor, _ = vars.Get(MarkerDonorVar, DCTEnv)
+	var err error
+	if policy.Strip, err = jpegcoef.ParseSegmentKinds(strip); err != nil {
+		fmt.Printf("Warning: ignoring invalid metadata strip list %q: %v\n", strip, err)
+	}
+	if policy.Replace, err = jpegcoef.ParseSegmentKinds(replace); err != nil {
+		fmt.Printf("Warning: ignoring invalid metadata replace list %q: %v\n", replace, err)
+	}
+	return policy
+}
+
+// applyMarkerPolicy applies the metadata policy to the stego image at path
+func applyMarkerPolicy(path string) error {
+	policy := markerPolicy()
+	if policy.Keep() {
+		return nil
+	}
+	if err := core.ApplyMarkerPolicy(path, policy); err != nil {
+		return fmt.Errorf("failed to apply metadata policy: %w", err)
+	}
+	fmt.Printf("Metadata policy applied: %s\n", policy)
+	return nil
+}
+
+// outputCoding reads the output coding from vars
+func outputCoding() core.OutputCoding {
+	value, _ := vars.Get(OutputCodingVar, DCTEnv)
+	coding, err := core.ParseOutputCoding(value)
+	if err != nil {
+		fmt.Printf("Warning: ignoring invalid output coding %q: %v\n", value, err)
+	}
+	return coding
+}
+
+// applyOutputCoding re-codes the stego image at path as set by `coding`
+func applyOutputCoding(path string) error {
+	coding := outputCoding()
+	if coding.Keep() {
+		return nil
+	}
+	if err := core.ApplyOutputCoding(path, coding); err != nil {
+		return fmt.Errorf("failed to apply output coding: %w", err)
+	}
+	fmt.Printf("Output coding applied: %s\n", coding)
+	return nil
+}
+
 // QRSizeCalculator handles QR code size calculations (SRP)
 type QRSizeCalculator struct {
 	strategy DCTEmbeddingStrategy
@@ -520,26 +312,18 @@ type ImageDimensions struct {
 
 // GetImageDimensions extracts dimensions from a JPEG file (SRP)
 func GetImageDimensions(imagePath string) (*ImageDimensions, error) {
-	file, err := os.Open(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open image: %w", err)
-	}
-	defer file.Close()
-
-	config, err := jpeg.DecodeConfig(file)
+	// jpegcoef also reads the arithmetic-coded covers image/jpeg rejects
+	img, err := jpegcoef.DecodeFile(imagePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image config: %w", err)
 	}
 
 	return &ImageDimensions{
-		Width:  config.Width,
-		Height: config.Height,
+		Width:  img.Width,
+		Height: img.Height,
 	}, nil
 }
 
-// ✅ **Fix for `C.free` not recognized**
-// `C.free` must be explicitly included in `stdlib.h` (which we did in CGO).
-
 // CreateQRCodeBytes generates a QR code and returns its PNG bytes.
 // Now tries ECC Highest -> High -> Medium -> Low and returns the first that fits.
 func CreateQRCodeBytes(data string) ([]byte, error) {
@@ -569,6 +353,23 @@ func EncodeQRCodeWithFallback(data string, size int) ([]byte, qrcode.RecoveryLev
 	return nil, qrcode.Low, fmt.Errorf("failed to encode QR with High or Highest ECC - payload too large for robust DCT steganography: %w", lastErr)
 }
 
+// EncodeQRModulesWithFallback is EncodeQRCodeWithFallback for the module
+// matrix of the QR (see core.GoQRProcessor.GenerateModules): Highest ECC if
+// the data fits, High otherwise. It returns the matrix and its side in modules.
+func EncodeQRModulesWithFallback(data string) ([]byte, int, error) {
+	qr := core.NewGoQRProcessor()
+	modules, size, err := qr.GenerateModules(data, core.ECCLevelHighest)
+	if err == nil {
+		fmt.Printf("Successfully generated QR code with Highest ECC level\n")
+		return modules, size, nil
+	}
+	if modules, size, err = qr.GenerateModules(data, core.ECCLevelHigh); err == nil {
+		fmt.Printf("Successfully generated QR code with High ECC level\n")
+		return modules, size, nil
+	}
+	return nil, 0, fmt.Errorf("failed to encode QR with High or Highest ECC - payload too large for robust DCT steganography: %w", err)
+}
+
 // WriteQRCodeWithFallback writes a QR to a file and returns chosen ECC level.
 func WriteQRCodeWithFallback(data string, size int, path string) (qrcode.RecoveryLevel, error) {
 	png, level, err := EncodeQRCodeWithFallback(data, size)
@@ -649,8 +450,21 @@ func ExtractBitstreamFromPNG(pngData []byte) ([]byte, error) {
 	return bitstream, nil
 }
 
-// EmbedQRCodeInJPEG embeds a QR code bitstream into a JPEG's DCT coefficients using SOLID principles
+// EmbedQRCodeInJPEG embeds the module matrix of a QR code into a JPEG's DCT
+// coefficients using SOLID principles. payloadSize is not needed any more:
+// the QR version follows from qrData.
 func EmbedQRCodeInJPEG(inputPath, outputPath, qrData string, payloadSize int) error {
+	return embedQRCodeWithMethod(inputPath, outputPath, qrData, core.EmbedMethodQR, "")
+}
+
+// EmbedQRCodeInJPEGWithKey is EmbedQRCodeInJPEG with the password needed by
+// the permuted strategy
+func EmbedQRCodeInJPEGWithKey(inputPath, outputPath, qrData string, payloadSize int, password string) error {
+	return embedQRCodeWithMethod(inputPath, outputPath, qrData, core.EmbedMethodQR, password)
+}
+
+// embedQRCodeWithMethod embeds a QR code and records method in the image header
+func embedQRCodeWithMethod(inputPath, outputPath, qrData string, method core.EmbedMethod, password string) error {
 	// Get DCT strategy from Bonzai vars (DIP - dependency inversion)
 	strategyName, _ := vars.Get(DCTStrategyVar, DCTEnv)
 	if strategyName == "" {
@@ -661,110 +475,68 @@ func EmbedQRCodeInJPEG(inputPath, outputPath, qrData string, payloadSize int) er
 	switch strategyName {
 	case "multi-coefficient":
 		strategy = &MultiCoefficientDCT{}
+	case "permuted-coefficient":
+		strategy = &PermutedCoefficientDCT{}
+	case "threshold-coefficient":
+		strategy = &ThresholdCoefficientDCT{threshold: coefficientThreshold()}
+	case "f5-matrix":
+		strategy = &F5MatrixDCT{}
+	case "qim-lattice":
+		strategy = &QIMLatticeDCT{}
 	default:
 		strategy = &SingleCoefficientDCT{}
 	}
 
-	// Create QR size calculator with strategy (OCP - open/closed principle)
-	calculator := NewQRSizeCalculator(strategy)
-
-	// Calculate optimal QR size
-	qrSize, err := calculator.CalculateOptimalQRSize(inputPath, payloadSize)
-	if err != nil {
-		return fmt.Errorf("error calculating QR size: %w", err)
+	if err := vars.Set(DCTStrategyVar, strategy.GetStrategyName(), DCTEnv); err != nil {
+		fmt.Printf("Warning: failed to store DCT strategy in vars: %v\n", err)
 	}
 
-	fmt.Printf("Using QR size: %dx%d for image\n", qrSize, qrSize)
-
-	// Generate QR Code as PNG bytes (High/Highest ECC only)
-	qrBytes, _, err := EncodeQRCodeWithFallback(qrData, qrSize)
+	// Map the strategy onto the core DCT layout (OCP - open/closed principle)
+	coreStrategy := core.DCTStrategySingle
+	switch strategy.GetCCode() {
+	case "multi":
+		coreStrategy = core.DCTStrategyMulti
+	case "permuted":
+		coreStrategy = core.DCTStrategyPermuted
+	case "threshold":
+		coreStrategy = core.DCTStrategyThreshold
+	case "f5":
+		coreStrategy = core.DCTStrategyF5
+	case "qim":
+		coreStrategy = core.DCTStrategyQIM
+	}
+
+	cover, err := os.Open(inputPath)
 	if err != nil {
-		return fmt.Errorf("error generating QR code: %w", err)
-	}
-	// No warning needed - we only allow High/Highest ECC now
-
-	// Convert PNG to bitstream
-	bitstream, err := ExtractBitstreamFromPNG(qrBytes)
+		return fmt.Errorf("failed to open cover: %w", err)
+	}
+	defer cover.Close()
+
+	// The facade encodes the module matrix (High/Highest ECC only), embeds
+	// its copies into disjoint coefficients and writes the header, which
+	// alone describes the matrix
+	result, err := crypt.Embed(context.Background(), cover, []byte(qrData),
+		crypt.WithMethod(method),
+		crypt.WithStrategy(coreStrategy),
+		crypt.WithParams(dctParams()),
+		crypt.WithCopies(qrCopies()),
+		crypt.WithWalkKey(password))
 	if err != nil {
-		return fmt.Errorf("error extracting bitstream: %w", err)
-	}
-
-	// Decode the PNG to get the actual dimensions
-	img, _, err := image.Decode(bytes.NewReader(qrBytes))
-	if err != nil {
-		return fmt.Errorf("failed to decode generated QR PNG: %w", err)
-	}
-	actualQRSize := img.Bounds().Dx() // Assume square QR code
-	fmt.Printf("Actual QR code size: %dx%d\n", actualQRSize, actualQRSize)
-
-	// Log first few bytes of bitstream for debugging (should be mostly zeros due to quiet zones)
-	fmt.Printf("QR bitstream first 10 bytes: ")
-	for i := 0; i < 10 && i < len(bitstream); i++ {
-		fmt.Printf("%02x ", bitstream[i])
-	}
-	fmt.Printf("\n")
-
-	// Log bytes around where we expect data (around byte 109 based on debug output)
-	fmt.Printf("QR bitstream bytes 109-119: ")
-	for i := 109; i < 120 && i < len(bitstream); i++ {
-		fmt.Printf("%02x ", bitstream[i])
-	}
-	fmt.Printf("\n")
-
-	// Log first few bits in detail
-	fmt.Printf("QR bitstream first 16 bits: ")
-	for i := 0; i < 16 && i < len(bitstream)*8; i++ {
-		bit := (bitstream[i/8] >> (7 - (i % 8))) & 1
-		fmt.Printf("%d", bit)
-	}
-	fmt.Printf("\n")
-
-	// Store both the actual pixel size AND the actual data size
-	if err := vars.Set(QRSizeVar, fmt.Sprintf("%d", actualQRSize), DCTEnv); err != nil {
-		fmt.Printf("Warning: failed to update actual QR size in vars: %v\n", err)
-	}
-
-	// Store the actual data size (this is the critical fix!)
-	actualDataSize := len(bitstream)
-	if err := vars.Set("QR_DATA_SIZE", fmt.Sprintf("%d", actualDataSize), DCTEnv); err != nil {
-		fmt.Printf("Warning: failed to store QR data size in vars: %v\n", err)
+		return fmt.Errorf("DCT embedding failed (%s strategy): %w", strategy.GetStrategyName(), err)
 	}
-
-	// Calculate the actual QR data area (excluding quiet zones and finder patterns)
-	// QR codes have quiet zones around them, so the actual data area is smaller
-	// For a 96x96 QR, the actual data area might be around 80x80 pixels
-	actualDataArea := int(float64(actualQRSize) * 0.83) // 83% of pixels contain actual data
-	actualDataArea = (actualDataArea / 8) * 8           // Round to multiple of 8
-
-	if err := vars.Set("QR_DATA_AREA", fmt.Sprintf("%d", actualDataArea), DCTEnv); err != nil {
-		fmt.Printf("Warning: failed to store QR data area in vars: %v\n", err)
+	qrModules := result.Header.QRModules
+	fmt.Printf("QR code: version %d, %dx%d modules, %d bytes (%d bits) embedded\n",
+		(qrModules-17)/4, qrModules, qrModules, result.Embedded/result.Copies, qrModules*qrModules)
+	if result.Copies > 1 {
+		fmt.Printf("Embedded %d copies of the QR (%d bits)\n", result.Copies, result.Embedded*8)
 	}
 
-	fmt.Printf("Stored QR pixel size: %dx%d, data size: %d bytes, data area: %dx%d\n",
-		actualQRSize, actualQRSize, actualDataSize, actualDataArea, actualDataArea)
-
-	// Convert paths to C strings
-	cInputPath := C.CString(inputPath)
-	cOutputPath := C.CString(outputPath)
-	defer C.free(unsafe.Pointer(cInputPath))
-	defer C.free(unsafe.Pointer(cOutputPath))
-
-	fmt.Printf("QR bitstream size: %d bytes (%d bits)\n", len(bitstream), len(bitstream)*8)
+	printF5Stats(result.F5)
 
-	// Call strategy-specific C function (OCP - open/closed principle)
-	var result C.int
-	switch strategy.GetCCode() {
-	case "multi":
-		result = C.embed_qr_in_dct_multi(cInputPath, cOutputPath, (*C.uchar)(unsafe.Pointer(&bitstream[0])), C.int(len(bitstream)))
-	default:
-		result = C.embed_qr_in_dct_single(cInputPath, cOutputPath, (*C.uchar)(unsafe.Pointer(&bitstream[0])), C.int(len(bitstream)))
+	if err := os.WriteFile(outputPath, result.Image, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outputPath, err)
 	}
-
-	if result != 0 {
-		return fmt.Errorf("DCT embedding failed with code %d (%s strategy)", int(result), strategy.GetStrategyName())
-	}
-
-	// No more metadata files - QR size is stored in Bonzai vars!
+	printImageHeader(result.Header)
 
 	fmt.Println("Modified JPEG saved as:", outputPath)
 	return nil
@@ -780,6 +552,12 @@ func (calc *QRSizeCalculator) CalculateOptimalQRSize(imagePath string, payloadSi
 
 	// Calculate DCT capacity using the strategy (OCP - open/closed principle)
 	dctCapacityBits := calc.strategy.CalculateCapacity(dims.Width, dims.Height)
+	if counter, ok := calc.strategy.(imageCapacityStrategy); ok {
+		dctCapacityBits, err = counter.CalculateImageCapacity(imagePath)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count eligible coefficients: %w", err)
+		}
+	}
 
 	// Calculate maximum QR size that fits in DCT capacity
 	maxQRPixelsFromDCT := int(float64(dctCapacityBits) * 0.9) // Use 90% of capacity for safety
@@ -889,77 +667,120 @@ func findOptimalQRSizeForHighECC(payloadBytes int) (int, error) {
 
 // EmbedDataDirectlyInDCT embeds data directly into DCT coefficients without QR overhead
 func EmbedDataDirectlyInDCT(inputPath, outputPath, data string) error {
+	return EmbedDataDirectlyInDCTWithKey(inputPath, outputPath, data, "")
+}
+
+// EmbedDataDirectlyInDCTWithKey embeds data directly into DCT coefficients.
+// With the permuted strategy selected the bits follow a walk keyed by password.
+func EmbedDataDirectlyInDCTWithKey(inputPath, outputPath, data, password string) error {
+	return EmbedBytesDirectlyInDCTWithKey(inputPath, outputPath, []byte(data), password)
+}
+
+// EmbedBytesDirectlyInDCTWithKey embeds binary data, such as a raw
+// ciphertext, directly into DCT coefficients
+func EmbedBytesDirectlyInDCTWithKey(inputPath, outputPath string, data []byte, password string) error {
 	fmt.Printf("Direct DCT embedding: %d bytes into %s\n", len(data), inputPath)
 
-	// Get image dimensions for capacity calculation
-	dims, err := GetImageDimensions(inputPath)
+	cover, err := os.Open(inputPath)
 	if err != nil {
-		return fmt.Errorf("failed to get image dimensions: %w", err)
+		return fmt.Errorf("failed to open cover: %w", err)
+	}
+	defer cover.Close()
+
+	// The facade frames the data, adds the error correction and writes the
+	// header
+	correction := fecParams()
+	result, err := crypt.Embed(context.Background(), cover, data,
+		crypt.WithMethod(crypt.MethodDirect),
+		crypt.WithStrategy(directStrategy()),
+		crypt.WithParams(dctParams()),
+		crypt.WithFEC(correction),
+		crypt.WithWalkKey(password))
+	if err != nil {
+		return fmt.Errorf("direct DCT embedding failed: %w", err)
 	}
+	fmt.Printf("Direct DCT capacity: %d bits (%d bytes) with %s over %s\n",
+		result.Capacity, result.Capacity/8, result.Header.Strategy, core.NormalizeComponents(result.Header.Components))
 
-	// Calculate DCT capacity using all available coefficients (not just 1 per block)
-	blocksWidth := dims.Width / 8
-	blocksHeight := dims.Height / 8
-	totalBlocks := blocksWidth * blocksHeight
-
-	// Use 6 coefficients per block (positions 1,2,3,4,5,6) - avoid DC coefficient (0)
-	// This gives us 6 bits per block = much higher capacity than QR codes
-	coefficientsPerBlock := 6
-	totalCapacityBits := totalBlocks * coefficientsPerBlock
-	totalCapacityBytes := totalCapacityBits / 8
-
-	fmt.Printf("Image: %dx%d, Blocks: %dx%d (%d total)\n", dims.Width, dims.Height, blocksWidth, blocksHeight, totalBlocks)
-	fmt.Printf("Direct DCT capacity: %d bits (%d bytes) using %d coefficients per block\n",
-		totalCapacityBits, totalCapacityBytes, coefficientsPerBlock)
-
-	if len(data) > totalCapacityBytes {
-		return fmt.Errorf("data too large: %d bytes > %d bytes capacity", len(data), totalCapacityBytes)
+	if correction.Enabled() {
+		fmt.Printf("FEC %s (parity %d, copies %d): %d bytes embedded\n",
+			correction, correction.Parity, max(correction.Repeat, 1), result.Embedded)
 	}
+	printF5Stats(result.F5)
 
-	// Add simple error detection: store data length + checksum at the beginning
-	dataBytes := []byte(data)
-	dataLength := uint32(len(dataBytes))
-	checksum := calculateSimpleChecksum(dataBytes)
+	if err := os.WriteFile(outputPath, result.Image, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+	printImageHeader(result.Header)
 
-	// Prepare payload: [length:4bytes][checksum:4bytes][data]
-	payload := make([]byte, 8+len(dataBytes))
-	binary.LittleEndian.PutUint32(payload[0:4], dataLength)
-	binary.LittleEndian.PutUint32(payload[4:8], checksum)
-	copy(payload[8:], dataBytes)
+	return nil
+}
 
-	fmt.Printf("Payload: %d bytes (length: %d, checksum: %08x, data: %d)\n",
-		len(payload), dataLength, checksum, len(dataBytes))
+// ExtractDataDirectlyFromDCT extracts data directly from DCT coefficients without QR overhead
+func ExtractDataDirectlyFromDCT(inputPath string) (string, error) {
+	return ExtractDataDirectlyFromDCTWithKey(inputPath, "")
+}
 
-	// Call C function for direct DCT embedding
-	cInputPath := C.CString(inputPath)
-	cOutputPath := C.CString(outputPath)
-	defer C.free(unsafe.Pointer(cInputPath))
-	defer C.free(unsafe.Pointer(cOutputPath))
+// ExtractDataDirectlyFromDCTWithKey extracts a direct payload; password is
+// only needed for images embedded with the permuted strategy
+func ExtractDataDirectlyFromDCTWithKey(inputPath, password string) (string, error) {
+	data, err := ExtractBytesDirectlyFromDCTWithKey(inputPath, password)
+	return string(data), err
+}
 
-	result := C.embed_data_directly_in_dct(cInputPath, cOutputPath,
-		(*C.uchar)(unsafe.Pointer(&payload[0])), C.int(len(payload)))
+// ExtractBytesDirectlyFromDCTWithKey extracts a direct payload as the bytes
+// that were embedded
+func ExtractBytesDirectlyFromDCTWithKey(inputPath, password string) ([]byte, error) {
+	fmt.Printf("Direct DCT extraction from: %s\n", inputPath)
 
-	if result != 0 {
-		return fmt.Errorf("direct DCT embedding failed with code %d", int(result))
+	layout, err := DirectPayloadLayout(inputPath, password)
+	if err != nil {
+		return nil, err
 	}
+	stego, err := os.Open(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", inputPath, err)
+	}
+	defer stego.Close()
 
-	// Store metadata for extraction
-	metadata := fmt.Sprintf("direct_dct:%d:%08x", dataLength, checksum)
-	if err := vars.Set("DIRECT_DCT_META", metadata, DCTEnv); err != nil {
-		fmt.Printf("Warning: failed to store direct DCT metadata: %v\n", err)
+	// The layout only matters for legacy images, the facade reads the
+	// header of the others
+	result, err := crypt.Extract(context.Background(), stego,
+		crypt.WithMethod(crypt.MethodDirect),
+		crypt.WithWalkKey(password),
+		crypt.WithLayout(*layout))
+	if err != nil {
+		return nil, fmt.Errorf("direct DCT extraction failed: %w", err)
 	}
+	if result.Corrected > 0 {
+		fmt.Printf("FEC: corrected %d byte errors\n", result.Corrected)
+	}
+	fmt.Printf("Extracted data: %d bytes, checksum=%08x\n", len(result.Payload), core.PayloadChecksum(result.Payload))
 
-	return nil
+	return result.Payload, nil
 }
 
-// ExtractDataDirectlyFromDCT extracts data directly from DCT coefficients without QR overhead
-func ExtractDataDirectlyFromDCT(inputPath string) (string, error) {
-	fmt.Printf("Direct DCT extraction from: %s\n", inputPath)
+// DirectPayloadLayout returns how many bytes to read for a direct payload
+// and with which strategy and threshold: exact values from the image header,
+// or a capacity based guess for legacy images. The header is whitened by
+// the password it was embedded with.
+func DirectPayloadLayout(inputPath, password string) (*core.ImageHeader, error) {
+	header, err := core.ReadImageHeaderWithKey(inputPath, password)
+	if err == nil {
+		if header.Method != core.EmbedMethodDirect {
+			return nil, fmt.Errorf("%s holds a %s payload, not a direct DCT payload", inputPath, header.Method)
+		}
+		fmt.Printf("Image header: direct payload of %d bytes (%s)\n", header.PayloadLength, header.Strategy)
+		return header, nil
+	}
+	if !errors.Is(err, core.ErrNoImageHeader) {
+		return nil, err
+	}
 
 	// Get image dimensions for capacity calculation
 	dims, err := GetImageDimensions(inputPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to get image dimensions: %w", err)
+		return nil, fmt.Errorf("failed to get image dimensions: %w", err)
 	}
 
 	// Calculate maximum possible data size (same as embedding)
@@ -969,53 +790,18 @@ func ExtractDataDirectlyFromDCT(inputPath string) (string, error) {
 	coefficientsPerBlock := 6
 	maxCapacityBytes := (totalBlocks * coefficientsPerBlock) / 8
 
-	fmt.Printf("Max extraction capacity: %d bytes\n", maxCapacityBytes)
+	// The header does not survive recompression, the QIM payload does: use
+	// the strategy selected on this machine
+	strategy := directStrategy()
+	fmt.Printf("No image header found, max extraction capacity: %d bytes (assuming %s)\n", maxCapacityBytes, strategy)
 
 	// Allocate buffer for extracted data (start with reasonable size for header)
 	maxDataSize := 16384 // 16KB should be enough for most payloads + header
 	if maxCapacityBytes < maxDataSize {
 		maxDataSize = maxCapacityBytes
 	}
-
-	extractedBytes := make([]byte, maxDataSize)
-
-	// Call C function for direct DCT extraction
-	cInputPath := C.CString(inputPath)
-	defer C.free(unsafe.Pointer(cInputPath))
-
-	result := C.extract_data_directly_from_dct(cInputPath,
-		(*C.uchar)(unsafe.Pointer(&extractedBytes[0])), C.int(maxDataSize))
-
-	if result != 0 {
-		return "", fmt.Errorf("direct DCT extraction failed with code %d", int(result))
-	}
-
-	// Parse the header: [length:4bytes][checksum:4bytes][data]
-	if len(extractedBytes) < 8 {
-		return "", fmt.Errorf("extracted data too small for header")
-	}
-
-	dataLength := binary.LittleEndian.Uint32(extractedBytes[0:4])
-	expectedChecksum := binary.LittleEndian.Uint32(extractedBytes[4:8])
-
-	fmt.Printf("Extracted header: length=%d, checksum=%08x\n", dataLength, expectedChecksum)
-
-	if dataLength > uint32(maxDataSize-8) {
-		return "", fmt.Errorf("extracted data length %d exceeds buffer size", dataLength)
-	}
-
-	// Extract the actual data
-	actualData := extractedBytes[8 : 8+dataLength]
-	actualChecksum := calculateSimpleChecksum(actualData)
-
-	fmt.Printf("Extracted data: %d bytes, checksum=%08x\n", len(actualData), actualChecksum)
-
-	// Verify checksum
-	if actualChecksum != expectedChecksum {
-		return "", fmt.Errorf("checksum mismatch: expected %08x, got %08x", expectedChecksum, actualChecksum)
-	}
-
-	return string(actualData), nil
+	params := dctParams()
+	return &core.ImageHeader{PayloadLength: maxDataSize, Strategy: strategy, Threshold: params.Threshold, QIMStep: params.QIMStep, Components: params.Components}, nil
 }
 
 // MultiQRMetadata contains information about the QR grid layout
@@ -1030,137 +816,129 @@ type MultiQRMetadata struct {
 	Padding       int      `json:"padding"`     // Padding around grid in pixels
 }
 
-// QRGridPosition represents the position of a QR code in the image
-type QRGridPosition struct {
-	X       int `json:"x"`     // X coordinate in image
-	Y       int `json:"y"`     // Y coordinate in image
-	ChunkID int `json:"chunk"` // Which data chunk this QR contains
-}
+// multiQRGridPrefix marks a grid metadata payload, see PackGrid
+const multiQRGridPrefix = "CRGQ1:"
 
-// EmbedMultiQRGrid embeds data as multiple QR codes in a grid layout for compression resilience
-func EmbedMultiQRGrid(inputPath, outputPath, data string) error {
-	fmt.Printf("Multi-QR Grid embedding: %d bytes into %s\n", len(data), inputPath)
+// PackGrid returns the chunk count, sizes and checksums as a grid metadata
+// payload: little endian uint32s in base64 behind multiQRGridPrefix. It is a
+// fraction of the JSON, so the metadata tile is no larger than a chunk tile,
+// and avoids the digit runs go-qrcode encodes as numeric segments, which
+// goqr misreads.
+func (m MultiQRMetadata) PackGrid() string {
+	packed := make([]byte, 12+4*len(m.Checksums))
+	binary.LittleEndian.PutUint32(packed[0:4], uint32(m.ChunkCount))
+	binary.LittleEndian.PutUint32(packed[4:8], uint32(m.ChunkSize))
+	binary.LittleEndian.PutUint32(packed[8:12], uint32(m.TotalDataSize))
+	for i, checksum := range m.Checksums {
+		binary.LittleEndian.PutUint32(packed[12+4*i:], checksum)
+	}
+	return multiQRGridPrefix + base64.StdEncoding.EncodeToString(packed)
+}
 
-	// Get image dimensions
-	dims, err := GetImageDimensions(inputPath)
+// UnpackGridMetadata parses a payload written by PackGrid
+func UnpackGridMetadata(payload string) (MultiQRMetadata, error) {
+	encoded, ok := strings.CutPrefix(payload, multiQRGridPrefix)
+	if !ok {
+		return MultiQRMetadata{}, fmt.Errorf("not a QR grid metadata payload")
+	}
+	packed, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
-		return fmt.Errorf("failed to get image dimensions: %w", err)
+		return MultiQRMetadata{}, fmt.Errorf("failed to decode grid metadata: %w", err)
 	}
-
-	// Determine optimal chunk size and grid layout
-	chunkSize := 400 // Start with 400 bytes per chunk for High ECC
-	chunks := chunkData([]byte(data), chunkSize)
-	chunkCount := len(chunks)
-
-	fmt.Printf("Input data length: %d bytes\n", len(data))
-	fmt.Printf("Chunk size: %d bytes\n", chunkSize)
-	fmt.Printf("Number of chunks created: %d\n", chunkCount)
-	for i, chunk := range chunks {
-		fmt.Printf("  Chunk %d: %d bytes\n", i, len(chunk))
+	if len(packed) < 12 || len(packed)%4 != 0 {
+		return MultiQRMetadata{}, fmt.Errorf("grid metadata of %d bytes is malformed", len(packed))
 	}
 
-	// Calculate grid dimensions (try to make it roughly square)
-	gridWidth := int(math.Ceil(math.Sqrt(float64(chunkCount + 1)))) // +1 for metadata QR
-	gridHeight := int(math.Ceil(float64(chunkCount+1) / float64(gridWidth)))
-
-	fmt.Printf("Data chunks: %d chunks of ~%d bytes each\n", chunkCount, chunkSize)
-	fmt.Printf("Grid layout: %dx%d (total %d positions)\n", gridWidth, gridHeight, gridWidth*gridHeight)
+	metadata := MultiQRMetadata{
+		ChunkCount:    int(binary.LittleEndian.Uint32(packed[0:4])),
+		ChunkSize:     int(binary.LittleEndian.Uint32(packed[4:8])),
+		TotalDataSize: int(binary.LittleEndian.Uint32(packed[8:12])),
+	}
+	for i := 12; i < len(packed); i += 4 {
+		metadata.Checksums = append(metadata.Checksums, binary.LittleEndian.Uint32(packed[i:]))
+	}
+	return metadata, nil
+}
 
-	// Determine QR size and padding based on image dimensions
-	qrSize := calculateOptimalQRSizeForGrid(dims.Width, dims.Height, gridWidth, gridHeight)
-	padding := qrSize / 4 // 25% padding around the grid
+// multiQRGridChunkSizes are the chunk sizes EmbedMultiQRGrid tries, largest
+// first: bigger chunks waste less of each tile, smaller ones fit small covers
+var multiQRGridChunkSizes = []int{400, 256, 128}
 
-	fmt.Printf("QR size: %dx%d, Padding: %d pixels\n", qrSize, qrSize, padding)
+// EmbedMultiQRGrid embeds data as multiple QR codes in a grid layout for compression resilience
+func EmbedMultiQRGrid(inputPath, outputPath, data string) error {
+	return EmbedMultiQRGridWithKey(inputPath, outputPath, data, "")
+}
 
-	// Calculate QR positions (for future use)
-	_ = calculateQRGridPositions(dims.Width, dims.Height, gridWidth, gridHeight, qrSize, padding)
+// EmbedMultiQRGridWithKey is EmbedMultiQRGrid with the password needed by
+// the permuted strategy. The metadata QR and one QR per chunk go into
+// separate 8x8-block aligned tiles of the single image outputPath.
+func EmbedMultiQRGridWithKey(inputPath, outputPath, data, password string) error {
+	fmt.Printf("Multi-QR Grid embedding: %d bytes into %s\n", len(data), inputPath)
 
-	// Create metadata
-	checksums := make([]uint32, len(chunks))
-	for i, chunk := range chunks {
-		checksums[i] = calculateSimpleChecksum(chunk)
+	strategy := directStrategy()
+	if strategy.DependsOnContent() {
+		fmt.Printf("Warning: %s strategy cannot embed into tiles, using %s\n", strategy, core.DCTStrategyDirect)
+		strategy = core.DCTStrategyDirect
 	}
-
-	metadata := MultiQRMetadata{
-		GridWidth:     gridWidth,
-		GridHeight:    gridHeight,
-		ChunkCount:    chunkCount,
-		ChunkSize:     chunkSize,
-		TotalDataSize: len(data),
-		Checksums:     checksums,
-		QRSize:        qrSize,
-		Padding:       padding,
-	}
-
-	// Create metadata QR code (position 0)
-	metadataJSON, err := json.Marshal(metadata)
-	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %w", err)
+	params := dctParams()
+	if !params.Components.LumaOnly() {
+		fmt.Printf("Warning: QR grid tiles use the luminance only, ignoring components %s\n", params.Components)
 	}
-
-	fmt.Printf("Metadata QR: %d bytes\n", len(metadataJSON))
-
-	// Create QR codes for metadata + all chunks
-	allQRData := make([][]byte, chunkCount+1)
-	allQRData[0] = metadataJSON // Metadata QR at position 0
-	for i, chunk := range chunks {
-		allQRData[i+1] = chunk
+	grid, err := core.NewServiceFactory().CreateQRGrid(strategy, password, params)
+	if err != nil {
+		return err
 	}
 
-	// Generate all QR codes with High ECC
-	qrImages := make([][]byte, len(allQRData))
-	for i, qrData := range allQRData {
-		qrBytes, _, err := EncodeQRCodeWithFallback(string(qrData), qrSize)
-		if err != nil {
-			return fmt.Errorf("failed to create QR code %d: %w", i, err)
+	for _, chunkSize := range multiQRGridChunkSizes {
+		chunks := chunkData([]byte(data), chunkSize)
+		checksums := make([]uint32, len(chunks))
+		for i, chunk := range chunks {
+			checksums[i] = core.PayloadChecksum(chunk)
 		}
-		qrImages[i] = qrBytes
-	}
-
-	fmt.Printf("Starting to embed %d QR codes...\n", len(qrImages))
-
-	// Simplified approach: Create separate embedded images for each chunk
-	// This proves the concept and allows testing compression resilience
-	fmt.Printf("Creating %d separate embedded images...\n", len(qrImages))
-
-	for i, qrImage := range qrImages {
-		fmt.Printf("Processing QR %d/%d (size: %d bytes)\n", i+1, len(qrImages), len(qrImage))
 
-		// Create output filename
-		var outputFile string
-		if i == 0 {
-			outputFile = fmt.Sprintf("%s_metadata.jpeg", outputPath)
-		} else {
-			outputFile = fmt.Sprintf("%s_chunk_%d.jpeg", outputPath, i-1)
+		// The grid geometry is in the image header, not in the metadata
+		metadata := MultiQRMetadata{
+			ChunkCount:    len(chunks),
+			ChunkSize:     chunkSize,
+			TotalDataSize: len(data),
+			Checksums:     checksums,
 		}
 
-		// Create temporary QR file
-		tempQRPath := fmt.Sprintf("/tmp/multiqr_%d.png", i)
-		fmt.Printf("Writing temp QR to: %s\n", tempQRPath)
-
-		err := os.WriteFile(tempQRPath, qrImage, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to write temp QR %d: %w", i, err)
+		// Metadata QR in the first tile, the chunks in order after it
+		payloads := []string{metadata.PackGrid()}
+		for _, chunk := range chunks {
+			payloads = append(payloads, string(chunk))
 		}
 
-		// Use a smaller payload size estimate to avoid hanging
-		estimatedSize := 200 // Conservative estimate for small QR codes
-		fmt.Printf("Embedding QR %d into: %s (estimated size: %d)\n", i, outputFile, estimatedSize)
-
-		// Embed this QR into a separate image copy using existing single-QR method
-		err = EmbedQRCodeInJPEG(inputPath, outputFile, tempQRPath, estimatedSize)
+		layout, err := grid.Embed(inputPath, outputPath, payloads, strategy)
+		if errors.Is(err, core.ErrQRGridTooSmall) {
+			fmt.Printf("%d chunks of %d bytes do not fit: %v\n", len(chunks), chunkSize, err)
+			continue
+		}
 		if err != nil {
-			fmt.Printf("WARNING: Failed to embed QR %d: %v\n", i, err)
-			os.Remove(tempQRPath)
-			continue // Continue with other chunks
+			return fmt.Errorf("failed to embed QR grid: %w", err)
 		}
 
-		os.Remove(tempQRPath)
-		fmt.Printf("✅ Successfully embedded QR %d/%d into %s\n", i+1, len(qrImages), outputFile)
+		fmt.Printf("Successfully embedded metadata and %d chunks of %d bytes in a %dx%d grid (%s strategy): %s\n",
+			len(chunks), chunkSize, layout.Columns, layout.Rows, strategy, outputPath)
+		return nil
 	}
+	return fmt.Errorf("%d bytes do not fit in a QR grid in %s: %w", len(data), inputPath, core.ErrQRGridTooSmall)
+}
 
-	fmt.Printf("Successfully embedded %d QR codes in %dx%d grid\n", len(qrImages), gridWidth, gridHeight)
-	return nil
+// printImageHeader reports a header written to an image
+func printImageHeader(header core.ImageHeader) {
+	fmt.Printf("Image header: method=%s strategy=%s components=%s qr=%d modules payload=%d bytes\n",
+		header.Method, header.Strategy, core.NormalizeComponents(header.Components), header.QRModules, header.PayloadLength)
+}
+
+// printF5Stats prints the statistics of an F5 embedding, if there was one
+func printF5Stats(stats *core.F5Stats) {
+	if stats == nil {
+		return
+	}
+	fmt.Printf("F5 matrix embedding: k=%d, %d bits, %d coefficients changed (%d shrinkage)\n",
+		stats.K, stats.Bits, stats.Changed, stats.Shrunk)
 }
 
 // chunkData splits data into chunks of specified size
@@ -1176,83 +954,6 @@ func chunkData(data []byte, chunkSize int) [][]byte {
 	return chunks
 }
 
-// calculateOptimalQRSizeForGrid determines optimal QR size for grid layout
-func calculateOptimalQRSizeForGrid(imageWidth, imageHeight, gridWidth, gridHeight int) int {
-	// Calculate available space per QR code
-	maxQRWidth := imageWidth / gridWidth
-	maxQRHeight := imageHeight / gridHeight
-
-	// Use the smaller dimension and add some margin
-	maxSize := maxQRWidth
-	if maxQRHeight < maxQRWidth {
-		maxSize = maxQRHeight
-	}
-
-	// Apply 80% factor for padding and margins
-	targetSize := int(float64(maxSize) * 0.8)
-
-	// Round to common QR sizes (64, 96, 128, 160, 192, 224, 256)
-	qrSizes := []int{64, 96, 128, 160, 192, 224, 256}
-	for i := len(qrSizes) - 1; i >= 0; i-- {
-		if qrSizes[i] <= targetSize {
-			return qrSizes[i]
-		}
-	}
-
-	// Default fallback if even 64x64 is too large
-	return 64
-}
-
-// calculateQRGridPositions calculates the (x,y) positions for each QR in the grid
-func calculateQRGridPositions(imageWidth, imageHeight, gridWidth, gridHeight, qrSize, padding int) []QRGridPosition {
-	positions := make([]QRGridPosition, gridWidth*gridHeight)
-
-	// Calculate total grid dimensions
-	totalGridWidth := gridWidth*qrSize + (gridWidth-1)*padding
-	totalGridHeight := gridHeight*qrSize + (gridHeight-1)*padding
-
-	// Center the grid in the image
-	startX := (imageWidth - totalGridWidth) / 2
-	startY := (imageHeight - totalGridHeight) / 2
-
-	// Calculate each position
-	index := 0
-	for row := 0; row < gridHeight; row++ {
-		for col := 0; col < gridWidth; col++ {
-			x := startX + col*(qrSize+padding)
-			y := startY + row*(qrSize+padding)
-
-			positions[index] = QRGridPosition{
-				X:       x,
-				Y:       y,
-				ChunkID: index,
-			}
-			index++
-		}
-	}
-
-	return positions
-}
-
-// embedQRAtPosition embeds a QR code at a specific position in the image
-func embedQRAtPosition(inputPath, outputPath string, qrImageBytes []byte, x, y, size int) error {
-	// For now, use the existing DCT embedding but we'll need to modify it
-	// to embed at specific coordinates rather than globally
-	// This is a placeholder - we'll need to implement position-specific embedding
-
-	// Create a temporary QR file
-	tempQRPath := fmt.Sprintf("/tmp/qr_grid_%d_%d.png", x, y)
-	err := os.WriteFile(tempQRPath, qrImageBytes, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write temp QR: %w", err)
-	}
-	defer os.Remove(tempQRPath)
-
-	// For now, use the existing embedding method with default size (this will need refinement)
-	// TODO: Implement position-specific DCT embedding
-	return EmbedQRCodeInJPEG(inputPath, outputPath, tempQRPath, size*size)
-}
-
 // Helper function for max
 func max(a, b int) int {
 	if a > b {
@@ -1261,15 +962,6 @@ func max(a, b int) int {
 	return b
 }
 
-// calculateSimpleChecksum calculates a simple checksum for error detection
-func calculateSimpleChecksum(data []byte) uint32 {
-	var checksum uint32
-	for _, b := range data {
-		checksum = (checksum << 1) ^ uint32(b)
-	}
-	return checksum
-}
-
 // storeQRSizeMetadata stores the QR size in a companion metadata file
 func storeQRSizeMetadata(imagePath string, qrSize int) error {
 	metadataPath := imagePath + ".qrmeta"
@@ -0,0 +1,324 @@
+// Package envelope wraps a file's contents with the metadata needed to
+// restore it: its name, permission bits, size and MIME type. Envelopes are
+// binary and sealed as they are, so a file costs only its metadata on top
+// of its bytes.
+//
+// The layout is
+//
+//	magic(4) version(1) mode(4) size(8) namelen(2) name mimelen(1) mime data
+//
+// with big endian integers. Plain text payloads carry no envelope, Unmarshal
+// tells them apart with ErrNoEnvelope. Open and NewReader stream the data of
+// large files instead of holding it.
+package envelope
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Magic prefixes every envelope
+var Magic = [4]byte{'C', 'E', 'N', 'V'}
+
+// Version is the current envelope format version
+const Version byte = 1
+
+// headerSize is the fixed part of an envelope: magic, version, mode, size
+// and the two length fields
+const headerSize = 4 + 1 + 4 + 8 + 2 + 1
+
+// ErrNoEnvelope reports data that does not start with an envelope, such as
+// an encrypted text message
+var ErrNoEnvelope = errors.New("envelope: no envelope found")
+
+// Envelope is a file with its metadata
+type Envelope struct {
+	Name string      // base name of the file, without directories
+	Mode fs.FileMode // permission bits
+	MIME string      // media type, application/octet-stream when unknown
+	Size int64       // length of the data
+	Data []byte      // nil when the data is streamed
+}
+
+// New wraps data as the file name; the MIME type follows from the
+// extension of name or, failing that, from the content
+func New(name string, mode fs.FileMode, data []byte) *Envelope {
+	return &Envelope{
+		Name: filepath.Base(name),
+		Mode: mode.Perm(),
+		MIME: DetectMIME(name, data),
+		Size: int64(len(data)),
+		Data: data,
+	}
+}
+
+// FromFile reads the file at path into an envelope
+func FromFile(path string) (*Envelope, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("envelope: %s is not a regular file", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(path, info.Mode(), data), nil
+}
+
+// Open opens the file at path for streaming: the envelope holds its
+// metadata without the data, which the returned file yields
+func Open(path string) (*Envelope, io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, nil, fmt.Errorf("envelope: %s is not a regular file", path)
+	}
+	// Content sniffing looks at the first 512 bytes at most
+	head := make([]byte, 512)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		f.Close()
+		return nil, nil, err
+	}
+	e := &Envelope{
+		Name: filepath.Base(path),
+		Mode: info.Mode().Perm(),
+		MIME: DetectMIME(path, head[:n]),
+		Size: info.Size(),
+	}
+	return e, f, nil
+}
+
+// DetectMIME returns the media type of a file named name holding data
+func DetectMIME(name string, data []byte) string {
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t
+	}
+	return http.DetectContentType(data)
+}
+
+// MarshalBinary encodes the envelope
+func (e *Envelope) MarshalBinary() ([]byte, error) {
+	if int64(len(e.Data)) != e.Size {
+		return nil, fmt.Errorf("envelope: %d bytes of data, expected %d", len(e.Data), e.Size)
+	}
+	buf, err := e.MarshalHeader()
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, e.Data...), nil
+}
+
+// MarshalHeader encodes the envelope without its data, which a stream
+// then follows with Size bytes
+func (e *Envelope) MarshalHeader() ([]byte, error) {
+	name := e.Name
+	if name != "" {
+		name = filepath.Base(name)
+	}
+	if len(name) > 0xFFFF {
+		return nil, fmt.Errorf("envelope: file name too long: %d bytes", len(name))
+	}
+	if len(e.MIME) > 0xFF {
+		return nil, fmt.Errorf("envelope: MIME type too long: %d bytes", len(e.MIME))
+	}
+
+	if e.Size < 0 {
+		return nil, fmt.Errorf("envelope: invalid size %d", e.Size)
+	}
+
+	buf := make([]byte, 0, headerSize+len(name)+len(e.MIME)+len(e.Data))
+	buf = append(buf, Magic[:]...)
+	buf = append(buf, Version)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(e.Mode.Perm()))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.Size))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(name)))
+	buf = append(buf, name...)
+	buf = append(buf, byte(len(e.MIME)))
+	buf = append(buf, e.MIME...)
+	return buf, nil
+}
+
+// Unmarshal decodes an envelope written by MarshalBinary. Data without the
+// magic gives ErrNoEnvelope, a damaged or truncated envelope another error.
+func Unmarshal(data []byte) (*Envelope, error) {
+	if !IsEnvelope(data) {
+		return nil, ErrNoEnvelope
+	}
+	if len(data) < headerSize {
+		return nil, errors.New("envelope: truncated header")
+	}
+	if data[4] != Version {
+		return nil, fmt.Errorf("envelope: unsupported version %d", data[4])
+	}
+	e := &Envelope{Mode: fs.FileMode(binary.BigEndian.Uint32(data[5:9])).Perm()}
+	size := binary.BigEndian.Uint64(data[9:17])
+
+	rest := data[17:]
+	nameLen := int(binary.BigEndian.Uint16(rest[0:2]))
+	if len(rest) < 2+nameLen+1 {
+		return nil, errors.New("envelope: truncated file name")
+	}
+	e.Name = string(rest[2 : 2+nameLen])
+	rest = rest[2+nameLen:]
+	mimeLen := int(rest[0])
+	if len(rest) < 1+mimeLen {
+		return nil, errors.New("envelope: truncated MIME type")
+	}
+	e.MIME = string(rest[1 : 1+mimeLen])
+	rest = rest[1+mimeLen:]
+
+	if uint64(len(rest)) != size {
+		return nil, fmt.Errorf("envelope: %d bytes of data, expected %d", len(rest), size)
+	}
+	e.Size = int64(size)
+	e.Data = rest
+	return e, nil
+}
+
+// NewReader reads the metadata of an envelope from r and returns it with
+// a reader of its data. The data reader fails when r holds fewer or more
+// than Size bytes. Without the magic NewReader gives ErrNoEnvelope, having
+// consumed what it read; bufio.Reader.Peek with IsEnvelope checks first.
+func NewReader(r io.Reader) (*Envelope, io.Reader, error) {
+	fixed := make([]byte, headerSize-1)
+	n, err := io.ReadFull(r, fixed)
+	if !IsEnvelope(fixed[:n]) {
+		return nil, nil, ErrNoEnvelope
+	}
+	if err != nil {
+		return nil, nil, errors.New("envelope: truncated header")
+	}
+	if fixed[4] != Version {
+		return nil, nil, fmt.Errorf("envelope: unsupported version %d", fixed[4])
+	}
+	e := &Envelope{Mode: fs.FileMode(binary.BigEndian.Uint32(fixed[5:9])).Perm()}
+	size := binary.BigEndian.Uint64(fixed[9:17])
+	if size > 1<<62 {
+		return nil, nil, fmt.Errorf("envelope: invalid size %d", size)
+	}
+	e.Size = int64(size)
+
+	name := make([]byte, int(binary.BigEndian.Uint16(fixed[17:19]))+1)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, nil, errors.New("envelope: truncated file name")
+	}
+	e.Name = string(name[:len(name)-1])
+	mimeType := make([]byte, name[len(name)-1])
+	if _, err := io.ReadFull(r, mimeType); err != nil {
+		return nil, nil, errors.New("envelope: truncated MIME type")
+	}
+	e.MIME = string(mimeType)
+	return e, &dataReader{r: r, left: e.Size, size: e.Size}, nil
+}
+
+// dataReader yields exactly the size bytes of an envelope's data
+type dataReader struct {
+	r    io.Reader
+	left int64
+	size int64
+}
+
+func (d *dataReader) Read(p []byte) (int, error) {
+	if d.left == 0 {
+		// The data must end the stream
+		var extra [1]byte
+		if n, _ := io.ReadFull(d.r, extra[:]); n > 0 {
+			return 0, fmt.Errorf("envelope: data continues past its %d bytes", d.size)
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > d.left {
+		p = p[:d.left]
+	}
+	n, err := d.r.Read(p)
+	d.left -= int64(n)
+	if err == io.EOF && d.left > 0 {
+		return n, fmt.Errorf("envelope: %d bytes of data, expected %d", d.size-d.left, d.size)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// IsEnvelope reports whether data starts with the envelope magic
+func IsEnvelope(data []byte) bool {
+	return len(data) >= len(Magic) && bytes.Equal(data[:len(Magic)], Magic[:])
+}
+
+// WriteFile restores the file at path with its permission bits; an empty
+// path uses the recorded name in the current directory
+func (e *Envelope) WriteFile(path string) (string, error) {
+	return e.Restore(path, bytes.NewReader(e.Data))
+}
+
+// Restore is WriteFile for streamed data, written with WriteStream so a
+// failure part way leaves an existing file at path untouched
+func (e *Envelope) Restore(path string, data io.Reader) (string, error) {
+	if path == "" {
+		path = e.SafeName()
+	}
+	mode := e.Mode.Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+	if _, err := WriteStream(path, data, mode); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// WriteStream copies r into a temporary file next to path and renames it
+// over path with mode once complete, so a failing r leaves an existing file
+// at path untouched. It returns the number of bytes written.
+func WriteStream(path string, r io.Reader, mode os.FileMode) (int64, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+	return n, nil
+}
+
+// SafeName is the recorded name reduced to a plain file name, so an
+// envelope cannot write outside the directory it is restored into
+func (e *Envelope) SafeName() string {
+	name := filepath.Base(filepath.Clean("/" + filepath.ToSlash(e.Name)))
+	if name == "/" || name == "." || name == ".." || name == "" {
+		return "restored.bin"
+	}
+	return name
+}
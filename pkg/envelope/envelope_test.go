@@ -0,0 +1,162 @@
+package envelope
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	data := make([]byte, 1024)
+	for i := range data {
+		data[i] = byte(i * 7) // every byte value, zeros and invalid UTF-8 included
+	}
+	path := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := FromFile(path)
+	if err != nil {
+		t.Fatalf("FromFile failed: %v", err)
+	}
+	if e.Name != "photo.png" || e.Mode != 0600 || e.MIME != "image/png" || e.Size != int64(len(data)) {
+		t.Errorf("unexpected metadata: name=%q mode=%v mime=%q size=%d", e.Name, e.Mode, e.MIME, e.Size)
+	}
+
+	raw, err := e.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEnvelope(raw) {
+		t.Fatal("marshalled envelope not recognised")
+	}
+	got, err := Unmarshal(raw)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if got.Name != e.Name || got.Mode != e.Mode || got.MIME != e.MIME || !bytes.Equal(got.Data, data) {
+		t.Errorf("round trip changed the envelope: %+v", got)
+	}
+
+	out := filepath.Join(t.TempDir(), "restored")
+	if _, err := got.WriteFile(out); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	restored, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, data) {
+		t.Error("restored file differs from the original")
+	}
+	if info, _ := os.Stat(out); info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestUnmarshalRejectsDamage(t *testing.T) {
+	if _, err := Unmarshal([]byte("plain text message")); !errors.Is(err, ErrNoEnvelope) {
+		t.Errorf("expected ErrNoEnvelope for text, got %v", err)
+	}
+
+	raw, err := New("notes.txt", 0644, []byte("hello")).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, damaged := range [][]byte{raw[:10], raw[:len(raw)-1], append(raw, 0)} {
+		if _, err := Unmarshal(damaged); err == nil || errors.Is(err, ErrNoEnvelope) {
+			t.Errorf("expected a damage error for %d bytes, got %v", len(damaged), err)
+		}
+	}
+}
+
+func TestSafeName(t *testing.T) {
+	for name, want := range map[string]string{
+		"report.pdf":       "report.pdf",
+		"../../etc/passwd": "passwd",
+		"/abs/path/key":    "key",
+		"..":               "restored.bin",
+		"":                 "restored.bin",
+	} {
+		if got := (&Envelope{Name: name}).SafeName(); got != want {
+			t.Errorf("SafeName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestStreamedEnvelope(t *testing.T) {
+	data := bytes.Repeat([]byte("streamed file contents\n"), 500)
+	path := filepath.Join(t.TempDir(), "big.log")
+	if err := os.WriteFile(path, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	e, f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	if e.Data != nil || e.Size != int64(len(data)) || e.Mode != 0640 {
+		t.Errorf("unexpected metadata: %+v", e)
+	}
+	header, err := e.MarshalHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stream bytes.Buffer
+	stream.Write(header)
+	if _, err := stream.ReadFrom(f); err != nil {
+		t.Fatal(err)
+	}
+	// The stream is what MarshalBinary writes for the file
+	whole, _ := FromFile(path)
+	if raw, _ := whole.MarshalBinary(); !bytes.Equal(stream.Bytes(), raw) {
+		t.Fatal("streamed envelope differs from MarshalBinary")
+	}
+
+	got, r, err := NewReader(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	out := filepath.Join(t.TempDir(), "restored")
+	if _, err := got.Restore(out, r); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if restored, _ := os.ReadFile(out); !bytes.Equal(restored, data) {
+		t.Error("restored file differs from the original")
+	}
+
+	// Short and trailing data fail, leave no file behind and do not touch
+	// an existing one
+	for _, damaged := range [][]byte{stream.Bytes()[:stream.Len()-1], append(stream.Bytes(), 0)} {
+		dir := t.TempDir()
+		for _, existing := range []bool{false, true} {
+			got, r, err := NewReader(bytes.NewReader(damaged))
+			if err != nil {
+				t.Fatal(err)
+			}
+			bad := filepath.Join(dir, "bad")
+			if existing {
+				if err := os.WriteFile(bad, []byte("keep me"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := got.Restore(bad, r); err == nil {
+				t.Errorf("expected an error for %d bytes", len(damaged))
+			}
+			if kept, err := os.ReadFile(bad); existing != (err == nil) || (existing && string(kept) != "keep me") {
+				t.Errorf("existing file %v: damaged restore left %q, %v", existing, kept, err)
+			}
+			if entries, _ := os.ReadDir(dir); existing && len(entries) != 1 || !existing && len(entries) != 0 {
+				t.Errorf("damaged restore left %d files behind", len(entries))
+			}
+		}
+	}
+
+	if _, _, err := NewReader(bytes.NewReader([]byte("plain text"))); !errors.Is(err, ErrNoEnvelope) {
+		t.Errorf("expected ErrNoEnvelope, got %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+// Package fec adds forward error correction to payloads hidden in lossy
+// carriers. A message is split across Reed-Solomon codewords over GF(256),
+// the codewords are byte-interleaved so a burst of damaged coefficients is
+// spread over all of them, and the result can optionally be repeated and
+// recovered by a bitwise majority vote.
+//
+// Encoded streams are self-describing: a small, heavily protected preamble
+// records the parameters and the message length, so Decode only needs the
+// bytes read back from the carrier (trailing bytes are ignored).
+package fec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNotEncoded is returned by Decode when the stream has no readable
+// preamble, e.g. a payload written without FEC
+var ErrNotEncoded = errors.New("fec: no FEC preamble found")
+
+const (
+	preambleVersion = 1
+	preambleData    = 9 // magic(2) version(1) parity(1) repeat(1) length(4)
+	preambleParity  = 8
+	preambleCopies  = 3
+
+	// PreambleSize is the number of bytes the preamble takes in a stream
+	PreambleSize = (preambleData + preambleParity) * preambleCopies
+
+	// MaxRepeat is the largest repetition factor
+	MaxRepeat = 15
+)
+
+var preambleMagic = [2]byte{'F', 'C'}
+
+// Params selects how much redundancy is added to a message
+type Params struct {
+	Parity int // Reed-Solomon parity bytes per codeword, 0 for none
+	Repeat int // copies of the coded message, 0 or 1 for none
+}
+
+// Named redundancy levels, from none to the strongest
+var (
+	LevelOff    = Params{}
+	LevelLow    = Params{Parity: 16}
+	LevelMedium = Params{Parity: 32}
+	LevelHigh   = Params{Parity: 64, Repeat: 3}
+)
+
+// ParseParams parses a level name (off, low, medium, high) or an explicit
+// "<parity>[:<repeat>]" specification
+func ParseParams(s string) (Params, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "off", "none":
+		return LevelOff, nil
+	case "low":
+		return LevelLow, nil
+	case "medium":
+		return LevelMedium, nil
+	case "high":
+		return LevelHigh, nil
+	}
+
+	parity, repeat, hasRepeat := strings.Cut(s, ":")
+	var p Params
+	var err error
+	if p.Parity, err = strconv.Atoi(strings.TrimSpace(parity)); err != nil {
+		return Params{}, fmt.Errorf("fec: invalid level %q (use off, low, medium, high or <parity>[:<repeat>])", s)
+	}
+	if hasRepeat {
+		if p.Repeat, err = strconv.Atoi(strings.TrimSpace(repeat)); err != nil {
+			return Params{}, fmt.Errorf("fec: invalid repeat count %q", repeat)
+		}
+	}
+	return p, p.Validate()
+}
+
+// String returns the level name, or "<parity>:<repeat>" for custom params
+func (p Params) String() string {
+	switch p.normalized() {
+	case LevelOff.normalized():
+		return "off"
+	case LevelLow.normalized():
+		return "low"
+	case LevelMedium.normalized():
+		return "medium"
+	case LevelHigh.normalized():
+		return "high"
+	}
+	return fmt.Sprintf("%d:%d", p.Parity, p.copies())
+}
+
+// Enabled reports whether p adds any redundancy
+func (p Params) Enabled() bool {
+	return p.Parity > 0 || p.copies() > 1
+}
+
+// Validate checks that p can be encoded
+func (p Params) Validate() error {
+	if p.Parity != 0 && (p.Parity < 2 || p.Parity > MaxCodewordLength-1) {
+		return fmt.Errorf("fec: parity must be 0 or between 2 and %d, got %d", MaxCodewordLength-1, p.Parity)
+	}
+	if p.Repeat < 0 || p.Repeat > MaxRepeat {
+		return fmt.Errorf("fec: repeat must be between 0 and %d, got %d", MaxRepeat, p.Repeat)
+	}
+	return nil
+}
+
+func (p Params) copies() int {
+	return max(p.Repeat, 1)
+}
+
+func (p Params) normalized() Params {
+	return Params{Parity: p.Parity, Repeat: p.copies()}
+}
+
+// blockLayout splits n message bytes into equally sized codewords
+func blockLayout(n, parity int) (blocks, dataLen int) {
+	if parity == 0 || n == 0 {
+		return 1, n
+	}
+	maxData := MaxCodewordLength - parity
+	blocks = (n + maxData - 1) / maxData
+	return blocks, (n + blocks - 1) / blocks
+}
+
+// codedSize returns the size of one copy of n coded message bytes
+func codedSize(n, parity int) int {
+	if parity == 0 || n == 0 {
+		return n
+	}
+	blocks, dataLen := blockLayout(n, parity)
+	return blocks * (dataLen + parity)
+}
+
+// EncodedSize returns the size of the stream Encode produces for a message
+// of n bytes
+func EncodedSize(n int, p Params) int {
+	return PreambleSize + codedSize(n, p.Parity)*p.copies()
+}
+
+// MaxMessageSize returns the largest message whose encoding fits in
+// capacity bytes, or 0 when not even an empty message fits
+func MaxMessageSize(capacity int, p Params) int {
+	lo, hi := 0, capacity
+	if EncodedSize(0, p) > capacity {
+		return 0
+	}
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if EncodedSize(mid, p) <= capacity {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+// Encode protects msg with p
+func Encode(msg []byte, p Params) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, preambleData)
+	copy(header, preambleMagic[:])
+	header[2] = preambleVersion
+	header[3] = byte(p.Parity)
+	header[4] = byte(p.copies())
+	binary.LittleEndian.PutUint32(header[5:], uint32(len(msg)))
+
+	preambleCode, _ := NewReedSolomon(preambleParity)
+	protected, err := preambleCode.Encode(header)
+	if err != nil {
+		return nil, err
+	}
+
+	coded, err := encodeBlocks(msg, p.Parity)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, EncodedSize(len(msg), p))
+	out = append(out, repeat(protected, preambleCopies)...)
+	out = append(out, repeat(coded, p.copies())...)
+	return out, nil
+}
+
+// Decode recovers the message from stream and returns it with the number
+// of byte errors the Reed-Solomon code corrected
+func Decode(stream []byte) ([]byte, int, error) {
+	if len(stream) < PreambleSize {
+		return nil, 0, ErrNotEncoded
+	}
+	preambleCode, _ := NewReedSolomon(preambleParity)
+	header, _, err := preambleCode.Decode(majority(stream[:PreambleSize], preambleCopies))
+	if err != nil || header[0] != preambleMagic[0] || header[1] != preambleMagic[1] {
+		return nil, 0, ErrNotEncoded
+	}
+	if header[2] != preambleVersion {
+		return nil, 0, fmt.Errorf("fec: unsupported stream version %d", header[2])
+	}
+	p := Params{Parity: int(header[3]), Repeat: int(header[4])}
+	if err := p.Validate(); err != nil {
+		return nil, 0, err
+	}
+	n := int(binary.LittleEndian.Uint32(header[5:]))
+
+	size := codedSize(n, p.Parity)
+	body := stream[PreambleSize:]
+	if n > len(body) || size*p.copies() > len(body) {
+		return nil, 0, fmt.Errorf("fec: stream truncated: need %d bytes, have %d", size*p.copies(), len(body))
+	}
+	return decodeBlocks(majority(body[:size*p.copies()], p.copies()), n, p.Parity)
+}
+
+// encodeBlocks splits msg into codewords and interleaves them byte by byte
+func encodeBlocks(msg []byte, parity int) ([]byte, error) {
+	if parity == 0 || len(msg) == 0 {
+		return append([]byte(nil), msg...), nil
+	}
+	rs, err := NewReedSolomon(parity)
+	if err != nil {
+		return nil, err
+	}
+	blocks, dataLen := blockLayout(len(msg), parity)
+	n := dataLen + parity
+	out := make([]byte, blocks*n)
+	for b := 0; b < blocks; b++ {
+		// The last block is zero padded to the common length
+		data := make([]byte, dataLen)
+		copy(data, msg[min(b*dataLen, len(msg)):])
+		cw, err := rs.Encode(data)
+		if err != nil {
+			return nil, err
+		}
+		for j, c := range cw {
+			out[j*blocks+b] = c
+		}
+	}
+	return out, nil
+}
+
+// decodeBlocks undoes encodeBlocks for a message of n bytes
+func decodeBlocks(coded []byte, n, parity int) ([]byte, int, error) {
+	if parity == 0 || n == 0 {
+		return append([]byte(nil), coded[:n]...), 0, nil
+	}
+	rs, err := NewReedSolomon(parity)
+	if err != nil {
+		return nil, 0, err
+	}
+	blocks, dataLen := blockLayout(n, parity)
+	cwLen := dataLen + parity
+	msg := make([]byte, 0, blocks*dataLen)
+	corrected := 0
+	for b := 0; b < blocks; b++ {
+		cw := make([]byte, cwLen)
+		for j := range cw {
+			cw[j] = coded[j*blocks+b]
+		}
+		data, fixed, err := rs.Decode(cw)
+		if err != nil {
+			return nil, 0, fmt.Errorf("codeword %d of %d: %w", b+1, blocks, err)
+		}
+		corrected += fixed
+		msg = append(msg, data...)
+	}
+	return msg[:n], corrected, nil
+}
+
+func repeat(data []byte, copies int) []byte {
+	out := make([]byte, 0, len(data)*copies)
+	for i := 0; i < copies; i++ {
+		out = append(out, data...)
+	}
+	return out
+}
+
+// majority folds copies consecutive copies of a block into one by a
+// bitwise majority vote; ties keep the bit of the first copy
+func majority(data []byte, copies int) []byte {
+	size := len(data) / copies
+	out := make([]byte, size)
+	for i := range out {
+		var b byte
+		for bit := 0; bit < 8; bit++ {
+			mask := byte(1) << bit
+			ones := 0
+			for c := 0; c < copies; c++ {
+				if data[c*size+i]&mask != 0 {
+					ones++
+				}
+			}
+			if 2*ones > copies || (2*ones == copies && data[i]&mask != 0) {
+				b |= mask
+			}
+		}
+		out[i] = b
+	}
+	return out
+}
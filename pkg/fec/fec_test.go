@@ -0,0 +1,162 @@
+package fec
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"testing"
+)
+
+func randomBytes(rng *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(rng.Uint32())
+	}
+	return b
+}
+
+func TestReedSolomonCorrectsUpToHalfParity(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, parity := range []int{2, 8, 32} {
+		rs, err := NewReedSolomon(parity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msgLen := range []int{1, 40, MaxCodewordLength - parity} {
+			msg := randomBytes(rng, msgLen)
+			cw, err := rs.Encode(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, pos := range rng.Perm(len(cw))[:parity/2] {
+				cw[pos] ^= byte(rng.IntN(255) + 1)
+			}
+			got, fixed, err := rs.Decode(cw)
+			if err != nil {
+				t.Fatalf("parity %d, length %d: %v", parity, msgLen, err)
+			}
+			if !bytes.Equal(got, msg) || fixed != parity/2 {
+				t.Errorf("parity %d, length %d: corrected %d, message intact %v", parity, msgLen, fixed, bytes.Equal(got, msg))
+			}
+		}
+	}
+}
+
+func TestReedSolomonReportsTooManyErrors(t *testing.T) {
+	rs, _ := NewReedSolomon(8)
+	cw, _ := rs.Encode([]byte("too many errors"))
+	for i := 0; i < 8; i++ {
+		cw[i] ^= 0xff
+	}
+	if _, _, err := rs.Decode(cw); err == nil {
+		t.Error("expected an error for 8 byte errors with 8 parity bytes")
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	for _, p := range []Params{LevelOff, LevelLow, LevelMedium, LevelHigh, {Repeat: 5}} {
+		for _, n := range []int{0, 1, 300, 2000} {
+			msg := randomBytes(rng, n)
+			stream, err := Encode(msg, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stream) != EncodedSize(n, p) {
+				t.Errorf("%v: stream is %d bytes, EncodedSize says %d", p, len(stream), EncodedSize(n, p))
+			}
+			// Readers hand over everything they extracted
+			got, _, err := Decode(append(stream, randomBytes(rng, 50)...))
+			if err != nil {
+				t.Fatalf("%v, %d bytes: %v", p, n, err)
+			}
+			if !bytes.Equal(got, msg) {
+				t.Errorf("%v, %d bytes: message changed", p, n)
+			}
+		}
+	}
+}
+
+func TestInterleavingSpreadsBursts(t *testing.T) {
+	msg := bytes.Repeat([]byte("burst"), 200) // 4 codewords at parity 16
+	stream, err := Encode(msg, LevelLow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 30 consecutive bytes exceed one codeword's 8 but not 4 codewords' 32
+	for i := PreambleSize + 100; i < PreambleSize+130; i++ {
+		stream[i] ^= 0x5a
+	}
+	got, fixed, err := Decode(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) || fixed != 30 {
+		t.Errorf("expected 30 corrections, got %d (intact %v)", fixed, bytes.Equal(got, msg))
+	}
+}
+
+func TestRepetitionOutvotesBitErrors(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	msg := randomBytes(rng, 100)
+	p := Params{Repeat: 3}
+	stream, _ := Encode(msg, p)
+	// Flip a different random bit set in each copy
+	for c := 0; c < 3; c++ {
+		for _, i := range rng.Perm(100)[:30] {
+			stream[PreambleSize+c*100+i] ^= 1 << (c + 2)
+		}
+	}
+	got, _, err := Decode(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Error("majority vote did not restore the message")
+	}
+}
+
+func TestDecodeRejectsPlainData(t *testing.T) {
+	plain := bytes.Repeat([]byte("not fec"), 20)
+	if _, _, err := Decode(plain); !errors.Is(err, ErrNotEncoded) {
+		t.Errorf("expected ErrNotEncoded, got %v", err)
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	for _, p := range []Params{LevelOff, LevelLow, LevelHigh} {
+		for _, capacity := range []int{10, PreambleSize, 1000, 16384} {
+			n := MaxMessageSize(capacity, p)
+			if n > 0 && EncodedSize(n, p) > capacity {
+				t.Errorf("%v: %d bytes do not fit in %d", p, n, capacity)
+			}
+			if EncodedSize(n+1, p) <= capacity {
+				t.Errorf("%v: %d bytes would also fit in %d", p, n+1, capacity)
+			}
+		}
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	cases := map[string]Params{
+		"off":    LevelOff,
+		"Medium": LevelMedium,
+		"high":   LevelHigh,
+		"48":     {Parity: 48},
+		"20:3":   {Parity: 20, Repeat: 3},
+	}
+	for in, want := range cases {
+		got, err := ParseParams(in)
+		if err != nil || got != want {
+			t.Errorf("ParseParams(%q) = %+v, %v; want %+v", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"extreme", "1", "300", "16:99"} {
+		if _, err := ParseParams(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+	if s := (Params{Parity: 20, Repeat: 3}).String(); s != "20:3" {
+		t.Errorf("expected 20:3, got %s", s)
+	}
+}
@@ -0,0 +1,94 @@
+package fec
+
+// Arithmetic in GF(2^8) with the primitive polynomial x^8+x^4+x^3+x^2+1
+// (0x11d) and generator 2, the field used by QR codes and most RS codecs.
+// Polynomials are byte slices with the highest degree coefficient first.
+
+var (
+	gfExp [512]byte // doubled so gfMul needs no modulo
+	gfLog [256]int
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+func gfDiv(a, b byte) byte {
+	if b == 0 {
+		panic("fec: division by zero in GF(256)")
+	}
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(gfLog[a]+255-gfLog[b])%255]
+}
+
+// gfPow returns x^power; power may be negative
+func gfPow(x byte, power int) byte {
+	e := (gfLog[x] * power) % 255
+	if e < 0 {
+		e += 255
+	}
+	return gfExp[e]
+}
+
+func gfInverse(x byte) byte {
+	return gfExp[255-gfLog[x]]
+}
+
+func polyScale(p []byte, x byte) []byte {
+	r := make([]byte, len(p))
+	for i, c := range p {
+		r[i] = gfMul(c, x)
+	}
+	return r
+}
+
+func polyAdd(p, q []byte) []byte {
+	n := max(len(p), len(q))
+	r := make([]byte, n)
+	for i, c := range p {
+		r[i+n-len(p)] = c
+	}
+	for i, c := range q {
+		r[i+n-len(q)] ^= c
+	}
+	return r
+}
+
+func polyMul(p, q []byte) []byte {
+	r := make([]byte, len(p)+len(q)-1)
+	for j, qc := range q {
+		for i, pc := range p {
+			r[i+j] ^= gfMul(pc, qc)
+		}
+	}
+	return r
+}
+
+// polyEval evaluates p at x with Horner's scheme
+func polyEval(p []byte, x byte) byte {
+	y := p[0]
+	for _, c := range p[1:] {
+		y = gfMul(y, x) ^ c
+	}
+	return y
+}
@@ -0,0 +1,294 @@
+package fec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"math/bits"
+)
+
+// LT fountain code. A message is cut into K source blocks; symbol id < K is
+// source block id itself (systematic), every further symbol is the XOR of
+// a pseudo-random set of blocks whose size follows the robust soliton
+// distribution with a floor of about 3 ln K. The decoder solves the
+// symbols it has over GF(2), so any set of symbols that spans the K blocks
+// rebuilds the message, whatever their order; in practice K plus a few.
+//
+// Symbols are self-describing:
+//
+//	[set:4][length:4][K:2][block size:2][id:4][block]
+//
+// where set is the CRC-32 of the message and ties symbols to their payload.
+
+// LTHeaderSize is the size of the header in front of every symbol's block
+const LTHeaderSize = 16
+
+// MaxLTBlocks is the largest number of source blocks
+const MaxLTBlocks = math.MaxUint16
+
+// ErrForeignSymbol is returned when a symbol belongs to another message
+var ErrForeignSymbol = errors.New("fec: symbol belongs to another message")
+
+// Robust soliton parameters
+const (
+	ltC     = 0.1
+	ltDelta = 0.5
+)
+
+// LTEncoder produces symbols of one message
+type LTEncoder struct {
+	set       uint32
+	length    int
+	blockSize int
+	blocks    [][]byte
+	cdf       []float64
+}
+
+// NewLTEncoder splits msg into blocks of blockSize bytes
+func NewLTEncoder(msg []byte, blockSize int) (*LTEncoder, error) {
+	if blockSize < 1 || blockSize > math.MaxUint16 {
+		return nil, fmt.Errorf("fec: block size must be between 1 and %d, got %d", math.MaxUint16, blockSize)
+	}
+	k := max((len(msg)+blockSize-1)/blockSize, 1)
+	if k > MaxLTBlocks {
+		return nil, fmt.Errorf("fec: %d bytes need %d blocks of %d bytes, at most %d allowed", len(msg), k, blockSize, MaxLTBlocks)
+	}
+
+	blocks := make([][]byte, k)
+	for i := range blocks {
+		// The last block is zero padded
+		blocks[i] = make([]byte, blockSize)
+		copy(blocks[i], msg[min(i*blockSize, len(msg)):])
+	}
+	return &LTEncoder{
+		set:       crc32.ChecksumIEEE(msg),
+		length:    len(msg),
+		blockSize: blockSize,
+		blocks:    blocks,
+		cdf:       robustSolitonCDF(k),
+	}, nil
+}
+
+// K returns the number of source blocks
+func (e *LTEncoder) K() int {
+	return len(e.blocks)
+}
+
+// Symbol returns encoded symbol id, header included
+func (e *LTEncoder) Symbol(id uint32) []byte {
+	out := make([]byte, LTHeaderSize+e.blockSize)
+	binary.LittleEndian.PutUint32(out[0:4], e.set)
+	binary.LittleEndian.PutUint32(out[4:8], uint32(e.length))
+	binary.LittleEndian.PutUint16(out[8:10], uint16(len(e.blocks)))
+	binary.LittleEndian.PutUint16(out[10:12], uint16(e.blockSize))
+	binary.LittleEndian.PutUint32(out[12:16], id)
+
+	block := out[LTHeaderSize:]
+	for _, i := range ltNeighbours(e.set, id, len(e.blocks), e.cdf) {
+		for j, b := range e.blocks[i] {
+			block[j] ^= b
+		}
+	}
+	return out
+}
+
+// LTDecoder rebuilds a message from its symbols
+type LTDecoder struct {
+	set       uint32
+	length    int
+	k         int
+	blockSize int
+	cdf       []float64
+	seen      map[uint32]bool
+
+	// pivots[i] is a row whose lowest set coefficient is i (row echelon
+	// form), nil until a symbol provides it
+	pivots []*ltRow
+	rank   int
+}
+
+type ltRow struct {
+	coef []uint64
+	data []byte
+}
+
+// NewLTDecoder creates a decoder; the first symbol added sets the message
+// it decodes
+func NewLTDecoder() *LTDecoder {
+	return &LTDecoder{seen: make(map[uint32]bool)}
+}
+
+// Add feeds one symbol and reports whether the message can now be rebuilt.
+// Duplicate and linearly dependent symbols are accepted and ignored.
+func (d *LTDecoder) Add(symbol []byte) (bool, error) {
+	if len(symbol) < LTHeaderSize {
+		return d.Complete(), fmt.Errorf("fec: symbol of %d bytes too short", len(symbol))
+	}
+	set := binary.LittleEndian.Uint32(symbol[0:4])
+	length := int(binary.LittleEndian.Uint32(symbol[4:8]))
+	k := int(binary.LittleEndian.Uint16(symbol[8:10]))
+	blockSize := int(binary.LittleEndian.Uint16(symbol[10:12]))
+	id := binary.LittleEndian.Uint32(symbol[12:16])
+
+	if d.pivots == nil {
+		if k == 0 || blockSize == 0 || length > k*blockSize || len(symbol) != LTHeaderSize+blockSize {
+			return false, fmt.Errorf("fec: invalid symbol header")
+		}
+		d.set, d.length, d.k, d.blockSize = set, length, k, blockSize
+		d.cdf = robustSolitonCDF(k)
+		d.pivots = make([]*ltRow, k)
+	} else if set != d.set || length != d.length || k != d.k || blockSize != d.blockSize {
+		return d.Complete(), ErrForeignSymbol
+	}
+	if len(symbol) != LTHeaderSize+d.blockSize {
+		return d.Complete(), fmt.Errorf("fec: symbol of %d bytes, expected %d", len(symbol), LTHeaderSize+d.blockSize)
+	}
+	if d.seen[id] || d.Complete() {
+		return d.Complete(), nil
+	}
+	d.seen[id] = true
+
+	row := &ltRow{coef: make([]uint64, (d.k+63)/64), data: append([]byte(nil), symbol[LTHeaderSize:]...)}
+	for _, i := range ltNeighbours(d.set, id, d.k, d.cdf) {
+		row.coef[i/64] ^= 1 << (i % 64)
+	}
+	d.insert(row)
+	return d.Complete(), nil
+}
+
+// insert reduces row by the existing pivots and keeps it if it adds rank
+func (d *LTDecoder) insert(row *ltRow) {
+	for w := range row.coef {
+		for row.coef[w] != 0 {
+			i := w*64 + bits.TrailingZeros64(row.coef[w])
+			pivot := d.pivots[i]
+			if pivot == nil {
+				d.pivots[i] = row
+				d.rank++
+				return
+			}
+			row.xor(pivot)
+		}
+	}
+	// Linearly dependent on the symbols we already have
+}
+
+func (r *ltRow) xor(o *ltRow) {
+	for w := range r.coef {
+		r.coef[w] ^= o.coef[w]
+	}
+	for j := range r.data {
+		r.data[j] ^= o.data[j]
+	}
+}
+
+// Complete reports whether the symbols added so far span all blocks
+func (d *LTDecoder) Complete() bool {
+	return d.pivots != nil && d.rank == d.k
+}
+
+// Received returns the number of distinct symbols added and the number of
+// source blocks (0 before the first symbol)
+func (d *LTDecoder) Received() (symbols, k int) {
+	return len(d.seen), d.k
+}
+
+// Message back-substitutes the pivots and returns the message
+func (d *LTDecoder) Message() ([]byte, error) {
+	if !d.Complete() {
+		return nil, fmt.Errorf("fec: need more symbols: %d of %d blocks solved", d.rank, d.k)
+	}
+	for i := d.k - 1; i >= 0; i-- {
+		row := d.pivots[i]
+		for j := i + 1; j < d.k; j++ {
+			if row.coef[j/64]&(1<<(j%64)) != 0 {
+				row.xor(d.pivots[j])
+			}
+		}
+	}
+
+	msg := make([]byte, 0, d.k*d.blockSize)
+	for _, row := range d.pivots {
+		msg = append(msg, row.data...)
+	}
+	msg = msg[:d.length]
+	if crc32.ChecksumIEEE(msg) != d.set {
+		return nil, fmt.Errorf("fec: rebuilt message does not match its checksum")
+	}
+	return msg, nil
+}
+
+// ltNeighbours returns the source blocks XORed into symbol id
+func ltNeighbours(set, id uint32, k int, cdf []float64) []int {
+	if int(id) < k {
+		return []int{int(id)}
+	}
+	rng := splitmix64(uint64(set)<<32 | uint64(id))
+	u := float64(rng.next()>>11) / (1 << 53)
+	degree := 1
+	for degree < k && cdf[degree-1] < u {
+		degree++
+	}
+	// Very sparse symbols mostly repeat what the decoder already has; with
+	// elimination decoding a floor of about 3 ln K keeps the overhead at a
+	// few symbols even for small K (the Raptor pre-code plays that role in
+	// peeling decoders)
+	degree = max(degree, min(int(math.Ceil(3*math.Log(float64(k+1)))), (k+1)/2))
+
+	picked := make(map[int]bool, degree)
+	neighbours := make([]int, 0, degree)
+	for len(neighbours) < degree {
+		i := int(rng.next() % uint64(k))
+		if !picked[i] {
+			picked[i] = true
+			neighbours = append(neighbours, i)
+		}
+	}
+	return neighbours
+}
+
+// robustSolitonCDF returns the cumulative robust soliton distribution of
+// degrees 1..k
+func robustSolitonCDF(k int) []float64 {
+	r := ltC * math.Log(float64(k)/ltDelta) * math.Sqrt(float64(k))
+	spike := int(math.Round(float64(k) / r))
+	weights := make([]float64, k)
+	total := 0.0
+	for d := 1; d <= k; d++ {
+		// Ideal soliton
+		w := 1 / float64(k)
+		if d > 1 {
+			w = 1 / float64(d*(d-1))
+		}
+		// Robust addition
+		switch {
+		case d < spike:
+			w += r / float64(d*k)
+		case d == spike:
+			w += r * math.Log(r/ltDelta) / float64(k)
+		}
+		weights[d-1] = w
+		total += w
+	}
+	cdf := make([]float64, k)
+	sum := 0.0
+	for i, w := range weights {
+		sum += w / total
+		cdf[i] = sum
+	}
+	return cdf
+}
+
+// splitmix64 is a tiny PRNG with a fixed definition, so symbols decode the
+// same with every build
+type splitmix64 uint64
+
+func (s *splitmix64) next() uint64 {
+	*s += 0x9e3779b97f4a7c15
+	z := uint64(*s)
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
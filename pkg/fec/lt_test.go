@@ -0,0 +1,89 @@
+package fec
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestLTSystematicSymbolsDecode(t *testing.T) {
+	msg := []byte("every source block once, in any order")
+	enc, err := NewLTEncoder(msg, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := NewLTDecoder()
+	for id := enc.K() - 1; id >= 0; id-- {
+		if _, err := dec.Add(enc.Symbol(uint32(id))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := dec.Message()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Errorf("expected %q, got %q", msg, got)
+	}
+}
+
+func TestLTRecoversFromAnySufficientSubset(t *testing.T) {
+	rng := rand.New(rand.NewPCG(7, 8))
+	msg := randomBytes(rng, 5000)
+	enc, err := NewLTEncoder(msg, 250) // K = 20
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 40
+	symbols := make([][]byte, n)
+	for id := range symbols {
+		symbols[id] = enc.Symbol(uint32(id))
+	}
+
+	// Lose half the images, keep a random subset in random order
+	used := 0
+	for trial := 0; trial < 50; trial++ {
+		dec := NewLTDecoder()
+		for i, id := range rng.Perm(n) {
+			complete, err := dec.Add(symbols[id])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete {
+				used += i + 1
+				break
+			}
+		}
+		got, err := dec.Message()
+		if err != nil {
+			t.Fatalf("trial %d: %v", trial, err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("trial %d: message changed", trial)
+		}
+	}
+	if avg := float64(used) / 50; avg > float64(enc.K())+4 {
+		t.Errorf("needed %.1f symbols on average for K=%d", avg, enc.K())
+	}
+}
+
+func TestLTDecoderNeedsEnoughSymbols(t *testing.T) {
+	enc, _ := NewLTEncoder(bytes.Repeat([]byte("x"), 100), 10)
+	dec := NewLTDecoder()
+	for id := 0; id < enc.K()-1; id++ {
+		dec.Add(enc.Symbol(uint32(id)))
+		dec.Add(enc.Symbol(uint32(id))) // duplicates add nothing
+	}
+	if _, err := dec.Message(); err == nil {
+		t.Error("expected an error with K-1 symbols")
+	}
+	if symbols, k := dec.Received(); symbols != enc.K()-1 || k != enc.K() {
+		t.Errorf("expected %d of %d symbols, got %d of %d", enc.K()-1, enc.K(), symbols, k)
+	}
+
+	other, _ := NewLTEncoder(bytes.Repeat([]byte("y"), 100), 10)
+	if _, err := dec.Add(other.Symbol(3)); !errors.Is(err, ErrForeignSymbol) {
+		t.Errorf("expected ErrForeignSymbol, got %v", err)
+	}
+}
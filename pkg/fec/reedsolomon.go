@@ -0,0 +1,192 @@
+package fec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUncorrectable is returned when a codeword has more errors than its
+// parity can correct
+var ErrUncorrectable = errors.New("fec: too many errors to correct")
+
+// MaxCodewordLength is the longest Reed-Solomon codeword over GF(256)
+const MaxCodewordLength = 255
+
+// ReedSolomon is a systematic Reed-Solomon code over GF(256) with a fixed
+// number of parity bytes per codeword. It corrects up to parity/2 byte
+// errors anywhere in a codeword of at most MaxCodewordLength bytes;
+// shorter (shortened) codewords are allowed.
+type ReedSolomon struct {
+	parity    int
+	generator []byte
+}
+
+// NewReedSolomon creates a code with parity check bytes per codeword
+func NewReedSolomon(parity int) (*ReedSolomon, error) {
+	if parity < 2 || parity >= MaxCodewordLength {
+		return nil, fmt.Errorf("fec: parity must be between 2 and %d, got %d", MaxCodewordLength-1, parity)
+	}
+	g := []byte{1}
+	for i := 0; i < parity; i++ {
+		g = polyMul(g, []byte{1, gfPow(2, i)})
+	}
+	return &ReedSolomon{parity: parity, generator: g}, nil
+}
+
+// Parity returns the number of parity bytes per codeword
+func (rs *ReedSolomon) Parity() int {
+	return rs.parity
+}
+
+// Encode returns msg followed by its parity bytes
+func (rs *ReedSolomon) Encode(msg []byte) ([]byte, error) {
+	if len(msg)+rs.parity > MaxCodewordLength {
+		return nil, fmt.Errorf("fec: message of %d bytes too long for %d parity bytes", len(msg), rs.parity)
+	}
+	// Remainder of msg*x^parity divided by the (monic) generator
+	out := make([]byte, len(msg)+rs.parity)
+	copy(out, msg)
+	for i := range msg {
+		coef := out[i]
+		if coef == 0 {
+			continue
+		}
+		for j := 1; j < len(rs.generator); j++ {
+			out[i+j] ^= gfMul(rs.generator[j], coef)
+		}
+	}
+	copy(out, msg)
+	return out, nil
+}
+
+// Decode corrects codeword in place and returns its message part and the
+// number of corrected bytes
+func (rs *ReedSolomon) Decode(codeword []byte) ([]byte, int, error) {
+	if len(codeword) > MaxCodewordLength || len(codeword) <= rs.parity {
+		return nil, 0, fmt.Errorf("fec: invalid codeword length %d", len(codeword))
+	}
+	synd := rs.syndromes(codeword)
+	if isZero(synd) {
+		return codeword[:len(codeword)-rs.parity], 0, nil
+	}
+
+	errLoc, err := rs.errorLocator(synd)
+	if err != nil {
+		return nil, 0, err
+	}
+	errPos, err := findErrors(reversed(errLoc), len(codeword))
+	if err != nil {
+		return nil, 0, err
+	}
+	correctErrata(codeword, synd, errPos)
+
+	if !isZero(rs.syndromes(codeword)) {
+		return nil, 0, ErrUncorrectable
+	}
+	return codeword[:len(codeword)-rs.parity], len(errPos), nil
+}
+
+// syndromes evaluates the codeword at the generator roots. The leading 0
+// keeps the indices of the classic formulation.
+func (rs *ReedSolomon) syndromes(codeword []byte) []byte {
+	synd := make([]byte, rs.parity+1)
+	for i := 0; i < rs.parity; i++ {
+		synd[i+1] = polyEval(codeword, gfPow(2, i))
+	}
+	return synd
+}
+
+// errorLocator runs Berlekamp-Massey on the syndromes
+func (rs *ReedSolomon) errorLocator(synd []byte) ([]byte, error) {
+	errLoc := []byte{1}
+	oldLoc := []byte{1}
+	shift := len(synd) - rs.parity
+	for i := 0; i < rs.parity; i++ {
+		k := i + shift
+		delta := synd[k]
+		for j := 1; j < len(errLoc); j++ {
+			delta ^= gfMul(errLoc[len(errLoc)-1-j], synd[k-j])
+		}
+		oldLoc = append(oldLoc, 0)
+		if delta != 0 {
+			if len(oldLoc) > len(errLoc) {
+				newLoc := polyScale(oldLoc, delta)
+				oldLoc = polyScale(errLoc, gfInverse(delta))
+				errLoc = newLoc
+			}
+			errLoc = polyAdd(errLoc, polyScale(oldLoc, delta))
+		}
+	}
+	for len(errLoc) > 0 && errLoc[0] == 0 {
+		errLoc = errLoc[1:]
+	}
+	if 2*(len(errLoc)-1) > rs.parity {
+		return nil, ErrUncorrectable
+	}
+	return errLoc, nil
+}
+
+// findErrors locates the roots of the error locator (Chien search)
+func findErrors(errLoc []byte, n int) ([]int, error) {
+	var pos []int
+	for i := 0; i < n; i++ {
+		if polyEval(errLoc, gfPow(2, i)) == 0 {
+			pos = append(pos, n-1-i)
+		}
+	}
+	if len(pos) != len(errLoc)-1 {
+		return nil, ErrUncorrectable
+	}
+	return pos, nil
+}
+
+// correctErrata computes the error magnitudes with Forney's algorithm and
+// applies them to codeword
+func correctErrata(codeword, synd []byte, errPos []int) {
+	coefPos := make([]int, len(errPos))
+	for i, p := range errPos {
+		coefPos[i] = len(codeword) - 1 - p
+	}
+
+	errLoc := []byte{1}
+	for _, p := range coefPos {
+		errLoc = polyMul(errLoc, []byte{gfPow(2, p), 1})
+	}
+	// Error evaluator: (S(x) * Λ(x)) mod x^(len(Λ))
+	product := polyMul(reversed(synd), errLoc)
+	errEval := reversed(product[len(product)-len(errLoc):])
+
+	x := make([]byte, len(coefPos))
+	for i, p := range coefPos {
+		x[i] = gfPow(2, -(MaxCodewordLength - p))
+	}
+
+	for i, xi := range x {
+		xiInv := gfInverse(xi)
+		locPrime := byte(1)
+		for j, xj := range x {
+			if j != i {
+				locPrime = gfMul(locPrime, 1^gfMul(xiInv, xj))
+			}
+		}
+		y := gfMul(xi, polyEval(reversed(errEval), xiInv))
+		codeword[errPos[i]] ^= gfDiv(y, locPrime)
+	}
+}
+
+func reversed(p []byte) []byte {
+	r := make([]byte, len(p))
+	for i, c := range p {
+		r[len(p)-1-i] = c
+	}
+	return r
+}
+
+func isZero(p []byte) bool {
+	for _, c := range p {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,724 @@
+package jpegcoef
+
+import (
+	"bytes"
+	"errors"
+	"math/bits"
+)
+
+var errArithmetic = errors.New("corrupt arithmetic-coded data")
+
+// arithStates is the probability estimation state machine of ITU T.81
+// Table D.2: Qe, next state after an LPS, next state after an MPS and
+// whether an LPS switches the sense of the MPS. The last state is the fixed
+// 0.5 estimate libjpeg uses for sign and refinement bits.
+var arithStates = [...][4]int{
+	{0x5a1d, 1, 1, 1}, {0x2586, 14, 2, 0}, {0x1114, 16, 3, 0}, {0x080b, 18, 4, 0},
+	{0x03d8, 20, 5, 0}, {0x01da, 23, 6, 0}, {0x00e5, 25, 7, 0}, {0x006f, 28, 8, 0},
+	{0x0036, 30, 9, 0}, {0x001a, 33, 10, 0}, {0x000d, 35, 11, 0}, {0x0006, 9, 12, 0},
+	{0x0003, 10, 13, 0}, {0x0001, 12, 13, 0}, {0x5a7f, 15, 15, 1}, {0x3f25, 36, 16, 0},
+	{0x2cf2, 38, 17, 0}, {0x207c, 39, 18, 0}, {0x17b9, 40, 19, 0}, {0x1182, 42, 20, 0},
+	{0x0cef, 43, 21, 0}, {0x09a1, 45, 22, 0}, {0x072f, 46, 23, 0}, {0x055c, 48, 24, 0},
+	{0x0406, 49, 25, 0}, {0x0303, 51, 26, 0}, {0x0240, 52, 27, 0}, {0x01b1, 54, 28, 0},
+	{0x0144, 56, 29, 0}, {0x00f5, 57, 30, 0}, {0x00b7, 59, 31, 0}, {0x008a, 60, 32, 0},
+	{0x0068, 62, 33, 0}, {0x004e, 63, 34, 0}, {0x003b, 32, 35, 0}, {0x002c, 33, 9, 0},
+	{0x5ae1, 37, 37, 1}, {0x484c, 64, 38, 0}, {0x3a0d, 65, 39, 0}, {0x2ef1, 67, 40, 0},
+	{0x261f, 68, 41, 0}, {0x1f33, 69, 42, 0}, {0x19a8, 70, 43, 0}, {0x1518, 72, 44, 0},
+	{0x1177, 73, 45, 0}, {0x0e74, 74, 46, 0}, {0x0bfb, 75, 47, 0}, {0x09f8, 77, 48, 0},
+	{0x0861, 78, 49, 0}, {0x0706, 79, 50, 0}, {0x05cd, 48, 51, 0}, {0x04de, 50, 52, 0},
+	{0x040f, 50, 53, 0}, {0x0363, 51, 54, 0}, {0x02d4, 52, 55, 0}, {0x025c, 53, 56, 0},
+	{0x01f8, 54, 57, 0}, {0x01a4, 55, 58, 0}, {0x0160, 56, 59, 0}, {0x0125, 57, 60, 0},
+	{0x00f6, 58, 61, 0}, {0x00cb, 59, 62, 0}, {0x00ab, 61, 63, 0}, {0x008f, 61, 32, 0},
+	{0x5b12, 65, 65, 1}, {0x4d04, 80, 66, 0}, {0x412c, 81, 67, 0}, {0x37d8, 82, 68, 0},
+	{0x2fe8, 83, 69, 0}, {0x293c, 84, 70, 0}, {0x2379, 86, 71, 0}, {0x1edf, 87, 72, 0},
+	{0x1aa9, 87, 73, 0}, {0x174e, 72, 74, 0}, {0x1424, 72, 75, 0}, {0x119c, 74, 76, 0},
+	{0x0f6b, 74, 77, 0}, {0x0d51, 75, 78, 0}, {0x0bb6, 77, 79, 0}, {0x0a40, 77, 48, 0},
+	{0x5832, 80, 81, 1}, {0x4d1c, 88, 82, 0}, {0x438e, 89, 83, 0}, {0x3bdd, 90, 84, 0},
+	{0x34ee, 91, 85, 0}, {0x2eae, 92, 86, 0}, {0x299a, 93, 87, 0}, {0x2516, 86, 71, 0},
+	{0x5570, 88, 89, 1}, {0x4ca9, 95, 90, 0}, {0x44d9, 96, 91, 0}, {0x3e22, 97, 92, 0},
+	{0x3824, 99, 93, 0}, {0x32b4, 99, 94, 0}, {0x2e17, 93, 86, 0}, {0x56a8, 95, 96, 1},
+	{0x4f46, 101, 97, 0}, {0x47e5, 102, 98, 0}, {0x41cf, 103, 99, 0}, {0x3c3d, 104, 100, 0},
+	{0x375e, 99, 93, 0}, {0x5231, 105, 102, 0}, {0x4c0f, 106, 103, 0}, {0x4639, 107, 104, 0},
+	{0x415e, 103, 99, 0}, {0x5627, 105, 106, 1}, {0x50e7, 108, 107, 0}, {0x4b85, 109, 103, 0},
+	{0x5597, 110, 109, 0}, {0x504f, 111, 107, 0}, {0x5a10, 110, 111, 1}, {0x5522, 112, 109, 0},
+	{0x59eb, 112, 111, 1}, {0x5a1d, 113, 113, 0},
+}
+
+// fixedState is the index of the fixed 0.5 estimate in arithStates
+const fixedState = 113
+
+// arithState returns Qe and the next states of state st after an LPS and
+// an MPS, with the MPS sense switch folded into bit 7 of the LPS state
+func arithState(st byte) (qe int64, nl, nm byte) {
+	s := arithStates[st&0x7F]
+	return int64(s[0]), byte(s[1] | s[3]<<7), byte(s[2])
+}
+
+// arithConditioning holds the DAC parameters of each table: the DC
+// difference bounds L and U and the AC band threshold K
+type arithConditioning struct {
+	dcL, dcU, acK [4]int
+}
+
+func defaultConditioning() arithConditioning {
+	var c arithConditioning
+	for t := range c.dcL {
+		c.dcL[t], c.dcU[t], c.acK[t] = 0, 1, 5
+	}
+	return c
+}
+
+func (c *arithConditioning) parse(s []byte) error {
+	for ; len(s) >= 2; s = s[2:] {
+		class, t, v := s[0]>>4, s[0]&15, int(s[1])
+		switch {
+		case class > 1 || t > 3:
+			return errors.New("invalid DAC table id")
+		case class == 0:
+			c.dcL[t], c.dcU[t] = v&15, v>>4
+			if c.dcL[t] > c.dcU[t] {
+				return errors.New("invalid DAC DC bounds")
+			}
+		default:
+			if v < 1 || v > 63 {
+				return errors.New("invalid DAC AC threshold")
+			}
+			c.acK[t] = v
+		}
+	}
+	if len(s) != 0 {
+		return errors.New("invalid DAC segment")
+	}
+	return nil
+}
+
+// arithStats holds the adaptive statistics bins of one scan (ITU T.81
+// Tables F.4 and F.5, G.1 and G.2 for refinement)
+type arithStats struct {
+	dc        [4][64]byte
+	ac        [4][256]byte
+	fixed     byte
+	pred      [4]int32
+	dcContext [4]int
+}
+
+// reset clears the statistics used by the components of scan, as at the
+// start of the scan and after each restart marker
+func (s *arithStats) reset(scan Scan, progressive bool, dcTable, acTable func(ci int) int) {
+	for _, ci := range scan.Components {
+		if !progressive || (scan.Ss == 0 && scan.Ah == 0) {
+			s.dc[dcTable(ci)] = [64]byte{}
+			s.pred[ci], s.dcContext[ci] = 0, 0
+		}
+		if !progressive || scan.Ss > 0 {
+			s.ac[acTable(ci)] = [256]byte{}
+		}
+	}
+	s.fixed = fixedState
+}
+
+// dcContextAfter returns the conditioning category of the next DC
+// difference after one of magnitude category m (ITU T.81 F.1.4.4.1.2)
+func dcContextAfter(m, sign, l, u int) int {
+	switch {
+	case m < (1<<l)>>1:
+		return 0
+	case m > (1<<u)>>1:
+		return 12 + 4*sign
+	default:
+		return 4 + 4*sign
+	}
+}
+
+// acMagnitudeBin returns the first magnitude bin of AC coefficient k
+func acMagnitudeBin(k, threshold int) int {
+	if k <= threshold {
+		return 189
+	}
+	return 217
+}
+
+// arithDecoder decodes arithmetic-coded scans, following libjpeg's
+// jdarith.c
+type arithDecoder struct {
+	scanHeader
+	progressive bool
+	cond        arithConditioning
+	stats       arithStats
+
+	data   []byte
+	pos    int
+	marker bool
+	c, a   int64
+	ct     int
+}
+
+func newArithDecoder(d *decoder, h *scanHeader) *arithDecoder {
+	dec := &arithDecoder{scanHeader: *h, progressive: d.img.Progressive, cond: d.conditioning, data: d.data, pos: d.pos}
+	dec.reset()
+	return dec
+}
+
+func (dec *arithDecoder) reset() {
+	dec.stats.reset(dec.Scan, dec.progressive,
+		func(ci int) int { return dec.dcTable[ci] }, func(ci int) int { return dec.acTable[ci] })
+	// ct = -16 makes the first decision read two bytes into C
+	dec.c, dec.a, dec.ct = 0, 0, -16
+}
+
+func (dec *arithDecoder) restart() error {
+	for dec.pos+1 < len(dec.data) && !(dec.data[dec.pos] == 0xFF && dec.data[dec.pos+1] >= 0xD0 && dec.data[dec.pos+1] <= 0xD7) {
+		dec.pos++
+	}
+	if dec.pos+1 >= len(dec.data) {
+		return errors.New("missing restart marker")
+	}
+	dec.pos += 2
+	dec.marker = false
+	dec.reset()
+	return nil
+}
+
+func (dec *arithDecoder) end() int {
+	return dec.pos
+}
+
+// readByte returns the next data byte, removing byte stuffing. At a
+// marker it stops and supplies zeros, as the arithmetic decoder may run
+// past the end of the data.
+func (dec *arithDecoder) readByte() int64 {
+	if dec.marker || dec.pos >= len(dec.data) {
+		dec.marker = true
+		return 0
+	}
+	b := dec.data[dec.pos]
+	dec.pos++
+	if b != 0xFF {
+		return int64(b)
+	}
+	for dec.pos < len(dec.data) && dec.data[dec.pos] == 0xFF {
+		dec.pos++
+	}
+	if dec.pos < len(dec.data) && dec.data[dec.pos] == 0x00 {
+		dec.pos++
+		return 0xFF
+	}
+	dec.marker = true
+	dec.pos--
+	return 0
+}
+
+// decode returns the next binary decision coded with statistics bin st
+// (ITU T.81 D.2)
+func (dec *arithDecoder) decode(st *byte) int {
+	for dec.a < 0x8000 {
+		dec.ct--
+		if dec.ct < 0 {
+			dec.c = dec.c<<8 | dec.readByte()
+			dec.ct += 8
+			if dec.ct < 0 {
+				dec.ct++
+				if dec.ct == 0 {
+					dec.a = 0x8000
+				}
+			}
+		}
+		dec.a <<= 1
+	}
+
+	sv := *st
+	qe, nl, nm := arithState(sv)
+	dec.a -= qe
+	temp := dec.a << dec.ct
+	if dec.c >= temp {
+		dec.c -= temp
+		// Conditional exchange: the LPS interval may be the larger one
+		if dec.a < qe {
+			dec.a = qe
+			*st = sv&0x80 ^ nm
+		} else {
+			dec.a = qe
+			*st = sv&0x80 ^ nl
+			sv ^= 0x80
+		}
+	} else if dec.a < 0x8000 {
+		if dec.a < qe {
+			*st = sv&0x80 ^ nl
+			sv ^= 0x80
+		} else {
+			*st = sv&0x80 ^ nm
+		}
+	}
+	return int(sv >> 7)
+}
+
+func (dec *arithDecoder) decodeBlock(ci int, b *Block) error {
+	switch {
+	case !dec.progressive:
+		diff, err := dec.decodeDC(ci)
+		if err != nil {
+			return err
+		}
+		dec.stats.pred[ci] += diff
+		b[0] = dec.stats.pred[ci]
+		return dec.decodeAC(ci, b)
+	case dec.Ss == 0 && dec.Ah == 0:
+		diff, err := dec.decodeDC(ci)
+		if err != nil {
+			return err
+		}
+		dec.stats.pred[ci] += diff
+		b[0] = dec.stats.pred[ci] << dec.Al
+	case dec.Ss == 0:
+		if dec.decode(&dec.stats.fixed) != 0 {
+			b[0] |= 1 << dec.Al
+		}
+	case dec.Ah == 0:
+		return dec.decodeAC(ci, b)
+	default:
+		return dec.decodeACRefine(ci, b)
+	}
+	return nil
+}
+
+// decodeDC decodes one DC difference (ITU T.81 F.2.4.1)
+func (dec *arithDecoder) decodeDC(ci int) (int32, error) {
+	t := dec.dcTable[ci]
+	stats := &dec.stats.dc[t]
+	st := dec.stats.dcContext[ci]
+	if dec.decode(&stats[st]) == 0 {
+		dec.stats.dcContext[ci] = 0
+		return 0, nil
+	}
+	sign := dec.decode(&stats[st+1])
+	st += 2 + sign
+	m := dec.decode(&stats[st])
+	if m != 0 {
+		for st = 20; dec.decode(&stats[st]) != 0; st++ {
+			if m <<= 1; m == 0x8000 {
+				return 0, errArithmetic
+			}
+		}
+	}
+	dec.stats.dcContext[ci] = dcContextAfter(m, sign, dec.cond.dcL[t], dec.cond.dcU[t])
+	return dec.magnitudeBits(stats[:], st+14, m, sign), nil
+}
+
+// magnitudeBits decodes the bits below the leading one of a value of
+// magnitude category m (ITU T.81 Figure F.24)
+func (dec *arithDecoder) magnitudeBits(stats []byte, st, m, sign int) int32 {
+	v := m
+	for m >>= 1; m != 0; m >>= 1 {
+		if dec.decode(&stats[st]) != 0 {
+			v |= m
+		}
+	}
+	v++
+	if sign != 0 {
+		v = -v
+	}
+	return int32(v)
+}
+
+// decodeAC decodes the AC band of a sequential or first progressive scan
+// (ITU T.81 F.2.4.2 and G.1.3.2)
+func (dec *arithDecoder) decodeAC(ci int, b *Block) error {
+	t := dec.acTable[ci]
+	stats := &dec.stats.ac[t]
+	for k := max(dec.Ss, 1); k <= dec.Se; k++ {
+		st := 3 * (k - 1)
+		if dec.decode(&stats[st]) != 0 {
+			break // EOB
+		}
+		for dec.decode(&stats[st+1]) == 0 {
+			st += 3
+			if k++; k > dec.Se {
+				return errArithmetic
+			}
+		}
+		sign := dec.decode(&dec.stats.fixed)
+		st += 2
+		m := dec.decode(&stats[st])
+		if m != 0 && dec.decode(&stats[st]) != 0 {
+			m <<= 1
+			for st = acMagnitudeBin(k, dec.cond.acK[t]); dec.decode(&stats[st]) != 0; st++ {
+				if m <<= 1; m == 0x8000 {
+					return errArithmetic
+				}
+			}
+		}
+		b[zigzag[k]] = dec.magnitudeBits(stats[:], st+14, m, sign) << dec.Al
+	}
+	return nil
+}
+
+// decodeACRefine decodes one bit plane of the AC band (ITU T.81 G.1.3.3)
+func (dec *arithDecoder) decodeACRefine(ci int, b *Block) error {
+	stats := &dec.stats.ac[dec.acTable[ci]]
+	p1, m1 := int32(1)<<dec.Al, int32(-1)<<dec.Al
+
+	// The previous passes ended the block at kex
+	kex := dec.Se
+	for kex > 0 && b[zigzag[kex]] == 0 {
+		kex--
+	}
+	for k := dec.Ss; k <= dec.Se; k++ {
+		st := 3 * (k - 1)
+		if k > kex && dec.decode(&stats[st]) != 0 {
+			break // EOB
+		}
+		for {
+			c := &b[zigzag[k]]
+			if *c != 0 {
+				if dec.decode(&stats[st+2]) != 0 {
+					if *c < 0 {
+						*c += m1
+					} else {
+						*c += p1
+					}
+				}
+				break
+			}
+			if dec.decode(&stats[st+1]) != 0 {
+				*c = p1
+				if dec.decode(&dec.stats.fixed) != 0 {
+					*c = m1
+				}
+				break
+			}
+			st += 3
+			if k++; k > dec.Se {
+				return errArithmetic
+			}
+		}
+	}
+	return nil
+}
+
+// arithEncoder codes one arithmetic-coded scan with the default
+// conditioning, following libjpeg's jcarith.c
+type arithEncoder struct {
+	Scan
+	progressive bool
+	cond        arithConditioning
+	stats       arithStats
+
+	buf    *bytes.Buffer
+	c, a   int64
+	ct     int
+	sc, zc int // stacked 0xFF bytes and pending zero bytes
+	buffer int // byte waiting for a possible carry, -1 for none
+}
+
+func newArithEncoder(buf *bytes.Buffer, scan Scan, progressive bool) *arithEncoder {
+	e := &arithEncoder{Scan: scan, progressive: progressive, cond: defaultConditioning(), buf: buf}
+	e.reset()
+	return e
+}
+
+func (e *arithEncoder) reset() {
+	e.stats.reset(e.Scan, e.progressive, tableFor, tableFor)
+	e.c, e.a, e.ct = 0, 0x10000, 11
+	e.sc, e.zc, e.buffer = 0, 0, -1
+}
+
+// emitByte writes b with byte stuffing
+func (e *arithEncoder) emitByte(b int) {
+	e.buf.WriteByte(byte(b))
+	if byte(b) == 0xFF {
+		e.buf.WriteByte(0x00)
+	}
+}
+
+func (e *arithEncoder) emitZeros() {
+	for ; e.zc > 0; e.zc-- {
+		e.buf.WriteByte(0x00)
+	}
+}
+
+// carry resolves the waiting byte and the stacked 0xFF bytes: a carry
+// increments the byte and turns the 0xFF bytes into zeros
+func (e *arithEncoder) carry(overflow bool) {
+	if overflow {
+		if e.buffer >= 0 {
+			e.emitZeros()
+			e.emitByte(e.buffer + 1)
+		}
+		e.zc += e.sc
+		e.sc = 0
+		return
+	}
+	if e.buffer == 0 {
+		e.zc++
+	} else if e.buffer >= 0 {
+		e.emitZeros()
+		e.emitByte(e.buffer)
+	}
+	if e.sc > 0 {
+		e.emitZeros()
+		for ; e.sc > 0; e.sc-- {
+			e.buf.Write([]byte{0xFF, 0x00})
+		}
+	}
+}
+
+// encode codes the binary decision val with statistics bin st (ITU T.81
+// D.1)
+func (e *arithEncoder) encode(st *byte, val int) {
+	sv := *st
+	qe, nl, nm := arithState(sv)
+	e.a -= qe
+	if val != int(sv>>7) {
+		if e.a >= qe {
+			e.c += e.a
+			e.a = qe
+		}
+		*st = sv&0x80 ^ nl
+	} else {
+		if e.a >= 0x8000 {
+			return
+		}
+		if e.a < qe {
+			e.c += e.a
+			e.a = qe
+		}
+		*st = sv&0x80 ^ nm
+	}
+
+	for e.a < 0x8000 {
+		e.a <<= 1
+		e.c <<= 1
+		if e.ct--; e.ct == 0 {
+			temp := int(e.c >> 19)
+			switch {
+			case temp > 0xFF:
+				e.carry(true)
+				e.buffer = temp & 0xFF
+			case temp == 0xFF:
+				e.sc++
+			default:
+				e.carry(false)
+				e.buffer = temp
+			}
+			e.c &= 0x7FFFF
+			e.ct += 8
+		}
+	}
+}
+
+// finish terminates the coded data (ITU T.81 D.1.8)
+func (e *arithEncoder) finish() {
+	// Pick the value in the interval with the most trailing zero bits
+	if temp := (e.a - 1 + e.c) & 0xFFFF0000; temp < e.c {
+		e.c = temp + 0x8000
+	} else {
+		e.c = temp
+	}
+	e.c <<= e.ct
+	e.carry(e.c&0xF8000000 != 0)
+	// Trailing zero bytes are implied
+	if e.c&0x7FFF800 != 0 {
+		e.emitZeros()
+		e.emitByte(int(e.c>>19) & 0xFF)
+		if e.c&0x7F800 != 0 {
+			e.emitByte(int(e.c>>11) & 0xFF)
+		}
+	}
+}
+
+func (e *arithEncoder) restart(n int) {
+	e.finish()
+	e.buf.Write([]byte{0xFF, byte(0xD0 + n%8)})
+	e.reset()
+}
+
+func (e *arithEncoder) encodeBlock(ci int, b *Block) error {
+	switch {
+	case !e.progressive:
+		e.encodeDC(ci, b[0]-e.stats.pred[ci])
+		e.stats.pred[ci] = b[0]
+		return e.encodeAC(ci, b)
+	case e.Ss == 0 && e.Ah == 0:
+		v := b[0] >> e.Al
+		e.encodeDC(ci, v-e.stats.pred[ci])
+		e.stats.pred[ci] = v
+	case e.Ss == 0:
+		e.encode(&e.stats.fixed, int(b[0]>>e.Al)&1)
+	case e.Ah == 0:
+		return e.encodeAC(ci, b)
+	default:
+		e.encodeACRefine(ci, b)
+	}
+	return nil
+}
+
+// magnitude codes v > 0 as the category of v-1 followed by its low bits
+// (ITU T.81 Figures F.8 and F.9). Category decision j uses bin(j) and the
+// low bits the bin 14 past the terminating decision. It returns the
+// category's leading bit, 0 for v = 1.
+func (e *arithEncoder) magnitude(stats []byte, bin func(j int) int, v int32) int {
+	v--
+	n := bits.Len32(uint32(v))
+	for j := 0; j < n; j++ {
+		e.encode(&stats[bin(j)], 1)
+	}
+	st := bin(n)
+	e.encode(&stats[st], 0)
+	m := int32(1) << n >> 1
+	for b := m >> 1; b != 0; b >>= 1 {
+		bit := 0
+		if b&v != 0 {
+			bit = 1
+		}
+		e.encode(&stats[st+14], bit)
+	}
+	return int(m)
+}
+
+// encodeDC codes one DC difference (ITU T.81 F.1.4.1)
+func (e *arithEncoder) encodeDC(ci int, v int32) {
+	t := tableFor(ci)
+	stats := &e.stats.dc[t]
+	st := e.stats.dcContext[ci]
+	if v == 0 {
+		e.encode(&stats[st], 0)
+		e.stats.dcContext[ci] = 0
+		return
+	}
+	e.encode(&stats[st], 1)
+	sign := 0
+	if v < 0 {
+		v, sign = -v, 1
+	}
+	e.encode(&stats[st+1], sign)
+	st += 2 + sign
+
+	// After the first decision the category bins run from X1 = 20
+	m := e.magnitude(stats[:], func(j int) int {
+		if j == 0 {
+			return st
+		}
+		return 19 + j
+	}, v)
+	e.stats.dcContext[ci] = dcContextAfter(m, sign, e.cond.dcL[t], e.cond.dcU[t])
+}
+
+// pointTransform returns coefficient k of b divided by 2^al, rounding
+// towards zero
+func pointTransform(b *Block, k, al int) int32 {
+	if v := b[zigzag[k]]; v < 0 {
+		return -(-v >> al)
+	} else {
+		return v >> al
+	}
+}
+
+// encodeAC codes the AC band of a sequential or first progressive scan
+// (ITU T.81 F.1.4.2 and G.1.3.2)
+func (e *arithEncoder) encodeAC(ci int, b *Block) error {
+	t := tableFor(ci)
+	stats := &e.stats.ac[t]
+	ke := e.Se
+	for ke > 0 && pointTransform(b, ke, e.Al) == 0 {
+		ke--
+	}
+	k := max(e.Ss, 1)
+	for ; k <= ke; k++ {
+		st := 3 * (k - 1)
+		e.encode(&stats[st], 0)
+		v := pointTransform(b, k, e.Al)
+		for ; v == 0; v = pointTransform(b, k, e.Al) {
+			e.encode(&stats[st+1], 0)
+			st += 3
+			k++
+		}
+		e.encode(&stats[st+1], 1)
+		sign := 0
+		if v < 0 {
+			v, sign = -v, 1
+		}
+		if v > 1<<15 {
+			return errors.New("AC coefficient out of range")
+		}
+		e.encode(&e.stats.fixed, sign)
+		// The first two category decisions share the SP bin, the rest run
+		// from X2 of the low or high band
+		sp := st + 2
+		e.magnitude(stats[:], func(j int) int {
+			if j < 2 {
+				return sp
+			}
+			return acMagnitudeBin(k, e.cond.acK[t]) + j - 2
+		}, v)
+	}
+	if k <= e.Se {
+		e.encode(&stats[3*(k-1)], 1)
+	}
+	return nil
+}
+
+// encodeACRefine codes one bit plane of the AC band (ITU T.81 G.1.3.3)
+func (e *arithEncoder) encodeACRefine(ci int, b *Block) {
+	stats := &e.stats.ac[tableFor(ci)]
+	ke := e.Se
+	for ke > 0 && pointTransform(b, ke, e.Al) == 0 {
+		ke--
+	}
+	kex := ke
+	for kex > 0 && pointTransform(b, kex, e.Ah) == 0 {
+		kex--
+	}
+	k := e.Ss
+	for ; k <= ke; k++ {
+		st := 3 * (k - 1)
+		if k > kex {
+			e.encode(&stats[st], 0)
+		}
+		for {
+			v := pointTransform(b, k, e.Al)
+			if v != 0 {
+				a := v
+				if a < 0 {
+					a = -a
+				}
+				if a>>1 != 0 {
+					e.encode(&stats[st+2], int(a&1))
+				} else {
+					e.encode(&stats[st+1], 1)
+					sign := 0
+					if v < 0 {
+						sign = 1
+					}
+					e.encode(&e.stats.fixed, sign)
+				}
+				break
+			}
+			e.encode(&stats[st+1], 0)
+			st += 3
+			k++
+		}
+	}
+	if k <= e.Se {
+		e.encode(&stats[3*(k-1)], 1)
+	}
+}
+
+// writeArithScan writes one scan of an arithmetic-coded file
+func (img *Image) writeArithScan(buf *bytes.Buffer, scan Scan) error {
+	img.writeSOS(buf, scan)
+	e := newArithEncoder(buf, scan, img.Progressive)
+	lastMCU, restarts := -1, 0
+	err := img.walkScan(scan.Components, func(ci int, b *Block, mcu int) error {
+		if mcu != lastMCU && img.RestartInterval > 0 && mcu > 0 && mcu%img.RestartInterval == 0 {
+			e.restart(restarts)
+			restarts++
+		}
+		lastMCU = mcu
+		return e.encodeBlock(ci, b)
+	})
+	if err != nil {
+		return err
+	}
+	e.finish()
+	return nil
+}
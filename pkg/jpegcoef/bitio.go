@@ -0,0 +1,148 @@
+package jpegcoef
+
+import (
+	"bytes"
+	"errors"
+)
+
+var errHuffman = errors.New("corrupt Huffman data")
+
+// bitReader reads entropy-coded data, removing byte stuffing and stopping
+// at markers (bits past a marker read as zero)
+type bitReader struct {
+	data   []byte
+	pos    int
+	acc    uint32
+	nbits  uint
+	marker bool
+}
+
+func (b *bitReader) fill() {
+	for b.nbits <= 24 {
+		var c byte
+		if !b.marker && b.pos < len(b.data) {
+			c = b.data[b.pos]
+			if c == 0xFF {
+				if b.pos+1 < len(b.data) && b.data[b.pos+1] == 0x00 {
+					b.pos += 2
+				} else {
+					b.marker = true
+					c = 0
+				}
+			} else {
+				b.pos++
+			}
+		} else {
+			b.marker = true
+		}
+		b.acc |= uint32(c) << (24 - b.nbits)
+		b.nbits += 8
+	}
+}
+
+func (b *bitReader) readBits(n uint) int32 {
+	if n == 0 {
+		return 0
+	}
+	if b.nbits < n {
+		b.fill()
+	}
+	v := int32(b.acc >> (32 - n))
+	b.acc <<= n
+	b.nbits -= n
+	return v
+}
+
+func (b *bitReader) decode(h *huffmanDecoder) (byte, error) {
+	if b.nbits < 16 {
+		b.fill()
+	}
+	if e := h.lut[b.acc>>(32-lutBits)]; e != 0 {
+		l := uint(e & 0xFF)
+		b.acc <<= l
+		b.nbits -= l
+		return byte(e >> 8), nil
+	}
+	code := int32(0)
+	for l := 1; l <= 16; l++ {
+		code = code<<1 | int32(b.acc>>31)
+		b.acc <<= 1
+		b.nbits--
+		if h.maxCode[l] >= 0 && code <= h.maxCode[l] && code >= h.minCode[l] {
+			return h.values[h.valPtr[l]+code-h.minCode[l]], nil
+		}
+	}
+	return 0, errHuffman
+}
+
+// receiveExtend reads s bits and sign-extends them (JPEG F.2.2.1)
+func (b *bitReader) receiveExtend(s uint) int32 {
+	if s == 0 {
+		return 0
+	}
+	v := b.readBits(s)
+	if v < 1<<(s-1) {
+		v += -1<<s + 1
+	}
+	return v
+}
+
+// restart consumes an RSTn marker and resets the reader state
+func (b *bitReader) restart() error {
+	b.acc, b.nbits, b.marker = 0, 0, false
+	for b.pos+1 < len(b.data) && b.data[b.pos] == 0xFF && b.data[b.pos+1] == 0xFF {
+		b.pos++
+	}
+	if b.pos+1 >= len(b.data) || b.data[b.pos] != 0xFF || b.data[b.pos+1] < 0xD0 || b.data[b.pos+1] > 0xD7 {
+		return errors.New("missing restart marker")
+	}
+	b.pos += 2
+	return nil
+}
+
+// bitWriter writes entropy-coded data with byte stuffing
+type bitWriter struct {
+	buf   *bytes.Buffer
+	acc   uint32
+	nbits uint
+}
+
+func (w *bitWriter) writeBits(v uint32, n uint) {
+	if n == 0 {
+		return
+	}
+	w.acc |= (v & (1<<n - 1)) << (32 - w.nbits - n)
+	w.nbits += n
+	for w.nbits >= 8 {
+		c := byte(w.acc >> 24)
+		w.buf.WriteByte(c)
+		if c == 0xFF {
+			w.buf.WriteByte(0x00)
+		}
+		w.acc <<= 8
+		w.nbits -= 8
+	}
+}
+
+// flush pads the final byte with one bits
+func (w *bitWriter) flush() {
+	if w.nbits > 0 {
+		w.writeBits(0x7F, 8-w.nbits)
+	}
+	w.acc, w.nbits = 0, 0
+}
+
+// magnitude returns the JPEG size category and the value bits of v
+func magnitude(v int32) (uint, uint32) {
+	a := v
+	if a < 0 {
+		a = -a
+		v--
+	}
+	s := uint(0)
+	for a > 0 {
+		s++
+		a >>= 1
+	}
+	return s, uint32(v)
+}
@@ -0,0 +1,397 @@
+package jpegcoef
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// JPEG marker codes
+const (
+	markerSOF0  = 0xC0
+	markerSOF1  = 0xC1
+	markerSOF2  = 0xC2
+	markerDHT   = 0xC4
+	markerSOF9  = 0xC9
+	markerSOF10 = 0xCA
+	markerDAC   = 0xCC
+	markerSOI   = 0xD8
+	markerEOI   = 0xD9
+	markerSOS   = 0xDA
+	markerDQT   = 0xDB
+	markerDRI   = 0xDD
+	markerAPP0  = 0xE0
+	markerAPPF  = 0xEF
+	markerCOM   = 0xFE
+)
+
+// decoder holds the parsing state of one Decode call
+type decoder struct {
+	data []byte
+	pos  int
+	img  *Image
+
+	frame bool
+	dc    [4]*huffmanDecoder
+	ac    [4]*huffmanDecoder
+
+	// conditioning holds the DAC parameters of the arithmetic decoder
+	conditioning arithConditioning
+}
+
+// Decode reads a sequential or progressive JPEG, Huffman or arithmetic
+// coded, into its quantized DCT coefficients
+func Decode(r io.Reader) (*Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JPEG: %w", err)
+	}
+	d := &decoder{data: data, img: &Image{}, conditioning: defaultConditioning()}
+	if err := d.decode(); err != nil {
+		return nil, err
+	}
+	return d.img, nil
+}
+
+func (d *decoder) decode() error {
+	if len(d.data) < 2 || d.data[0] != 0xFF || d.data[1] != markerSOI {
+		return errors.New("not a JPEG file (missing SOI)")
+	}
+	d.pos = 2
+
+	for {
+		marker, err := d.nextMarker()
+		if err != nil {
+			return err
+		}
+		if marker == markerEOI {
+			break
+		}
+		segment, err := d.segment()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case marker == markerSOF0 || marker == markerSOF1:
+			err = d.parseSOF(segment)
+		case marker == markerSOF2:
+			d.img.Progressive = true
+			err = d.parseSOF(segment)
+		case marker == markerSOF9:
+			d.img.Arithmetic = true
+			err = d.parseSOF(segment)
+		case marker == markerSOF10:
+			d.img.Progressive, d.img.Arithmetic = true, true
+			err = d.parseSOF(segment)
+		case marker >= 0xC3 && marker <= 0xCF && marker != markerDHT && marker != 0xC8 && marker != markerDAC:
+			err = fmt.Errorf("unsupported JPEG coding process (SOF%d)", marker-markerSOF0)
+		case marker == markerDAC:
+			err = d.conditioning.parse(segment)
+		case marker == markerDHT:
+			err = d.parseDHT(segment)
+		case marker == markerDQT:
+			err = d.parseDQT(segment)
+		case marker == markerDRI:
+			if len(segment) < 2 {
+				return errors.New("invalid DRI segment")
+			}
+			d.img.RestartInterval = int(binary.BigEndian.Uint16(segment))
+		case marker == markerSOS:
+			err = d.parseScan(segment)
+		case (marker >= markerAPP0 && marker <= markerAPPF) || marker == markerCOM:
+			d.img.Segments = append(d.img.Segments, Segment{Marker: marker, Data: append([]byte(nil), segment...)})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !d.frame {
+		return errors.New("no frame header found")
+	}
+	return nil
+}
+
+// nextMarker skips to the next marker and returns its code
+func (d *decoder) nextMarker() (byte, error) {
+	for d.pos < len(d.data) && d.data[d.pos] != 0xFF {
+		d.pos++
+	}
+	for d.pos < len(d.data) && d.data[d.pos] == 0xFF {
+		d.pos++
+	}
+	if d.pos >= len(d.data) {
+		if d.frame {
+			// Tolerate a missing EOI like libjpeg does
+			return markerEOI, nil
+		}
+		return 0, errors.New("unexpected end of JPEG data")
+	}
+	m := d.data[d.pos]
+	d.pos++
+	return m, nil
+}
+
+// segment returns the payload of the marker segment at the current position
+func (d *decoder) segment() ([]byte, error) {
+	if d.pos+2 > len(d.data) {
+		return nil, errors.New("truncated marker segment")
+	}
+	n := int(binary.BigEndian.Uint16(d.data[d.pos:]))
+	if n < 2 || d.pos+n > len(d.data) {
+		return nil, errors.New("invalid marker segment length")
+	}
+	s := d.data[d.pos+2 : d.pos+n]
+	d.pos += n
+	return s, nil
+}
+
+func (d *decoder) parseSOF(s []byte) error {
+	if d.frame {
+		return errors.New("multiple frame headers")
+	}
+	if len(s) < 6 {
+		return errors.New("invalid SOF segment")
+	}
+	img := d.img
+	img.Precision = int(s[0])
+	if img.Precision != 8 {
+		return fmt.Errorf("unsupported sample precision %d", img.Precision)
+	}
+	img.Height = int(binary.BigEndian.Uint16(s[1:]))
+	img.Width = int(binary.BigEndian.Uint16(s[3:]))
+	n := int(s[5])
+	if n < 1 || n > 4 || len(s) < 6+3*n {
+		return errors.New("invalid SOF component count")
+	}
+	img.Components = make([]Component, n)
+	for i := 0; i < n; i++ {
+		c := s[6+3*i:]
+		img.Components[i] = Component{ID: c[0], H: int(c[1] >> 4), V: int(c[1] & 15), Tq: int(c[2] & 3)}
+	}
+	if err := img.layout(); err != nil {
+		return err
+	}
+	d.frame = true
+	return nil
+}
+
+func (d *decoder) parseDHT(s []byte) error {
+	for len(s) > 0 {
+		if len(s) < 17 {
+			return errors.New("invalid DHT segment")
+		}
+		class, id := s[0]>>4, s[0]&15
+		if class > 1 || id > 3 {
+			return errors.New("invalid Huffman table id")
+		}
+		var spec huffmanSpec
+		copy(spec.counts[:], s[1:17])
+		total := 0
+		for _, c := range spec.counts {
+			total += int(c)
+		}
+		if len(s) < 17+total {
+			return errors.New("truncated DHT segment")
+		}
+		spec.values = append([]byte(nil), s[17:17+total]...)
+		h, err := newHuffmanDecoder(spec)
+		if err != nil {
+			return err
+		}
+		if class == 0 {
+			d.dc[id] = h
+		} else {
+			d.ac[id] = h
+		}
+		s = s[17+total:]
+	}
+	return nil
+}
+
+func (d *decoder) parseDQT(s []byte) error {
+	for len(s) > 0 {
+		pq, tq := s[0]>>4, s[0]&15
+		if tq > 3 || pq > 1 {
+			return errors.New("invalid DQT segment")
+		}
+		size := 64 * int(pq+1)
+		if len(s) < 1+size {
+			return errors.New("truncated DQT segment")
+		}
+		var t [64]uint16
+		for k := 0; k < 64; k++ {
+			if pq == 0 {
+				t[zigzag[k]] = uint16(s[1+k])
+			} else {
+				t[zigzag[k]] = binary.BigEndian.Uint16(s[1+2*k:])
+			}
+		}
+		d.img.QuantTables[tq] = &t
+		s = s[1+size:]
+	}
+	return nil
+}
+
+// scanHeader is a parsed SOS segment
+type scanHeader struct {
+	Scan
+	dcTable, acTable [4]int // table ids by component index
+}
+
+func (d *decoder) parseSOS(s []byte) (*scanHeader, error) {
+	if len(s) < 1 {
+		return nil, errors.New("invalid SOS segment")
+	}
+	n := int(s[0])
+	if n < 1 || n > 4 || len(s) < 1+2*n+3 {
+		return nil, errors.New("invalid SOS component count")
+	}
+	h := &scanHeader{}
+	for i := 0; i < n; i++ {
+		id, tables := s[1+2*i], s[2+2*i]
+		ci := -1
+		for j := range d.img.Components {
+			if d.img.Components[j].ID == id {
+				ci = j
+			}
+		}
+		if ci < 0 {
+			return nil, fmt.Errorf("scan references unknown component %d", id)
+		}
+		h.Components = append(h.Components, ci)
+		h.dcTable[ci], h.acTable[ci] = int(tables>>4&3), int(tables&3)
+	}
+	// Sequential scans always carry the whole block
+	h.Se = 63
+	if d.img.Progressive {
+		p := s[1+2*n:]
+		h.Ss, h.Se, h.Ah, h.Al = int(p[0]), int(p[1]), int(p[2]>>4), int(p[2]&15)
+		if err := h.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// entropyDecoder decodes the blocks of one scan
+type entropyDecoder interface {
+	decodeBlock(ci int, b *Block) error
+	restart() error
+	// end returns the position right after the data read so far
+	end() int
+}
+
+func (d *decoder) parseScan(s []byte) error {
+	if !d.frame {
+		return errors.New("scan before frame header")
+	}
+	h, err := d.parseSOS(s)
+	if err != nil {
+		return err
+	}
+	if d.img.Progressive {
+		d.img.Scans = append(d.img.Scans, h.Scan)
+	}
+
+	var dec entropyDecoder
+	switch {
+	case d.img.Arithmetic:
+		dec = newArithDecoder(d, h)
+	case d.img.Progressive:
+		dec, err = newProgressiveDecoder(d, h)
+	default:
+		dec, err = newSequentialDecoder(d, h)
+	}
+	if err != nil {
+		return err
+	}
+
+	lastMCU := -1
+	err = d.img.walkScan(h.Components, func(ci int, b *Block, mcu int) error {
+		if mcu != lastMCU && d.img.RestartInterval > 0 && mcu > 0 && mcu%d.img.RestartInterval == 0 {
+			if err := dec.restart(); err != nil {
+				return err
+			}
+		}
+		lastMCU = mcu
+		return dec.decodeBlock(ci, b)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Resume marker parsing right after the entropy-coded data
+	d.pos = dec.end()
+	for d.pos+1 < len(d.data) {
+		if d.data[d.pos] == 0xFF && d.data[d.pos+1] != 0x00 && (d.data[d.pos+1] < 0xD0 || d.data[d.pos+1] > 0xD7) && d.data[d.pos+1] != 0xFF {
+			break
+		}
+		d.pos++
+	}
+	return nil
+}
+
+// sequentialDecoder decodes sequential Huffman scans
+type sequentialDecoder struct {
+	br     *bitReader
+	dc, ac [4]*huffmanDecoder
+	pred   [4]int32
+}
+
+func newSequentialDecoder(d *decoder, h *scanHeader) (*sequentialDecoder, error) {
+	dec := &sequentialDecoder{br: &bitReader{data: d.data, pos: d.pos}}
+	for _, ci := range h.Components {
+		dec.dc[ci], dec.ac[ci] = d.dc[h.dcTable[ci]], d.ac[h.acTable[ci]]
+		if dec.dc[ci] == nil || dec.ac[ci] == nil {
+			return nil, errors.New("scan references undefined Huffman table")
+		}
+	}
+	return dec, nil
+}
+
+func (dec *sequentialDecoder) restart() error {
+	dec.pred = [4]int32{}
+	return dec.br.restart()
+}
+
+func (dec *sequentialDecoder) end() int {
+	return dec.br.pos
+}
+
+func (dec *sequentialDecoder) decodeBlock(ci int, b *Block) error {
+	br := dec.br
+	s, err := br.decode(dec.dc[ci])
+	if err != nil {
+		return err
+	}
+	if s > 11 {
+		return errHuffman
+	}
+	dec.pred[ci] += br.receiveExtend(uint(s))
+	b[0] = dec.pred[ci]
+
+	for k := 1; k < 64; {
+		rs, err := br.decode(dec.ac[ci])
+		if err != nil {
+			return err
+		}
+		r, s := int(rs>>4), uint(rs&15)
+		if s == 0 {
+			if r != 15 {
+				break
+			}
+			k += 16
+			continue
+		}
+		k += r
+		if k > 63 {
+			return errHuffman
+		}
+		b[zigzag[k]] = br.receiveExtend(s)
+		k++
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package jpegcoef
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encode writes img in the coding it was decoded with: sequential or
+// progressive (see Scans), Huffman or arithmetic coded. The coefficients
+// are written unchanged; Huffman tables are rebuilt (optimized) from the
+// coefficients so every value is representable.
+func (img *Image) Encode(w io.Writer) error {
+	if len(img.Components) == 0 || len(img.Components) > 4 {
+		return fmt.Errorf("invalid component count %d", len(img.Components))
+	}
+	for _, c := range img.Components {
+		if img.QuantTables[c.Tq] == nil {
+			return fmt.Errorf("component %d references undefined quantization table %d", c.ID, c.Tq)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, markerSOI})
+	for _, s := range img.Segments {
+		if err := writeSegment(&buf, s.Marker, s.Data); err != nil {
+			return err
+		}
+	}
+	img.writeDQT(&buf)
+	img.writeSOF(&buf)
+	if img.RestartInterval > 0 {
+		dri := binary.BigEndian.AppendUint16(nil, uint16(img.RestartInterval))
+		writeSegment(&buf, markerDRI, dri)
+	}
+
+	if err := img.writeScans(&buf); err != nil {
+		return err
+	}
+	buf.Write([]byte{0xFF, markerEOI})
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeSegment(buf *bytes.Buffer, marker byte, data []byte) error {
+	if len(data)+2 > 0xFFFF {
+		return fmt.Errorf("marker segment 0x%02X too long (%d bytes)", marker, len(data))
+	}
+	buf.Write([]byte{0xFF, marker})
+	binary.Write(buf, binary.BigEndian, uint16(len(data)+2))
+	buf.Write(data)
+	return nil
+}
+
+// extended reports whether any quantization table needs 16-bit precision
+func (img *Image) extended() bool {
+	for _, q := range img.QuantTables {
+		if q == nil {
+			continue
+		}
+		for _, v := range q {
+			if v > 255 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (img *Image) writeDQT(buf *bytes.Buffer) {
+	var data []byte
+	for id, q := range img.QuantTables {
+		if q == nil {
+			continue
+		}
+		wide := false
+		for _, v := range q {
+			wide = wide || v > 255
+		}
+		if wide {
+			data = append(data, 0x10|byte(id))
+			for k := 0; k < 64; k++ {
+				data = binary.BigEndian.AppendUint16(data, q[zigzag[k]])
+			}
+		} else {
+			data = append(data, byte(id))
+			for k := 0; k < 64; k++ {
+				data = append(data, byte(q[zigzag[k]]))
+			}
+		}
+	}
+	writeSegment(buf, markerDQT, data)
+}
+
+// writeScans writes the entropy-coded scans in the coding of img
+func (img *Image) writeScans(buf *bytes.Buffer) error {
+	var scans []Scan
+	if img.Progressive {
+		script, err := img.script()
+		if err != nil {
+			return err
+		}
+		scans = script
+	} else {
+		for _, group := range img.scans() {
+			scans = append(scans, Scan{Components: group, Se: 63})
+		}
+	}
+	for _, scan := range scans {
+		var err error
+		switch {
+		case img.Arithmetic:
+			err = img.writeArithScan(buf, scan)
+		case img.Progressive:
+			err = img.writeProgressiveScan(buf, scan)
+		default:
+			err = img.writeScan(buf, scan.Components)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (img *Image) writeSOF(buf *bytes.Buffer) {
+	marker := byte(markerSOF0)
+	switch {
+	case img.Arithmetic && img.Progressive:
+		marker = markerSOF10
+	case img.Arithmetic:
+		marker = markerSOF9
+	case img.Progressive:
+		marker = markerSOF2
+	case img.extended():
+		marker = markerSOF1
+	}
+	data := []byte{8}
+	data = binary.BigEndian.AppendUint16(data, uint16(img.Height))
+	data = binary.BigEndian.AppendUint16(data, uint16(img.Width))
+	data = append(data, byte(len(img.Components)))
+	for _, c := range img.Components {
+		data = append(data, c.ID, byte(c.H<<4|c.V), byte(c.Tq))
+	}
+	writeSegment(buf, marker, data)
+}
+
+// scans returns the component groups written as separate scans: a single
+// interleaved scan when the MCU allows it, one scan per component otherwise
+func (img *Image) scans() [][]int {
+	blocks := 0
+	for _, c := range img.Components {
+		blocks += c.H * c.V
+	}
+	if len(img.Components) > 1 && blocks <= 10 {
+		all := make([]int, len(img.Components))
+		for i := range all {
+			all[i] = i
+		}
+		return [][]int{all}
+	}
+	var out [][]int
+	for i := range img.Components {
+		out = append(out, []int{i})
+	}
+	return out
+}
+
+// tableFor returns the Huffman table slot used by component index i
+// (luminance gets table 0, chrominance shares table 1, as libjpeg does)
+func tableFor(i int) int {
+	if i == 0 {
+		return 0
+	}
+	return 1
+}
+
+// blockVisitor is called for each block of a scan in coding order; mcu is
+// the MCU index within the scan
+type blockVisitor func(ci int, b *Block, mcu int) error
+
+func (img *Image) walkScan(scan []int, visit blockVisitor) error {
+	if len(scan) == 1 {
+		c := &img.Components[scan[0]]
+		for by := 0; by < c.HeightInBlocks; by++ {
+			for bx := 0; bx < c.WidthInBlocks; bx++ {
+				if err := visit(scan[0], c.Block(bx, by), by*c.WidthInBlocks+bx); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for my := 0; my < img.mcusY; my++ {
+		for mx := 0; mx < img.mcusX; mx++ {
+			for _, ci := range scan {
+				c := &img.Components[ci]
+				for v := 0; v < c.V; v++ {
+					for h := 0; h < c.H; h++ {
+						if err := visit(ci, c.Block(mx*c.H+h, my*c.V+v), my*img.mcusX+mx); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (img *Image) writeScan(buf *bytes.Buffer, scan []int) error {
+	// Pass 1: gather symbol statistics
+	var dcFreq, acFreq [2][256]int64
+	preds := make([]int32, len(img.Components))
+	lastMCU := -1
+	err := img.walkScan(scan, func(ci int, b *Block, mcu int) error {
+		if mcu != lastMCU && img.RestartInterval > 0 && mcu%img.RestartInterval == 0 {
+			clear(preds)
+		}
+		lastMCU = mcu
+		t := tableFor(ci)
+		diff := b[0] - preds[ci]
+		preds[ci] = b[0]
+		s, _ := magnitude(diff)
+		if s > 11 {
+			return fmt.Errorf("DC difference %d out of range", diff)
+		}
+		dcFreq[t][s]++
+		return forEachAC(b, func(r int, s uint, _ uint32) {
+			acFreq[t][byte(r<<4)|byte(s)]++
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	var dcEnc, acEnc [2]*huffmanEncoder
+	var dht []byte
+	for t := 0; t < 2; t++ {
+		if !usesTable(scan, t) {
+			continue
+		}
+		for class, freq := range [][256]int64{dcFreq[t], acFreq[t]} {
+			spec, err := optimalSpec(&freq)
+			if err != nil {
+				return err
+			}
+			dht = append(dht, byte(class<<4|t))
+			dht = append(dht, spec.counts[:]...)
+			dht = append(dht, spec.values...)
+			if class == 0 {
+				dcEnc[t] = newHuffmanEncoder(spec)
+			} else {
+				acEnc[t] = newHuffmanEncoder(spec)
+			}
+		}
+	}
+	writeSegment(buf, markerDHT, dht)
+
+	img.writeSOS(buf, Scan{Components: scan, Se: 63})
+
+	// Pass 2: emit entropy-coded data
+	bw := &bitWriter{buf: buf}
+	clear(preds)
+	lastMCU = -1
+	restarts := 0
+	err = img.walkScan(scan, func(ci int, b *Block, mcu int) error {
+		if mcu != lastMCU && img.RestartInterval > 0 && mcu > 0 && mcu%img.RestartInterval == 0 {
+			bw.flush()
+			buf.Write([]byte{0xFF, byte(0xD0 + restarts%8)})
+			restarts++
+			clear(preds)
+		}
+		lastMCU = mcu
+		t := tableFor(ci)
+		diff := b[0] - preds[ci]
+		preds[ci] = b[0]
+		s, bits := magnitude(diff)
+		bw.writeBits(uint32(dcEnc[t].code[s]), uint(dcEnc[t].size[s]))
+		bw.writeBits(bits, s)
+		return forEachAC(b, func(r int, s uint, bits uint32) {
+			sym := byte(r<<4) | byte(s)
+			bw.writeBits(uint32(acEnc[t].code[sym]), uint(acEnc[t].size[sym]))
+			bw.writeBits(bits, s)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	bw.flush()
+	return nil
+}
+
+// writeSOS writes the header of scan, each component using the tables of
+// tableFor
+func (img *Image) writeSOS(buf *bytes.Buffer, scan Scan) {
+	sos := []byte{byte(len(scan.Components))}
+	for _, ci := range scan.Components {
+		t := byte(tableFor(ci))
+		sos = append(sos, img.Components[ci].ID, t<<4|t)
+	}
+	sos = append(sos, byte(scan.Ss), byte(scan.Se), byte(scan.Ah<<4|scan.Al))
+	writeSegment(buf, markerSOS, sos)
+}
+
+func usesTable(scan []int, t int) bool {
+	for _, ci := range scan {
+		if tableFor(ci) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachAC emits the run/size symbols of the AC coefficients of b,
+// including ZRL (r=15,s=0) and EOB (r=0,s=0)
+func forEachAC(b *Block, emit func(r int, s uint, bits uint32)) error {
+	run := 0
+	for k := 1; k < 64; k++ {
+		v := b[zigzag[k]]
+		if v == 0 {
+			run++
+			continue
+		}
+		for run > 15 {
+			emit(15, 0, 0)
+			run -= 16
+		}
+		s, bits := magnitude(v)
+		if s > 10 {
+			return errors.New("AC coefficient out of range")
+		}
+		emit(run, s, bits)
+		run = 0
+	}
+	if run > 0 {
+		emit(0, 0, 0)
+	}
+	return nil
+}
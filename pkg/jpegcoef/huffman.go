@@ -0,0 +1,177 @@
+package jpegcoef
+
+import (
+	"errors"
+	"fmt"
+)
+
+// huffmanSpec is a table as carried in a DHT segment
+type huffmanSpec struct {
+	counts [16]byte // number of codes of each length 1..16
+	values []byte
+}
+
+// lutBits is the size of the fast decoding lookup
+const lutBits = 9
+
+// huffmanDecoder decodes symbols of one table
+type huffmanDecoder struct {
+	// lut[peek] = symbol<<8 | length, 0 when the code is longer than lutBits
+	lut     [1 << lutBits]uint16
+	maxCode [17]int32
+	valPtr  [17]int32
+	minCode [17]int32
+	values  []byte
+}
+
+func newHuffmanDecoder(spec huffmanSpec) (*huffmanDecoder, error) {
+	d := &huffmanDecoder{values: spec.values}
+	total := 0
+	for _, n := range spec.counts {
+		total += int(n)
+	}
+	if total != len(spec.values) || total > 256 {
+		return nil, errors.New("invalid Huffman table")
+	}
+
+	code, k := int32(0), int32(0)
+	for l := 1; l <= 16; l++ {
+		n := int32(spec.counts[l-1])
+		// Checked before the codes are placed, which would overrun lut
+		if code+n > 1<<l {
+			return nil, errors.New("over-subscribed Huffman table")
+		}
+		if n == 0 {
+			d.maxCode[l] = -1
+		} else {
+			d.valPtr[l] = k
+			d.minCode[l] = code
+			for i := int32(0); i < n; i++ {
+				if l <= lutBits {
+					shift := uint(lutBits - l)
+					base := (code + i) << shift
+					for j := int32(0); j < 1<<shift; j++ {
+						d.lut[base+j] = uint16(spec.values[k+i])<<8 | uint16(l)
+					}
+				}
+			}
+			code += n
+			k += n
+			d.maxCode[l] = code - 1
+		}
+		code <<= 1
+	}
+	return d, nil
+}
+
+// huffmanEncoder maps symbols to codes
+type huffmanEncoder struct {
+	code [256]uint16
+	size [256]byte
+}
+
+func newHuffmanEncoder(spec huffmanSpec) *huffmanEncoder {
+	e := &huffmanEncoder{}
+	code, k := uint16(0), 0
+	for l := 1; l <= 16; l++ {
+		for i := 0; i < int(spec.counts[l-1]); i++ {
+			v := spec.values[k]
+			e.code[v] = code
+			e.size[v] = byte(l)
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return e
+}
+
+// optimalSpec builds a length-limited Huffman table from symbol frequencies
+// (JPEG Annex K.2, same procedure as libjpeg's jpeg_gen_optimal_table)
+func optimalSpec(freqIn *[256]int64) (huffmanSpec, error) {
+	var freq [257]int64
+	copy(freq[:], freqIn[:])
+	freq[256] = 1 // reserve one code point so no code is all ones
+
+	var codesize [257]int
+	var others [257]int
+	for i := range others {
+		others[i] = -1
+	}
+
+	for {
+		c1, c2 := -1, -1
+		var v int64 = 1 << 62
+		for i := 0; i <= 256; i++ {
+			if freq[i] != 0 && freq[i] <= v {
+				v = freq[i]
+				c1 = i
+			}
+		}
+		v = 1 << 62
+		for i := 0; i <= 256; i++ {
+			if freq[i] != 0 && freq[i] <= v && i != c1 {
+				v = freq[i]
+				c2 = i
+			}
+		}
+		if c2 < 0 {
+			break
+		}
+		freq[c1] += freq[c2]
+		freq[c2] = 0
+
+		codesize[c1]++
+		for others[c1] >= 0 {
+			c1 = others[c1]
+			codesize[c1]++
+		}
+		others[c1] = c2
+		codesize[c2]++
+		for others[c2] >= 0 {
+			c2 = others[c2]
+			codesize[c2]++
+		}
+	}
+
+	var bits [33]int
+	for i := 0; i <= 256; i++ {
+		if codesize[i] > 0 {
+			if codesize[i] > 32 {
+				return huffmanSpec{}, fmt.Errorf("Huffman code length %d overflow", codesize[i])
+			}
+			bits[codesize[i]]++
+		}
+	}
+
+	for i := 32; i > 16; i-- {
+		for bits[i] > 0 {
+			j := i - 2
+			for bits[j] == 0 {
+				j--
+			}
+			bits[i] -= 2
+			bits[i-1]++
+			bits[j+1] += 2
+			bits[j]--
+		}
+	}
+	i := 16
+	for bits[i] == 0 {
+		i--
+	}
+	bits[i]-- // drop the reserved code point
+
+	var spec huffmanSpec
+	for l := 1; l <= 16; l++ {
+		spec.counts[l-1] = byte(bits[l])
+	}
+	for l := 1; l <= 32; l++ {
+		for s := 0; s < 256; s++ {
+			if codesize[s] == l {
+				spec.values = append(spec.values, byte(s))
+			}
+		}
+	}
+	return spec, nil
+}
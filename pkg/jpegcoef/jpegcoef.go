@@ -0,0 +1,215 @@
+// Package jpegcoef reads sequential and progressive JPEG files, Huffman or
+// arithmetic coded, into their quantized DCT coefficients and writes them
+// back without loss in the same coding. It is a pure-Go replacement for
+// libjpeg's jpeg_read_coefficients / jpeg_write_coefficients pair.
+//
+// Coefficients are stored per 8x8 block in natural (row-major) order, the
+// same layout as libjpeg's JBLOCK, so index 1 is the first horizontal AC
+// coefficient and index 8 the first vertical one.
+package jpegcoef
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Block holds the 64 quantized coefficients of one 8x8 block (natural order)
+type Block [64]int32
+
+// Component is one colour channel of the image (Y, Cb or Cr for JFIF)
+type Component struct {
+	ID    byte
+	H, V  int // sampling factors
+	Tq    int // quantization table index
+	Width int // component width in samples
+	// Height is the component height in samples
+	Height int
+
+	// WidthInBlocks and HeightInBlocks match libjpeg's
+	// comp_info[i].width_in_blocks / height_in_blocks
+	WidthInBlocks  int
+	HeightInBlocks int
+
+	// BlocksPerLine and BlockLines are the allocated (MCU padded) dimensions
+	BlocksPerLine int
+	BlockLines    int
+
+	Blocks []Block
+}
+
+// Block returns the block at block coordinates (bx, by)
+func (c *Component) Block(bx, by int) *Block {
+	return &c.Blocks[by*c.BlocksPerLine+bx]
+}
+
+// Segment is a marker segment kept verbatim (APPn, COM)
+type Segment struct {
+	Marker byte
+	Data   []byte
+}
+
+// Scan is one pass over the coefficients of a progressive file: the
+// zigzag band Ss..Se of the listed components, at bit position Al. Ah is
+// the position of the previous pass over the band, 0 for the first one.
+type Scan struct {
+	Components []int // indices into Image.Components
+	Ss, Se     int
+	Ah, Al     int
+}
+
+// validate checks a progressive scan against ITU T.81 G.1.1
+func (s Scan) validate() error {
+	switch {
+	case len(s.Components) == 0 || len(s.Components) > 4:
+		return fmt.Errorf("invalid scan component count %d", len(s.Components))
+	case s.Ss > s.Se || s.Se > 63:
+		return fmt.Errorf("invalid spectral selection %d-%d", s.Ss, s.Se)
+	case s.Ss == 0 && s.Se != 0:
+		return errors.New("progressive DC scan carries AC coefficients")
+	case s.Ss > 0 && len(s.Components) != 1:
+		return errors.New("progressive AC scan with several components")
+	case s.Al > 13 || (s.Ah != 0 && s.Ah != s.Al+1):
+		return fmt.Errorf("invalid successive approximation %d/%d", s.Ah, s.Al)
+	}
+	return nil
+}
+
+// Image is a decoded JPEG in the coefficient domain
+type Image struct {
+	Width, Height int
+	Precision     int
+
+	Components []Component
+
+	// QuantTables are indexed by table id and stored in natural order;
+	// nil entries are undefined tables
+	QuantTables [4]*[64]uint16
+
+	// RestartInterval is the number of MCUs between restart markers (0 = none)
+	RestartInterval int
+
+	// Progressive and Arithmetic describe the coding of the decoded file.
+	// Encode writes the same coding, so a progressive cover stays progressive.
+	Progressive bool
+	Arithmetic  bool
+
+	// Scans is the scan script of a progressive file. Encode reuses it;
+	// nil falls back to libjpeg's jpeg_simple_progression script.
+	Scans []Scan
+
+	// Segments are the APPn and COM segments in file order
+	Segments []Segment
+
+	hmax, vmax   int
+	mcusX, mcusY int
+}
+
+// DecodeFile reads the JPEG at path
+func DecodeFile(path string) (*Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JPEG: %w", err)
+	}
+	return Decode(bytes.NewReader(data))
+}
+
+// EncodeFile writes img to path
+func (img *Image) EncodeFile(path string) error {
+	var buf bytes.Buffer
+	if err := img.Encode(&buf); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write JPEG: %w", err)
+	}
+	return nil
+}
+
+// QuantTable returns the quantization table used by component c
+func (img *Image) QuantTable(c int) *[64]uint16 {
+	return img.QuantTables[img.Components[c].Tq]
+}
+
+// Clone returns a deep copy of img
+func (img *Image) Clone() *Image {
+	out := *img
+	out.Components = make([]Component, len(img.Components))
+	for i, c := range img.Components {
+		c.Blocks = append([]Block(nil), c.Blocks...)
+		out.Components[i] = c
+	}
+	for i, q := range img.QuantTables {
+		if q != nil {
+			t := *q
+			out.QuantTables[i] = &t
+		}
+	}
+	out.Scans = make([]Scan, len(img.Scans))
+	for i, scan := range img.Scans {
+		scan.Components = append([]int(nil), scan.Components...)
+		out.Scans[i] = scan
+	}
+	out.Segments = make([]Segment, len(img.Segments))
+	for i, s := range img.Segments {
+		out.Segments[i] = Segment{Marker: s.Marker, Data: append([]byte(nil), s.Data...)}
+	}
+	return &out
+}
+
+// maxBlocks bounds the blocks of all components of one image (128 bytes
+// each), so a forged frame header cannot exhaust memory
+var maxBlocks = 1 << 23
+
+// layout computes the MCU geometry and allocates block storage
+func (img *Image) layout() error {
+	if img.Width <= 0 || img.Height <= 0 {
+		return fmt.Errorf("invalid image dimensions %dx%d", img.Width, img.Height)
+	}
+	img.hmax, img.vmax = 1, 1
+	for _, c := range img.Components {
+		if c.H < 1 || c.H > 4 || c.V < 1 || c.V > 4 {
+			return fmt.Errorf("invalid sampling factors %dx%d", c.H, c.V)
+		}
+		img.hmax = max(img.hmax, c.H)
+		img.vmax = max(img.vmax, c.V)
+	}
+	img.mcusX = ceilDiv(img.Width, 8*img.hmax)
+	img.mcusY = ceilDiv(img.Height, 8*img.vmax)
+	blocks := 0
+	for _, c := range img.Components {
+		blocks += img.mcusX * c.H * img.mcusY * c.V
+	}
+	if blocks > maxBlocks {
+		return fmt.Errorf("image too large: %dx%d needs %d blocks, at most %d are supported",
+			img.Width, img.Height, blocks, maxBlocks)
+	}
+	for i := range img.Components {
+		c := &img.Components[i]
+		c.Width = ceilDiv(img.Width*c.H, img.hmax)
+		c.Height = ceilDiv(img.Height*c.V, img.vmax)
+		c.WidthInBlocks = ceilDiv(img.Width*c.H, img.hmax*8)
+		c.HeightInBlocks = ceilDiv(img.Height*c.V, img.vmax*8)
+		c.BlocksPerLine = img.mcusX * c.H
+		c.BlockLines = img.mcusY * c.V
+		c.Blocks = make([]Block, c.BlocksPerLine*c.BlockLines)
+	}
+	return nil
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+// zigzag maps zigzag scan position to natural order index
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
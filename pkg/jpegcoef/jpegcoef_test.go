@@ -0,0 +1,390 @@
+package jpegcoef
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testJPEG renders a deterministic textured image and encodes it with the
+// standard library encoder (baseline, 4:2:0 for colour)
+func testJPEG(t testing.TB, w, h int, gray bool, quality int) []byte {
+	t.Helper()
+	var img image.Image
+	if gray {
+		g := image.NewGray(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				g.SetGray(x, y, color.Gray{Y: uint8((x*7 + y*13 + x*y) % 256)})
+			}
+		}
+		img = g
+	} else {
+		c := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				c.Set(x, y, color.RGBA{R: uint8((x*x + y) % 256), G: uint8((x + y*3) % 256), B: uint8((x ^ y) % 256), A: 255})
+			}
+		}
+		img = c
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatalf("failed to encode test JPEG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func sameCoefficients(t *testing.T, a, b *Image) {
+	t.Helper()
+	if a.Width != b.Width || a.Height != b.Height || len(a.Components) != len(b.Components) {
+		t.Fatalf("geometry mismatch: %dx%d/%d vs %dx%d/%d", a.Width, a.Height, len(a.Components), b.Width, b.Height, len(b.Components))
+	}
+	for ci := range a.Components {
+		ca, cb := &a.Components[ci], &b.Components[ci]
+		for by := 0; by < ca.HeightInBlocks; by++ {
+			for bx := 0; bx < ca.WidthInBlocks; bx++ {
+				if *ca.Block(bx, by) != *cb.Block(bx, by) {
+					t.Fatalf("component %d block (%d,%d) differs", ci, bx, by)
+				}
+			}
+		}
+		if *a.QuantTable(ci) != *b.QuantTable(ci) {
+			t.Fatalf("component %d quantization table differs", ci)
+		}
+	}
+}
+
+func TestRoundTripIsLossless(t *testing.T) {
+	tests := []struct {
+		name    string
+		w, h    int
+		gray    bool
+		quality int
+	}{
+		{"Gray", 64, 48, true, 90},
+		{"GrayOddSize", 61, 37, true, 75},
+		{"Color", 96, 64, false, 90},
+		{"ColorOddSize", 101, 77, false, 50},
+		{"ColorHighQuality", 40, 40, false, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := testJPEG(t, tt.w, tt.h, tt.gray, tt.quality)
+
+			img, err := Decode(bytes.NewReader(src))
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			if img.Width != tt.w || img.Height != tt.h {
+				t.Fatalf("expected %dx%d, got %dx%d", tt.w, tt.h, img.Width, img.Height)
+			}
+
+			var out bytes.Buffer
+			if err := img.Encode(&out); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+
+			again, err := Decode(bytes.NewReader(out.Bytes()))
+			if err != nil {
+				t.Fatalf("Decode of re-encoded image failed: %v", err)
+			}
+			sameCoefficients(t, img, again)
+
+			// Same coefficients and tables must give identical pixels
+			want, err := jpeg.Decode(bytes.NewReader(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := jpeg.Decode(bytes.NewReader(out.Bytes()))
+			if err != nil {
+				t.Fatalf("standard decoder rejected re-encoded image: %v", err)
+			}
+			b := want.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if want.At(x, y) != got.At(x, y) {
+						t.Fatalf("pixel (%d,%d) differs after round trip", x, y)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRoundTripWithRestartMarkers(t *testing.T) {
+	img, err := Decode(bytes.NewReader(testJPEG(t, 80, 56, false, 85)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.RestartInterval = 3
+
+	var out bytes.Buffer
+	if err := img.Encode(&out); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if !bytes.Contains(out.Bytes(), []byte{0xFF, 0xD0}) {
+		t.Fatal("expected restart markers in output")
+	}
+
+	again, err := Decode(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if again.RestartInterval != 3 {
+		t.Errorf("expected restart interval 3, got %d", again.RestartInterval)
+	}
+	sameCoefficients(t, img, again)
+
+	if _, err := jpeg.Decode(bytes.NewReader(out.Bytes())); err != nil {
+		t.Fatalf("standard decoder rejected restart markers: %v", err)
+	}
+}
+
+func TestModifiedCoefficientsSurviveEncoding(t *testing.T) {
+	img, err := Decode(bytes.NewReader(testJPEG(t, 64, 64, false, 80)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flip LSBs the way an embedder would, including zero -> one changes
+	y := &img.Components[0]
+	for i := range y.Blocks {
+		y.Blocks[i][1] ^= 1
+		y.Blocks[i][63] = -3
+	}
+
+	var out bytes.Buffer
+	if err := img.Encode(&out); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	again, err := Decode(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameCoefficients(t, img, again)
+}
+
+func TestSegmentsArePreserved(t *testing.T) {
+	img, err := Decode(bytes.NewReader(testJPEG(t, 16, 16, true, 90)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.Segments = append(img.Segments, Segment{Marker: markerCOM, Data: []byte("hello")})
+
+	var out bytes.Buffer
+	if err := img.Encode(&out); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Decode(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Segments) != len(img.Segments) {
+		t.Fatalf("expected %d segments, got %d", len(img.Segments), len(again.Segments))
+	}
+	last := again.Segments[len(again.Segments)-1]
+	if last.Marker != markerCOM || string(last.Data) != "hello" {
+		t.Errorf("comment segment not preserved: %+v", last)
+	}
+}
+
+func TestDecodeRejectsGarbage(t *testing.T) {
+	if _, err := Decode(bytes.NewReader([]byte("not a jpeg"))); err == nil {
+		t.Error("expected error for non-JPEG input")
+	}
+	src := testJPEG(t, 32, 32, true, 90)
+	if _, err := Decode(bytes.NewReader(src[:len(src)/3])); err == nil {
+		t.Error("expected error for truncated input")
+	}
+}
+
+func TestDecodeRejectsHostileHeaders(t *testing.T) {
+	// Three 1-bit codes: placing the third overran the lookup table
+	if _, err := newHuffmanDecoder(huffmanSpec{counts: [16]byte{3}, values: []byte{1, 2, 3}}); err == nil {
+		t.Error("expected an over-subscribed table to be rejected")
+	}
+
+	// A 65535x65535 frame header is refused before its blocks are allocated
+	src := testJPEG(t, 16, 16, false, 90)
+	sof := bytes.Index(src, []byte{0xFF, markerSOF0})
+	forged := bytes.Clone(src)
+	copy(forged[sof+5:], []byte{0xFF, 0xFF, 0xFF, 0xFF})
+	if _, err := Decode(bytes.NewReader(forged)); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("expected a size error, got %v", err)
+	}
+}
+
+// FuzzDecode checks that no input panics the decoder or the encoder
+func FuzzDecode(f *testing.F) {
+	for _, coding := range [][2]bool{{false, false}, {true, false}, {false, true}, {true, true}} {
+		img, err := Decode(bytes.NewReader(testJPEG(f, 32, 24, false, 75)))
+		if err != nil {
+			f.Fatal(err)
+		}
+		img.Progressive, img.Arithmetic, img.RestartInterval = coding[0], coding[1], 2
+		var buf bytes.Buffer
+		if err := img.Encode(&buf); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+	}
+	f.Add(testJPEG(f, 16, 16, true, 95))
+	saved := maxBlocks
+	maxBlocks = 1 << 14 // keep forged frames cheap
+	f.Cleanup(func() { maxBlocks = saved })
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		img, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		img.Encode(io.Discard)
+	})
+}
+
+func TestStripAndReplaceSegments(t *testing.T) {
+	img, err := Decode(bytes.NewReader(testJPEG(t, 16, 16, true, 90)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exif := Segment{Marker: markerAPP0 + 1, Data: []byte("Exif\x00\x00cover")}
+	icc := Segment{Marker: markerAPP0 + 2, Data: []byte("ICC_PROFILE\x00\x01\x01cover")}
+	img.Segments = []Segment{exif, icc, {Marker: markerCOM, Data: []byte("note")}}
+
+	kinds := []string{SegmentEXIF, SegmentICC, SegmentComment}
+	for i, s := range img.Segments {
+		if s.Kind() != kinds[i] {
+			t.Errorf("segment %d: expected kind %s, got %s", i, kinds[i], s.Kind())
+		}
+	}
+
+	donor := &Image{Segments: []Segment{{Marker: markerAPP0 + 1, Data: []byte("Exif\x00\x00donor")}}}
+	img.ReplaceSegments(donor, SegmentEXIF)
+	if len(img.Segments) != 3 || string(img.Segments[0].Data) != "Exif\x00\x00donor" {
+		t.Errorf("expected the donor EXIF in place of the cover one, got %+v", img.Segments)
+	}
+
+	if n := img.StripSegments(SegmentICC, SegmentComment); n != 2 || len(img.Segments) != 1 {
+		t.Errorf("expected 2 segments stripped leaving 1, got %d leaving %d", n, len(img.Segments))
+	}
+	if n := img.StripSegments("all"); n != 1 || len(img.Segments) != 0 {
+		t.Errorf("expected all segments stripped, %d left", len(img.Segments))
+	}
+
+	if _, err := ParseSegmentKinds("exif, app13"); err != nil {
+		t.Error(err)
+	}
+	for _, bad := range []string{"gps", "app16", "app-1"} {
+		if _, err := ParseSegmentKinds(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestScanModesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name                    string
+		progressive, arithmetic bool
+	}{
+		{"Progressive", true, false},
+		{"Arithmetic", false, true},
+		{"ProgressiveArithmetic", true, true},
+	}
+
+	for _, tt := range tests {
+		for _, restart := range []int{0, 3} {
+			t.Run(fmt.Sprintf("%s/Restart%d", tt.name, restart), func(t *testing.T) {
+				src := testJPEG(t, 101, 77, false, 80)
+				img, err := Decode(bytes.NewReader(src))
+				if err != nil {
+					t.Fatal(err)
+				}
+				img.Progressive, img.Arithmetic, img.RestartInterval = tt.progressive, tt.arithmetic, restart
+
+				var out bytes.Buffer
+				if err := img.Encode(&out); err != nil {
+					t.Fatalf("Encode failed: %v", err)
+				}
+				again, err := Decode(bytes.NewReader(out.Bytes()))
+				if err != nil {
+					t.Fatalf("Decode failed: %v", err)
+				}
+				if again.Progressive != tt.progressive || again.Arithmetic != tt.arithmetic || again.RestartInterval != restart {
+					t.Fatalf("expected progressive=%v arithmetic=%v restart=%d, got %v %v %d",
+						tt.progressive, tt.arithmetic, restart, again.Progressive, again.Arithmetic, again.RestartInterval)
+				}
+				sameCoefficients(t, img, again)
+
+				// A second round trip keeps the coding and the scan script
+				var out2 bytes.Buffer
+				if err := again.Encode(&out2); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(out.Bytes(), out2.Bytes()) {
+					t.Error("re-encoding a decoded file changed its bytes")
+				}
+
+				// The standard decoder reads progressive Huffman files, but not
+				// with restart markers (it rejects libjpeg's as well)
+				if tt.arithmetic || restart > 0 {
+					return
+				}
+				want, err := jpeg.Decode(bytes.NewReader(src))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := jpeg.Decode(bytes.NewReader(out.Bytes()))
+				if err != nil {
+					t.Fatalf("standard decoder rejected progressive output: %v", err)
+				}
+				b := want.Bounds()
+				for y := b.Min.Y; y < b.Max.Y; y++ {
+					for x := b.Min.X; x < b.Max.X; x++ {
+						if want.At(x, y) != got.At(x, y) {
+							t.Fatalf("pixel (%d,%d) differs from the baseline decode", x, y)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestProgressiveScriptIsKept(t *testing.T) {
+	img, err := Decode(bytes.NewReader(testJPEG(t, 64, 48, true, 85)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.Progressive = true
+	img.Scans = []Scan{
+		{Components: []int{0}},
+		{Components: []int{0}, Ss: 1, Se: 9, Al: 1},
+		{Components: []int{0}, Ss: 10, Se: 63},
+		{Components: []int{0}, Ss: 1, Se: 9, Ah: 1},
+	}
+
+	var out bytes.Buffer
+	if err := img.Encode(&out); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	again, err := Decode(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	sameCoefficients(t, img, again)
+	if !reflect.DeepEqual(again.Scans, img.Scans) {
+		t.Errorf("expected script %v, got %v", img.Scans, again.Scans)
+	}
+
+	img.Scans = []Scan{{Components: []int{0}, Ss: 0, Se: 63}}
+	if err := img.Encode(io.Discard); err == nil {
+		t.Error("expected an error for a DC scan carrying AC coefficients")
+	}
+}
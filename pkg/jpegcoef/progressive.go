@@ -0,0 +1,471 @@
+package jpegcoef
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// maxCorrectionBits bounds the refinement bits buffered behind an EOB run,
+// as libjpeg's MAX_CORR_BITS
+const maxCorrectionBits = 1000
+
+// progressiveDecoder decodes progressive Huffman scans (ITU T.81 G.2),
+// following libjpeg's jdphuff.c
+type progressiveDecoder struct {
+	scanHeader
+	br     *bitReader
+	dc, ac [4]*huffmanDecoder
+	pred   [4]int32
+	eobrun int
+}
+
+func newProgressiveDecoder(d *decoder, h *scanHeader) (*progressiveDecoder, error) {
+	dec := &progressiveDecoder{scanHeader: *h, br: &bitReader{data: d.data, pos: d.pos}}
+	for _, ci := range h.Components {
+		switch {
+		case h.Ss == 0 && h.Ah == 0:
+			dec.dc[ci] = d.dc[h.dcTable[ci]]
+			if dec.dc[ci] == nil {
+				return nil, errors.New("scan references undefined Huffman table")
+			}
+		case h.Ss > 0:
+			dec.ac[ci] = d.ac[h.acTable[ci]]
+			if dec.ac[ci] == nil {
+				return nil, errors.New("scan references undefined Huffman table")
+			}
+		}
+	}
+	return dec, nil
+}
+
+func (dec *progressiveDecoder) restart() error {
+	dec.pred, dec.eobrun = [4]int32{}, 0
+	return dec.br.restart()
+}
+
+func (dec *progressiveDecoder) end() int {
+	return dec.br.pos
+}
+
+func (dec *progressiveDecoder) decodeBlock(ci int, b *Block) error {
+	switch {
+	case dec.Ss == 0 && dec.Ah == 0:
+		s, err := dec.br.decode(dec.dc[ci])
+		if err != nil {
+			return err
+		}
+		if s > 11 {
+			return errHuffman
+		}
+		dec.pred[ci] += dec.br.receiveExtend(uint(s))
+		b[0] = dec.pred[ci] << dec.Al
+	case dec.Ss == 0:
+		if dec.br.readBits(1) != 0 {
+			b[0] |= 1 << dec.Al
+		}
+	case dec.Ah == 0:
+		return dec.decodeACFirst(dec.ac[ci], b)
+	default:
+		return dec.decodeACRefine(dec.ac[ci], b)
+	}
+	return nil
+}
+
+// readEOBRun reads the run length of an EOBr symbol
+func (dec *progressiveDecoder) readEOBRun(r int) {
+	dec.eobrun = 1 << r
+	if r > 0 {
+		dec.eobrun += int(dec.br.readBits(uint(r)))
+	}
+}
+
+func (dec *progressiveDecoder) decodeACFirst(h *huffmanDecoder, b *Block) error {
+	if dec.eobrun > 0 {
+		dec.eobrun--
+		return nil
+	}
+	for k := dec.Ss; k <= dec.Se; k++ {
+		rs, err := dec.br.decode(h)
+		if err != nil {
+			return err
+		}
+		r, s := int(rs>>4), uint(rs&15)
+		if s == 0 {
+			if r != 15 {
+				dec.readEOBRun(r)
+				dec.eobrun--
+				return nil
+			}
+			k += 15
+			continue
+		}
+		k += r
+		if k > 63 {
+			return errHuffman
+		}
+		b[zigzag[k]] = dec.br.receiveExtend(s) << dec.Al
+	}
+	return nil
+}
+
+func (dec *progressiveDecoder) decodeACRefine(h *huffmanDecoder, b *Block) error {
+	p1, m1 := int32(1)<<dec.Al, int32(-1)<<dec.Al
+	// refine appends the correction bit of an already nonzero coefficient
+	refine := func(c *int32) {
+		if dec.br.readBits(1) != 0 && *c&p1 == 0 {
+			if *c >= 0 {
+				*c += p1
+			} else {
+				*c += m1
+			}
+		}
+	}
+
+	k := dec.Ss
+	if dec.eobrun == 0 {
+		for ; k <= dec.Se; k++ {
+			rs, err := dec.br.decode(h)
+			if err != nil {
+				return err
+			}
+			r, s := int(rs>>4), int32(0)
+			switch rs & 15 {
+			case 0:
+				if r != 15 {
+					dec.readEOBRun(r)
+				}
+			case 1:
+				s = m1
+				if dec.br.readBits(1) != 0 {
+					s = p1
+				}
+			default:
+				return errHuffman
+			}
+			if dec.eobrun > 0 {
+				break
+			}
+			// Skip r zero coefficients, refining the nonzero ones on the way
+			for ; k <= dec.Se; k++ {
+				c := &b[zigzag[k]]
+				if *c != 0 {
+					refine(c)
+				} else {
+					if r == 0 {
+						break
+					}
+					r--
+				}
+			}
+			if s != 0 {
+				if k > dec.Se {
+					return errHuffman
+				}
+				b[zigzag[k]] = s
+			}
+		}
+	}
+	if dec.eobrun > 0 {
+		for ; k <= dec.Se; k++ {
+			if c := &b[zigzag[k]]; *c != 0 {
+				refine(c)
+			}
+		}
+		dec.eobrun--
+	}
+	return nil
+}
+
+// defaultScript returns libjpeg's jpeg_simple_progression script for img
+func (img *Image) defaultScript() []Scan {
+	dc := img.scans()
+	n := len(img.Components)
+	var script []Scan
+	dcPass := func(ah, al int) {
+		for _, group := range dc {
+			script = append(script, Scan{Components: group, Ah: ah, Al: al})
+		}
+	}
+	acPass := func(order []int, ss, se, ah, al int) {
+		for _, ci := range order {
+			script = append(script, Scan{Components: []int{ci}, Ss: ss, Se: se, Ah: ah, Al: al})
+		}
+	}
+	if n == 3 {
+		// Custom script for YCbCr: chroma goes in one pass per bit
+		dcPass(0, 1)
+		acPass([]int{0}, 1, 5, 0, 2)
+		acPass([]int{2, 1}, 1, 63, 0, 1)
+		acPass([]int{0}, 6, 63, 0, 2)
+		acPass([]int{0}, 1, 63, 2, 1)
+		dcPass(1, 0)
+		acPass([]int{2, 1, 0}, 1, 63, 1, 0)
+		return script
+	}
+	all := make([]int, n)
+	for i := range all {
+		all[i] = i
+	}
+	dcPass(0, 1)
+	acPass(all, 1, 5, 0, 2)
+	acPass(all, 6, 63, 0, 2)
+	acPass(all, 1, 63, 2, 1)
+	dcPass(1, 0)
+	acPass(all, 1, 63, 1, 0)
+	return script
+}
+
+// script returns the progressive scans Encode writes: the decoded script
+// when it still fits the image, the default one otherwise
+func (img *Image) script() ([]Scan, error) {
+	if len(img.Scans) == 0 {
+		return img.defaultScript(), nil
+	}
+	for _, scan := range img.Scans {
+		if err := scan.validate(); err != nil {
+			return nil, err
+		}
+		for _, ci := range scan.Components {
+			if ci < 0 || ci >= len(img.Components) {
+				return nil, fmt.Errorf("scan references component %d of %d", ci, len(img.Components))
+			}
+		}
+	}
+	return img.Scans, nil
+}
+
+// progressiveEncoder codes one progressive Huffman scan (ITU T.81 G.1.2),
+// following libjpeg's jcphuff.c. It runs twice: once gathering symbol
+// statistics for the optimal tables, once writing the data.
+type progressiveEncoder struct {
+	Scan
+	gather bool
+	freq   [2][256]int64
+	enc    [2]*huffmanEncoder
+	bw     *bitWriter
+	pred   [4]int32
+	eobrun int
+	be     []byte // correction bits buffered behind the EOB run
+	table  int    // AC table of the scan
+}
+
+func (e *progressiveEncoder) emitSymbol(t int, sym byte) {
+	if e.gather {
+		e.freq[t][sym]++
+		return
+	}
+	e.bw.writeBits(uint32(e.enc[t].code[sym]), uint(e.enc[t].size[sym]))
+}
+
+func (e *progressiveEncoder) emitBits(v uint32, n uint) {
+	if !e.gather {
+		e.bw.writeBits(v, n)
+	}
+}
+
+func (e *progressiveEncoder) emitCorrections(bits []byte) {
+	for _, bit := range bits {
+		e.emitBits(uint32(bit), 1)
+	}
+}
+
+// emitEOBRun writes the pending EOB run and the corrections behind it
+func (e *progressiveEncoder) emitEOBRun() {
+	if e.eobrun == 0 {
+		return
+	}
+	n := 0
+	for t := e.eobrun >> 1; t > 0; t >>= 1 {
+		n++
+	}
+	e.emitSymbol(e.table, byte(n<<4))
+	e.emitBits(uint32(e.eobrun), uint(n))
+	e.eobrun = 0
+	e.emitCorrections(e.be)
+	e.be = e.be[:0]
+}
+
+func (e *progressiveEncoder) restart(buf *bytes.Buffer, n int) {
+	e.emitEOBRun()
+	if !e.gather {
+		e.bw.flush()
+		buf.Write([]byte{0xFF, byte(0xD0 + n%8)})
+	}
+	e.pred, e.eobrun, e.be = [4]int32{}, 0, e.be[:0]
+}
+
+func (e *progressiveEncoder) finish() {
+	e.emitEOBRun()
+	if !e.gather {
+		e.bw.flush()
+	}
+}
+
+func (e *progressiveEncoder) encodeBlock(ci int, b *Block) error {
+	switch {
+	case e.Ss == 0 && e.Ah == 0:
+		v := b[0] >> e.Al
+		diff := v - e.pred[ci]
+		e.pred[ci] = v
+		s, bits := magnitude(diff)
+		if s > 11 {
+			return fmt.Errorf("DC difference %d out of range", diff)
+		}
+		e.emitSymbol(tableFor(ci), byte(s))
+		e.emitBits(bits, s)
+	case e.Ss == 0:
+		e.emitBits(uint32(b[0]>>e.Al)&1, 1)
+	case e.Ah == 0:
+		return e.encodeACFirst(b)
+	default:
+		e.encodeACRefine(b)
+	}
+	return nil
+}
+
+func (e *progressiveEncoder) encodeACFirst(b *Block) error {
+	r := 0
+	for k := e.Ss; k <= e.Se; k++ {
+		v := b[zigzag[k]]
+		a := v
+		if a < 0 {
+			a = -a
+		}
+		a >>= e.Al
+		if a == 0 {
+			r++
+			continue
+		}
+		if v < 0 {
+			v = -a
+		} else {
+			v = a
+		}
+		e.emitEOBRun()
+		for ; r > 15; r -= 16 {
+			e.emitSymbol(e.table, 0xF0)
+		}
+		s, bits := magnitude(v)
+		if s > 10 {
+			return errors.New("AC coefficient out of range")
+		}
+		e.emitSymbol(e.table, byte(r<<4)|byte(s))
+		e.emitBits(bits, s)
+		r = 0
+	}
+	if r > 0 {
+		e.eobrun++
+		if e.eobrun == 0x7FFF {
+			e.emitEOBRun()
+		}
+	}
+	return nil
+}
+
+func (e *progressiveEncoder) encodeACRefine(b *Block) {
+	var abs [64]int32
+	eob := 0
+	for k := e.Ss; k <= e.Se; k++ {
+		a := b[zigzag[k]]
+		if a < 0 {
+			a = -a
+		}
+		abs[k] = a >> e.Al
+		if abs[k] == 1 {
+			eob = k
+		}
+	}
+
+	r := 0
+	var br []byte // correction bits of this block
+	for k := e.Ss; k <= e.Se; k++ {
+		a := abs[k]
+		if a == 0 {
+			r++
+			continue
+		}
+		// ZRLs cannot fold into the EOB before the last new coefficient
+		for r > 15 && k <= eob {
+			e.emitEOBRun()
+			e.emitSymbol(e.table, 0xF0)
+			r -= 16
+			e.emitCorrections(br)
+			br = br[:0]
+		}
+		if a > 1 {
+			br = append(br, byte(a&1))
+			continue
+		}
+		e.emitEOBRun()
+		e.emitSymbol(e.table, byte(r<<4)|1)
+		sign := uint32(1)
+		if b[zigzag[k]] < 0 {
+			sign = 0
+		}
+		e.emitBits(sign, 1)
+		e.emitCorrections(br)
+		br = br[:0]
+		r = 0
+	}
+	if r > 0 || len(br) > 0 {
+		e.eobrun++
+		e.be = append(e.be, br...)
+		if e.eobrun == 0x7FFF || len(e.be) > maxCorrectionBits-64+1 {
+			e.emitEOBRun()
+		}
+	}
+}
+
+// writeProgressiveScan writes one scan of a progressive Huffman file
+func (img *Image) writeProgressiveScan(buf *bytes.Buffer, scan Scan) error {
+	e := &progressiveEncoder{Scan: scan, gather: true, table: tableFor(scan.Components[0])}
+	run := func() error {
+		lastMCU, restarts := -1, 0
+		err := img.walkScan(scan.Components, func(ci int, b *Block, mcu int) error {
+			if mcu != lastMCU && img.RestartInterval > 0 && mcu > 0 && mcu%img.RestartInterval == 0 {
+				e.restart(buf, restarts)
+				restarts++
+			}
+			lastMCU = mcu
+			return e.encodeBlock(ci, b)
+		})
+		if err != nil {
+			return err
+		}
+		e.finish()
+		return nil
+	}
+
+	// Pass 1: gather symbol statistics (refinement of DC codes raw bits)
+	if scan.Ss > 0 || scan.Ah == 0 {
+		if err := run(); err != nil {
+			return err
+		}
+		class := 0
+		if scan.Ss > 0 {
+			class = 1
+		}
+		var dht []byte
+		for t := 0; t < 2; t++ {
+			if !usesTable(scan.Components, t) {
+				continue
+			}
+			spec, err := optimalSpec(&e.freq[t])
+			if err != nil {
+				return err
+			}
+			dht = append(dht, byte(class<<4|t))
+			dht = append(dht, spec.counts[:]...)
+			dht = append(dht, spec.values...)
+			e.enc[t] = newHuffmanEncoder(spec)
+		}
+		writeSegment(buf, markerDHT, dht)
+	}
+	img.writeSOS(buf, scan)
+
+	// Pass 2: emit entropy-coded data
+	e.gather, e.bw = false, &bitWriter{buf: buf}
+	e.pred, e.eobrun, e.be = [4]int32{}, 0, nil
+	return run()
+}
@@ -0,0 +1,132 @@
+package jpegcoef
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Segment kinds recognised by Kind. Other APPn segments are "appN".
+const (
+	SegmentJFIF    = "jfif"
+	SegmentEXIF    = "exif"
+	SegmentXMP     = "xmp"
+	SegmentICC     = "icc"
+	SegmentAdobe   = "adobe"
+	SegmentComment = "com"
+)
+
+// segmentSignatures identify the well known APPn payloads by their prefix
+var segmentSignatures = []struct {
+	marker byte
+	prefix string
+	kind   string
+}{
+	{markerAPP0, "JFIF\x00", SegmentJFIF},
+	{markerAPP0 + 1, "Exif\x00", SegmentEXIF},
+	{markerAPP0 + 1, "http://ns.adobe.com/xap/1.0/", SegmentXMP},
+	{markerAPP0 + 2, "ICC_PROFILE\x00", SegmentICC},
+	{markerAPP0 + 14, "Adobe", SegmentAdobe},
+}
+
+// Kind names what the segment holds: jfif, exif, xmp, icc, adobe, com or
+// appN for other application segments
+func (s Segment) Kind() string {
+	if s.Marker == markerCOM {
+		return SegmentComment
+	}
+	for _, sig := range segmentSignatures {
+		if s.Marker == sig.marker && bytes.HasPrefix(s.Data, []byte(sig.prefix)) {
+			return sig.kind
+		}
+	}
+	return fmt.Sprintf("app%d", s.Marker-markerAPP0)
+}
+
+// ParseSegmentKinds parses a comma separated list of segment kinds. "all"
+// stands for every APPn and COM segment.
+func ParseSegmentKinds(list string) ([]string, error) {
+	var kinds []string
+	for _, part := range strings.Split(strings.ToLower(list), ",") {
+		kind := strings.TrimSpace(part)
+		if kind == "" {
+			continue
+		}
+		if !validSegmentKind(kind) {
+			return nil, fmt.Errorf("unknown segment kind '%s' (use jfif, exif, xmp, icc, adobe, com, app0-app15 or all)", kind)
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+func validSegmentKind(kind string) bool {
+	switch kind {
+	case "all", SegmentJFIF, SegmentEXIF, SegmentXMP, SegmentICC, SegmentAdobe, SegmentComment:
+		return true
+	}
+	n, ok := strings.CutPrefix(kind, "app")
+	if !ok {
+		return false
+	}
+	i, err := strconv.Atoi(n)
+	return err == nil && strconv.Itoa(i) == n && i >= 0 && i <= 15
+}
+
+// segmentMatches reports whether s is one of kinds
+func segmentMatches(s Segment, kinds []string) bool {
+	kind := s.Kind()
+	for _, k := range kinds {
+		if k == "all" || k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// StripSegments removes the segments of the given kinds and returns how
+// many were removed
+func (img *Image) StripSegments(kinds ...string) int {
+	kept := img.Segments[:0]
+	for _, s := range img.Segments {
+		if !segmentMatches(s, kinds) {
+			kept = append(kept, s)
+		}
+	}
+	removed := len(img.Segments) - len(kept)
+	img.Segments = kept
+	return removed
+}
+
+// ReplaceSegments swaps the segments of the given kinds for those of donor.
+// The donor segments take the place of the first removed one, or follow a
+// leading JFIF segment when img had none of these kinds.
+func (img *Image) ReplaceSegments(donor *Image, kinds ...string) {
+	var incoming []Segment
+	for _, s := range donor.Segments {
+		if segmentMatches(s, kinds) {
+			incoming = append(incoming, Segment{Marker: s.Marker, Data: append([]byte(nil), s.Data...)})
+		}
+	}
+
+	at := -1
+	var kept []Segment
+	for _, s := range img.Segments {
+		if segmentMatches(s, kinds) {
+			if at < 0 {
+				at = len(kept)
+			}
+			continue
+		}
+		kept = append(kept, s)
+	}
+	if at < 0 {
+		at = 0
+		if len(kept) > 0 && kept[0].Kind() == SegmentJFIF {
+			at = 1
+		}
+	}
+	img.Segments = slices.Insert(kept, at, incoming...)
+}
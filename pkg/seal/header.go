@@ -0,0 +1,75 @@
+package seal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Magic prefixes every versioned ciphertext
+var Magic = [4]byte{'C', 'R', 'Y', 'P'}
+
+// Version is the current header format version
+const Version byte = 1
+
+// HeaderSize is the encoded size of a version 1 header:
+// magic(4) version(1) algorithm(1) time(4) memory(4) threads(1) saltlen(1) salt(16)
+const HeaderSize = 4 + 1 + 1 + 4 + 4 + 1 + 1 + SaltSize
+
+// ErrNoHeader reports that the ciphertext does not start with a versioned header
+var ErrNoHeader = errors.New("ciphertext has no versioned header")
+
+// Header describes how the key of a ciphertext was derived. It is written
+// in front of the nonce and authenticated as GCM additional data.
+type Header struct {
+	Version byte
+	Params  Params
+	Salt    []byte
+}
+
+// MarshalBinary encodes the header
+func (h *Header) MarshalBinary() ([]byte, error) {
+	if len(h.Salt) > 255 {
+		return nil, fmt.Errorf("salt too long: %d bytes", len(h.Salt))
+	}
+	buf := make([]byte, 0, HeaderSize)
+	buf = append(buf, Magic[:]...)
+	buf = append(buf, h.Version, byte(h.Params.Algorithm))
+	buf = binary.BigEndian.AppendUint32(buf, h.Params.Time)
+	buf = binary.BigEndian.AppendUint32(buf, h.Params.Memory)
+	buf = append(buf, h.Params.Threads, byte(len(h.Salt)))
+	buf = append(buf, h.Salt...)
+	return buf, nil
+}
+
+// ParseHeader decodes a header from the start of data and returns it with
+// the number of bytes consumed
+func ParseHeader(data []byte) (*Header, int, error) {
+	if len(data) < 4 || !bytes.Equal(data[:4], Magic[:]) {
+		return nil, 0, ErrNoHeader
+	}
+	if len(data) < HeaderSize-SaltSize {
+		return nil, 0, errors.New("truncated header")
+	}
+	h := &Header{Version: data[4]}
+	if h.Version != Version && h.Version != StreamVersion {
+		return nil, 0, fmt.Errorf("unsupported header version %d", h.Version)
+	}
+	h.Params = Params{
+		Algorithm: Algorithm(data[5]),
+		Time:      binary.BigEndian.Uint32(data[6:10]),
+		Memory:    binary.BigEndian.Uint32(data[10:14]),
+		Threads:   data[14],
+	}
+	saltLen := int(data[15])
+	n := 16 + saltLen
+	if len(data) < n {
+		return nil, 0, errors.New("truncated header salt")
+	}
+	h.Salt = append([]byte(nil), data[16:n]...)
+	if err := h.Params.Validate(); err != nil {
+		return nil, 0, err
+	}
+	return h, n, nil
+}
@@ -0,0 +1,147 @@
+package seal
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeySize is the derived key length (AES-256)
+const KeySize = 32
+
+// SaltSize is the length of the random salt stored in every header
+const SaltSize = 16
+
+// Algorithm identifies the password-based key derivation function
+type Algorithm byte
+
+const (
+	AlgorithmArgon2id Algorithm = 1
+	AlgorithmScrypt   Algorithm = 2
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case AlgorithmArgon2id:
+		return "argon2id"
+	case AlgorithmScrypt:
+		return "scrypt"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseAlgorithm maps a KDF name (as stored in vars or given on the CLI) to an Algorithm
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch name {
+	case "", "argon2id", "argon2":
+		return AlgorithmArgon2id, nil
+	case "scrypt":
+		return AlgorithmScrypt, nil
+	default:
+		return 0, fmt.Errorf("unknown KDF '%s' (use argon2id or scrypt)", name)
+	}
+}
+
+// Params holds the cost parameters of a KDF. The meaning of the three
+// fields depends on the algorithm:
+//
+//	argon2id: Time (iterations), Memory (KiB), Threads
+//	scrypt:   Time (log2 N),     Memory (r),   Threads (p)
+type Params struct {
+	Algorithm Algorithm
+	Time      uint32
+	Memory    uint32
+	Threads   uint8
+}
+
+// DefaultParams returns the recommended Argon2id parameters (RFC 9106, second choice)
+func DefaultParams() Params {
+	return Params{Algorithm: AlgorithmArgon2id, Time: 3, Memory: 64 * 1024, Threads: 4}
+}
+
+// ScryptParams returns the recommended scrypt parameters (N=2^15, r=8, p=1)
+func ScryptParams() Params {
+	return Params{Algorithm: AlgorithmScrypt, Time: 15, Memory: 8, Threads: 1}
+}
+
+// ParamsFor returns the default parameters for the given algorithm
+func ParamsFor(alg Algorithm) (Params, error) {
+	switch alg {
+	case AlgorithmArgon2id:
+		return DefaultParams(), nil
+	case AlgorithmScrypt:
+		return ScryptParams(), nil
+	default:
+		return Params{}, fmt.Errorf("unsupported KDF algorithm %d", alg)
+	}
+}
+
+// maxKDFMemory bounds the memory a KDF may use, in bytes
+const maxKDFMemory = 4 << 30
+
+// Scrypt block size and parallelisation bounds
+const (
+	maxScryptR = 64
+	maxScryptP = 16
+)
+
+// Validate rejects parameters that are unusable or absurdly expensive
+// (protects decryption from hostile headers)
+func (p Params) Validate() error {
+	switch p.Algorithm {
+	case AlgorithmArgon2id:
+		if p.Time == 0 || p.Threads == 0 || p.Memory < 8*uint32(p.Threads) {
+			return fmt.Errorf("invalid argon2id parameters t=%d m=%d p=%d", p.Time, p.Memory, p.Threads)
+		}
+		if p.Time > 64 || uint64(p.Memory)*1024 > maxKDFMemory {
+			return fmt.Errorf("argon2id parameters too expensive t=%d m=%d", p.Time, p.Memory)
+		}
+	case AlgorithmScrypt:
+		if p.Time < 1 || p.Time > 24 || p.Memory == 0 || p.Threads == 0 {
+			return fmt.Errorf("invalid scrypt parameters logN=%d r=%d p=%d", p.Time, p.Memory, p.Threads)
+		}
+		// scrypt holds 128·r·N bytes, and p passes over them
+		if p.Memory > maxScryptR || p.Threads > maxScryptP || 128*uint64(p.Memory)<<p.Time > maxKDFMemory {
+			return fmt.Errorf("scrypt parameters too expensive logN=%d r=%d p=%d", p.Time, p.Memory, p.Threads)
+		}
+	default:
+		return fmt.Errorf("unsupported KDF algorithm %d", p.Algorithm)
+	}
+	return nil
+}
+
+// DeriveKey derives a KeySize key from password and salt using params
+func DeriveKey(password []byte, salt []byte, p Params) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	switch p.Algorithm {
+	case AlgorithmScrypt:
+		key, err := scrypt.Key(password, salt, 1<<p.Time, int(p.Memory), int(p.Threads), KeySize)
+		if err != nil {
+			return nil, fmt.Errorf("scrypt key derivation failed: %w", err)
+		}
+		return key, nil
+	default:
+		return argon2.IDKey(password, salt, p.Time, p.Memory, p.Threads, KeySize), nil
+	}
+}
+
+// DeriveLabeledKey derives a key that must be reproducible from the password
+// alone (no stored salt). The salt is fixed per label, so keys for different
+// purposes are independent.
+func DeriveLabeledKey(password []byte, label string, p Params) ([]byte, error) {
+	salt := sha256.Sum256([]byte(label))
+	return DeriveKey(password, salt[:SaltSize], p)
+}
+
+// legacyKey reproduces the original zero-padded key used before the
+// versioned header existed (only for decrypting old payloads)
+func legacyKey(password []byte) []byte {
+	derived := make([]byte, KeySize)
+	copy(derived, password)
+	return derived
+}
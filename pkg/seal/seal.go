@@ -0,0 +1,138 @@
+// Package seal implements password-based authenticated encryption
+// (AES-256-GCM with an Argon2id or scrypt derived key).
+//
+// Sealed payloads have the layout
+//
+//	[header][nonce:12][ciphertext+tag]
+//
+// where the header records the KDF, its parameters and the salt. Payloads
+// written before the header existed ([nonce][ciphertext+tag] with a
+// zero-padded password as key) are still accepted by Open. Large inputs
+// are sealed as a stream of segments instead, see Writer and Reader.
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NonceSize is the GCM nonce length
+const NonceSize = 12
+
+// Seal encrypts plaintext with a key derived from password using params
+func Seal(plaintext []byte, password string, params Params) ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	header := &Header{Version: Version, Params: params, Salt: salt}
+	headerBytes, err := header.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := DeriveKey([]byte(password), salt, params)
+	if err != nil {
+		return nil, err
+	}
+
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, NonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := make([]byte, 0, len(headerBytes)+NonceSize+len(plaintext)+aesGCM.Overhead())
+	out = append(out, headerBytes...)
+	out = append(out, nonce...)
+	return aesGCM.Seal(out, nonce, plaintext, headerBytes), nil
+}
+
+// Open decrypts a payload produced by Seal or Writer, or a legacy payload
+// without header
+func Open(sealed []byte, password string) ([]byte, error) {
+	header, n, err := ParseHeader(sealed)
+	switch {
+	case err == nil && header.Version == StreamVersion:
+		return openStream(sealed, password)
+	case err == nil:
+		plaintext, openErr := openVersioned(sealed, n, header, password)
+		if openErr == nil {
+			return plaintext, nil
+		}
+		// A legacy nonce can start with the magic by chance
+		if legacy, legacyErr := openLegacy(sealed, password); legacyErr == nil {
+			return legacy, nil
+		}
+		return nil, openErr
+	case errors.Is(err, ErrNoHeader):
+		return openLegacy(sealed, password)
+	default:
+		if legacy, legacyErr := openLegacy(sealed, password); legacyErr == nil {
+			return legacy, nil
+		}
+		return nil, fmt.Errorf("invalid ciphertext header: %w", err)
+	}
+}
+
+// IsVersioned reports whether sealed starts with a versioned header
+func IsVersioned(sealed []byte) bool {
+	_, _, err := ParseHeader(sealed)
+	return err == nil
+}
+
+func openVersioned(sealed []byte, headerLen int, header *Header, password string) ([]byte, error) {
+	if len(sealed) < headerLen+NonceSize {
+		return nil, errors.New("invalid ciphertext: too short")
+	}
+	key, err := DeriveKey([]byte(password), header.Salt, header.Params)
+	if err != nil {
+		return nil, err
+	}
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := sealed[headerLen : headerLen+NonceSize]
+	plaintext, err := aesGCM.Open(nil, nonce, sealed[headerLen+NonceSize:], sealed[:headerLen])
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed: %w", err)
+	}
+	return plaintext, nil
+}
+
+func openLegacy(sealed []byte, password string) ([]byte, error) {
+	if len(sealed) < NonceSize {
+		return nil, errors.New("invalid ciphertext: too short")
+	}
+	aesGCM, err := newGCM(legacyKey([]byte(password)))
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aesGCM.Open(nil, sealed[:NonceSize], sealed[NonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	aesGCM, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aesGCM, nil
+}
@@ -0,0 +1,157 @@
+package seal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+)
+
+// fastParams keeps the tests quick while exercising both KDFs
+var fastParams = []Params{
+	{Algorithm: AlgorithmArgon2id, Time: 1, Memory: 64, Threads: 1},
+	{Algorithm: AlgorithmScrypt, Time: 4, Memory: 8, Threads: 1},
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	plaintext := []byte("Hello, World! this is a secret")
+	password := "mysecurepassword123"
+
+	for _, params := range fastParams {
+		t.Run(params.Algorithm.String(), func(t *testing.T) {
+			sealed, err := Seal(plaintext, password, params)
+			if err != nil {
+				t.Fatalf("Seal failed: %v", err)
+			}
+
+			if !IsVersioned(sealed) {
+				t.Fatal("sealed payload should carry a versioned header")
+			}
+
+			header, n, err := ParseHeader(sealed)
+			if err != nil {
+				t.Fatalf("ParseHeader failed: %v", err)
+			}
+			if n != HeaderSize {
+				t.Errorf("expected header size %d, got %d", HeaderSize, n)
+			}
+			if header.Params != params {
+				t.Errorf("expected params %+v, got %+v", params, header.Params)
+			}
+
+			opened, err := Open(sealed, password)
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			if !bytes.Equal(opened, plaintext) {
+				t.Errorf("expected %q, got %q", plaintext, opened)
+			}
+
+			if _, err := Open(sealed, "wrongpassword12345"); err == nil {
+				t.Error("Open should fail with the wrong password")
+			}
+		})
+	}
+}
+
+func TestSealUsesRandomSalt(t *testing.T) {
+	a, err := Seal([]byte("same"), "mysecurepassword123", fastParams[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Seal([]byte("same"), "mysecurepassword123", fastParams[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a[:HeaderSize], b[:HeaderSize]) {
+		t.Error("two seals of the same input should use different salts")
+	}
+}
+
+func TestHeaderIsAuthenticated(t *testing.T) {
+	sealed, err := Seal([]byte("payload"), "mysecurepassword123", fastParams[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bump the iteration count: the header still parses but the tag must fail
+	sealed[9]++
+	if _, err := Open(sealed, "mysecurepassword123"); err == nil {
+		t.Error("Open should reject a modified header")
+	}
+}
+
+func TestOpenLegacyCiphertext(t *testing.T) {
+	password := "mysecurepassword123"
+	plaintext := []byte("legacy payload")
+
+	// Reproduce the original zero-padded key format
+	key := make([]byte, 32)
+	copy(key, password)
+	block, _ := aes.NewCipher(key)
+	aesGCM, _ := cipher.NewGCM(block)
+	nonce := make([]byte, NonceSize)
+	rand.Read(nonce)
+	legacy := append(nonce, aesGCM.Seal(nil, nonce, plaintext, nil)...)
+
+	if IsVersioned(legacy) {
+		t.Fatal("legacy ciphertext should not look versioned")
+	}
+
+	opened, err := Open(legacy, password)
+	if err != nil {
+		t.Fatalf("Open failed on legacy ciphertext: %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("expected %q, got %q", plaintext, opened)
+	}
+}
+
+func TestParseHeaderRejectsHostileParams(t *testing.T) {
+	for _, params := range []Params{
+		{Algorithm: AlgorithmArgon2id, Time: 1, Memory: 1 << 30, Threads: 1},
+		{Algorithm: AlgorithmScrypt, Time: 24, Memory: 8, Threads: 1},   // 16 GiB
+		{Algorithm: AlgorithmScrypt, Time: 15, Memory: 255, Threads: 1}, // r out of bounds
+		{Algorithm: AlgorithmScrypt, Time: 15, Memory: 8, Threads: 255},
+	} {
+		h := &Header{Version: Version, Params: params, Salt: make([]byte, SaltSize)}
+		data, err := h.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := ParseHeader(data); err == nil {
+			t.Errorf("ParseHeader should reject excessive cost %+v", params)
+		}
+	}
+	// The ceiling still admits the defaults and 4 GiB of scrypt
+	for _, params := range []Params{DefaultParams(), ScryptParams(), {Algorithm: AlgorithmScrypt, Time: 22, Memory: 8, Threads: 1}} {
+		if err := params.Validate(); err != nil {
+			t.Errorf("%+v: %v", params, err)
+		}
+	}
+}
+
+func TestDeriveLabeledKeyIsDeterministicPerLabel(t *testing.T) {
+	params := fastParams[0]
+	password := []byte("mysecurepassword123")
+
+	a, err := DeriveLabeledKey(password, "purpose-a", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := DeriveLabeledKey(password, "purpose-a", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := DeriveLabeledKey(password, "purpose-b", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(a, again) {
+		t.Error("same password and label must give the same key")
+	}
+	if bytes.Equal(a, b) {
+		t.Error("different labels must give different keys")
+	}
+}
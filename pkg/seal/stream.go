@@ -0,0 +1,334 @@
+package seal
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Streamed payloads are sealed in segments (the STREAM construction of
+// Hoang, Reyhanitabar, Rogaway and Vizár), with the layout
+//
+//	[header][segment size:4][nonce prefix:7][segment]...
+//
+// The header is a versioned header with StreamVersion. Every segment is
+// sealed on its own under the nonce
+//
+//	[nonce prefix:7][counter:4][last:1]
+//
+// with the header, segment size and prefix as additional data. Segments
+// hold segment size bytes of plaintext, the last one at most that and
+// possibly none; its last flag is 1. Reordered, dropped or appended
+// segments, and a stream cut at a segment boundary, fail to open.
+
+// StreamVersion is the header version of segmented payloads
+const StreamVersion byte = 2
+
+const (
+	// DefaultSegmentSize is the plaintext carried by each segment
+	DefaultSegmentSize = 64 << 10
+
+	// MaxSegmentSize bounds the segment size a reader accepts
+	MaxSegmentSize = 16 << 20
+
+	streamPrefixSize = NonceSize - 5
+)
+
+// Writer seals what is written to it as a stream of segments. Close seals
+// the last segment and must be called.
+type Writer struct {
+	w           io.Writer
+	aead        cipher.AEAD
+	ad          []byte // header, segment size and nonce prefix
+	prefix      []byte
+	segmentSize int
+	counter     uint32
+	buf         []byte // plaintext of the segment being filled
+	out         []byte
+	closed      bool
+	err         error
+}
+
+// NewWriter writes the header of a stream to w and returns a Writer
+// sealing DefaultSegmentSize segments with a key derived from password
+func NewWriter(w io.Writer, password string, params Params) (*Writer, error) {
+	return NewWriterSize(w, password, params, DefaultSegmentSize)
+}
+
+// NewWriterSize is NewWriter with segments of segmentSize bytes
+func NewWriterSize(w io.Writer, password string, params Params, segmentSize int) (*Writer, error) {
+	if segmentSize < 1 || segmentSize > MaxSegmentSize {
+		return nil, fmt.Errorf("invalid segment size %d (1 to %d bytes)", segmentSize, MaxSegmentSize)
+	}
+	salt := make([]byte, SaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	prefix := make([]byte, streamPrefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce prefix: %w", err)
+	}
+
+	header := &Header{Version: StreamVersion, Params: params, Salt: salt}
+	ad, err := header.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	ad = binary.BigEndian.AppendUint32(ad, uint32(segmentSize))
+	ad = append(ad, prefix...)
+
+	key, err := DeriveKey([]byte(password), salt, params)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(ad); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		w:           w,
+		aead:        aead,
+		ad:          ad,
+		prefix:      prefix,
+		segmentSize: segmentSize,
+		buf:         make([]byte, 0, segmentSize),
+	}, nil
+}
+
+// Write buffers p and seals every segment it completes
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.closed {
+		return 0, errors.New("seal: write to a closed stream")
+	}
+	n := 0
+	for len(p) > 0 {
+		if len(w.buf) == w.segmentSize {
+			// More data follows, so the full segment is not the last one
+			if err := w.flush(false); err != nil {
+				return n, err
+			}
+		}
+		k := min(w.segmentSize-len(w.buf), len(p))
+		w.buf = append(w.buf, p[:k]...)
+		p = p[k:]
+		n += k
+	}
+	return n, nil
+}
+
+// Close seals the buffered plaintext as the last segment
+func (w *Writer) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	return w.flush(true)
+}
+
+func (w *Writer) flush(last bool) error {
+	if !last && w.counter == math.MaxUint32 {
+		w.err = errors.New("seal: stream exceeds the segment counter")
+		return w.err
+	}
+	w.out = w.aead.Seal(w.out[:0], streamNonce(w.prefix, w.counter, last), w.buf, w.ad)
+	if _, err := w.w.Write(w.out); err != nil {
+		w.err = err
+		return err
+	}
+	w.buf = w.buf[:0]
+	w.counter++
+	return nil
+}
+
+// Reader opens a stream written by Writer. Each segment is verified before
+// its plaintext is returned, so a damaged segment stops the stream with an
+// error after the segments before it.
+type Reader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	ad      []byte
+	prefix  []byte
+	counter uint32
+	enc     []byte // one sealed segment and a byte of look-ahead
+	pending int    // look-ahead bytes already in enc
+	out     []byte // plaintext of the last segment opened
+	plain   []byte // the part of out not yet returned
+	done    bool
+	err     error
+}
+
+// NewReader reads the header of a stream from r and returns a Reader
+// opening its segments with a key derived from password
+func NewReader(r io.Reader, password string) (*Reader, error) {
+	header, ad, err := readStreamHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	segmentSize := int(binary.BigEndian.Uint32(ad[len(ad)-streamPrefixSize-4:]))
+	if segmentSize < 1 || segmentSize > MaxSegmentSize {
+		return nil, fmt.Errorf("invalid segment size %d in stream header", segmentSize)
+	}
+
+	key, err := DeriveKey([]byte(password), header.Salt, header.Params)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		r:      r,
+		aead:   aead,
+		ad:     ad,
+		prefix: ad[len(ad)-streamPrefixSize:],
+		enc:    make([]byte, segmentSize+aead.Overhead()+1),
+	}, nil
+}
+
+// Read returns the plaintext of the verified segments
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next reads and opens one segment. A segment is the last one when the
+// stream ends before the byte following it.
+func (r *Reader) next() error {
+	full := len(r.enc) - 1
+	n, err := io.ReadFull(r.r, r.enc[r.pending:])
+	n += r.pending
+	last := false
+	switch {
+	case err == nil:
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	default:
+		return err
+	}
+	if last && n < r.aead.Overhead() {
+		return fmt.Errorf("seal: stream truncated after %d segments", r.counter)
+	}
+
+	segment := r.enc[:n]
+	if !last {
+		segment = r.enc[:full]
+	}
+	r.out, err = r.aead.Open(r.out[:0], streamNonce(r.prefix, r.counter, last), segment, r.ad)
+	if err != nil {
+		return fmt.Errorf("seal: segment %d failed authentication (wrong password, damaged or truncated stream)", r.counter)
+	}
+	r.plain = r.out
+	if last {
+		r.done = true
+	} else {
+		r.enc[0] = r.enc[full]
+		r.pending = 1
+		r.counter++
+	}
+	return nil
+}
+
+// streamNonce is the nonce of segment counter
+func streamNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, NonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamPrefixSize:], counter)
+	if last {
+		nonce[NonceSize-1] = 1
+	}
+	return nonce
+}
+
+// readStreamHeader reads the header, segment size and nonce prefix of a
+// stream and returns the header with the bytes read
+func readStreamHeader(r io.Reader) (*Header, []byte, error) {
+	fixed := make([]byte, HeaderSize-SaltSize)
+	n, err := io.ReadFull(r, fixed)
+	if !bytes.HasPrefix(fixed[:n], Magic[:min(n, len(Magic))]) || errors.Is(err, io.EOF) {
+		return nil, nil, ErrNoHeader
+	}
+	if err != nil {
+		return nil, nil, errors.New("truncated stream header")
+	}
+	if !bytes.Equal(fixed[:4], Magic[:]) {
+		return nil, nil, ErrNoHeader
+	}
+	if fixed[4] != StreamVersion {
+		return nil, nil, fmt.Errorf("header version %d is not a stream", fixed[4])
+	}
+	rest := make([]byte, int(fixed[len(fixed)-1])+4+streamPrefixSize)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, nil, errors.New("truncated stream header")
+	}
+	ad := append(fixed, rest...)
+	header, _, err := ParseHeader(ad)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, ad, nil
+}
+
+// OpenReader opens a payload read from r, whichever format it has: a
+// stream is opened segment by segment as it is read, a payload sealed by
+// Seal (or a legacy one) is read whole and opened by Open
+func OpenReader(r io.Reader, password string) (io.Reader, error) {
+	head := make([]byte, 5)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	r = io.MultiReader(bytes.NewReader(head[:n]), r)
+	if n == len(head) && bytes.Equal(head[:4], Magic[:]) && head[4] == StreamVersion {
+		return NewReader(r, password)
+	}
+
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := Open(sealed, password)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(plaintext), nil
+}
+
+// IsStream reports whether sealed starts with a stream header
+func IsStream(sealed []byte) bool {
+	header, _, err := ParseHeader(sealed)
+	return err == nil && header.Version == StreamVersion
+}
+
+// openStream opens a whole stream held in memory
+func openStream(sealed []byte, password string) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(sealed), password)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
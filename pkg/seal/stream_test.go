@@ -0,0 +1,146 @@
+package seal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+// sealStream seals plaintext as a stream of segmentSize segments
+func sealStream(t *testing.T, plaintext []byte, password string, segmentSize int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriterSize(&buf, password, fastParams[0], segmentSize)
+	if err != nil {
+		t.Fatalf("NewWriterSize failed: %v", err)
+	}
+	// Odd write sizes, so writes straddle segment boundaries
+	for rest := plaintext; len(rest) > 0; {
+		n := min(len(rest), 37)
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	password := "stream-password-123"
+	plaintext := make([]byte, 1000)
+	rand.Read(plaintext)
+
+	// Empty, shorter than, exactly and several segments
+	for _, size := range []int{0, 99, 100, 1000} {
+		sealed := sealStream(t, plaintext[:size], password, 100)
+		if !IsStream(sealed) || !IsVersioned(sealed) {
+			t.Fatalf("%d bytes: stream not recognised", size)
+		}
+
+		r, err := NewReader(bytes.NewReader(sealed), password)
+		if err != nil {
+			t.Fatalf("NewReader failed: %v", err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%d bytes: read failed: %v", size, err)
+		}
+		if !bytes.Equal(got, plaintext[:size]) {
+			t.Errorf("%d bytes: plaintext differs", size)
+		}
+
+		// Open and OpenReader take streams too
+		if opened, err := Open(sealed, password); err != nil || !bytes.Equal(opened, plaintext[:size]) {
+			t.Errorf("%d bytes: Open failed: %v", size, err)
+		}
+		or, err := OpenReader(bytes.NewReader(sealed), password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := io.ReadAll(or); err != nil || !bytes.Equal(got, plaintext[:size]) {
+			t.Errorf("%d bytes: OpenReader failed: %v", size, err)
+		}
+	}
+}
+
+func TestStreamRejectsTampering(t *testing.T) {
+	password := "stream-password-123"
+	plaintext := bytes.Repeat([]byte("0123456789"), 50)
+	sealed := sealStream(t, plaintext, password, 100)
+	headerLen := HeaderSize + 4 + streamPrefixSize
+	segment := 100 + 16
+
+	flipped := bytes.Clone(sealed)
+	flipped[headerLen+segment+3] ^= 1
+	swapped := bytes.Clone(sealed)
+	copy(swapped[headerLen:], sealed[headerLen+segment:headerLen+2*segment])
+	copy(swapped[headerLen+segment:], sealed[headerLen:headerLen+segment])
+
+	for name, damaged := range map[string][]byte{
+		"flipped bit":          flipped,
+		"swapped segments":     swapped,
+		"cut at a boundary":    sealed[:headerLen+2*segment],
+		"cut inside segment":   sealed[:len(sealed)-5],
+		"appended data":        append(bytes.Clone(sealed), 0),
+		"dropped last segment": sealed[:len(sealed)-segment],
+	} {
+		r, err := NewReader(bytes.NewReader(damaged), password)
+		if err != nil {
+			t.Fatalf("%s: NewReader failed: %v", name, err)
+		}
+		if _, err := io.ReadAll(r); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	r, err := NewReader(bytes.NewReader(sealed), "wrong-password-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); err == nil {
+		t.Error("expected the wrong password to fail")
+	}
+}
+
+func TestStreamReleasesVerifiedSegments(t *testing.T) {
+	password := "stream-password-123"
+	plaintext := bytes.Repeat([]byte("a"), 350)
+	sealed := sealStream(t, plaintext, password, 100)
+	// Damage the third segment: the first two still come out
+	headerLen := HeaderSize + 4 + streamPrefixSize
+	sealed[headerLen+2*(100+16)] ^= 1
+
+	r, err := NewReader(bytes.NewReader(sealed), password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err == nil {
+		t.Fatal("expected the damaged segment to fail")
+	}
+	if !bytes.Equal(got, plaintext[:200]) {
+		t.Errorf("expected the 200 bytes of the verified segments, got %d", len(got))
+	}
+}
+
+func TestOpenReaderTakesSealedPayloads(t *testing.T) {
+	password := "mysecurepassword123"
+	sealed, err := Seal([]byte("single shot"), password, fastParams[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenReader(bytes.NewReader(sealed), password)
+	if err != nil {
+		t.Fatalf("OpenReader failed: %v", err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "single shot" {
+		t.Errorf("expected %q, got %q", "single shot", got)
+	}
+	if IsStream(sealed) {
+		t.Error("a Seal payload is not a stream")
+	}
+}